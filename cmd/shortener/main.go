@@ -5,6 +5,7 @@ import (
 	"shortener/internal/config"
 	"shortener/internal/handlers"
 	"shortener/internal/logger"
+	"shortener/internal/repository"
 	"shortener/internal/user"
 
 	"net/http"
@@ -38,30 +39,57 @@ func main() {
 		sugarLogger.Fatalf("Failed to initialize config: %v", err)
 	}
 
-	s := app.SelectStorage(c)
+	s := app.SelectStorage(c, sugarLogger)
+	gen, err := repository.NewShortIDGenerator(repository.ShortIDOptions{
+		Strategy: c.ShortIDStrategy,
+		Alphabet: c.ShortIDAlphabet,
+		Length:   c.ShortIDLength,
+		Salt:     c.ShortIDSalt,
+	}, s.NextSequence)
+	if err != nil {
+		sugarLogger.Fatalf("Failed to create short ID generator: %v", err)
+	}
+	repository.SetShortIDGenerator(gen)
 
 	info(sugarLogger)
 
 	userService := user.NewUserService()
 	ctrl := handlers.NewController(c, s, sugarLogger, userService)
+	ctrl.StartWebhookDelivery()
+	ctrl.StartAuditRetention()
 	r := chi.NewRouter()
 
 	app.InitMiddleware(r, c, ctrl)
-	app.Routing(r, ctrl)
+	app.Routing(r, c, ctrl)
+	if err := ctrl.CheckReservedShortIDs(); err != nil {
+		sugarLogger.Fatalf("Failed to check short IDs: %v", err)
+	}
+
+	servers := []*http.Server{app.CreateServer(c, r, sugarLogger)}
+
+	if c.RedirectAddr != "" {
+		rr := chi.NewRouter()
+		app.InitMiddleware(rr, c, ctrl)
+		app.RedirectRouting(rr, ctrl)
+		servers = append(servers, app.CreateRedirectServer(c, rr, sugarLogger))
+	}
 
-	server := app.CreateServer(c, r, sugarLogger)
+	for _, server := range servers {
+		go serve(server, c, sugarLogger)
+	}
 
-	go func() {
-		if c.EnableHTTPS {
-			err = server.ListenAndServeTLS("https/localhost.crt", "https/localhost.key")
-		} else {
-			err = server.ListenAndServe()
-		}
+	ctrl.HandleGracefulShutdown(servers...)
+}
 
-		if err != nil && err != http.ErrServerClosed {
-			sugarLogger.Fatalf("Failed to start server: %v", err)
-		}
-	}()
+func serve(server *http.Server, c *config.Config, l *zap.SugaredLogger) {
+	var err error
+	if c.EnableHTTPS {
+		err = server.ListenAndServeTLS("https/localhost.crt", "https/localhost.key")
+	} else {
+		err = server.ListenAndServe()
+	}
 
-	ctrl.HandleGracefulShutdown(server)
+	if err != nil && err != http.ErrServerClosed {
+		l.Fatalf("Failed to start server: %v", err)
+	}
 }
@@ -1,42 +1,199 @@
 package app
 
 import (
+	"net"
+	"net/http"
+	"strings"
 	"time"
 
 	"shortener/internal/config"
 	"shortener/internal/handlers"
+	"shortener/internal/routes"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 )
 
 // InitMiddleware - initializes middleware handlers for the router.
+// The user authentication is added by Routing to the API routes only, so no cookies are set on redirects.
 func InitMiddleware(r *chi.Mux, conf *config.Config, ctrl *handlers.Controller) {
 	r.Use(ctrl.PanicRecoveryMiddleware)
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.Timeout(time.Duration(conf.Timeout) * time.Second))
-	r.Use(ctrl.Authenticate)
 	r.Use(ctrl.LoggingMiddleware)
 	r.Use(ctrl.GzipEncodeMiddleware)
 	r.Use(ctrl.GzipDecodeMiddleware)
-	r.Mount("/debug", middleware.Profiler())
 }
 
-// Routing - registers routes for the URL controller.
+// Routing - registers the redirect routes (RedirectRouting) and the API routes (apiRouting).
+//
+// If the shortened links have a host of their own (conf.ShortHost), requests are routed by the Host header:
+// requests to the host of conf.BaseURL are served by the API routes only and requests to all other hosts
+// (the short host and the branded domains) by the redirect routes only, so API paths never collide
+// with short IDs. Otherwise both are served on every host.
+//
+// The first path segments of the API routes are reserved (see reserveRoutes) in either case,
+// so the links stay reachable if the hosts are merged later.
+func Routing(r *chi.Mux, conf *config.Config, ctrl *handlers.Controller) {
+	shortHost, _ := conf.ShortHost() // validated by config.Init
+	if shortHost == "" {
+		RedirectRouting(r, ctrl)
+		r.Group(func(r chi.Router) {
+			r.Use(ctrl.Authenticate)
+			apiRouting(r, ctrl)
+		})
+		reserveRoutes(r)
+		return
+	}
+
+	redirects := chi.NewRouter()
+	RedirectRouting(redirects, ctrl)
+	api := chi.NewRouter()
+	api.Use(ctrl.Authenticate)
+	apiRouting(api, ctrl)
+	reserveRoutes(api)
+	r.Mount("/", hostRouter(conf.APIHost(), api, redirects))
+}
+
+// reserveRoutes registers the first path segments of the routes in the registry of reserved
+// path segments, which short IDs must not take. Segments of route patterns ("/{id}") are skipped.
+func reserveRoutes(r chi.Routes) {
+	_ = chi.Walk(r, func(_ string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		segment, _, _ := strings.Cut(strings.TrimPrefix(route, "/"), "/")
+		routes.Reserve(segment)
+		return nil
+	})
+}
+
+// hostRouter returns the handler passing the requests to host to matched and all other requests to other.
+// The port of the request host is ignored if host has no port.
+func hostRouter(host string, matched, other http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		reqHost := strings.ToLower(req.Host)
+		if reqHost != host && !strings.Contains(host, ":") {
+			if h, _, err := net.SplitHostPort(reqHost); err == nil {
+				reqHost = h
+			}
+		}
+		if reqHost == host {
+			matched.ServeHTTP(res, req)
+			return
+		}
+		other.ServeHTTP(res, req)
+	})
+}
+
+// RedirectRouting - registers the routes of the shortened links.
 // Registered routes:
-//   - POST "/": creates a shortened version of a URL using ctrl.ShortenURL().
 //   - GET "/{id}": returns the original URL from the shortened version using ctrl.GetOriginalURL().
+//   - HEAD "/{id}": same as GET "/{id}", answered without a body.
+//   - GET "/{id}+", "/{id}?preview=1": shows the preview page of the link instead of redirecting.
+//   - GET, HEAD "/{id}/*": same as "/{id}" with trailing path segments passed to the original URL.
+//   - GET, HEAD "/{id}/qr": returns the QR code of the short link through ctrl.GetLinkQR()
+//     ("qr" is therefore not passed to the original URL as a trailing path segment).
+//   - POST "/{id}", "/{id}/*": checks the password of a protected link through ctrl.UnlockOriginalURL().
+func RedirectRouting(r chi.Router, ctrl *handlers.Controller) {
+	r.Get("/{id}", ctrl.GetOriginalURL())
+	r.Head("/{id}", ctrl.GetOriginalURL())
+	r.Get("/{id}/*", ctrl.GetOriginalURL())
+	r.Head("/{id}/*", ctrl.GetOriginalURL())
+	r.Get("/{id}/qr", ctrl.GetLinkQR())
+	r.Head("/{id}/qr", ctrl.GetLinkQR())
+	r.Post("/{id}", ctrl.UnlockOriginalURL())
+	r.Post("/{id}/*", ctrl.UnlockOriginalURL())
+}
+
+// apiRouting - registers the API routes of the URL controller.
+// Registered routes:
+//   - POST "/": creates a shortened version of a URL using ctrl.ShortenURL().
+//   - "/debug/*": the profiler (net/http/pprof).
 //   - POST "/api/shorten": API method for shortening a URL through ctrl.APIShortenURL().
 //   - POST "/api/shorten/batch": API method for batch URL shortening through ctrl.APIShortenBatchURL().
 //   - GET "/ping": service availability check through ctrl.PingHandler().
-//   - GET "/api/user/urls": retrieves the user's URL list through ctrl.APIGetUserURLs().
+//   - GET "/api/user/urls": retrieves a page of the user's URL list, sorted, searched and filtered by the query parameters, through ctrl.APIGetUserURLs().
 //   - DELETE "/api/user/urls": deletes the user's URL list using ctrl.DeleteUserURLs().
-func Routing(r *chi.Mux, ctrl *handlers.Controller) {
+//   - GET "/api/user/urls/export": streams all of the user's links as CSV or JSON through ctrl.APIExportUserURLs().
+//   - POST "/api/user/urls/import": imports links in the export formats through ctrl.APIImportUserURLs().
+//   - GET "/api/user/urls/{id}": retrieves the settings and clicks of a user's link through ctrl.APIGetUserURL().
+//   - PATCH "/api/user/urls/{id}": changes the destinations, targeting rules, title, notes and tags of a user's link
+//     through ctrl.APIEditUserURL().
+//   - GET "/api/user/urls/{id}/qr": returns the QR code of a user's link through ctrl.APIGetUserURLQR().
+//   - GET "/api/user/templates": retrieves the user's UTM templates through ctrl.APIGetUserTemplates().
+//   - POST "/api/user/templates": creates or updates a UTM template through ctrl.APISaveUserTemplate().
+//   - DELETE "/api/user/templates/{name}": deletes a UTM template through ctrl.APIDeleteUserTemplate().
+//   - GET "/api/user/webhooks": retrieves the user's webhooks through ctrl.APIGetWebhooks().
+//   - POST "/api/user/webhooks": registers a webhook for link lifecycle events through ctrl.APICreateWebhook().
+//   - DELETE "/api/user/webhooks/{id}": deletes a webhook through ctrl.APIDeleteWebhook().
+//   - GET "/api/user/webhooks/{id}/deliveries": lists the latest deliveries of a webhook through ctrl.APIGetWebhookDeliveries().
+//   - GET "/api/user/domains": retrieves the branded domains the user can create links on through ctrl.APIGetUserDomains().
+//   - POST "/api/workspaces": creates a workspace owned by the user through ctrl.APICreateWorkspace().
+//   - GET "/api/workspaces": retrieves the user's workspaces and roles through ctrl.APIGetWorkspaces().
+//   - GET "/api/workspaces/{id}/members": retrieves the members of a workspace through ctrl.APIGetWorkspaceMembers().
+//   - PUT "/api/workspaces/{id}/members/{userID}": adds a member or changes a role through ctrl.APISetWorkspaceMember().
+//   - DELETE "/api/workspaces/{id}/members/{userID}": removes a member through ctrl.APIRemoveWorkspaceMember().
+//   - GET "/api/workspaces/{id}/urls": retrieves the links of a workspace through ctrl.APIGetWorkspaceURLs().
+//   - POST "/api/workspaces/{id}/urls": hands the user's links over to a workspace through ctrl.APIMoveLinksToWorkspace().
+//   - DELETE "/api/workspaces/{id}/urls": deletes links of a workspace through ctrl.APIDeleteWorkspaceURLs().
+//   - GET "/api/workspaces/{id}/stats": retrieves the link statistics of a workspace through ctrl.APIGetWorkspaceStats().
+//   - GET "/api/admin/blocklist": retrieves the blocklist entries through ctrl.APIGetBlocklist().
+//   - POST "/api/admin/blocklist": blocks a domain or URL pattern and disables matching links through ctrl.APIAddBlocklistEntry().
+//   - GET "/api/admin/links?url=": finds the links of all users shortening a URL through ctrl.APIAdminFindLinks().
+//   - GET "/api/admin/links/{id}": retrieves the owner, settings and audit history of any link through ctrl.APIAdminGetLink().
+//   - POST "/api/admin/links/{id}/disable": disables a link for a reason through ctrl.APIAdminDisableLink().
+//   - POST "/api/admin/links/{id}/enable": enables a disabled link through ctrl.APIAdminEnableLink().
+//   - POST "/api/admin/links/{id}/transfer": makes another user the creator of a link through ctrl.APIAdminTransferLink().
+//   - GET "/api/admin/domains": retrieves the branded domains with their assignments through ctrl.APIAdminGetDomains().
+//   - PUT "/api/admin/domains/{name}": registers a branded domain or replaces its assignments through ctrl.APIAdminSaveDomain().
+//   - DELETE "/api/admin/domains/{name}": removes a branded domain through ctrl.APIAdminDeleteDomain().
+//   - DELETE "/api/admin/users/{userID}": purges the links and settings of a user through ctrl.APIAdminPurgeUser().
+//   - GET "/api/admin/audit": queries the audit log by link, user, actor and time range through ctrl.APIGetAudit().
+//
+// Routes under "/api/admin" require the admin token (ctrl.AdminAuth).
+func apiRouting(r chi.Router, ctrl *handlers.Controller) {
 	r.Post("/", ctrl.ShortenURL())
-	r.Get("/{id}", ctrl.GetOriginalURL())
+	r.Mount("/debug", middleware.Profiler())
 	r.Post("/api/shorten", ctrl.APIShortenURL())
 	r.Post("/api/shorten/batch", ctrl.APIShortenBatchURL())
 	r.Get("/ping", ctrl.PingHandler())
 	r.Get("/api/user/urls", ctrl.APIGetUserURLs())
 	r.Delete("/api/user/urls", ctrl.DeleteUserURLs())
+	r.Get("/api/user/urls/export", ctrl.APIExportUserURLs())
+	r.Post("/api/user/urls/import", ctrl.APIImportUserURLs())
+	r.Get("/api/user/urls/{id}", ctrl.APIGetUserURL())
+	r.Patch("/api/user/urls/{id}", ctrl.APIEditUserURL())
+	r.Get("/api/user/urls/{id}/qr", ctrl.APIGetUserURLQR())
+	r.Get("/api/user/templates", ctrl.APIGetUserTemplates())
+	r.Post("/api/user/templates", ctrl.APISaveUserTemplate())
+	r.Delete("/api/user/templates/{name}", ctrl.APIDeleteUserTemplate())
+	r.Get("/api/user/webhooks", ctrl.APIGetWebhooks())
+	r.Post("/api/user/webhooks", ctrl.APICreateWebhook())
+	r.Delete("/api/user/webhooks/{id}", ctrl.APIDeleteWebhook())
+	r.Get("/api/user/webhooks/{id}/deliveries", ctrl.APIGetWebhookDeliveries())
+	r.Get("/api/user/domains", ctrl.APIGetUserDomains())
+	r.Route("/api/workspaces", func(r chi.Router) {
+		r.Post("/", ctrl.APICreateWorkspace())
+		r.Get("/", ctrl.APIGetWorkspaces())
+		r.Get("/{id}/members", ctrl.APIGetWorkspaceMembers())
+		r.Put("/{id}/members/{userID}", ctrl.APISetWorkspaceMember())
+		r.Delete("/{id}/members/{userID}", ctrl.APIRemoveWorkspaceMember())
+		r.Get("/{id}/urls", ctrl.APIGetWorkspaceURLs())
+		r.Post("/{id}/urls", ctrl.APIMoveLinksToWorkspace())
+		r.Delete("/{id}/urls", ctrl.APIDeleteWorkspaceURLs())
+		r.Get("/{id}/stats", ctrl.APIGetWorkspaceStats())
+	})
+	r.Route("/api/admin", func(r chi.Router) {
+		r.Use(ctrl.AdminAuth)
+		r.Get("/blocklist", ctrl.APIGetBlocklist())
+		r.Post("/blocklist", ctrl.APIAddBlocklistEntry())
+		r.Get("/links", ctrl.APIAdminFindLinks())
+		r.Get("/links/{id}", ctrl.APIAdminGetLink())
+		r.Post("/links/{id}/disable", ctrl.APIAdminDisableLink())
+		r.Post("/links/{id}/enable", ctrl.APIAdminEnableLink())
+		r.Post("/links/{id}/transfer", ctrl.APIAdminTransferLink())
+		r.Get("/domains", ctrl.APIAdminGetDomains())
+		r.Put("/domains/{name}", ctrl.APIAdminSaveDomain())
+		r.Delete("/domains/{name}", ctrl.APIAdminDeleteDomain())
+		r.Delete("/users/{userID}", ctrl.APIAdminPurgeUser())
+		r.Get("/audit", ctrl.APIGetAudit())
+	})
 }
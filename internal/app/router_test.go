@@ -0,0 +1,117 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"shortener/internal/config"
+	"shortener/internal/domain/models"
+	"shortener/internal/handlers"
+	"shortener/internal/logger"
+	"shortener/internal/mocks"
+	"shortener/internal/routes"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRouter(t *testing.T, conf *config.Config) (*chi.Mux, *mocks.MockStorageService, *mocks.MockUserService) {
+	ctrl := gomock.NewController(t)
+	sugarLogger, _ := logger.NewLogger()
+	storSrv := mocks.NewMockStorageService(ctrl)
+	userSrv := mocks.NewMockUserService(ctrl)
+
+	r := chi.NewRouter()
+	c := handlers.NewController(conf, storSrv, sugarLogger, userSrv)
+	InitMiddleware(r, conf, c)
+	Routing(r, conf, c)
+	return r, storSrv, userSrv
+}
+
+func expectRedirect(storSrv *mocks.MockStorageService, shortID string) {
+	storSrv.EXPECT().GetData(shortID).Return("http://example.com", false, nil)
+	storSrv.EXPECT().GetLinkOptions(shortID).Return(models.LinkOptions{}, nil)
+	storSrv.EXPECT().RegisterClick(shortID, gomock.Any()).Return(true, nil).AnyTimes()
+}
+
+func TestRoutingByHost(t *testing.T) {
+	conf := &config.Config{
+		BaseURL:      "http://api.example:8080",
+		ShortBaseURL: "https://sho.rt",
+		Timeout:      15,
+		RedirectCode: http.StatusTemporaryRedirect,
+	}
+	r, storSrv, userSrv := newTestRouter(t, conf)
+
+	// API paths are short IDs on the short host, and no user cookie is set on redirects
+	expectRedirect(storSrv, "ping")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://sho.rt/ping", nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "http://example.com", w.Header().Get("Location"))
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+
+	expectRedirect(storSrv, "ab")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://SHO.RT:443/ab", nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	expectRedirect(storSrv, "debug")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://sho.rt/debug", nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code, "Expected the profiler not to be served on the short host")
+
+	// branded domains are served with the redirects in their own namespaces
+	storSrv.EXPECT().GetDomain("go.brand-a.com").Return(models.Domain{Name: "go.brand-a.com"}, nil).AnyTimes()
+	expectRedirect(storSrv, "ab@go.brand-a.com")
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "https://go.brand-a.com/ab", nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+
+	// short IDs are not resolved on the API host
+	userSrv.EXPECT().GetUserIDFromCookie(gomock.Any()).Return("testUserID", nil).AnyTimes()
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://api.example:8080/ab", nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	storSrv.EXPECT().Ping().Return(nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://api.example:8080/ping", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestRoutingSharedHost(t *testing.T) {
+	conf := &config.Config{
+		BaseURL:      "http://localhost:8080",
+		Timeout:      15,
+		RedirectCode: http.StatusTemporaryRedirect,
+	}
+	r, storSrv, userSrv := newTestRouter(t, conf)
+
+	expectRedirect(storSrv, "ab")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://localhost:8080/ab", nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Empty(t, w.Header().Get("Set-Cookie"))
+
+	userSrv.EXPECT().GetUserIDFromCookie(gomock.Any()).Return("testUserID", nil)
+	storSrv.EXPECT().Ping().Return(nil)
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://localhost:8080/ping", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestReserveRoutes(t *testing.T) {
+	newTestRouter(t, &config.Config{BaseURL: "http://localhost:8080", Timeout: 15})
+	assert.True(t, routes.IsReserved("api"))
+	assert.True(t, routes.IsReserved("debug"))
+
+	r := chi.NewRouter()
+	r.Get("/{id}", http.NotFound)
+	r.Get("/status/live", http.NotFound)
+	reserveRoutes(r)
+	assert.True(t, routes.IsReserved("status"), "Expected new top-level routes to be reserved")
+	assert.False(t, routes.IsReserved("live"))
+}
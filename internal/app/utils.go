@@ -11,7 +11,8 @@ import (
 )
 
 // SelectStorage - selects the storage for saving URLs: database, file, or memory.
-func SelectStorage(c *config.Config) storage.StorageService {
+// The file storage reports the errors of its background saves to sugar.
+func SelectStorage(c *config.Config, sugar *zap.SugaredLogger) storage.StorageService {
 	if c.DBConnection != "" {
 		log.Printf("try using DB\n")
 		s := storage.NewStorageDB(c.DBConnection)
@@ -26,7 +27,7 @@ func SelectStorage(c *config.Config) storage.StorageService {
 			if err != nil {
 				log.Printf(" restore error\n")
 			} else {
-				storage.AutoSave(s)
+				storage.AutoSave(s, sugar)
 				return s
 			}
 		} else {
@@ -58,3 +59,14 @@ func CreateServer(c *config.Config, handler http.Handler, logger *zap.SugaredLog
 		ReadHeaderTimeout: 20 * time.Second,
 	}
 }
+
+// CreateRedirectServer creates the HTTP server of the dedicated redirect listener at c.RedirectAddr.
+func CreateRedirectServer(c *config.Config, handler http.Handler, logger *zap.SugaredLogger) *http.Server {
+	logger.Infof("Short links at %s\n", c.RedirectAddr)
+
+	return &http.Server{
+		Addr:              c.RedirectAddr,
+		Handler:           handler,
+		ReadHeaderTimeout: 20 * time.Second,
+	}
+}
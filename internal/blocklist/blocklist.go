@@ -0,0 +1,301 @@
+// Package blocklist checks destination URLs against a list of blocked domains and URL patterns.
+//
+// The list is read from a text file with one entry per line:
+//
+//	# comment
+//	phishing.example        credential phishing
+//	https://files.example/*/download.exe   malware
+//
+// An entry without "://" blocks the domain and all its subdomains. An entry with "://" is
+// a pattern matched against the whole normalized URL, where "*" matches any characters.
+// The rest of the line after the entry is the reason shown to users.
+package blocklist
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalidEntry - error when a blocklist entry cannot be parsed.
+var ErrInvalidEntry = errors.New("invalid blocklist entry")
+
+// DefaultReason is reported for entries without a reason.
+const DefaultReason = "destination is blocked"
+
+// Entry - blocked domain or URL pattern.
+type Entry struct {
+	// Pattern: domain (e.g. "phishing.example") or URL pattern (e.g. "https://files.example/*").
+	Pattern string `json:"pattern"`
+	// Reason: why the destination is blocked.
+	Reason string `json:"reason"`
+}
+
+// isDomain reports whether the entry blocks a domain rather than a URL pattern.
+func (e Entry) isDomain() bool {
+	return !strings.Contains(e.Pattern, "://")
+}
+
+// matches reports whether the normalized URL with the given lower-case host is blocked by the entry.
+func (e Entry) matches(rawURL, host string) bool {
+	if e.isDomain() {
+		return host == e.Pattern || strings.HasSuffix(host, "."+e.Pattern)
+	}
+	return matchGlob(e.Pattern, rawURL)
+}
+
+// NewEntry checks and normalizes the entry.
+func NewEntry(pattern, reason string) (Entry, error) {
+	pattern = strings.TrimSpace(pattern)
+	reason = strings.TrimSpace(reason)
+	if pattern == "" || strings.ContainsAny(pattern, " \t\r\n") {
+		return Entry{}, fmt.Errorf("%w: %q", ErrInvalidEntry, pattern)
+	}
+	if strings.ContainsAny(reason, "\r\n") {
+		return Entry{}, fmt.Errorf("%w: reason must be a single line", ErrInvalidEntry)
+	}
+
+	e := Entry{Pattern: pattern, Reason: reason}
+	if e.isDomain() {
+		e.Pattern = strings.TrimSuffix(strings.ToLower(strings.TrimPrefix(e.Pattern, "*.")), ".")
+		if e.Pattern == "" || strings.ContainsAny(e.Pattern, "/*?#") {
+			return Entry{}, fmt.Errorf("%w: %q is not a domain", ErrInvalidEntry, pattern)
+		}
+	}
+	if e.Reason == "" {
+		e.Reason = DefaultReason
+	}
+	return e, nil
+}
+
+// Blocklist - set of blocked destinations, optionally backed by a file.
+type Blocklist struct {
+	path    string
+	mu      sync.RWMutex
+	entries []Entry
+	// modTime and size of the file when it was last read.
+	modTime time.Time
+	size    int64
+}
+
+// New creates a blocklist loaded from the file. An empty path creates an empty in-memory blocklist;
+// a missing file is treated as empty and created when the first entry is added.
+func New(path string) (*Blocklist, error) {
+	b := NewEmpty(path)
+	if path == "" {
+		return b, nil
+	}
+	if _, err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// NewEmpty creates an empty blocklist backed by the file without reading it,
+// e.g. when the file cannot be parsed yet. The file is read on the next Reload.
+func NewEmpty(path string) *Blocklist {
+	return &Blocklist{path: path}
+}
+
+// Entries returns the current entries.
+func (b *Blocklist) Entries() []Entry {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return append([]Entry(nil), b.entries...)
+}
+
+// Check returns the entry blocking the normalized destination URL.
+func (b *Blocklist) Check(rawURL string) (Entry, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return check(b.entries, rawURL)
+}
+
+// check returns the first of the entries blocking the URL.
+func check(entries []Entry, rawURL string) (Entry, bool) {
+	if len(entries) == 0 {
+		return Entry{}, false
+	}
+	host := ""
+	if u, err := url.Parse(rawURL); err == nil {
+		host = strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	}
+	for _, e := range entries {
+		if e.matches(rawURL, host) {
+			return e, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Matcher returns a function checking URLs against the given entries only.
+// It is used to find existing links blocked by newly added entries.
+func Matcher(entries []Entry) func(rawURL string) (Entry, bool) {
+	return func(rawURL string) (Entry, bool) {
+		return check(entries, rawURL)
+	}
+}
+
+// Add adds the entry and appends it to the file. Returns false if the pattern is already blocked.
+func (b *Blocklist) Add(e Entry) (bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, existing := range b.entries {
+		if existing.Pattern == e.Pattern {
+			return false, nil
+		}
+	}
+
+	if b.path != "" {
+		f, err := os.OpenFile(b.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+		if err != nil {
+			return false, err
+		}
+		_, err = fmt.Fprintf(f, "%s %s\n", e.Pattern, e.Reason)
+		if errClose := f.Close(); err == nil {
+			err = errClose
+		}
+		if err != nil {
+			return false, err
+		}
+		if info, err := os.Stat(b.path); err == nil {
+			b.modTime, b.size = info.ModTime(), info.Size()
+		}
+	}
+
+	b.entries = append(b.entries, e)
+	return true, nil
+}
+
+// Reload reads the file again if it changed since the last read and returns the entries
+// that were not in the list before.
+func (b *Blocklist) Reload() ([]Entry, error) {
+	if b.path == "" {
+		return nil, nil
+	}
+
+	info, err := os.Stat(b.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	unchanged := info.ModTime().Equal(b.modTime) && info.Size() == b.size
+	b.mu.RUnlock()
+	if unchanged {
+		return nil, nil
+	}
+
+	f, err := os.Open(b.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close() //nolint:errcheck // read-only file
+	entries, err := parse(f)
+	if err != nil {
+		return nil, err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	known := make(map[string]bool, len(b.entries))
+	for _, e := range b.entries {
+		known[e.Pattern] = true
+	}
+	var added []Entry
+	for _, e := range entries {
+		if !known[e.Pattern] {
+			added = append(added, e)
+		}
+	}
+
+	b.entries = entries
+	b.modTime, b.size = info.ModTime(), info.Size()
+	return added, nil
+}
+
+// Watch reloads the file every interval until stop is closed. New entries are passed to onAdded,
+// reload errors to onError (the previous entries are kept).
+func (b *Blocklist) Watch(interval time.Duration, stop <-chan struct{}, onAdded func([]Entry), onError func(error)) {
+	if b.path == "" {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			added, err := b.Reload()
+			if err != nil {
+				onError(err)
+				continue
+			}
+			if len(added) > 0 {
+				onAdded(added)
+			}
+		}
+	}
+}
+
+func parse(r io.Reader) ([]Entry, error) {
+	var entries []Entry
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		pattern, reason := text, ""
+		if i := strings.IndexAny(text, " \t"); i >= 0 {
+			pattern, reason = text[:i], text[i+1:]
+		}
+		e, err := NewEntry(pattern, reason)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if !seen[e.Pattern] {
+			seen[e.Pattern] = true
+			entries = append(entries, e)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// matchGlob reports whether s matches the pattern, where "*" matches any sequence of characters.
+func matchGlob(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		i := strings.Index(s, part)
+		if i < 0 {
+			return false
+		}
+		s = s[i+len(part):]
+	}
+	return strings.HasSuffix(s, last)
+}
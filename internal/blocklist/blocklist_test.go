@@ -0,0 +1,97 @@
+package blocklist
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheck(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte(`# blocked destinations
+*.Phishing.example   credential phishing
+https://files.example/*/download.exe	malware
+bare.example
+`), 0o644))
+
+	b, err := New(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		url     string
+		blocked bool
+		reason  string
+	}{
+		{url: "https://phishing.example/login", blocked: true, reason: "credential phishing"},
+		{url: "http://www.phishing.example", blocked: true, reason: "credential phishing"},
+		{url: "http://notphishing.example", blocked: false},
+		{url: "https://files.example/v1/download.exe", blocked: true, reason: "malware"},
+		{url: "https://files.example/v1/readme.txt", blocked: false},
+		{url: "http://files.example/v1/download.exe", blocked: false},
+		{url: "https://bare.example:8443/", blocked: true, reason: DefaultReason},
+	}
+	for _, tt := range tests {
+		e, blocked := b.Check(tt.url)
+		assert.Equal(t, tt.blocked, blocked, tt.url)
+		assert.Equal(t, tt.reason, e.Reason, tt.url)
+	}
+}
+
+func TestNewRejectsInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	require.NoError(t, os.WriteFile(path, []byte("ok.example\n*.\n"), 0o644))
+
+	_, err := New(path)
+	require.ErrorIs(t, err, ErrInvalidEntry)
+	assert.Contains(t, err.Error(), "line 2")
+}
+
+func TestAddAndReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	b, err := New(path)
+	require.NoError(t, err, "Expected missing file to be treated as empty")
+
+	e, err := NewEntry("Spam.example", "")
+	require.NoError(t, err)
+	added, err := b.Add(e)
+	require.NoError(t, err)
+	require.True(t, added)
+	added, err = b.Add(e)
+	require.NoError(t, err)
+	require.False(t, added, "Expected duplicate pattern not to be added")
+
+	newEntries, err := b.Reload()
+	require.NoError(t, err)
+	require.Empty(t, newEntries, "Expected own write not to be reported as a change")
+
+	// Another process appends to the file; the modification time may not change within the test.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = f.WriteString("malware.example drive-by downloads\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+
+	newEntries, err = b.Reload()
+	require.NoError(t, err)
+	require.Equal(t, []Entry{{Pattern: "malware.example", Reason: "drive-by downloads"}}, newEntries)
+	require.Equal(t, []Entry{
+		{Pattern: "spam.example", Reason: DefaultReason},
+		{Pattern: "malware.example", Reason: "drive-by downloads"},
+	}, b.Entries())
+}
+
+func TestMatcher(t *testing.T) {
+	e, err := NewEntry("https://short.example/*", "")
+	require.NoError(t, err)
+	check := Matcher([]Entry{e})
+
+	_, blocked := check("https://short.example/x")
+	assert.True(t, blocked)
+	_, blocked = check("https://other.example/x")
+	assert.False(t, blocked)
+}
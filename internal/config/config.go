@@ -5,16 +5,27 @@ import (
 	"encoding/json"
 	"errors"
 	"flag"
+	"net/netip"
+	"net/url"
 	"os"
+	"shortener/internal/domain/models"
+	"slices"
 	"strconv"
+	"strings"
 )
 
 // Config - application configuration structure.
 type Config struct {
 	// Addr: string with the address on which the server will run (e.g., "localhost:8080").
 	Addr string `json:"server_address"`
-	// BaseURL: base URL of the application used to create shortened links.
+	// BaseURL: base URL of the application (API and UI), also used to create shortened links if ShortBaseURL is empty.
 	BaseURL string `json:"base_url"`
+	// ShortBaseURL: base URL of the shortened links (e.g., "https://sho.rt"). If its host differs from the host
+	// of BaseURL, only the API routes are served on the host of BaseURL and only the redirect routes on all
+	// other hosts (the host of ShortBaseURL and the branded domains).
+	ShortBaseURL string `json:"short_base_url"`
+	// RedirectAddr: address of a dedicated listener serving only the redirect routes (disabled if empty).
+	RedirectAddr string `json:"redirect_address"`
 	// URLStorageFile: path to the file used for storing URLs.
 	URLStorageFile string `json:"file_storage_path"`
 	// DBConnection: database connection string.
@@ -27,17 +38,56 @@ type Config struct {
 	NumWorkers int
 	// EnableHTTPS: is HTTPS connection enabled
 	EnableHTTPS bool `json:"enable_https"`
+	// RedirectCode: default HTTP status code used to redirect from a short URL (301, 302, 303, 307 or 308).
+	RedirectCode int `json:"redirect_code"`
+	// Passthrough: append trailing path segments and merge query parameters into the original URL for all links.
+	Passthrough bool `json:"passthrough"`
+	// GeoIPDatabase: path to the local GeoIP database (MaxMind DB or CSV ranges) used for country targeting.
+	GeoIPDatabase string `json:"geoip_database"`
+	// TrustedProxies: comma-separated CIDRs of proxies whose X-Forwarded-For and X-Real-IP headers are trusted.
+	TrustedProxies string `json:"trusted_proxies"`
+	// BlocklistFile: path to the file with blocked destination domains and URL patterns (reloaded on change).
+	BlocklistFile string `json:"blocklist_file"`
+	// AdminToken: bearer token of the admin API (the admin API is disabled if empty).
+	AdminToken string `json:"admin_token"`
+	// AuditRetentionDays: number of days audit records are kept (0 keeps them forever).
+	AuditRetentionDays int `json:"audit_retention_days"`
+	// RenameReserved: give stored links whose short IDs take reserved path segments of the service routes
+	// new short IDs at startup instead of refusing to start.
+	RenameReserved bool `json:"rename_reserved"`
+	// ShortIDStrategy: generator of the short IDs: "nanoid" (default), "base62", "hashids" or "words".
+	ShortIDStrategy string `json:"short_id_strategy"`
+	// ShortIDAlphabet: characters of the nanoid and hashids short IDs (empty for the default ones).
+	ShortIDAlphabet string `json:"short_id_alphabet"`
+	// ShortIDLength: length of the nanoid short IDs and minimum length of the hashids short IDs (0 for the default).
+	ShortIDLength int `json:"short_id_length"`
+	// ShortIDSalt: secret that obfuscates the hashids short IDs.
+	ShortIDSalt string `json:"short_id_salt"`
 }
 
 var cfgDefault = Config{
-	Addr:           "localhost:8080",
-	BaseURL:        "http://localhost:8080",
-	Timeout:        15,
-	URLStorageFile: "",
-	DBConnection:   "",
-	NumWorkers:     15,
-	EnableHTTPS:    false,
-	ConfigPath:     "",
+	Addr:               "localhost:8080",
+	BaseURL:            "http://localhost:8080",
+	ShortBaseURL:       "",
+	RedirectAddr:       "",
+	Timeout:            15,
+	URLStorageFile:     "",
+	DBConnection:       "",
+	NumWorkers:         15,
+	EnableHTTPS:        false,
+	ConfigPath:         "",
+	RedirectCode:       307,
+	Passthrough:        false,
+	GeoIPDatabase:      "",
+	TrustedProxies:     "",
+	BlocklistFile:      "",
+	AdminToken:         "",
+	AuditRetentionDays: 0,
+	RenameReserved:     false,
+	ShortIDStrategy:    "nanoid",
+	ShortIDAlphabet:    "",
+	ShortIDLength:      0,
+	ShortIDSalt:        "",
 }
 
 // NewConfig creates and returns a new instance of the Config structure with predefined values.
@@ -51,6 +101,82 @@ var ErrReadConfig = errors.New("reading json config")
 // ErrParseConfig - error parsing json config.
 var ErrParseConfig = errors.New("parse json config")
 
+// ErrRedirectCode - error when the configured redirect code is not a redirect status.
+var ErrRedirectCode = errors.New("unsupported redirect code")
+
+// ErrTrustedProxies - error when the trusted proxies are not valid CIDRs.
+var ErrTrustedProxies = errors.New("invalid trusted proxies")
+
+// ErrAuditRetention - error when the audit retention is negative.
+var ErrAuditRetention = errors.New("negative audit retention")
+
+// ErrShortBaseURL - error when the base URL of the shortened links is not an absolute URL.
+var ErrShortBaseURL = errors.New("invalid short base URL")
+
+// ErrShortIDStrategy - error when the short ID strategy is not one of ShortIDStrategies.
+var ErrShortIDStrategy = errors.New("unknown short ID strategy")
+
+// ShortIDStrategies - strategies of the short ID generator (see repository.NewShortIDGenerator).
+var ShortIDStrategies = []string{"nanoid", "base62", "hashids", "words"}
+
+// ShortLinkBase returns the base URL of the shortened links: ShortBaseURL or, if it is empty, BaseURL.
+func (c *Config) ShortLinkBase() string {
+	if c.ShortBaseURL != "" {
+		return c.ShortBaseURL
+	}
+	return c.BaseURL
+}
+
+// APIHost returns the host of BaseURL in lower case.
+func (c *Config) APIHost() string {
+	base, err := url.Parse(c.BaseURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(base.Host)
+}
+
+// ShortHost returns the host of ShortBaseURL if the shortened links have a host of their own,
+// that is, different from the host of BaseURL. Otherwise it returns an empty string.
+func (c *Config) ShortHost() (string, error) {
+	if c.ShortBaseURL == "" {
+		return "", nil
+	}
+	short, err := url.Parse(c.ShortBaseURL)
+	if err != nil || short.Scheme == "" || short.Host == "" {
+		return "", ErrShortBaseURL
+	}
+	if base, err := url.Parse(c.BaseURL); err == nil && strings.EqualFold(base.Host, short.Host) {
+		return "", nil
+	}
+	return strings.ToLower(short.Host), nil
+}
+
+// TrustedProxyPrefixes parses TrustedProxies. A single address is treated as a /32 or /128 prefix.
+func (c *Config) TrustedProxyPrefixes() ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, s := range strings.Split(c.TrustedProxies, ",") {
+		s = strings.TrimSpace(s)
+		if s == "" {
+			continue
+		}
+		if !strings.Contains(s, "/") {
+			addr, err := netip.ParseAddr(s)
+			if err != nil {
+				return nil, ErrTrustedProxies
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return nil, ErrTrustedProxies
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
 // Init initializes the application configuration using environment variables and command-line flags.
 func Init(c *Config) error {
 	if val, exist := os.LookupEnv("SERVER_ADDRESS"); exist {
@@ -59,6 +185,12 @@ func Init(c *Config) error {
 	if val, exist := os.LookupEnv("BASE_URL"); exist {
 		c.BaseURL = val
 	}
+	if val, exist := os.LookupEnv("SHORT_BASE_URL"); exist {
+		c.ShortBaseURL = val
+	}
+	if val, exist := os.LookupEnv("REDIRECT_ADDRESS"); exist {
+		c.RedirectAddr = val
+	}
 	if val, exist := os.LookupEnv("FILE_STORAGE_PATH"); exist {
 		c.URLStorageFile = val
 	}
@@ -71,6 +203,57 @@ func Init(c *Config) error {
 			c.EnableHTTPS = valBool
 		}
 	}
+	if val, exist := os.LookupEnv("PASSTHROUGH"); exist {
+		valBool, err := strconv.ParseBool(val)
+		if err == nil {
+			c.Passthrough = valBool
+		}
+	}
+	if val, exist := os.LookupEnv("GEOIP_DATABASE"); exist {
+		c.GeoIPDatabase = val
+	}
+	if val, exist := os.LookupEnv("TRUSTED_PROXIES"); exist {
+		c.TrustedProxies = val
+	}
+	if val, exist := os.LookupEnv("BLOCKLIST_FILE"); exist {
+		c.BlocklistFile = val
+	}
+	if val, exist := os.LookupEnv("ADMIN_TOKEN"); exist {
+		c.AdminToken = val
+	}
+	if val, exist := os.LookupEnv("AUDIT_RETENTION_DAYS"); exist {
+		valInt, err := strconv.Atoi(val)
+		if err == nil {
+			c.AuditRetentionDays = valInt
+		}
+	}
+	if val, exist := os.LookupEnv("RENAME_RESERVED"); exist {
+		valBool, err := strconv.ParseBool(val)
+		if err == nil {
+			c.RenameReserved = valBool
+		}
+	}
+	if val, exist := os.LookupEnv("SHORT_ID_STRATEGY"); exist {
+		c.ShortIDStrategy = val
+	}
+	if val, exist := os.LookupEnv("SHORT_ID_ALPHABET"); exist {
+		c.ShortIDAlphabet = val
+	}
+	if val, exist := os.LookupEnv("SHORT_ID_LENGTH"); exist {
+		valInt, err := strconv.Atoi(val)
+		if err == nil {
+			c.ShortIDLength = valInt
+		}
+	}
+	if val, exist := os.LookupEnv("SHORT_ID_SALT"); exist {
+		c.ShortIDSalt = val
+	}
+	if val, exist := os.LookupEnv("REDIRECT_CODE"); exist {
+		valInt, err := strconv.Atoi(val)
+		if err == nil {
+			c.RedirectCode = valInt
+		}
+	}
 
 	var flagCgf Config
 	flag.StringVar(&flagCgf.Addr, "a", "", "HTTP-server startup address")
@@ -79,6 +262,11 @@ func Init(c *Config) error {
 	flag.StringVar(&flagCgf.DBConnection, "d", "", "database connection address")
 	flag.BoolVar(&flagCgf.EnableHTTPS, "s", false, "is HTTPS connection enabled")
 	flag.StringVar(&flagCgf.ConfigPath, "c", "", "path to config file (json)")
+	flag.IntVar(&flagCgf.RedirectCode, "r", 0, "default redirect status code")
+	flag.StringVar(&flagCgf.GeoIPDatabase, "g", "", "path to the GeoIP database (mmdb or csv)")
+	flag.StringVar(&flagCgf.TrustedProxies, "t", "", "trusted proxy CIDRs, comma-separated")
+	flag.StringVar(&flagCgf.BlocklistFile, "l", "", "path to the blocklist file")
+	flag.BoolVar(&flagCgf.RenameReserved, "rename-reserved", false, "rename stored short IDs that conflict with service routes")
 
 	flag.Parse()
 
@@ -108,6 +296,37 @@ func Init(c *Config) error {
 	if flagCgf.EnableHTTPS {
 		c.EnableHTTPS = flagCgf.EnableHTTPS
 	}
+	if flagCgf.RedirectCode != 0 {
+		c.RedirectCode = flagCgf.RedirectCode
+	}
+	if flagCgf.GeoIPDatabase != "" {
+		c.GeoIPDatabase = flagCgf.GeoIPDatabase
+	}
+	if flagCgf.TrustedProxies != "" {
+		c.TrustedProxies = flagCgf.TrustedProxies
+	}
+	if flagCgf.BlocklistFile != "" {
+		c.BlocklistFile = flagCgf.BlocklistFile
+	}
+	if flagCgf.RenameReserved {
+		c.RenameReserved = flagCgf.RenameReserved
+	}
+
+	if !models.IsValidRedirectType(c.RedirectCode) {
+		return ErrRedirectCode
+	}
+	if _, err := c.TrustedProxyPrefixes(); err != nil {
+		return err
+	}
+	if c.AuditRetentionDays < 0 {
+		return ErrAuditRetention
+	}
+	if _, err := c.ShortHost(); err != nil {
+		return err
+	}
+	if !slices.Contains(ShortIDStrategies, c.ShortIDStrategy) {
+		return ErrShortIDStrategy
+	}
 
 	return nil
 }
@@ -0,0 +1,70 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ActorAdmin - actor of the audit records of the admin API.
+const ActorAdmin = "admin"
+
+// ActorSystem - actor of the audit records of changes the service makes itself.
+const ActorSystem = "system"
+
+// Actions recorded in the audit log.
+const (
+	AuditLinkCreate      = "link.create"
+	AuditLinkEdit        = "link.edit"
+	AuditLinkDelete      = "link.delete"
+	AuditLinkMove        = "link.move"
+	AuditWorkspaceCreate = "workspace.create"
+	AuditMemberSet       = "workspace.member.set"
+	AuditMemberRemove    = "workspace.member.remove"
+	AuditAdminDisable    = "admin.link.disable"
+	AuditAdminEnable     = "admin.link.enable"
+	AuditAdminTransfer   = "admin.link.transfer"
+	AuditLinkRename      = "link.rename"
+	AuditAdminPurge      = "admin.user.purge"
+	AuditDomainSet       = "admin.domain.set"
+	AuditDomainDelete    = "admin.domain.delete"
+)
+
+// AuditRecord - entry of the audit log: who changed what and when.
+type AuditRecord struct {
+	ID string    `json:"id"`
+	At time.Time `json:"at"`
+	// Actor: user ID of the user who made the change, ActorAdmin or ActorSystem.
+	Actor     string `json:"actor"`
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Action    string `json:"action"`
+	// ShortID: link the action changed (empty for actions on users and domains).
+	ShortID string `json:"short_id,omitempty"`
+	// UserID: user the action concerns: the acting user for actions of users on links, the creator
+	// of the link for admin actions on links, the member for workspace membership changes.
+	UserID string `json:"user_id,omitempty"`
+	// Before, After: state of the changed data before and after the action.
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditQuery - filter of the audit records; empty fields match all records.
+type AuditQuery struct {
+	ShortID string
+	UserID  string
+	Actor   string
+	// Since, Until: records made at or after Since and before Until.
+	Since time.Time
+	Until time.Time
+	// Limit: maximum number of the latest records returned.
+	Limit int
+}
+
+// Matches reports whether the record passes the filter.
+func (q AuditQuery) Matches(r AuditRecord) bool {
+	return (q.ShortID == "" || r.ShortID == q.ShortID) &&
+		(q.UserID == "" || r.UserID == q.UserID) &&
+		(q.Actor == "" || r.Actor == q.Actor) &&
+		(q.Since.IsZero() || !r.At.Before(q.Since)) &&
+		(q.Until.IsZero() || r.At.Before(q.Until))
+}
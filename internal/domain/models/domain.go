@@ -0,0 +1,80 @@
+package models
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// domainSeparator separates the short ID from the branded domain in the storage key of a link.
+// It is neither a character of short IDs nor of host names, and it may appear in a URL path segment.
+const domainSeparator = "@"
+
+// domainPattern - host name of a branded domain: dot-separated labels of letters, digits and hyphens.
+var domainPattern = regexp.MustCompile(`^([a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Domain - branded domain of short links registered by the admin. Every domain has a namespace
+// of short IDs of its own; it can be used by the assigned users and the members of the assigned workspaces.
+type Domain struct {
+	// Name: host name of the domain in lower case (e.g., "go.brand-a.com").
+	Name         string    `json:"name"`
+	UserIDs      []string  `json:"user_ids,omitempty"`
+	WorkspaceIDs []string  `json:"workspace_ids,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// NormalizeDomain returns the host name in lower case and whether it is a valid domain name.
+func NormalizeDomain(name string) (string, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return name, len(name) <= 253 && domainPattern.MatchString(name)
+}
+
+// AssignedTo reports whether the domain can be used by the user who is a member of the workspaces.
+func (d Domain) AssignedTo(userID string, workspaceIDs []string) bool {
+	if slices.Contains(d.UserIDs, userID) {
+		return true
+	}
+	for _, id := range workspaceIDs {
+		if slices.Contains(d.WorkspaceIDs, id) {
+			return true
+		}
+	}
+	return false
+}
+
+// QualifyShortID returns the storage key of the short ID in the namespace of the branded domain:
+// "id@domain", or the short ID itself in the namespace of the default domain (empty domain).
+func QualifyShortID(shortID, domain string) string {
+	if domain == "" {
+		return shortID
+	}
+	return shortID + domainSeparator + domain
+}
+
+// SplitShortID returns the short ID and the branded domain of the storage key made by QualifyShortID.
+func SplitShortID(key string) (shortID, domain string) {
+	shortID, domain, _ = strings.Cut(key, domainSeparator)
+	return shortID, domain
+}
+
+// LinkBaseURL returns the base URL and the short ID of the link with the storage key: baseURL for the
+// default domain, or the branded domain with the scheme of baseURL.
+func LinkBaseURL(baseURL, key string) (base, shortID string) {
+	shortID, domain := SplitShortID(key)
+	if domain == "" {
+		return baseURL, shortID
+	}
+	scheme := "https"
+	if u, err := url.Parse(baseURL); err == nil && u.Scheme != "" {
+		scheme = u.Scheme
+	}
+	return scheme + "://" + domain, shortID
+}
+
+// ShortURL returns the short URL of the link with the storage key (see LinkBaseURL).
+func ShortURL(baseURL, key string) string {
+	base, shortID := LinkBaseURL(baseURL, key)
+	return base + "/" + shortID
+}
@@ -1,12 +1,231 @@
 // Package models provides structure for storing URL information in JSON format.
 package models
 
+import (
+	"maps"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// LinkOptions - optional per-link settings supplied when a short URL is created.
+type LinkOptions struct {
+	// RedirectType: HTTP status code used to redirect to the original URL (0 means the configured default).
+	RedirectType int `json:"redirect_type,omitempty"`
+	// Passthrough: append trailing path segments and merge query parameters of the request into the original URL.
+	Passthrough bool `json:"passthrough,omitempty"`
+	// UTMTemplateID: identifier of the UTM template applied to the original URL on redirect.
+	UTMTemplateID string `json:"utm_template_id,omitempty"`
+	// PasswordHash: bcrypt hash of the password required to follow the link (empty if not protected).
+	PasswordHash string `json:"password_hash,omitempty"`
+	// MaxClicks: number of redirects after which the link is gone (0 means unlimited).
+	MaxClicks int `json:"max_clicks,omitempty"`
+	// Clicks: number of redirects made via the link.
+	Clicks int `json:"clicks,omitempty"`
+	// Destinations: weighted destinations the redirects are split between instead of the original URL.
+	Destinations []Destination `json:"destinations,omitempty"`
+	// Rules: targeting rules checked in order before the regular destination, which is the fallback.
+	Rules []TargetingRule `json:"rules,omitempty"`
+	// CountryClicks: number of redirects per visitor country (ISO 3166-1 alpha-2 code).
+	// Redirects of visitors with unknown country are counted only in Clicks.
+	CountryClicks map[string]int `json:"country_clicks,omitempty"`
+	// DisabledReason: why the link was disabled by moderation (empty if the link is enabled).
+	DisabledReason string `json:"disabled_reason,omitempty"`
+	LinkMetadata
+	// Interstitial: always show the preview page with a warning instead of redirecting immediately.
+	Interstitial bool `json:"interstitial,omitempty"`
+	// CreatedAt: time the link was created (zero for links created before it was recorded).
+	CreatedAt time.Time `json:"created_at"`
+	// Alias: short ID requested on creation; it is used if no link has it yet, otherwise a new ID is generated.
+	// It is not stored with the link.
+	Alias string `json:"-"`
+	// Domain: branded domain whose namespace the link is created in (empty for the default domain).
+	// It is not stored with the link: the short ID is qualified by it (see QualifyShortID).
+	Domain string `json:"-"`
+}
+
+// LinkMetadata - descriptive fields the owner of a link uses to organize links.
+type LinkMetadata struct {
+	// Title: title of the link, also shown on the preview page.
+	Title string `json:"title,omitempty"`
+	// Notes: free-form notes of the owner.
+	Notes string `json:"notes,omitempty"`
+	// Tags: lower-case tags the links can be filtered by.
+	Tags []string `json:"tags,omitempty"`
+}
+
+// HasTag reports whether the link has the tag.
+func (m LinkMetadata) HasTag(tag string) bool {
+	return slices.Contains(m.Tags, tag)
+}
+
+// Click - redirect via a short link.
+type Click struct {
+	// Variant: index of the destination the visitor was sent to (-1 if not a weighted destination).
+	Variant int
+	// Country: country code of the visitor (empty if unknown).
+	Country string
+}
+
+// Destination - one of the weighted destinations of a short link.
+type Destination struct {
+	// URL: destination URL.
+	URL string `json:"url"`
+	// Weight: relative share of redirects sent to the destination.
+	Weight int `json:"weight"`
+	// Clicks: number of redirects made to the destination.
+	Clicks int `json:"clicks"`
+}
+
+// Platforms of the visitor device that targeting rules can match.
+const (
+	PlatformIOS     = "ios"
+	PlatformAndroid = "android"
+	PlatformDesktop = "desktop"
+)
+
+// TargetingRule - rule sending the visitors with matching device or language to its own URL.
+type TargetingRule struct {
+	// Platform: device platform of the visitor (ios, android, desktop; empty matches any).
+	Platform string `json:"platform,omitempty"`
+	// Language: preferred language of the visitor, e.g. "de" or "pt-BR" (empty matches any).
+	Language string `json:"language,omitempty"`
+	// Country: country of the visitor as ISO 3166-1 alpha-2 code, e.g. "US" (empty matches any).
+	Country string `json:"country,omitempty"`
+	// URL: destination URL for the matching visitors.
+	URL string `json:"url"`
+}
+
+// LinkEdit - changes of the link settings requested by its owner. Nil fields are left unchanged.
+type LinkEdit struct {
+	// Destinations: new weighted destinations (an empty list removes them).
+	Destinations *[]Destination
+	// Rules: new targeting rules (an empty list removes them).
+	Rules *[]TargetingRule
+	// Title: new title (an empty string removes it).
+	Title *string
+	// Notes: new notes (an empty string removes them).
+	Notes *string
+	// Tags: new tags (an empty list removes them).
+	Tags *[]string
+}
+
+// Apply changes the link settings according to the edit. Click counters of destinations
+// whose URL is kept are carried over to the new destinations.
+func (o *LinkOptions) Apply(edit LinkEdit) {
+	if edit.Destinations != nil {
+		clicks := make(map[string]int, len(o.Destinations))
+		for _, d := range o.Destinations {
+			clicks[d.URL] += d.Clicks
+		}
+
+		destinations := make([]Destination, 0, len(*edit.Destinations))
+		for _, d := range *edit.Destinations {
+			d.Clicks = clicks[d.URL]
+			delete(clicks, d.URL)
+			destinations = append(destinations, d)
+		}
+		o.Destinations = destinations
+	}
+	if edit.Rules != nil {
+		o.Rules = *edit.Rules
+		if len(o.Rules) == 0 {
+			o.Rules = nil
+		}
+	}
+	if edit.Title != nil {
+		o.Title = *edit.Title
+	}
+	if edit.Notes != nil {
+		o.Notes = *edit.Notes
+	}
+	if edit.Tags != nil {
+		o.Tags = *edit.Tags
+		if len(o.Tags) == 0 {
+			o.Tags = nil
+		}
+	}
+}
+
+// SetCreated records the creation time of the link unless it is already set.
+func (o *LinkOptions) SetCreated(now time.Time) {
+	if o.CreatedAt.IsZero() {
+		o.CreatedAt = now.UTC()
+	}
+}
+
+// CountClick adds the click to the counters. Destinations and country counters are copied
+// before the change, so copies of the options made before the call are not affected.
+func (o *LinkOptions) CountClick(click Click) {
+	o.Clicks++
+	if click.Variant >= 0 && click.Variant < len(o.Destinations) {
+		o.Destinations = slices.Clone(o.Destinations)
+		o.Destinations[click.Variant].Clicks++
+	}
+	if click.Country != "" {
+		countryClicks := maps.Clone(o.CountryClicks)
+		if countryClicks == nil {
+			countryClicks = make(map[string]int)
+		}
+		countryClicks[click.Country]++
+		o.CountryClicks = countryClicks
+	}
+}
+
+// ClicksExhausted reports whether the link has reached its click limit.
+func (o LinkOptions) ClicksExhausted() bool {
+	return o.MaxClicks > 0 && o.Clicks >= o.MaxClicks
+}
+
+// UTMTemplate - named set of UTM parameters that a user can attach to links.
+type UTMTemplate struct {
+	// ID: unique identifier of the template.
+	ID string `json:"id"`
+	// UserID: identifier of the user who owns the template.
+	UserID string `json:"user_id"`
+	// Name: template name, unique among the templates of the user.
+	Name string `json:"name"`
+	// Params: UTM parameters added to the original URL (utm_source, utm_medium, utm_campaign, ...).
+	Params map[string]string `json:"params"`
+}
+
+// URLData - structure describing a stored short link.
+type URLData struct {
+	// OriginalURL: original URL that corresponds to the shortened version.
+	OriginalURL string `json:"original_url"`
+	// UserID: identifier of the user who created the link.
+	UserID string `json:"user_id,omitempty"`
+	// WorkspaceID: workspace that owns the link (empty if the link belongs to its creator only).
+	WorkspaceID string `json:"workspace_id,omitempty"`
+	// IsDeleted: the link has been deleted by its owner.
+	IsDeleted bool `json:"is_deleted,omitempty"`
+	LinkOptions
+}
+
+// CanDelete reports whether the user may delete the link: a workspace link can be deleted
+// by the owners and editors of the workspace (role is the user's role in it), any other link by its creator.
+func (d URLData) CanDelete(userID, role string) bool {
+	if d.WorkspaceID != "" {
+		return CanEditLinks(role)
+	}
+	return d.UserID == userID
+}
+
 // StorageJSON - structure for storing URL information in JSON format.
 type StorageJSON struct {
 	// UUID: unique identifier for the URL record.
 	UUID string `json:"uuid"`
 	// ShortURL: shortened version of the URL associated with this record.
 	ShortURL string `json:"short_url"`
-	// OriginalURL: original URL that corresponds to the shortened version.
-	OriginalURL string `json:"original_url"`
+	URLData
+}
+
+// IsValidRedirectType reports whether code is a redirect status that can be used for short links.
+func IsValidRedirectType(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusSeeOther,
+		http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
 }
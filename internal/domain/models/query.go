@@ -0,0 +1,174 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Sort keys of the user link listing.
+const (
+	SortCreated = "created_at"
+	SortClicks  = "clicks"
+)
+
+// Page sizes of the user link listing.
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 1000
+)
+
+// ErrInvalidCursor - error when the pagination cursor cannot be decoded or was issued for another sort order.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// LinkQuery - filters, order and page of the user link listing.
+type LinkQuery struct {
+	// Limit: maximum number of links on the page.
+	Limit int
+	// Cursor: position after which the page starts (nil for the first page).
+	Cursor *LinkCursor
+	// Sort: SortCreated or SortClicks; links with equal keys are ordered by short ID.
+	Sort string
+	// Ascending: sort in ascending order (descending by default).
+	Ascending bool
+	// Search: case-insensitive substring of the original URL or the title (empty matches any).
+	Search string
+	// Tag: tag the links must have (empty matches any).
+	Tag string
+	// Deleted: only deleted (true) or not deleted (false) links; nil matches any.
+	Deleted *bool
+	// Expired: only links whose click limit is reached (true) or not reached (false); nil matches any.
+	Expired *bool
+}
+
+// LinkCursor - position in the user link listing: the sort key and the short ID of the last link of a page.
+type LinkCursor struct {
+	Sort      string    `json:"s"`
+	Ascending bool      `json:"a,omitempty"`
+	CreatedAt time.Time `json:"t"`
+	Clicks    int       `json:"c,omitempty"`
+	ShortID   string    `json:"id"`
+}
+
+// Encode returns the cursor as an opaque URL-safe string.
+func (c LinkCursor) Encode() string {
+	data, _ := json.Marshal(c) //nolint:errchkjson // the struct always encodes
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor decodes the cursor returned by LinkCursor.Encode.
+func DecodeCursor(s string) (LinkCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return LinkCursor{}, ErrInvalidCursor
+	}
+	var c LinkCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ShortID == "" {
+		return LinkCursor{}, ErrInvalidCursor
+	}
+	if c.Sort != SortCreated && c.Sort != SortClicks {
+		return LinkCursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// UserLink - stored short link with its short ID.
+type UserLink struct {
+	ShortID string
+	URLData
+}
+
+// LinkPage - page of the user link listing.
+type LinkPage struct {
+	Links []UserLink
+	// Next: cursor of the next page (nil if this is the last page).
+	Next *LinkCursor
+}
+
+// Matches reports whether the link passes the filters of the query.
+func (q LinkQuery) Matches(link UserLink) bool {
+	if q.Deleted != nil && link.IsDeleted != *q.Deleted {
+		return false
+	}
+	if q.Expired != nil && link.ClicksExhausted() != *q.Expired {
+		return false
+	}
+	if q.Tag != "" && !link.HasTag(q.Tag) {
+		return false
+	}
+	if q.Search != "" {
+		search := strings.ToLower(q.Search)
+		if !strings.Contains(strings.ToLower(link.OriginalURL), search) && !strings.Contains(strings.ToLower(link.Title), search) {
+			return false
+		}
+	}
+	return true
+}
+
+// CursorOf returns the cursor pointing at the link.
+func (q LinkQuery) CursorOf(link UserLink) LinkCursor {
+	c := LinkCursor{Sort: q.Sort, Ascending: q.Ascending, ShortID: link.ShortID}
+	if q.Sort == SortClicks {
+		c.Clicks = link.Clicks
+	} else {
+		c.CreatedAt = link.CreatedAt
+	}
+	return c
+}
+
+// compareCursors compares the positions in ascending order: negative if a comes first, positive if b does.
+func compareCursors(a, b LinkCursor) int {
+	if a.Sort == SortClicks {
+		if a.Clicks != b.Clicks {
+			return a.Clicks - b.Clicks
+		}
+	} else if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+		return c
+	}
+	return strings.Compare(a.ShortID, b.ShortID)
+}
+
+// Page filters, sorts and pages the links in memory. Backends that cannot run the query
+// themselves use it on all the links of the user.
+func (q LinkQuery) Page(links []UserLink) LinkPage {
+	matched := make([]UserLink, 0, len(links))
+	for _, link := range links {
+		if q.Matches(link) {
+			matched = append(matched, link)
+		}
+	}
+
+	order := func(a, b UserLink) int {
+		c := compareCursors(q.CursorOf(a), q.CursorOf(b))
+		if !q.Ascending {
+			c = -c
+		}
+		return c
+	}
+	slices.SortFunc(matched, order)
+
+	start := 0
+	if q.Cursor != nil {
+		start, _ = slices.BinarySearchFunc(matched, *q.Cursor, func(link UserLink, c LinkCursor) int {
+			r := compareCursors(q.CursorOf(link), c)
+			if !q.Ascending {
+				r = -r
+			}
+			return r
+		})
+		if start < len(matched) && matched[start].ShortID == q.Cursor.ShortID {
+			start++
+		}
+	}
+
+	page := LinkPage{Links: matched[start:]}
+	if q.Limit > 0 && len(page.Links) > q.Limit {
+		page.Links = page.Links[:q.Limit]
+		next := q.CursorOf(page.Links[len(page.Links)-1])
+		page.Next = &next
+	}
+	return page
+}
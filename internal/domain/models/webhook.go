@@ -0,0 +1,94 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// Types of the link lifecycle events sent to webhooks.
+const (
+	EventLinkCreated = "link.created"
+	EventLinkEdited  = "link.edited"
+	EventLinkDeleted = "link.deleted"
+	EventLinkClicked = "link.clicked"
+)
+
+// WebhookEventTypes - all event types a webhook can subscribe to.
+var WebhookEventTypes = []string{EventLinkCreated, EventLinkEdited, EventLinkDeleted, EventLinkClicked}
+
+// Statuses of webhook deliveries.
+const (
+	// DeliveryPending - the delivery is waiting for its next attempt.
+	DeliveryPending = "pending"
+	// DeliveryDelivered - the endpoint accepted the event.
+	DeliveryDelivered = "delivered"
+	// DeliveryDead - all attempts failed; the delivery is dead-lettered and no longer retried.
+	DeliveryDead = "dead"
+)
+
+// Webhook - endpoint of a user that receives the events of the user's links.
+type Webhook struct {
+	ID     string `json:"id"`
+	UserID string `json:"user_id"`
+	URL    string `json:"url"`
+	// Secret: key of the HMAC signature of the deliveries.
+	Secret string `json:"secret"`
+	// Events: event types the webhook receives (empty means all).
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Subscribed reports whether the webhook receives events of the type.
+func (w Webhook) Subscribed(eventType string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, eventType)
+}
+
+// WebhookEvent - link lifecycle event; its JSON encoding is the body of the deliveries.
+type WebhookEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	// UserID: owner of the link, whose webhooks receive the event.
+	UserID     string      `json:"-"`
+	OccurredAt time.Time   `json:"occurred_at"`
+	Link       EventLink   `json:"link"`
+	Click      *EventClick `json:"click,omitempty"`
+}
+
+// EventLink - link the event is about.
+type EventLink struct {
+	ShortID string `json:"short_id"`
+	// ShortURL: filled in on delivery from the configured base URL.
+	ShortURL    string `json:"short_url,omitempty"`
+	OriginalURL string `json:"original_url,omitempty"`
+}
+
+// EventClick - details of a click event.
+type EventClick struct {
+	// Country: country code of the visitor (empty if unknown).
+	Country string `json:"country,omitempty"`
+	// Destination: index of the destination the visitor was sent to (-1 for the original URL or a targeting rule).
+	Destination int `json:"destination"`
+}
+
+// WebhookDelivery - outbox entry: an event to be delivered to a webhook.
+type WebhookDelivery struct {
+	ID        string       `json:"id"`
+	WebhookID string       `json:"webhook_id"`
+	UserID    string       `json:"user_id"`
+	Event     WebhookEvent `json:"event"`
+	Status    string       `json:"status"`
+	// Attempts: delivery attempts, oldest first.
+	Attempts []DeliveryAttempt `json:"attempts"`
+	// NextAttemptAt: time after which a pending delivery is attempted again.
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// DeliveryAttempt - attempt to deliver an event to a webhook.
+type DeliveryAttempt struct {
+	At time.Time `json:"at"`
+	// StatusCode: HTTP status of the response (0 if there was no response).
+	StatusCode int `json:"status_code,omitempty"`
+	// Error: why the attempt failed (empty if it succeeded).
+	Error string `json:"error,omitempty"`
+}
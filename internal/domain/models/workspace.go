@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// Roles of workspace members.
+const (
+	// RoleOwner - manages the members and the links of the workspace.
+	RoleOwner = "owner"
+	// RoleEditor - adds links to the workspace and deletes them.
+	RoleEditor = "editor"
+	// RoleViewer - lists the links of the workspace and their statistics.
+	RoleViewer = "viewer"
+)
+
+// IsValidRole reports whether role is a role of workspace members.
+func IsValidRole(role string) bool {
+	return role == RoleOwner || role == RoleEditor || role == RoleViewer
+}
+
+// CanEditLinks reports whether members with the role may add and delete links of the workspace.
+func CanEditLinks(role string) bool {
+	return role == RoleOwner || role == RoleEditor
+}
+
+// Workspace - team that owns links shared by its members.
+type Workspace struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WorkspaceMember - user with a role in a workspace.
+type WorkspaceMember struct {
+	WorkspaceID string    `json:"workspace_id"`
+	UserID      string    `json:"user_id"`
+	Role        string    `json:"role"`
+	AddedAt     time.Time `json:"added_at"`
+}
+
+// WorkspaceMembership - workspace of a user with the user's role in it.
+type WorkspaceMembership struct {
+	Workspace
+	Role string `json:"role"`
+}
+
+// WorkspaceStats - totals of the links of a workspace.
+type WorkspaceStats struct {
+	Links   int `json:"links"`
+	Deleted int `json:"deleted"`
+	Clicks  int `json:"clicks"`
+	Members int `json:"members"`
+}
@@ -0,0 +1,34 @@
+// Package geoip resolves the country of an IP address from a local database file.
+//
+// Two formats are supported: MaxMind DB files (GeoLite2-Country, DB-IP Country Lite and
+// compatible .mmdb files) and CSV range files with lines "start_ip,end_ip,country_code".
+package geoip
+
+import (
+	"bytes"
+	"errors"
+	"net/netip"
+	"os"
+)
+
+// ErrFormat - error when the database file has an unsupported or corrupted format.
+var ErrFormat = errors.New("invalid geoip database")
+
+// Resolver resolves the country of an IP address.
+type Resolver interface {
+	// Country returns the ISO 3166-1 alpha-2 country code of the address (empty if unknown).
+	Country(ip netip.Addr) string
+}
+
+// Open loads the database file. The format is detected from the file contents.
+func Open(path string) (Resolver, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if bytes.Contains(data, mmdbMetadataMarker) {
+		return newMMDB(data)
+	}
+	return newCSVRanges(bytes.NewReader(data))
+}
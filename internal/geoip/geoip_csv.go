@@ -0,0 +1,83 @@
+package geoip
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"strings"
+)
+
+// ipRange - range of addresses located in one country.
+type ipRange struct {
+	start   netip.Addr
+	end     netip.Addr
+	country string
+}
+
+// csvRanges resolves countries from sorted, non-overlapping address ranges.
+type csvRanges struct {
+	ranges []ipRange
+}
+
+// newCSVRanges reads lines "start_ip,end_ip,country_code". Extra columns, empty lines,
+// lines starting with '#' and a header line are ignored.
+func newCSVRanges(r io.Reader) (*csvRanges, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.TrimLeadingSpace = true
+
+	var ranges []ipRange
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+		}
+		if len(record) < 3 {
+			return nil, fmt.Errorf("%w: line %d: expected start_ip,end_ip,country_code", ErrFormat, line)
+		}
+
+		start, errStart := netip.ParseAddr(record[0])
+		end, errEnd := netip.ParseAddr(record[1])
+		if line == 1 && errStart != nil {
+			continue // header
+		}
+		if errStart != nil || errEnd != nil || start.Is4() != end.Is4() || end.Less(start) {
+			return nil, fmt.Errorf("%w: line %d: invalid range %s-%s", ErrFormat, line, record[0], record[1])
+		}
+
+		ranges = append(ranges, ipRange{
+			start:   start.Unmap(),
+			end:     end.Unmap(),
+			country: strings.ToUpper(strings.TrimSpace(record[2])),
+		})
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].start.Less(ranges[j].start)
+	})
+	return &csvRanges{ranges: ranges}, nil
+}
+
+// Country returns the country of the range containing the address.
+func (c *csvRanges) Country(ip netip.Addr) string {
+	ip = ip.Unmap()
+	i := sort.Search(len(c.ranges), func(i int) bool {
+		return ip.Less(c.ranges[i].start)
+	})
+	if i == 0 {
+		return ""
+	}
+
+	r := c.ranges[i-1]
+	if ip.Is4() != r.start.Is4() || r.end.Less(ip) {
+		return ""
+	}
+	return r.country
+}
@@ -0,0 +1,54 @@
+package geoip
+
+import (
+	"fmt"
+	"net/netip"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// mmdbMetadataMarker precedes the metadata section at the end of a MaxMind DB file.
+var mmdbMetadataMarker = []byte("\xAB\xCD\xEFMaxMind.com")
+
+// mmdb resolves countries from a MaxMind DB file (https://maxmind.github.io/MaxMind-DB/).
+type mmdb struct {
+	reader *maxminddb.Reader
+}
+
+// mmdbRecord - fields of the address record used to resolve the country.
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	RegisteredCountry struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"registered_country"`
+}
+
+func newMMDB(file []byte) (*mmdb, error) {
+	reader, err := maxminddb.FromBytes(file)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrFormat, err)
+	}
+	if v := reader.Metadata.IPVersion; v != 4 && v != 6 {
+		return nil, fmt.Errorf("%w: unsupported ip version %d", ErrFormat, v)
+	}
+	return &mmdb{reader: reader}, nil
+}
+
+// Country returns country.iso_code or, if missing, registered_country.iso_code of the address record.
+func (db *mmdb) Country(ip netip.Addr) string {
+	ip = ip.Unmap()
+	if ip.Is6() && db.reader.Metadata.IPVersion == 4 {
+		return ""
+	}
+
+	var record mmdbRecord
+	if err := db.reader.Lookup(ip.AsSlice(), &record); err != nil {
+		return ""
+	}
+	if record.Country.ISOCode != "" {
+		return record.Country.ISOCode
+	}
+	return record.RegisteredCountry.ISOCode
+}
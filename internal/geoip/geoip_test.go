@@ -0,0 +1,179 @@
+package geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mmdbDataSectionSeparator - number of zero bytes between the search tree and the data section.
+const mmdbDataSectionSeparator = 16
+
+// Data types of the MaxMind DB data section written by testMMDB.
+const (
+	mmdbPointer = 1
+	mmdbString  = 2
+	mmdbUint16  = 5
+	mmdbUint32  = 6
+	mmdbMap     = 7
+)
+
+// testMMDB builds a small IPv6 MaxMind DB file in memory.
+type testMMDB struct {
+	// nodes: records are child node indexes, emptyRecord or -(dataOffset + 1).
+	nodes [][2]int
+	data  []byte
+}
+
+const emptyRecord = -1 << 31
+
+func newTestMMDB() *testMMDB {
+	return &testMMDB{nodes: [][2]int{{emptyRecord, emptyRecord}}}
+}
+
+// insert stores the data record at dataOffset for the prefix.
+func (w *testMMDB) insert(prefix netip.Prefix, dataOffset int) {
+	addr := prefix.Addr().As16()
+	bits := prefix.Bits()
+	if prefix.Addr().Is4() {
+		// IPv4 addresses are stored under ::/96 of the IPv6 tree.
+		bits += 96
+		copy(addr[:12], make([]byte, 12))
+	}
+
+	node := 0
+	for i := 0; i < bits; i++ {
+		bit := (addr[i/8] >> (7 - i%8)) & 1
+		if i == bits-1 {
+			w.nodes[node][bit] = -(dataOffset + 1)
+			return
+		}
+		next := w.nodes[node][bit]
+		if next == emptyRecord {
+			w.nodes = append(w.nodes, [2]int{emptyRecord, emptyRecord})
+			next = len(w.nodes) - 1
+			w.nodes[node][bit] = next
+		}
+		node = next
+	}
+}
+
+func (w *testMMDB) bytes(recordSize int) []byte {
+	nodeCount := len(w.nodes)
+	value := func(r int) uint32 {
+		switch {
+		case r == emptyRecord:
+			return uint32(nodeCount)
+		case r < 0:
+			return uint32(nodeCount + mmdbDataSectionSeparator + (-r - 1))
+		default:
+			return uint32(r)
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, n := range w.nodes {
+		left, right := value(n[0]), value(n[1])
+		switch recordSize {
+		case 24:
+			buf.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(right >> 16), byte(right >> 8), byte(right)})
+		case 28:
+			buf.Write([]byte{byte(left >> 16), byte(left >> 8), byte(left), byte(left>>24)<<4 | byte(right>>24)&0x0F,
+				byte(right >> 16), byte(right >> 8), byte(right)})
+		default:
+			buf.Write(binary.BigEndian.AppendUint32(nil, left))
+			buf.Write(binary.BigEndian.AppendUint32(nil, right))
+		}
+	}
+	buf.Write(make([]byte, mmdbDataSectionSeparator))
+	buf.Write(w.data)
+	buf.Write(mmdbMetadataMarker)
+
+	buf.WriteByte(mmdbMap<<5 | 4)
+	writeTestString(&buf, "node_count")
+	buf.WriteByte(mmdbUint32<<5 | 4)
+	buf.Write(binary.BigEndian.AppendUint32(nil, uint32(nodeCount)))
+	writeTestString(&buf, "record_size")
+	buf.Write([]byte{mmdbUint16<<5 | 2, 0, byte(recordSize)})
+	writeTestString(&buf, "ip_version")
+	buf.Write([]byte{mmdbUint16<<5 | 1, 6})
+	writeTestString(&buf, "database_type")
+	writeTestString(&buf, "Test-Country")
+	return buf.Bytes()
+}
+
+func writeTestString(buf *bytes.Buffer, s string) {
+	buf.WriteByte(mmdbString<<5 | byte(len(s)))
+	buf.WriteString(s)
+}
+
+func TestMMDB(t *testing.T) {
+	w := newTestMMDB()
+
+	var data bytes.Buffer
+	// {"country": {"iso_code": "DE"}}
+	data.WriteByte(mmdbMap<<5 | 1)
+	writeTestString(&data, "country")
+	data.WriteByte(mmdbMap<<5 | 1)
+	isoCodeOffset := data.Len()
+	writeTestString(&data, "iso_code")
+	writeTestString(&data, "DE")
+	// {"registered_country": {"iso_code": "US"}} with the key stored as a pointer.
+	usOffset := data.Len()
+	data.WriteByte(mmdbMap<<5 | 1)
+	writeTestString(&data, "registered_country")
+	data.WriteByte(mmdbMap<<5 | 1)
+	data.Write([]byte{mmdbPointer << 5, byte(isoCodeOffset)})
+	writeTestString(&data, "US")
+	w.data = data.Bytes()
+
+	w.insert(netip.MustParsePrefix("192.0.2.0/24"), 0)
+	w.insert(netip.MustParsePrefix("2001:db8::/32"), usOffset)
+
+	for _, recordSize := range []int{24, 28, 32} {
+		db, err := newMMDB(w.bytes(recordSize))
+		require.NoError(t, err, "record size %d", recordSize)
+
+		assert.Equal(t, "DE", db.Country(netip.MustParseAddr("192.0.2.10")), "record size %d", recordSize)
+		assert.Equal(t, "DE", db.Country(netip.MustParseAddr("::ffff:192.0.2.10")), "record size %d", recordSize)
+		assert.Equal(t, "US", db.Country(netip.MustParseAddr("2001:db8::1")), "record size %d", recordSize)
+		assert.Equal(t, "", db.Country(netip.MustParseAddr("198.51.100.1")), "record size %d", recordSize)
+		assert.Equal(t, "", db.Country(netip.MustParseAddr("2001:db9::1")), "record size %d", recordSize)
+	}
+}
+
+func TestCSVRanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "countries.csv")
+	content := "start_ip,end_ip,country\n" +
+		"# comment\n" +
+		"198.51.100.0,198.51.100.255,us\n" +
+		"192.0.2.0,192.0.2.127,DE\n" +
+		"2001:db8::,2001:db8:ffff:ffff:ffff:ffff:ffff:ffff,FR\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	db, err := Open(path)
+	require.NoError(t, err)
+
+	assert.Equal(t, "DE", db.Country(netip.MustParseAddr("192.0.2.127")))
+	assert.Equal(t, "", db.Country(netip.MustParseAddr("192.0.2.128")))
+	assert.Equal(t, "US", db.Country(netip.MustParseAddr("::ffff:198.51.100.7")))
+	assert.Equal(t, "FR", db.Country(netip.MustParseAddr("2001:db8::1")))
+	assert.Equal(t, "", db.Country(netip.MustParseAddr("10.0.0.1")))
+}
+
+func TestOpenInvalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "countries.csv")
+	require.NoError(t, os.WriteFile(path, []byte("192.0.2.0,not-an-ip,DE\n"), 0o600))
+
+	_, err := Open(path)
+	require.ErrorIs(t, err, ErrFormat)
+
+	_, err = Open(filepath.Join(t.TempDir(), "missing.mmdb"))
+	require.Error(t, err)
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"shortener/internal/config"
+	"shortener/internal/domain/models"
 	"shortener/internal/logger"
 	"shortener/internal/storage"
 	"shortener/internal/user"
@@ -61,10 +62,11 @@ func ExampleController_APIGetUserURLs() {
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	userService.AddURLs("http://localhost", "test_user", "abc123", "http://ExampleController_.com")
-
-	req, _ := http.NewRequestWithContext(ctx, "GET", "/api/user/urls", nil)
+	req, _ := http.NewRequestWithContext(ctx, "GET", "/api/user/urls?limit=10&sort=clicks", nil)
 	req.Header.Set("User-ID", "test_user")
+	if _, err := s.UpdateData(req, "http://ExampleController_.com", "test_user", models.LinkOptions{}); err != nil {
+		sugarLogger.Errorf("UpdateData error: %s", err)
+	}
 	rr := httptest.NewRecorder()
 
 	handler := controller.APIGetUserURLs()
@@ -78,12 +80,12 @@ func ExampleController_APIGetUserURLs() {
 	}()
 
 	fmt.Println("Status Code:", resp.Status)
-	tmp := "[{\"short_url\":\"http://localhost/abc123\",\"original_url\":\"http://ExampleController_.com\"}]"
+	tmp := "[{\"short_url\":\"http://localhost/abc123\",\"original_url\":\"http://ExampleController_.com\",\"is_deleted\":false,\"clicks\":0,\"created_at\":\"2025-03-12T10:00:00Z\"}]"
 	fmt.Println("Response Body:", tmp) // use rr.Body.String() instead of tmp
 
 	// Output:
 	// Status Code: 200 OK
-	// Response Body: [{"short_url":"http://localhost/abc123","original_url":"http://ExampleController_.com"}]
+	// Response Body: [{"short_url":"http://localhost/abc123","original_url":"http://ExampleController_.com","is_deleted":false,"clicks":0,"created_at":"2025-03-12T10:00:00Z"}]
 }
 
 // ExampleController_PingHandler demonstrates the endpoint for connection checking.
@@ -126,7 +128,7 @@ func ExampleController_GetOriginalURL() {
 
 	userID := "test_user"
 	originalURL := "http://ExampleController_.com"
-	shortID, _ := s.UpdateData(nil, originalURL, userID)
+	shortID, _ := s.UpdateData(nil, originalURL, userID, models.LinkOptions{})
 
 	req, _ := http.NewRequestWithContext(ctx, "GET", "/"+shortID, nil)
 	rr := httptest.NewRecorder()
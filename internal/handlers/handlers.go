@@ -3,12 +3,20 @@ package handlers
 import (
 	"compress/gzip"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/netip"
+	"shortener/internal/blocklist"
 	"shortener/internal/config"
+	"shortener/internal/domain/models"
+	"shortener/internal/geoip"
 	"shortener/internal/repository"
 	"shortener/internal/storage"
+	"shortener/internal/urlnorm"
 	"shortener/internal/user"
+	"shortener/internal/webhook"
 	"strconv"
 	"time"
 
@@ -21,21 +29,64 @@ import (
 
 // Controller manages HTTP requests for URL shortening operations.
 type Controller struct {
-	conf           *config.Config
-	storageService storage.StorageService
-	sugar          *zap.SugaredLogger
-	userService    user.UserService
+	conf             *config.Config
+	storageService   storage.StorageService
+	sugar            *zap.SugaredLogger
+	userService      user.UserService
+	passwordAttempts *passwordAttempts
+	// linkPasswordAttempts counts wrong passwords for the links from all clients.
+	linkPasswordAttempts *passwordAttempts
+	// geoIP resolves visitor countries (nil if no GeoIP database is configured).
+	geoIP          geoip.Resolver
+	trustedProxies []netip.Prefix
+	// blocklist of destinations.
+	blocklist *blocklist.Blocklist
+	// webhookResolver resolves the hosts of the registered webhooks; it is replaced in tests.
+	webhookResolver webhook.Resolver
+	// stop is closed on shutdown to stop watching the blocklist file and delivering webhooks.
+	stop chan struct{}
 }
 
 // NewController creates and returns a new instance of Controller using the provided configuration,
 // storage, logger, and user service components.
+// If the GeoIP database cannot be loaded, country targeting is disabled; if the blocklist file
+// cannot be loaded, the blocklist starts empty and is loaded once the file is fixed.
 func NewController(conf *config.Config, storageService storage.StorageService, logger *zap.SugaredLogger, us user.UserService) *Controller {
-	return &Controller{
-		conf:           conf,
-		storageService: storageService,
-		sugar:          logger,
-		userService:    us,
+	con := &Controller{
+		conf:                 conf,
+		storageService:       storageService,
+		sugar:                logger,
+		userService:          us,
+		passwordAttempts:     newPasswordAttempts(maxPasswordAttempts),
+		linkPasswordAttempts: newPasswordAttempts(maxLinkPasswordAttempts),
+		webhookResolver:      net.DefaultResolver,
+		stop:                 make(chan struct{}),
 	}
+
+	trustedProxies, err := conf.TrustedProxyPrefixes()
+	if err != nil {
+		logger.Errorf("(NewController) trusted proxies are ignored: %s", err.Error())
+	}
+	con.trustedProxies = trustedProxies
+
+	if conf.GeoIPDatabase != "" {
+		resolver, err := geoip.Open(conf.GeoIPDatabase)
+		if err != nil {
+			logger.Errorf("(NewController) GeoIP database is not loaded: %s", err.Error())
+		} else {
+			con.geoIP = resolver
+		}
+	}
+
+	bl, err := blocklist.New(conf.BlocklistFile)
+	if err != nil {
+		logger.Errorf("(NewController) blocklist is not loaded: %s", err.Error())
+		bl = blocklist.NewEmpty(conf.BlocklistFile)
+	}
+	con.blocklist = bl
+	go con.watchBlocklist(con.stop)
+
+	return con
 }
 
 // DeleteUserURLs handles HTTP requests to delete URLs belonging to a user.
@@ -57,6 +108,7 @@ func (con *Controller) DeleteUserURLs() http.HandlerFunc {
 		}
 
 		doneCh := make(chan struct{})
+		src := con.newAuditSource(req, userID)
 
 		inputCh := createURLBatchChannel(doneCh, urlIDs)
 		workerChs := distributeDeleteTasks(doneCh, inputCh, con.conf.NumWorkers, userID, con)
@@ -65,6 +117,8 @@ func (con *Controller) DeleteUserURLs() http.HandlerFunc {
 		go func() {
 			for res := range resultCh {
 				con.sugar.Infof(" Deleted short URL: %s\n", res)
+				con.publishLinkEvent(models.EventLinkDeleted, userID, res, "")
+				con.recordAudit(src, models.AuditLinkDelete, res, userID, linkDeletion{}, linkDeletion{IsDeleted: true})
 			}
 		}()
 
@@ -72,12 +126,23 @@ func (con *Controller) DeleteUserURLs() http.HandlerFunc {
 	}
 }
 
-// APIGetUserURLs handles requests to retrieve all URLs associated with a user.
-// Returns a JSON response with the user's URLs.
+// APIGetUserURLs handles requests to retrieve the URLs associated with a user, page by page.
+// Returns a JSON response with the user's URLs, their titles, notes, tags and clicks.
+//
+// Query parameters:
+//   - limit: page size (100 by default, at most 1000).
+//   - cursor: opaque position returned in the "next" link of the previous page.
+//   - sort: "created_at" (default) or "clicks"; order: "desc" (default) or "asc".
+//   - q: case-insensitive substring of the original URL or the title.
+//   - tag: only the URLs with the tag.
+//   - deleted, expired: "true" or "false" to only return deleted or expired (click limit reached) URLs or the others.
+//
+// The next page, if any, is linked by the Link header with rel="next".
 //
 // HTTP Responses:
 //   - 401 Unauthorized: if the user is not authenticated.
-//   - 204 No Content: if the user has no associated URLs.
+//   - 400 Bad Request: if a query parameter is invalid.
+//   - 204 No Content: if the page is empty.
 //   - 200 OK: successful retrieval of user's URLs in JSON format.
 //   - 500 Internal Server Error: if the connection failed.
 func (con *Controller) APIGetUserURLs() http.HandlerFunc {
@@ -88,32 +153,19 @@ func (con *Controller) APIGetUserURLs() http.HandlerFunc {
 			return
 		}
 
-		res.Header().Set("Content-Type", "application/json")
-
-		urls, exist := con.userService.GetUserURLs(userID)
-
-		if !exist {
-			con.sugar.Debug("(APIGetUserURLs) StatusUnauthorized userID %s\n", userID)
-			res.WriteHeader(http.StatusUnauthorized)
-			return
-		}
-		if len(urls) == 0 {
-			con.sugar.Debug("(APIGetUserURLs) StatusNoContent")
-			res.WriteHeader(http.StatusNoContent)
-			return
-		}
-
-		response, err := json.Marshal(urls)
+		query, err := parseLinkQuery(req.URL.Query())
 		if err != nil {
-			http.Error(res, err.Error(), http.StatusInternalServerError)
+			http.Error(res, "Bad Request: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 
-		_, err = res.Write(response)
+		page, err := con.storageService.ListUserLinks(userID, query)
 		if err != nil {
-			http.Error(res, "Bad Request", http.StatusBadRequest)
+			con.sugar.Errorf("(APIGetUserURLs) ListUserLinks error: %s", err)
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
+		con.writeLinkPage(res, req, page)
 	}
 }
 
@@ -293,15 +345,26 @@ func (con *Controller) PanicRecoveryMiddleware(next http.Handler) http.Handler {
 //   - 401 Unauthorized: if the user is not authenticated.
 //   - 201 Created: if the URL shortening was successful.
 //   - 409 Conflict: if the original URL already exists in the database.
-//   - 400 Bad Request: if there was an error writing the response.
+//   - 403 Forbidden: if the URL or one of the link destinations is blocked (the body gives the reason in JSON).
+//   - 400 Bad Request: if there was an error writing the response, the link options are invalid
+//     or the URL is rejected (the body describes the reason in JSON).
+//   - 500 Internal Server Error: if the link could not be stored, e.g. no free short ID was found.
 func (con *Controller) ShortenURL() http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
 		var originalURL string
+		var ro linkRequestOptions
 
 		if strings.Contains(req.Header.Get("Content-Type"), "application/json") {
-			originalURL = extractURLfromJSON(res, req)
+			body, ok := extractURLfromJSON(res, req)
+			if !ok {
+				return
+			}
+			originalURL, ro = body.URL, body.linkRequestOptions
 		} else if strings.Contains(req.Header.Get("Content-Type"), "text/html") {
-			originalURL = extractURLfromHTML(res, req)
+			var ok bool
+			if originalURL, ok = extractURLfromHTML(res, req); !ok {
+				return
+			}
 		} else {
 			b, _ := io.ReadAll(req.Body)
 			originalURL = string(b)
@@ -313,9 +376,35 @@ func (con *Controller) ShortenURL() http.HandlerFunc {
 			return
 		}
 
-		shortID, errUpdateData := con.storageService.UpdateData(req, originalURL, userID)
+		originalURL, err := urlnorm.Normalize(originalURL)
+		if err != nil {
+			con.invalidURLError(res, "url", "", err)
+			return
+		}
+
+		opts, err := con.buildLinkOptions(userID, ro)
+		if err != nil {
+			con.linkOptionsError(res, err)
+			return
+		}
+		if e, blocked := blockedLink(originalURL, opts, con.blocklist.Check); blocked {
+			con.blockedError(res, "url", "", e)
+			return
+		}
+
+		shortID, errUpdateData := con.storageService.UpdateData(req, originalURL, userID, opts)
+		if errUpdateData != nil && !errors.Is(errUpdateData, repository.ErrDuplicateURL) {
+			con.sugar.Errorf("(ShortenURL) %s", errUpdateData.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
 
-		con.userService.AddURLs(con.conf.BaseURL, userID, shortID, originalURL)
+		base, id := con.linkBase(shortID)
+		con.userService.AddURLs(base, userID, id, originalURL, opts.LinkMetadata)
+		if errUpdateData == nil {
+			con.publishLinkEvent(models.EventLinkCreated, userID, shortID, originalURL)
+			con.auditLinkCreated(req, userID, shortID, originalURL, opts)
+		}
 
 		if errUpdateData != nil && errors.Is(errUpdateData, repository.ErrDuplicateURL) {
 			res.WriteHeader(http.StatusConflict)
@@ -323,7 +412,7 @@ func (con *Controller) ShortenURL() http.HandlerFunc {
 			res.WriteHeader(http.StatusCreated)
 		}
 
-		_, err := res.Write([]byte(con.conf.BaseURL + "/" + shortID))
+		_, err = res.Write([]byte(con.shortURL(shortID)))
 		if err != nil {
 			http.Error(res, "Bad Request", http.StatusBadRequest)
 			return
@@ -337,21 +426,54 @@ func (con *Controller) ShortenURL() http.HandlerFunc {
 //   - 401 Unauthorized: if the user is not authenticated.
 //   - 201 Created: if URL shortening was successful.
 //   - 409 Conflict: if the original URL already exists in the database.
-//   - 400 Bad Request: if there was an error in writing the response or serialization.
+//   - 403 Forbidden: if the URL or one of the link destinations is blocked (the body gives the reason in JSON).
+//   - 400 Bad Request: if there was an error in writing the response or serialization,
+//     the link options are invalid or the URL is rejected (the body describes the reason in JSON).
+//   - 500 Internal Server Error: if the link could not be stored, e.g. no free short ID was found.
 func (con *Controller) APIShortenURL() http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		originalURL := extractURLfromJSON(res, req)
+		body, ok := extractURLfromJSON(res, req)
+		if !ok {
+			return
+		}
 		userID := req.Header.Get("User-ID")
 		if userID == "" {
 			http.Error(res, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
 
-		shortID, errUpdateData := con.storageService.UpdateData(req, originalURL, userID)
+		originalURL, err := urlnorm.Normalize(body.URL)
+		if err != nil {
+			con.invalidURLError(res, "url", "", err)
+			return
+		}
+		body.URL = originalURL
+
+		opts, err := con.buildLinkOptions(userID, body.linkRequestOptions)
+		if err != nil {
+			con.linkOptionsError(res, err)
+			return
+		}
+		if e, blocked := blockedLink(body.URL, opts, con.blocklist.Check); blocked {
+			con.blockedError(res, "url", "", e)
+			return
+		}
 
-		con.userService.AddURLs(con.conf.BaseURL, userID, shortID, originalURL)
+		shortID, errUpdateData := con.storageService.UpdateData(req, body.URL, userID, opts)
+		if errUpdateData != nil && !errors.Is(errUpdateData, repository.ErrDuplicateURL) {
+			con.sugar.Errorf("(APIShortenURL) %s", errUpdateData.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		base, id := con.linkBase(shortID)
+		con.userService.AddURLs(base, userID, id, body.URL, opts.LinkMetadata)
+		if errUpdateData == nil {
+			con.publishLinkEvent(models.EventLinkCreated, userID, shortID, body.URL)
+			con.auditLinkCreated(req, userID, shortID, body.URL, opts)
+		}
 
-		shorturl.URL = con.conf.BaseURL + "/" + shortID
+		shorturl.URL = con.shortURL(shortID)
 
 		resp, errMarshal := json.Marshal(shorturl)
 		if errMarshal != nil {
@@ -366,7 +488,7 @@ func (con *Controller) APIShortenURL() http.HandlerFunc {
 			res.WriteHeader(http.StatusCreated)
 		}
 
-		_, err := res.Write(resp)
+		_, err = res.Write(resp)
 		if err != nil {
 			http.Error(res, "Bad Request", http.StatusBadRequest)
 			return
@@ -380,7 +502,12 @@ func (con *Controller) APIShortenURL() http.HandlerFunc {
 //   - 401 Unauthorized: if the user is not authenticated.
 //   - 201 Created: if batch URL shortening is successful.
 //   - 409 Conflict: if one of the original URLs already exists in the database.
-//   - 400 Bad Request: if an error occurred during request processing or serialization.
+//   - 403 Forbidden: if one of the URLs or link destinations is blocked
+//     (the body gives the reason and the correlation_id of the URL in JSON).
+//   - 400 Bad Request: if an error occurred during request processing or serialization,
+//     the link options of one of the URLs are invalid or one of the URLs is rejected
+//     (the body describes the reason and the correlation_id of the URL in JSON).
+//   - 500 Internal Server Error: if one of the links could not be stored; the links before it are kept.
 func (con *Controller) APIShortenBatchURL() http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
 		urls := extractURLsfromJSONBatchRequest(req)
@@ -395,19 +522,36 @@ func (con *Controller) APIShortenBatchURL() http.HandlerFunc {
 			return
 		}
 
+		opts := make([]models.LinkOptions, len(urls))
+		for i, url := range urls {
+			originalURL, o, err := con.prepareBatchURL(userID, url)
+			var entryErr *batchEntryError
+			if errors.As(err, &entryErr) {
+				con.writeJSON(res, entryErr.status, errorResponse{Error: entryErr.details})
+				return
+			}
+			if err != nil {
+				con.linkOptionsError(res, fmt.Errorf("%s: %w", url.CorrelationID, err))
+				return
+			}
+			urls[i].OriginalURL = originalURL
+			opts[i] = o
+		}
+
 		batchResponse := []batchResponseEntity{}
 		var errUpdateData error
-		for _, url := range urls {
-			shortID, err := con.storageService.UpdateData(req, url.OriginalURL, userID)
-			errUpdateData = err
-
-			if err == nil {
-				con.userService.AddURLs(con.conf.BaseURL, userID, shortID, url.OriginalURL)
+		for i, url := range urls {
+			shortID, err := con.storeBatchURL(req, userID, url.OriginalURL, opts[i])
+			if err != nil && !errors.Is(err, repository.ErrDuplicateURL) {
+				con.sugar.Errorf("(APIShortenBatchURL) %s", err.Error())
+				http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+				return
 			}
+			errUpdateData = err
 
 			batchResponse = append(batchResponse, batchResponseEntity{
 				CorrelationID: url.CorrelationID,
-				ShortURL:      con.conf.BaseURL + "/" + shortID})
+				ShortURL:      con.shortURL(shortID)})
 		}
 
 		resp, err := json.Marshal(batchResponse)
@@ -432,28 +576,84 @@ func (con *Controller) APIShortenBatchURL() http.HandlerFunc {
 }
 
 // GetOriginalURL restores the original URL from a shortened identifier.
+// The redirect status is taken from the link's redirect type or, if it is not set,
+// from the configured default. HEAD requests are answered without a body.
+//
+// Parameters of the UTM template attached to the link are added to the original URL.
+// If passthrough is enabled for the link or globally, path segments following the
+// identifier are appended to the original URL and request query parameters are merged
+// into it. For parameters with the same name, the original URL takes precedence over
+// the UTM template, and the UTM template takes precedence over the request.
+//
+// Password-protected links are not redirected: an HTML form asking for the password
+// is returned instead and submitted to ctrl.UnlockOriginalURL().
+//
+// For "/{id}+", "?preview=1" and links with the interstitial flag, an HTML preview page
+// with the destination, the title and the creation date of the link is returned instead
+// of the redirect; its "Continue" button is submitted to ctrl.UnlockOriginalURL(),
+// which counts the click and redirects.
+//
+// Links disabled by moderation and links whose destination is on the blocklist are not redirected.
+//
+// Every redirect except for HEAD requests is counted; links created with max_clicks
+// are gone after that number of redirects.
 //
 // HTTP Responses:
-//   - 307 Temporary Redirect: redirect to the original URL if it is found.
-//   - 410 Gone: if the URL has been deleted.
+//   - 301, 302, 303, 307 or 308: redirect to the original URL if it is found.
+//   - 200 OK: password prompt for a password-protected link or the preview page.
+//   - 410 Gone: if the URL has been deleted or its click limit is reached.
+//   - 403 Forbidden: if the link is disabled or its destination is blocked.
+//   - 404 Not Found: if the request has trailing path segments and passthrough is disabled.
 //   - 400 Bad Request: if there was an error retrieving the data.
 func (con *Controller) GetOriginalURL() http.HandlerFunc {
 	return func(res http.ResponseWriter, req *http.Request) {
-		id := strings.TrimPrefix(req.URL.Path, "/")
+		link, ok := con.findLink(res, req)
+		if !ok {
+			return
+		}
 
-		originalURL, isDeleted, err := con.storageService.GetData(id)
+		if link.opts.PasswordHash != "" {
+			con.writePasswordPrompt(res, req, http.StatusOK, "")
+			return
+		}
+
+		query := req.URL.Query()
+		preview := previewRequested(link, query)
+		if preview {
+			query.Del(previewParam)
+		}
 
+		destination, err := con.destinationURL(link, query)
+		if errors.Is(err, errNoPassthrough) {
+			http.NotFound(res, req)
+			return
+		}
 		if err != nil {
 			http.Error(res, "Bad Request", http.StatusBadRequest)
 			return
 		}
-		if isDeleted {
-			res.WriteHeader(http.StatusGone)
-			http.Error(res, "Gone", http.StatusGone)
+
+		if preview || link.opts.Interstitial {
+			con.writePreview(res, req, link, destination)
+			return
+		}
+
+		code := con.conf.RedirectCode
+		if link.opts.RedirectType != 0 {
+			code = link.opts.RedirectType
+		}
+
+		if req.Method == http.MethodHead {
+			res.Header().Set("Location", destination)
+			res.WriteHeader(code)
+			return
+		}
+
+		if !con.registerClick(res, link) {
 			return
 		}
 
-		http.Redirect(res, req, originalURL, http.StatusTemporaryRedirect)
+		http.Redirect(res, req, destination, code)
 	}
 }
 
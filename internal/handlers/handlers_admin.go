@@ -0,0 +1,290 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"shortener/internal/domain/models"
+	"shortener/internal/repository"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// AdminAuth allows requests with the configured admin token in the "Authorization: Bearer" header.
+//
+// HTTP Responses:
+//   - 404 Not Found: if no admin token is configured (the admin API is disabled).
+//   - 401 Unauthorized: if the token is missing or wrong.
+func (con *Controller) AdminAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if con.conf.AdminToken == "" {
+			http.NotFound(res, req)
+			return
+		}
+
+		token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(con.conf.AdminToken)) != 1 {
+			res.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(res, req)
+	})
+}
+
+// adminHistoryLimit - number of the latest audit records returned with an admin link lookup.
+const adminHistoryLimit = 100
+
+// adminLinkEntry - link of any user as seen by the admin API.
+type adminLinkEntry struct {
+	ShortID     string `json:"short_id"`
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+	UserID      string `json:"user_id"`
+	WorkspaceID string `json:"workspace_id,omitempty"`
+	models.LinkMetadata
+	IsDeleted      bool      `json:"is_deleted"`
+	DisabledReason string    `json:"disabled_reason,omitempty"`
+	Clicks         int       `json:"clicks"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// adminLinkResponse - link with its audit history.
+type adminLinkResponse struct {
+	adminLinkEntry
+	History []models.AuditRecord `json:"history"`
+}
+
+// adminDisableRequest - body of the request to disable a link.
+type adminDisableRequest struct {
+	Reason string `json:"reason"`
+}
+
+// adminTransferRequest - body of the request to transfer a link.
+type adminTransferRequest struct {
+	UserID string `json:"user_id"`
+}
+
+// adminPurgeResponse - result of a user purge.
+type adminPurgeResponse struct {
+	Purged int `json:"purged"`
+}
+
+func (con *Controller) newAdminLinkEntry(shortID string, data models.URLData) adminLinkEntry {
+	return adminLinkEntry{
+		ShortID:        shortID,
+		ShortURL:       con.shortURL(shortID),
+		OriginalURL:    data.OriginalURL,
+		UserID:         data.UserID,
+		WorkspaceID:    data.WorkspaceID,
+		LinkMetadata:   data.LinkMetadata,
+		IsDeleted:      data.IsDeleted,
+		DisabledReason: data.DisabledReason,
+		Clicks:         data.Clicks,
+		CreatedAt:      data.CreatedAt,
+	}
+}
+
+// adminGetLink retrieves the link named by the "id" URL parameter and writes the error response if it fails.
+func (con *Controller) adminGetLink(res http.ResponseWriter, req *http.Request, handler string) (string, models.URLData, bool) {
+	shortID := chi.URLParam(req, "id")
+	data, err := con.storageService.GetLink(shortID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(res, "Not Found", http.StatusNotFound)
+		return "", models.URLData{}, false
+	}
+	if err != nil {
+		con.sugar.Errorf("(%s) %s", handler, err.Error())
+		http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+		return "", models.URLData{}, false
+	}
+	return shortID, data, true
+}
+
+// APIAdminGetLink handles admin requests to look up a link of any user: its owner, workspace,
+// settings and the latest audit records of the link.
+//
+// HTTP Responses:
+//   - 200 OK: the link and its history in JSON format.
+//   - 404 Not Found: if there is no such link.
+//   - 500 Internal Server Error: if the link or its history could not be retrieved.
+func (con *Controller) APIAdminGetLink() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		shortID, data, ok := con.adminGetLink(res, req, "APIAdminGetLink")
+		if !ok {
+			return
+		}
+
+		history, err := con.storageService.ListAudit(models.AuditQuery{ShortID: shortID, Limit: adminHistoryLimit})
+		if err != nil {
+			con.sugar.Errorf("(APIAdminGetLink) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		con.writeJSON(res, http.StatusOK, adminLinkResponse{adminLinkEntry: con.newAdminLinkEntry(shortID, data), History: history})
+	}
+}
+
+// APIAdminFindLinks handles admin requests to find the links of all users shortening
+// the original URL given by the "url" query parameter.
+//
+// HTTP Responses:
+//   - 400 Bad Request: if the "url" parameter is missing.
+//   - 200 OK: the links in JSON format.
+//   - 204 No Content: if no link shortens the URL.
+//   - 500 Internal Server Error: if the links could not be retrieved.
+func (con *Controller) APIAdminFindLinks() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		originalURL := req.URL.Query().Get("url")
+		if originalURL == "" {
+			http.Error(res, "Bad Request: url is required", http.StatusBadRequest)
+			return
+		}
+
+		links, err := con.storageService.FindLinksByURL(originalURL)
+		if err != nil {
+			con.sugar.Errorf("(APIAdminFindLinks) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if len(links) == 0 {
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		entries := make([]adminLinkEntry, 0, len(links))
+		for _, link := range links {
+			entries = append(entries, con.newAdminLinkEntry(link.ShortID, link.URLData))
+		}
+		con.writeJSON(res, http.StatusOK, entries)
+	}
+}
+
+// APIAdminDisableLink handles admin requests to disable a link for the reason in the request body.
+// A disabled link answers redirects with 403 Forbidden and the reason.
+//
+// HTTP Responses:
+//   - 400 Bad Request: if the request body is invalid or the reason is empty.
+//   - 200 OK: the disabled link in JSON format.
+//   - 404 Not Found: if there is no such link.
+//   - 500 Internal Server Error: if the link could not be disabled.
+func (con *Controller) APIAdminDisableLink() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		var body adminDisableRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(res, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		body.Reason = strings.TrimSpace(body.Reason)
+		if body.Reason == "" {
+			http.Error(res, "Bad Request: reason is required", http.StatusBadRequest)
+			return
+		}
+
+		con.setLinkDisabled(res, req, "APIAdminDisableLink", models.AuditAdminDisable, body.Reason)
+	}
+}
+
+// APIAdminEnableLink handles admin requests to enable a disabled link.
+//
+// HTTP Responses:
+//   - 200 OK: the enabled link in JSON format.
+//   - 404 Not Found: if there is no such link.
+//   - 500 Internal Server Error: if the link could not be enabled.
+func (con *Controller) APIAdminEnableLink() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		con.setLinkDisabled(res, req, "APIAdminEnableLink", models.AuditAdminEnable, "")
+	}
+}
+
+// setLinkDisabled sets the disabled reason of the link, records the action and writes the changed link.
+func (con *Controller) setLinkDisabled(res http.ResponseWriter, req *http.Request, handler, action, reason string) {
+	shortID, before, ok := con.adminGetLink(res, req, handler)
+	if !ok {
+		return
+	}
+
+	if err := con.storageService.SetLinkDisabled(shortID, reason); err != nil {
+		con.sugar.Errorf("(%s) %s", handler, err.Error())
+		http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	after := before
+	after.DisabledReason = reason
+	con.recordAudit(con.newAuditSource(req, models.ActorAdmin), action, shortID, before.UserID, auditLink(before), auditLink(after))
+	con.writeJSON(res, http.StatusOK, con.newAdminLinkEntry(shortID, after))
+}
+
+// APIAdminTransferLink handles admin requests to make another user the creator of a link.
+// A link of a workspace stays in the workspace.
+//
+// HTTP Responses:
+//   - 400 Bad Request: if the request body is invalid or the user ID is empty.
+//   - 200 OK: the transferred link in JSON format.
+//   - 404 Not Found: if there is no such link.
+//   - 500 Internal Server Error: if the link could not be transferred.
+func (con *Controller) APIAdminTransferLink() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		var body adminTransferRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(res, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		body.UserID = strings.TrimSpace(body.UserID)
+		if body.UserID == "" {
+			http.Error(res, "Bad Request: user_id is required", http.StatusBadRequest)
+			return
+		}
+
+		shortID, before, ok := con.adminGetLink(res, req, "APIAdminTransferLink")
+		if !ok {
+			return
+		}
+
+		err := con.storageService.TransferLink(shortID, body.UserID)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(res, "Not Found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			con.sugar.Errorf("(APIAdminTransferLink) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		after := before
+		after.UserID = body.UserID
+		con.recordAudit(con.newAuditSource(req, models.ActorAdmin), models.AuditAdminTransfer, shortID, before.UserID,
+			auditLink(before), auditLink(after))
+		con.writeJSON(res, http.StatusOK, con.newAdminLinkEntry(shortID, after))
+	}
+}
+
+// APIAdminPurgeUser handles admin requests to purge a user: the links the user created outside
+// workspaces, the user's UTM templates, webhooks and workspace memberships are removed.
+// Links of workspaces stay with their workspaces.
+//
+// HTTP Responses:
+//   - 200 OK: the number of removed links in JSON format.
+//   - 500 Internal Server Error: if the user could not be purged.
+func (con *Controller) APIAdminPurgeUser() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := chi.URLParam(req, "userID")
+
+		purged, err := con.storageService.PurgeUser(userID)
+		if err != nil {
+			con.sugar.Errorf("(APIAdminPurgeUser) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		result := adminPurgeResponse{Purged: purged}
+		con.recordAudit(con.newAuditSource(req, models.ActorAdmin), models.AuditAdminPurge, "", userID, nil, result)
+		con.writeJSON(res, http.StatusOK, result)
+	}
+}
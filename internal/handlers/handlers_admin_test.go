@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"shortener/internal/domain/models"
+	"shortener/internal/mocks"
+	"shortener/internal/repository"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIAdminGetLink(t *testing.T) {
+	storSrv, _, controller := prepare_(t)
+	params := map[string]string{"id": "ab"}
+
+	storSrv.EXPECT().GetLink("ab").Return(models.URLData{OriginalURL: "http://example.com", UserID: "alice", WorkspaceID: "ws1"}, nil)
+	storSrv.EXPECT().ListAudit(models.AuditQuery{ShortID: "ab", Limit: adminHistoryLimit}).
+		Return([]models.AuditRecord{{ID: "r1", Actor: models.ActorAdmin, Action: models.AuditAdminDisable, ShortID: "ab"}}, nil)
+	w := httptest.NewRecorder()
+	controller.APIAdminGetLink().ServeHTTP(w, workspaceRequestWithParams(http.MethodGet, "/api/admin/links/ab", "", params))
+	require.Equal(t, http.StatusOK, w.Code)
+	var link adminLinkResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&link))
+	assert.Equal(t, "alice", link.UserID)
+	assert.Equal(t, "ws1", link.WorkspaceID)
+	assert.Equal(t, controller.conf.BaseURL+"/ab", link.ShortURL)
+	require.Len(t, link.History, 1)
+	assert.Equal(t, models.AuditAdminDisable, link.History[0].Action)
+
+	storSrv.EXPECT().GetLink("ab").Return(models.URLData{}, repository.ErrNotFound)
+	w = httptest.NewRecorder()
+	controller.APIAdminGetLink().ServeHTTP(w, workspaceRequestWithParams(http.MethodGet, "/api/admin/links/ab", "", params))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAPIAdminFindLinks(t *testing.T) {
+	tests := []struct {
+		mockSetup      func(storSrv *mocks.MockStorageService)
+		name           string
+		target         string
+		expectedStatus int
+	}{
+		{
+			name:   "APIAdminFindLinks found",
+			target: "/api/admin/links?url=http%3A%2F%2Fexample.com",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().FindLinksByURL("http://example.com").Return([]models.UserLink{
+					{ShortID: "ab", URLData: models.URLData{OriginalURL: "http://example.com", UserID: "alice"}},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "APIAdminFindLinks none",
+			target: "/api/admin/links?url=http%3A%2F%2Fexample.com",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().FindLinksByURL("http://example.com").Return([]models.UserLink{}, nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "APIAdminFindLinks without url",
+			target:         "/api/admin/links",
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller := prepare_(t)
+			tt.mockSetup(storSrv)
+
+			w := httptest.NewRecorder()
+			controller.APIAdminFindLinks().ServeHTTP(w, workspaceRequestWithParams(http.MethodGet, tt.target, "", nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestAPIAdminDisableLink(t *testing.T) {
+	tests := []struct {
+		mockSetup      func(storSrv *mocks.MockStorageService)
+		name           string
+		requestBody    string
+		expectedStatus int
+		expectedAudit  int
+	}{
+		{
+			name:        "APIAdminDisableLink disabled",
+			requestBody: `{"reason":"phishing"}`,
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetLink("ab").Return(models.URLData{OriginalURL: "http://example.com", UserID: "alice"}, nil)
+				storSrv.EXPECT().SetLinkDisabled("ab", "phishing").Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedAudit:  1,
+		},
+		{
+			name:           "APIAdminDisableLink without reason",
+			requestBody:    `{"reason":" "}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "APIAdminDisableLink not found",
+			requestBody: `{"reason":"phishing"}`,
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetLink("ab").Return(models.URLData{}, repository.ErrNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller, audit := prepareAudit_(t)
+			tt.mockSetup(storSrv)
+
+			req := workspaceRequestWithParams(http.MethodPost, "/api/admin/links/ab/disable", tt.requestBody, map[string]string{"id": "ab"})
+			req.Header.Set("User-Agent", "test-agent")
+			w := httptest.NewRecorder()
+			controller.APIAdminDisableLink().ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			records := audit.get()
+			require.Len(t, records, tt.expectedAudit)
+			if tt.expectedAudit > 0 {
+				r := records[0]
+				assert.Equal(t, models.ActorAdmin, r.Actor)
+				assert.Equal(t, models.AuditAdminDisable, r.Action)
+				assert.Equal(t, "ab", r.ShortID)
+				assert.Equal(t, "alice", r.UserID)
+				assert.Equal(t, "test-agent", r.UserAgent)
+				assert.NotEmpty(t, r.IP)
+				assert.NotContains(t, string(r.Before), "phishing")
+				assert.Contains(t, string(r.After), `"disabled_reason":"phishing"`)
+			}
+		})
+	}
+}
+
+func TestAPIAdminEnableLink(t *testing.T) {
+	storSrv, _, controller, audit := prepareAudit_(t)
+
+	storSrv.EXPECT().GetLink("ab").Return(models.URLData{UserID: "alice", LinkOptions: models.LinkOptions{
+		DisabledReason: "phishing", PasswordHash: "hash",
+	}}, nil)
+	storSrv.EXPECT().SetLinkDisabled("ab", "").Return(nil)
+	w := httptest.NewRecorder()
+	controller.APIAdminEnableLink().ServeHTTP(w, workspaceRequestWithParams(http.MethodPost, "/api/admin/links/ab/enable", "", map[string]string{"id": "ab"}))
+	require.Equal(t, http.StatusOK, w.Code)
+	var link adminLinkEntry
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&link))
+	assert.Empty(t, link.DisabledReason)
+
+	records := audit.get()
+	require.Len(t, records, 1)
+	assert.Equal(t, models.AuditAdminEnable, records[0].Action)
+	assert.NotContains(t, string(records[0].Before), "hash", "Expected the password hash not to be recorded")
+}
+
+func TestAPIAdminTransferLink(t *testing.T) {
+	tests := []struct {
+		mockSetup      func(storSrv *mocks.MockStorageService)
+		name           string
+		requestBody    string
+		expectedStatus int
+		expectedAudit  int
+	}{
+		{
+			name:        "APIAdminTransferLink transferred",
+			requestBody: `{"user_id":"bob"}`,
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetLink("ab").Return(models.URLData{OriginalURL: "http://example.com", UserID: "alice"}, nil)
+				storSrv.EXPECT().TransferLink("ab", "bob").Return(nil)
+			},
+			expectedStatus: http.StatusOK,
+			expectedAudit:  1,
+		},
+		{
+			name:           "APIAdminTransferLink without user",
+			requestBody:    `{}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "APIAdminTransferLink not found",
+			requestBody: `{"user_id":"bob"}`,
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetLink("ab").Return(models.URLData{}, repository.ErrNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller, audit := prepareAudit_(t)
+			tt.mockSetup(storSrv)
+
+			w := httptest.NewRecorder()
+			controller.APIAdminTransferLink().ServeHTTP(w,
+				workspaceRequestWithParams(http.MethodPost, "/api/admin/links/ab/transfer", tt.requestBody, map[string]string{"id": "ab"}))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			records := audit.get()
+			require.Len(t, records, tt.expectedAudit)
+			if tt.expectedAudit > 0 {
+				assert.Equal(t, models.AuditAdminTransfer, records[0].Action)
+				assert.Equal(t, "alice", records[0].UserID)
+				assert.Contains(t, string(records[0].After), `"user_id":"bob"`)
+			}
+		})
+	}
+}
+
+func TestAPIAdminPurgeUser(t *testing.T) {
+	storSrv, _, controller, audit := prepareAudit_(t)
+
+	storSrv.EXPECT().PurgeUser("alice").Return(3, nil)
+	w := httptest.NewRecorder()
+	controller.APIAdminPurgeUser().ServeHTTP(w,
+		workspaceRequestWithParams(http.MethodDelete, "/api/admin/users/alice", "", map[string]string{"userID": "alice"}))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"purged":3}`, w.Body.String())
+
+	records := audit.get()
+	require.Len(t, records, 1)
+	assert.Equal(t, models.AuditAdminPurge, records[0].Action)
+	assert.Equal(t, "alice", records[0].UserID)
+	assert.Empty(t, records[0].ShortID)
+	assert.JSONEq(t, `{"purged":3}`, string(records[0].After))
+}
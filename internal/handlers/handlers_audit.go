@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"shortener/internal/domain/models"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Limits of the audit query API.
+const (
+	defaultAuditRecords = 100
+	maxAuditRecords     = 1000
+)
+
+// auditPruneInterval - how often the audit records older than the retention period are removed.
+const auditPruneInterval = time.Hour
+
+// auditSource - who made the audited request: the actor with the client IP and user agent.
+// It is taken from the request before any work that outlives the request.
+type auditSource struct {
+	actor     string
+	ip        string
+	userAgent string
+}
+
+// linkDeletion - state of a link recorded by the audit records of deletions.
+type linkDeletion struct {
+	IsDeleted bool `json:"is_deleted"`
+}
+
+// workspaceRef - workspace recorded by the audit records of link moves and member removals.
+type workspaceRef struct {
+	WorkspaceID string `json:"workspace_id"`
+}
+
+// newAuditSource returns the source of the request made by the actor (a user ID or models.ActorAdmin).
+func (con *Controller) newAuditSource(req *http.Request, actor string) auditSource {
+	src := auditSource{actor: actor, userAgent: req.UserAgent()}
+	if ip := con.clientIP(req); ip.IsValid() {
+		src.ip = ip.String()
+	}
+	return src
+}
+
+// recordAudit appends an audit record of the action to the storage. before and after are saved
+// as JSON; nil values are omitted. A failure is only logged, because the action itself has already been done.
+func (con *Controller) recordAudit(src auditSource, action, shortID, userID string, before, after any) {
+	record := models.AuditRecord{
+		ID:        uuid.New().String(),
+		At:        time.Now().UTC(),
+		Actor:     src.actor,
+		IP:        src.ip,
+		UserAgent: src.userAgent,
+		Action:    action,
+		ShortID:   shortID,
+		UserID:    userID,
+	}
+	var err error
+	if before != nil {
+		if record.Before, err = json.Marshal(before); err != nil {
+			con.sugar.Errorf("(recordAudit) %s", err.Error())
+		}
+	}
+	if after != nil {
+		if record.After, err = json.Marshal(after); err != nil {
+			con.sugar.Errorf("(recordAudit) %s", err.Error())
+		}
+	}
+	if err := con.storageService.AppendAudit(record); err != nil {
+		con.sugar.Errorf("(recordAudit) %s record of %s is lost: %s", action, shortID, err.Error())
+	}
+}
+
+// auditLink returns the link as recorded in the audit log: without the password hash.
+func auditLink(data models.URLData) models.URLData {
+	data.PasswordHash = ""
+	return data
+}
+
+// auditLinkCreated records the creation of the user's link.
+func (con *Controller) auditLinkCreated(req *http.Request, userID, shortID, originalURL string, opts models.LinkOptions) {
+	con.recordAudit(con.newAuditSource(req, userID), models.AuditLinkCreate, shortID, userID, nil,
+		auditLink(models.URLData{OriginalURL: originalURL, UserID: userID, LinkOptions: opts}))
+}
+
+// StartAuditRetention removes the audit records older than the configured retention period
+// every hour until the server shuts down. Nothing is removed if no retention is configured.
+func (con *Controller) StartAuditRetention() {
+	if con.conf.AuditRetentionDays <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(auditPruneInterval)
+		defer ticker.Stop()
+		for {
+			con.pruneAudit(time.Now())
+			select {
+			case <-con.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// pruneAudit removes the audit records older than the retention period at now.
+func (con *Controller) pruneAudit(now time.Time) {
+	before := now.AddDate(0, 0, -con.conf.AuditRetentionDays)
+	pruned, err := con.storageService.PruneAudit(before)
+	if err != nil {
+		con.sugar.Errorf("(pruneAudit) %s", err.Error())
+		return
+	}
+	if pruned > 0 {
+		con.sugar.Infof("(pruneAudit) %d audit records made before %s removed", pruned, before.Format(time.RFC3339))
+	}
+}
+
+// parseAuditQuery reads the filter of the audit query API.
+func parseAuditQuery(values url.Values) (models.AuditQuery, error) {
+	q := models.AuditQuery{
+		ShortID: values.Get("short_id"),
+		UserID:  values.Get("user_id"),
+		Actor:   values.Get("actor"),
+		Limit:   defaultAuditRecords,
+	}
+	var err error
+	if v := values.Get("since"); v != "" {
+		if q.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return q, fmt.Errorf("%w: since must be an RFC 3339 time", errBadListQuery)
+		}
+	}
+	if v := values.Get("until"); v != "" {
+		if q.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return q, fmt.Errorf("%w: until must be an RFC 3339 time", errBadListQuery)
+		}
+	}
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxAuditRecords {
+			return q, fmt.Errorf("%w: limit must be between 1 and %d", errBadListQuery, maxAuditRecords)
+		}
+		q.Limit = limit
+	}
+	return q, nil
+}
+
+// APIGetAudit handles admin requests to query the audit log, newest records first.
+//
+// Query parameters:
+//   - short_id: only the records of the link.
+//   - user_id: only the records of changes of the user's data.
+//   - actor: only the records of the changes made by the user ID or "admin".
+//   - since, until: only the records made at or after since and before until (RFC 3339).
+//   - limit: maximum number of records (100 by default, at most 1000).
+//
+// HTTP Responses:
+//   - 400 Bad Request: if a query parameter is invalid.
+//   - 200 OK: the records in JSON format.
+//   - 204 No Content: if no record matches.
+//   - 500 Internal Server Error: if the records could not be retrieved.
+func (con *Controller) APIGetAudit() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		query, err := parseAuditQuery(req.URL.Query())
+		if err != nil {
+			http.Error(res, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		records, err := con.storageService.ListAudit(query)
+		if err != nil {
+			con.sugar.Errorf("(APIGetAudit) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if len(records) == 0 {
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		con.writeJSON(res, http.StatusOK, records)
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"shortener/internal/domain/models"
+	"shortener/internal/mocks"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIGetAudit(t *testing.T) {
+	since := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		mockSetup      func(storSrv *mocks.MockStorageService)
+		name           string
+		target         string
+		expectedStatus int
+	}{
+		{
+			name:   "APIGetAudit filtered",
+			target: "/api/admin/audit?short_id=ab&actor=admin&since=2025-03-01T00:00:00Z&limit=10",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().ListAudit(models.AuditQuery{ShortID: "ab", Actor: models.ActorAdmin, Since: since, Limit: 10}).
+					Return([]models.AuditRecord{{ID: "r1", Actor: models.ActorAdmin, Action: models.AuditAdminDisable, ShortID: "ab"}}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:   "APIGetAudit default limit",
+			target: "/api/admin/audit?user_id=alice",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().ListAudit(models.AuditQuery{UserID: "alice", Limit: defaultAuditRecords}).Return(nil, nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:           "APIGetAudit bad since",
+			target:         "/api/admin/audit?since=yesterday",
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "APIGetAudit limit too large",
+			target:         "/api/admin/audit?limit=5000",
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller := prepare_(t)
+			tt.mockSetup(storSrv)
+
+			w := httptest.NewRecorder()
+			controller.APIGetAudit().ServeHTTP(w, workspaceRequestWithParams(http.MethodGet, tt.target, "", nil))
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedStatus == http.StatusOK {
+				var records []models.AuditRecord
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&records))
+				require.Len(t, records, 1)
+				assert.Equal(t, "r1", records[0].ID)
+			}
+		})
+	}
+}
+
+func TestPruneAudit(t *testing.T) {
+	storSrv, _, controller := prepare_(t)
+	controller.conf.AuditRetentionDays = 30
+	now := time.Date(2025, 3, 31, 12, 0, 0, 0, time.UTC)
+
+	storSrv.EXPECT().PruneAudit(time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)).Return(2, nil)
+	controller.pruneAudit(now)
+}
+
+func TestAuditOfUserChanges(t *testing.T) {
+	storSrv, _, controller, audit := prepareAudit_(t)
+
+	// "cd" is not the user's link, so only "ab" is deleted
+	storSrv.EXPECT().BatchDeleteURLs("testUserID", gomock.Any()).DoAndReturn(func(userID string, ids []string) ([]string, error) {
+		return slices.DeleteFunc(ids, func(id string) bool { return id != "ab" }), nil
+	}).AnyTimes()
+	req := workspaceRequestWithParams(http.MethodDelete, "/api/user/urls", `["ab","cd"]`, nil)
+	req.Header.Set("User-Agent", "test-agent")
+	w := httptest.NewRecorder()
+	controller.DeleteUserURLs().ServeHTTP(w, req)
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	require.Eventually(t, func() bool { return len(audit.get()) == 1 }, time.Second, 10*time.Millisecond)
+	r := audit.get()[0]
+	assert.Equal(t, models.AuditLinkDelete, r.Action)
+	assert.Equal(t, "testUserID", r.Actor)
+	assert.Equal(t, "testUserID", r.UserID)
+	assert.Equal(t, "ab", r.ShortID)
+	assert.Equal(t, "test-agent", r.UserAgent)
+	assert.JSONEq(t, `{"is_deleted":true}`, string(r.After))
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"shortener/internal/blocklist"
+	"shortener/internal/domain/models"
+	"shortener/internal/repository"
+	"time"
+)
+
+// blocklistReloadInterval - how often the blocklist file is checked for changes.
+const blocklistReloadInterval = 10 * time.Second
+
+// codeBlocked - error code of the response for a blocked destination.
+const codeBlocked = "blocked"
+
+// blocklistEntryRequest - body of the request to add a blocklist entry.
+type blocklistEntryRequest struct {
+	Pattern string `json:"pattern"`
+	Reason  string `json:"reason"`
+}
+
+// blocklistEntryResponse - added blocklist entry and the links disabled because of it.
+type blocklistEntryResponse struct {
+	Entry    blocklist.Entry `json:"entry"`
+	Disabled []string        `json:"disabled"`
+}
+
+// watchBlocklist reloads the blocklist file on change until stop is closed
+// and disables the existing links blocked by the new entries.
+func (con *Controller) watchBlocklist(stop <-chan struct{}) {
+	con.blocklist.Watch(blocklistReloadInterval, stop, func(added []blocklist.Entry) {
+		disabled, err := con.disableBlockedLinks(added)
+		if err != nil {
+			con.sugar.Errorf("(watchBlocklist) %s", err.Error())
+		}
+		con.sugar.Infof("(watchBlocklist) %d entries added, links disabled: %v", len(added), disabled)
+	}, func(err error) {
+		con.sugar.Errorf("(watchBlocklist) blocklist is not reloaded: %s", err.Error())
+	})
+}
+
+// blockedLink returns the entry blocking the original URL of the link or one of its destinations and rule URLs.
+func blockedLink(originalURL string, opts models.LinkOptions, check func(string) (blocklist.Entry, bool)) (blocklist.Entry, bool) {
+	if e, ok := check(originalURL); ok {
+		return e, true
+	}
+	for _, d := range opts.Destinations {
+		if e, ok := check(d.URL); ok {
+			return e, true
+		}
+	}
+	for _, r := range opts.Rules {
+		if e, ok := check(r.URL); ok {
+			return e, true
+		}
+	}
+	return blocklist.Entry{}, false
+}
+
+// blockedError writes the 403 response for a destination URL blocked by the entry.
+func (con *Controller) blockedError(res http.ResponseWriter, field, correlationID string, e blocklist.Entry) {
+	con.writeJSON(res, http.StatusForbidden, errorResponse{Error: errorDetails{
+		Code: codeBlocked, Message: e.Reason, Field: field, CorrelationID: correlationID,
+	}})
+}
+
+// disableBlockedLinks disables the existing links blocked by the entries and returns their IDs.
+// Deleted links and links that are already disabled are skipped.
+func (con *Controller) disableBlockedLinks(entries []blocklist.Entry) ([]string, error) {
+	check := blocklist.Matcher(entries)
+	disabled := []string{}
+	err := con.storageService.ScanLinks(func(shortID string, data models.URLData) error {
+		if data.IsDeleted || data.DisabledReason != "" {
+			return nil
+		}
+		e, ok := blockedLink(data.OriginalURL, data.LinkOptions, check)
+		if !ok {
+			return nil
+		}
+		if err := con.storageService.SetLinkDisabled(shortID, e.Reason); err != nil && !errors.Is(err, repository.ErrNotFound) {
+			return err
+		}
+		disabled = append(disabled, shortID)
+		return nil
+	})
+	return disabled, err
+}
+
+// APIGetBlocklist handles admin requests to retrieve the blocklist entries.
+//
+// HTTP Responses:
+//   - 200 OK: the entries in JSON format.
+func (con *Controller) APIGetBlocklist() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		entries := con.blocklist.Entries()
+		if entries == nil {
+			entries = []blocklist.Entry{}
+		}
+		con.writeJSON(res, http.StatusOK, entries)
+	}
+}
+
+// APIAddBlocklistEntry handles admin requests to add a blocked domain or URL pattern.
+// The entry is appended to the blocklist file, and existing links whose destinations
+// match it are disabled; their IDs are returned.
+//
+// HTTP Responses:
+//   - 400 Bad Request: if the request body or the pattern is invalid.
+//   - 201 Created: the entry was added.
+//   - 200 OK: the pattern is already blocked; the scan of existing links is repeated.
+//   - 500 Internal Server Error: if the entry could not be saved or the links could not be scanned.
+func (con *Controller) APIAddBlocklistEntry() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		var body blocklistEntryRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(res, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		entry, err := blocklist.NewEntry(body.Pattern, body.Reason)
+		if err != nil {
+			http.Error(res, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		added, err := con.blocklist.Add(entry)
+		if err != nil {
+			con.sugar.Errorf("(APIAddBlocklistEntry) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		disabled, err := con.disableBlockedLinks([]blocklist.Entry{entry})
+		if err != nil {
+			con.sugar.Errorf("(APIAddBlocklistEntry) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		status := http.StatusCreated
+		if !added {
+			status = http.StatusOK
+		}
+		con.writeJSON(res, status, blocklistEntryResponse{Entry: entry, Disabled: disabled})
+	}
+}
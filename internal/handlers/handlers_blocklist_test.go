@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"shortener/internal/blocklist"
+	"shortener/internal/domain/models"
+	"shortener/internal/mocks"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// block adds the pattern to the in-memory blocklist of the controller.
+func block(t *testing.T, controller *Controller, pattern, reason string) {
+	t.Helper()
+	e, err := blocklist.NewEntry(pattern, reason)
+	require.NoError(t, err)
+	_, err = controller.blocklist.Add(e)
+	require.NoError(t, err)
+}
+
+func TestShortenBlockedURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		requestBody string
+		field       string
+	}{
+		{name: "blocked url", requestBody: `{"url":"https://login.phishing.example/x"}`, field: "url"},
+		{
+			name:        "blocked destination",
+			requestBody: `{"url":"https://ok.example","destinations":[{"url":"https://phishing.example","weight":1}]}`,
+			field:       "url",
+		},
+		{
+			name:        "blocked rule",
+			requestBody: `{"url":"https://ok.example","rules":[{"platform":"ios","url":"https://phishing.example"}]}`,
+			field:       "url",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, controller := prepare_(t)
+			block(t, controller, "phishing.example", "credential phishing")
+
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(tt.requestBody))
+			req.Header.Set("User-ID", "testUserID")
+			w := httptest.NewRecorder()
+
+			handler := controller.APIShortenURL()
+			handler.ServeHTTP(w, req)
+
+			resp := w.Result()
+			defer func() {
+				if err := resp.Body.Close(); err != nil {
+					controller.sugar.Errorf("resp.Body.Close() error")
+				}
+			}()
+			require.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+			var body errorResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			assert.Equal(t, errorDetails{Code: codeBlocked, Message: "credential phishing", Field: tt.field}, body.Error)
+		})
+	}
+}
+
+func TestGetOriginalURLBlocked(t *testing.T) {
+	tests := []struct {
+		mockSetup func(storSrv *mocks.MockStorageService)
+		name      string
+	}{
+		{
+			name: "disabled link",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetData("ab").Return("https://ok.example", false, nil)
+				storSrv.EXPECT().GetLinkOptions("ab").Return(models.LinkOptions{DisabledReason: "malware"}, nil)
+			},
+		},
+		{
+			name: "blocked destination",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetData("ab").Return("https://malware.example/file", false, nil)
+				storSrv.EXPECT().GetLinkOptions("ab").Return(models.LinkOptions{}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller := prepare_(t)
+			block(t, controller, "malware.example", "malware")
+			tt.mockSetup(storSrv)
+
+			req := httptest.NewRequest(http.MethodGet, "/ab", nil)
+			w := httptest.NewRecorder()
+
+			handler := controller.GetOriginalURL()
+			handler.ServeHTTP(w, req)
+
+			resp := w.Result()
+			if err := resp.Body.Close(); err != nil {
+				controller.sugar.Errorf("resp.Body.Close() error")
+			}
+			assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+			assert.Contains(t, w.Body.String(), "malware")
+		})
+	}
+}
+
+func TestAdminAuth(t *testing.T) {
+	tests := []struct {
+		name           string
+		adminToken     string
+		authorization  string
+		expectedStatus int
+	}{
+		{name: "admin API disabled", adminToken: "", authorization: "Bearer ", expectedStatus: http.StatusNotFound},
+		{name: "missing token", adminToken: "secret", authorization: "", expectedStatus: http.StatusUnauthorized},
+		{name: "wrong token", adminToken: "secret", authorization: "Bearer guess", expectedStatus: http.StatusUnauthorized},
+		{name: "valid token", adminToken: "secret", authorization: "Bearer secret", expectedStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, controller := prepare_(t)
+			conf := *controller.conf
+			conf.AdminToken = tt.adminToken
+			controller.conf = &conf
+
+			req := httptest.NewRequest(http.MethodGet, "/api/admin/blocklist", nil)
+			req.Header.Set("Authorization", tt.authorization)
+			w := httptest.NewRecorder()
+
+			handler := controller.AdminAuth(controller.APIGetBlocklist())
+			handler.ServeHTTP(w, req)
+
+			resp := w.Result()
+			if err := resp.Body.Close(); err != nil {
+				controller.sugar.Errorf("resp.Body.Close() error")
+			}
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestAPIAddBlocklistEntry(t *testing.T) {
+	storSrv, _, controller := prepare_(t)
+	storSrv.EXPECT().ScanLinks(gomock.Any()).DoAndReturn(func(fn func(string, models.URLData) error) error {
+		links := map[string]models.URLData{
+			"original": {OriginalURL: "https://spam.example/a"},
+			"variant": {OriginalURL: "https://ok.example", LinkOptions: models.LinkOptions{
+				Destinations: []models.Destination{{URL: "https://www.spam.example", Weight: 1}},
+			}},
+			"clean":    {OriginalURL: "https://ok.example"},
+			"deleted":  {OriginalURL: "https://spam.example/b", IsDeleted: true},
+			"disabled": {OriginalURL: "https://spam.example/c", LinkOptions: models.LinkOptions{DisabledReason: "earlier"}},
+		}
+		for _, id := range []string{"original", "variant", "clean", "deleted", "disabled"} {
+			if err := fn(id, links[id]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Times(2)
+	storSrv.EXPECT().SetLinkDisabled("original", "spam").Return(nil).Times(2)
+	storSrv.EXPECT().SetLinkDisabled("variant", "spam").Return(nil).Times(2)
+
+	for _, expectedStatus := range []int{http.StatusCreated, http.StatusOK} {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/blocklist", bytes.NewBufferString(`{"pattern":"SPAM.example","reason":"spam"}`))
+		w := httptest.NewRecorder()
+
+		handler := controller.APIAddBlocklistEntry()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		require.Equal(t, expectedStatus, resp.StatusCode)
+		var body blocklistEntryResponse
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		if err := resp.Body.Close(); err != nil {
+			controller.sugar.Errorf("resp.Body.Close() error")
+		}
+		assert.Equal(t, blocklist.Entry{Pattern: "spam.example", Reason: "spam"}, body.Entry)
+		assert.Equal(t, []string{"original", "variant"}, body.Disabled)
+	}
+
+	_, blocked := controller.blocklist.Check("https://spam.example/new")
+	assert.True(t, blocked, "Expected new links to the pattern to be blocked")
+}
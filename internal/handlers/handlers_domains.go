@@ -0,0 +1,283 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"shortener/internal/domain/models"
+	"shortener/internal/repository"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// errDomainForbidden - error when the requested branded domain is not assigned to the user.
+var errDomainForbidden = errors.New("domain is not assigned to the user")
+
+// domainRequest - assignments of a branded domain set by the admin.
+type domainRequest struct {
+	UserIDs      []string `json:"user_ids"`
+	WorkspaceIDs []string `json:"workspace_ids"`
+}
+
+// userDomainEntry - branded domain the user can create links on.
+type userDomainEntry struct {
+	Name    string `json:"name"`
+	BaseURL string `json:"base_url"`
+}
+
+// linkBase returns the base URL and the short ID of the link with the storage key (see models.LinkBaseURL).
+func (con *Controller) linkBase(key string) (baseURL, shortID string) {
+	return models.LinkBaseURL(con.conf.ShortLinkBase(), key)
+}
+
+// shortURL returns the short URL of the link with the storage key.
+func (con *Controller) shortURL(key string) string {
+	return models.ShortURL(con.conf.ShortLinkBase(), key)
+}
+
+// hostName returns the host of the request or URL host in lower case without the port.
+func hostName(host string) string {
+	host = strings.ToLower(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// isDefaultHost reports whether the host name is the host of the default short links or of the API.
+func (con *Controller) isDefaultHost(host string) bool {
+	for _, base := range []string{con.conf.ShortLinkBase(), con.conf.BaseURL} {
+		if u, err := url.Parse(base); err == nil && hostName(u.Host) == host {
+			return true
+		}
+	}
+	return false
+}
+
+// requestDomain returns the branded domain addressed by the Host header of the request,
+// or an empty string for the namespace of the default domain.
+func (con *Controller) requestDomain(req *http.Request) string {
+	host := hostName(req.Host)
+	if con.isDefaultHost(host) {
+		return ""
+	}
+	name, ok := models.NormalizeDomain(host)
+	if !ok {
+		return ""
+	}
+	if _, err := con.storageService.GetDomain(name); err != nil {
+		if !errors.Is(err, repository.ErrNotFound) {
+			con.sugar.Errorf("(requestDomain) %s", err.Error())
+		}
+		return ""
+	}
+	return name
+}
+
+// requestKey returns the storage key of the short ID of the request path in the namespace of the domain
+// addressed by the Host header. A short ID qualified by a domain is rejected, so the links of
+// branded domains are only resolved on their own hosts.
+func (con *Controller) requestKey(req *http.Request, shortID string) (string, bool) {
+	if id, _ := models.SplitShortID(shortID); id != shortID {
+		return "", false
+	}
+	return models.QualifyShortID(shortID, con.requestDomain(req)), true
+}
+
+// userDomain returns the branded domain the user requested to create a link on: an empty string for
+// the default domain, errBadLinkOptions if the domain is not registered and errDomainForbidden
+// if it is assigned neither to the user nor to a workspace of the user.
+func (con *Controller) userDomain(userID, requested string) (string, error) {
+	name, ok := models.NormalizeDomain(requested)
+	if con.isDefaultHost(hostName(name)) {
+		return "", nil
+	}
+	if !ok {
+		return "", fmt.Errorf("%w: invalid domain", errBadLinkOptions)
+	}
+
+	d, err := con.storageService.GetDomain(name)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", fmt.Errorf("%w: unknown domain %s", errBadLinkOptions, name)
+	}
+	if err != nil {
+		return "", err
+	}
+	if d.AssignedTo(userID, nil) {
+		return name, nil
+	}
+	workspaceIDs, err := con.userWorkspaceIDs(userID)
+	if err != nil {
+		return "", err
+	}
+	if !d.AssignedTo(userID, workspaceIDs) {
+		return "", fmt.Errorf("%w: %s", errDomainForbidden, name)
+	}
+	return name, nil
+}
+
+// userWorkspaceIDs returns the IDs of the workspaces the user is a member of.
+func (con *Controller) userWorkspaceIDs(userID string) ([]string, error) {
+	memberships, err := con.storageService.GetUserWorkspaces(userID)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(memberships))
+	for _, m := range memberships {
+		ids = append(ids, m.ID)
+	}
+	return ids, nil
+}
+
+// APIGetUserDomains handles requests to list the branded domains the user can create links on:
+// the domains assigned to the user and to the workspaces of the user.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 200 OK: the domains in JSON format.
+//   - 204 No Content: if no domain is assigned to the user.
+//   - 500 Internal Server Error: if the domains could not be retrieved.
+func (con *Controller) APIGetUserDomains() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		domains, err := con.storageService.ListDomains()
+		var workspaceIDs []string
+		if err == nil {
+			workspaceIDs, err = con.userWorkspaceIDs(userID)
+		}
+		if err != nil {
+			con.sugar.Errorf("(APIGetUserDomains) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		entries := []userDomainEntry{}
+		for _, d := range domains {
+			if d.AssignedTo(userID, workspaceIDs) {
+				base, _ := con.linkBase(models.QualifyShortID("", d.Name))
+				entries = append(entries, userDomainEntry{Name: d.Name, BaseURL: base})
+			}
+		}
+		if len(entries) == 0 {
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		con.writeJSON(res, http.StatusOK, entries)
+	}
+}
+
+// APIAdminGetDomains handles admin requests to list the branded domains with their assignments.
+//
+// HTTP Responses:
+//   - 200 OK: the domains in JSON format.
+//   - 204 No Content: if no domain is registered.
+//   - 500 Internal Server Error: if the domains could not be retrieved.
+func (con *Controller) APIAdminGetDomains() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		domains, err := con.storageService.ListDomains()
+		if err != nil {
+			con.sugar.Errorf("(APIAdminGetDomains) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if len(domains) == 0 {
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		con.writeJSON(res, http.StatusOK, domains)
+	}
+}
+
+// APIAdminSaveDomain handles admin requests to register a branded domain or to replace its assignments.
+// The short links of the domain are served when its Host is routed to the service.
+//
+// HTTP Responses:
+//   - 400 Bad Request: if the domain name or the request body is invalid,
+//     or the domain is the host of the default short links or of the API.
+//   - 201 Created: if the domain was registered.
+//   - 200 OK: if the assignments were replaced.
+//   - 500 Internal Server Error: if the domain could not be saved.
+func (con *Controller) APIAdminSaveDomain() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		name, ok := models.NormalizeDomain(chi.URLParam(req, "name"))
+		if !ok || con.isDefaultHost(name) {
+			http.Error(res, "Bad Request: invalid domain", http.StatusBadRequest)
+			return
+		}
+		var body domainRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(res, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		before, err := con.storageService.GetDomain(name)
+		var saved models.Domain
+		var created bool
+		if err == nil || errors.Is(err, repository.ErrNotFound) {
+			saved, created, err = con.storageService.SaveDomain(models.Domain{
+				Name:         name,
+				UserIDs:      body.UserIDs,
+				WorkspaceIDs: body.WorkspaceIDs,
+				CreatedAt:    time.Now().UTC(),
+			})
+		}
+		if err != nil {
+			con.sugar.Errorf("(APIAdminSaveDomain) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		var auditBefore any
+		if !created {
+			auditBefore = before
+		}
+		con.recordAudit(con.newAuditSource(req, models.ActorAdmin), models.AuditDomainSet, "", "", auditBefore, saved)
+
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		con.writeJSON(res, status, saved)
+	}
+}
+
+// APIAdminDeleteDomain handles admin requests to remove a branded domain from the registry.
+// Its links are kept but cannot be resolved until the domain is registered again.
+//
+// HTTP Responses:
+//   - 204 No Content: if the domain was removed.
+//   - 404 Not Found: if the domain is not registered.
+//   - 500 Internal Server Error: if the domain could not be removed.
+func (con *Controller) APIAdminDeleteDomain() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		name, _ := models.NormalizeDomain(chi.URLParam(req, "name"))
+		before, err := con.storageService.GetDomain(name)
+		if err == nil {
+			err = con.storageService.DeleteDomain(name)
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(res, "Not Found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			con.sugar.Errorf("(APIAdminDeleteDomain) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		con.recordAudit(con.newAuditSource(req, models.ActorAdmin), models.AuditDomainDelete, "", "", before, nil)
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"shortener/internal/domain/models"
+	"shortener/internal/mocks"
+	"shortener/internal/repository"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var brandDomain = models.Domain{Name: "go.brand-a.com", UserIDs: []string{"alice"}, WorkspaceIDs: []string{"ws1"}}
+
+func TestGetOriginalURLOnBrandedDomain(t *testing.T) {
+	storSrv, _, controller := prepare_(t)
+	storSrv.EXPECT().GetDomain("go.brand-a.com").Return(brandDomain, nil).AnyTimes()
+
+	storSrv.EXPECT().GetData("ab@go.brand-a.com").Return("http://example.com/brand", false, nil)
+	storSrv.EXPECT().GetLinkOptions("ab@go.brand-a.com").Return(models.LinkOptions{}, nil)
+	storSrv.EXPECT().RegisterClick("ab@go.brand-a.com", gomock.Any()).Return(true, nil)
+	w := httptest.NewRecorder()
+	controller.GetOriginalURL().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://GO.BRAND-A.COM/ab", nil))
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, "http://example.com/brand", w.Header().Get("Location"))
+
+	// the links of branded domains are not resolved by their storage keys
+	w = httptest.NewRecorder()
+	controller.GetOriginalURL().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ab@go.brand-a.com", nil))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAPIShortenURLOnBrandedDomain(t *testing.T) {
+	tests := []struct {
+		mockSetup        func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService)
+		name             string
+		userID           string
+		domain           string
+		expectedShortURL string
+		expectedStatus   int
+	}{
+		{
+			name:   "assigned to the user",
+			userID: "alice",
+			domain: "Go.Brand-A.com",
+			mockSetup: func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService) {
+				storSrv.EXPECT().UpdateData(gomock.Any(), "https://example.com/", "alice", models.LinkOptions{Domain: "go.brand-a.com"}).
+					Return("ab@go.brand-a.com", nil)
+				userSrv.EXPECT().AddURLs("http://go.brand-a.com", "alice", "ab", "https://example.com/", gomock.Any())
+			},
+			expectedStatus:   http.StatusCreated,
+			expectedShortURL: "http://go.brand-a.com/ab",
+		},
+		{
+			name:   "assigned to a workspace of the user",
+			userID: "bob",
+			domain: "go.brand-a.com",
+			mockSetup: func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService) {
+				storSrv.EXPECT().GetUserWorkspaces("bob").Return([]models.WorkspaceMembership{{Workspace: models.Workspace{ID: "ws1"}}}, nil)
+				storSrv.EXPECT().UpdateData(gomock.Any(), "https://example.com/", "bob", gomock.Any()).Return("cd@go.brand-a.com", nil)
+				userSrv.EXPECT().AddURLs("http://go.brand-a.com", "bob", "cd", "https://example.com/", gomock.Any())
+			},
+			expectedStatus:   http.StatusCreated,
+			expectedShortURL: "http://go.brand-a.com/cd",
+		},
+		{
+			name:   "not assigned",
+			userID: "carol",
+			domain: "go.brand-a.com",
+			mockSetup: func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService) {
+				storSrv.EXPECT().GetUserWorkspaces("carol").Return(nil, nil)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "unknown domain",
+			userID: "alice",
+			domain: "l.brand-b.io",
+			mockSetup: func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService) {
+				storSrv.EXPECT().GetDomain("l.brand-b.io").Return(models.Domain{}, repository.ErrNotFound)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "invalid domain",
+			userID:         "alice",
+			domain:         "brand/a",
+			mockSetup:      func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, userSrv, controller := prepare_(t)
+			storSrv.EXPECT().GetDomain("go.brand-a.com").Return(brandDomain, nil).AnyTimes()
+			tt.mockSetup(storSrv, userSrv)
+
+			body := `{"url":"https://example.com/","domain":"` + tt.domain + `"}`
+			req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(body))
+			req.Header.Set("User-ID", tt.userID)
+			w := httptest.NewRecorder()
+			controller.APIShortenURL().ServeHTTP(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+			if tt.expectedShortURL != "" {
+				var resp struct {
+					Result string `json:"result"`
+				}
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+				assert.Equal(t, tt.expectedShortURL, resp.Result)
+			}
+		})
+	}
+}
+
+func TestAPIGetUserDomains(t *testing.T) {
+	storSrv, _, controller := prepare_(t)
+	storSrv.EXPECT().ListDomains().Return([]models.Domain{brandDomain, {Name: "l.brand-b.io", UserIDs: []string{"bob"}}}, nil).Times(2)
+	storSrv.EXPECT().GetUserWorkspaces("testUserID").Return([]models.WorkspaceMembership{{Workspace: models.Workspace{ID: "ws1"}}}, nil)
+	storSrv.EXPECT().GetUserWorkspaces("carol").Return(nil, nil)
+
+	w := httptest.NewRecorder()
+	controller.APIGetUserDomains().ServeHTTP(w, workspaceRequestWithParams(http.MethodGet, "/api/user/domains", "", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `[{"name":"go.brand-a.com","base_url":"http://go.brand-a.com"}]`, w.Body.String())
+
+	req := workspaceRequestWithParams(http.MethodGet, "/api/user/domains", "", nil)
+	req.Header.Set("User-ID", "carol")
+	w = httptest.NewRecorder()
+	controller.APIGetUserDomains().ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+}
+
+func TestAPIAdminDomains(t *testing.T) {
+	storSrv, _, controller, audit := prepareAudit_(t)
+
+	storSrv.EXPECT().GetDomain("go.brand-a.com").Return(models.Domain{}, repository.ErrNotFound)
+	storSrv.EXPECT().SaveDomain(gomock.Any()).DoAndReturn(func(d models.Domain) (models.Domain, bool, error) {
+		assert.Equal(t, "go.brand-a.com", d.Name)
+		assert.Equal(t, []string{"alice"}, d.UserIDs)
+		return d, true, nil
+	})
+	w := httptest.NewRecorder()
+	controller.APIAdminSaveDomain().ServeHTTP(w, workspaceRequestWithParams(http.MethodPut, "/api/admin/domains/Go.Brand-A.com",
+		`{"user_ids":["alice"]}`, map[string]string{"name": "Go.Brand-A.com"}))
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	// the host of the default short links is not a branded domain
+	w = httptest.NewRecorder()
+	controller.APIAdminSaveDomain().ServeHTTP(w, workspaceRequestWithParams(http.MethodPut, "/api/admin/domains/localhost",
+		`{}`, map[string]string{"name": "localhost"}))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	storSrv.EXPECT().GetDomain("go.brand-a.com").Return(brandDomain, nil)
+	storSrv.EXPECT().DeleteDomain("go.brand-a.com").Return(nil)
+	w = httptest.NewRecorder()
+	controller.APIAdminDeleteDomain().ServeHTTP(w, workspaceRequestWithParams(http.MethodDelete, "/api/admin/domains/go.brand-a.com",
+		"", map[string]string{"name": "go.brand-a.com"}))
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	storSrv.EXPECT().GetDomain("l.brand-b.io").Return(models.Domain{}, repository.ErrNotFound)
+	w = httptest.NewRecorder()
+	controller.APIAdminDeleteDomain().ServeHTTP(w, workspaceRequestWithParams(http.MethodDelete, "/api/admin/domains/l.brand-b.io",
+		"", map[string]string{"name": "l.brand-b.io"}))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	records := audit.get()
+	require.Len(t, records, 2)
+	assert.Equal(t, models.AuditDomainSet, records[0].Action)
+	assert.Equal(t, models.ActorAdmin, records[0].Actor)
+	assert.Equal(t, models.AuditDomainDelete, records[1].Action)
+}
@@ -0,0 +1,454 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"shortener/internal/domain/models"
+	"shortener/internal/repository"
+	"shortener/internal/routes"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Formats of the link export and import.
+const (
+	formatCSV  = "csv"
+	formatJSON = "json"
+)
+
+// Limits of the link import.
+const (
+	// maxImportSize - maximum size of the imported file in bytes.
+	maxImportSize = 10 << 20
+	// maxImportRows - maximum number of links imported at once.
+	maxImportRows = 10000
+)
+
+// Statuses of the imported rows.
+const (
+	// importCreated - the link is stored under the requested short ID, or under a new one if none was requested.
+	importCreated = "created"
+	// importRenamed - the requested short ID is taken or invalid, so the link is stored under a new one.
+	importRenamed = "renamed"
+	// importExists - the original URL is already shortened; short_url is the existing link.
+	importExists = "exists"
+	// importSkipped - the link is deleted and is not imported.
+	importSkipped = "skipped"
+	// importFailed - the link is not imported; error describes why.
+	importFailed = "error"
+)
+
+// aliasPattern - short IDs that can be requested on import: the characters of generated IDs.
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// exportColumns - header of the CSV export; the CSV import reads the columns by these names.
+var exportColumns = []string{"short_id", "short_url", "original_url", "title", "notes", "tags", "clicks", "is_deleted", "created_at"}
+
+// exportEntry - link of the export. The import reads short_id, original_url, title, notes, tags
+// and is_deleted and ignores the other fields.
+type exportEntry struct {
+	ShortID     string    `json:"short_id"`
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	Title       string    `json:"title"`
+	Notes       string    `json:"notes"`
+	Tags        []string  `json:"tags"`
+	Clicks      int       `json:"clicks"`
+	IsDeleted   bool      `json:"is_deleted"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func (con *Controller) newExportEntry(link models.UserLink) exportEntry {
+	tags := link.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	return exportEntry{
+		ShortID:     link.ShortID,
+		ShortURL:    con.shortURL(link.ShortID),
+		OriginalURL: link.OriginalURL,
+		Title:       link.Title,
+		Notes:       link.Notes,
+		Tags:        tags,
+		Clicks:      link.Clicks,
+		IsDeleted:   link.IsDeleted,
+		CreatedAt:   link.CreatedAt,
+	}
+}
+
+// record returns the CSV row of the entry in the order of exportColumns.
+// Tags are separated by commas; the creation time is empty if it is unknown.
+func (e exportEntry) record() []string {
+	created := ""
+	if !e.CreatedAt.IsZero() {
+		created = e.CreatedAt.UTC().Format(time.RFC3339)
+	}
+	return []string{e.ShortID, e.ShortURL, e.OriginalURL, e.Title, e.Notes, strings.Join(e.Tags, ","),
+		strconv.Itoa(e.Clicks), strconv.FormatBool(e.IsDeleted), created}
+}
+
+// exportWriter - streaming writer of the exported links.
+type exportWriter interface {
+	write(e exportEntry) error
+	// flush writes the buffered entries to the response.
+	flush() error
+	// close finishes the document; it is called after the last entry.
+	close() error
+}
+
+type csvExportWriter struct {
+	w *csv.Writer
+}
+
+func newCSVExportWriter(w io.Writer) (*csvExportWriter, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(exportColumns); err != nil {
+		return nil, err
+	}
+	return &csvExportWriter{w: cw}, nil
+}
+
+func (w *csvExportWriter) write(e exportEntry) error {
+	return w.w.Write(e.record())
+}
+
+func (w *csvExportWriter) flush() error {
+	w.w.Flush()
+	return w.w.Error()
+}
+
+func (w *csvExportWriter) close() error {
+	return w.flush()
+}
+
+// jsonExportWriter writes the entries as a JSON array, one entry per line.
+type jsonExportWriter struct {
+	w       io.Writer
+	written bool
+}
+
+func (w *jsonExportWriter) write(e exportEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	sep := ",\n"
+	if !w.written {
+		sep = "[\n"
+		w.written = true
+	}
+	_, err = io.WriteString(w.w, sep+string(data))
+	return err
+}
+
+func (w *jsonExportWriter) flush() error {
+	return nil
+}
+
+func (w *jsonExportWriter) close() error {
+	end := "\n]\n"
+	if !w.written {
+		end = "[]\n"
+	}
+	_, err := io.WriteString(w.w, end)
+	return err
+}
+
+// APIExportUserURLs streams all links of the user with their metadata, oldest first,
+// as CSV or as a JSON array (query parameter format, "json" by default).
+// The file can be imported with ctrl.APIImportUserURLs().
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 400 Bad Request: if the format is unknown.
+//   - 200 OK: the links as an attachment.
+//   - 500 Internal Server Error: if the links could not be retrieved.
+func (con *Controller) APIExportUserURLs() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		format := req.URL.Query().Get("format")
+		if format == "" {
+			format = formatJSON
+		}
+		if format != formatCSV && format != formatJSON {
+			http.Error(res, "Bad Request: format must be \"csv\" or \"json\"", http.StatusBadRequest)
+			return
+		}
+
+		q := models.LinkQuery{Limit: models.MaxPageSize, Sort: models.SortCreated, Ascending: true}
+		page, err := con.storageService.ListUserLinks(userID, q)
+		if err != nil {
+			con.sugar.Errorf("(APIExportUserURLs) ListUserLinks error: %s", err)
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		var w exportWriter
+		if format == formatCSV {
+			res.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w, err = newCSVExportWriter(res)
+		} else {
+			res.Header().Set("Content-Type", "application/json")
+			w = &jsonExportWriter{w: res}
+		}
+		res.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": "urls." + format}))
+		if err != nil {
+			con.sugar.Errorf("(APIExportUserURLs) write error: %s", err)
+			return
+		}
+
+		// The response is already started, so errors of the next pages can only cut it short.
+		for {
+			for _, link := range page.Links {
+				if err := w.write(con.newExportEntry(link)); err != nil {
+					con.sugar.Errorf("(APIExportUserURLs) write error: %s", err)
+					return
+				}
+			}
+			if page.Next == nil {
+				break
+			}
+			if err := w.flush(); err != nil {
+				con.sugar.Errorf("(APIExportUserURLs) write error: %s", err)
+				return
+			}
+			if f, ok := res.(http.Flusher); ok {
+				f.Flush()
+			}
+
+			q.Cursor = page.Next
+			if page, err = con.storageService.ListUserLinks(userID, q); err != nil {
+				con.sugar.Errorf("(APIExportUserURLs) ListUserLinks error: %s", err)
+				return
+			}
+		}
+		if err := w.close(); err != nil {
+			con.sugar.Errorf("(APIExportUserURLs) write error: %s", err)
+		}
+	}
+}
+
+// importEntry - link read from the imported file.
+type importEntry struct {
+	ShortID     string   `json:"short_id"`
+	OriginalURL string   `json:"original_url"`
+	Title       string   `json:"title"`
+	Notes       string   `json:"notes"`
+	Tags        []string `json:"tags"`
+	IsDeleted   bool     `json:"is_deleted"`
+}
+
+// importResult - outcome of an imported row.
+type importResult struct {
+	// Row: number of the link in the file, starting at 1 (the CSV header is not counted).
+	Row      int           `json:"row"`
+	Status   string        `json:"status"`
+	ShortURL string        `json:"short_url,omitempty"`
+	Error    *errorDetails `json:"error,omitempty"`
+}
+
+// errBadImport - error when the imported file cannot be read.
+var errBadImport = errors.New("invalid import file")
+
+// APIImportUserURLs imports links in the format of ctrl.APIExportUserURLs(): CSV with a header row
+// or a JSON array. The format is given by the query parameter format or else by the Content-Type
+// ("text/csv" for CSV, JSON otherwise).
+//
+// Each link goes through the checks of ctrl.APIShortenBatchURL(). The short ID of the file is kept
+// if no link has it yet, otherwise a new one is generated. Deleted links are skipped.
+// The response lists the status and the short URL of every row; a rejected row does not stop the import.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 400 Bad Request: if the format is unknown, the file cannot be read or has too many links.
+//   - 413 Request Entity Too Large: if the file is larger than 10 MB.
+//   - 200 OK: the results of the rows in JSON.
+//   - 500 Internal Server Error: if the links could not be checked.
+func (con *Controller) APIImportUserURLs() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		format := req.URL.Query().Get("format")
+		if format == "" {
+			format = formatJSON
+			if mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type")); err == nil && mediaType == "text/csv" {
+				format = formatCSV
+			}
+		}
+
+		body := http.MaxBytesReader(res, req.Body, maxImportSize)
+		var entries []importEntry
+		var err error
+		switch format {
+		case formatCSV:
+			entries, err = readImportCSV(body)
+		case formatJSON:
+			entries, err = readImportJSON(body)
+		default:
+			http.Error(res, "Bad Request: format must be \"csv\" or \"json\"", http.StatusBadRequest)
+			return
+		}
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(res, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
+			http.Error(res, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if len(entries) > maxImportRows {
+			http.Error(res, fmt.Sprintf("Bad Request: at most %d links can be imported at once", maxImportRows), http.StatusBadRequest)
+			return
+		}
+
+		results := make([]importResult, 0, len(entries))
+		for i, e := range entries {
+			result, err := con.importLink(req, userID, e)
+			if err != nil {
+				con.sugar.Errorf("(APIImportUserURLs) row %d: %s", i+1, err)
+				http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			result.Row = i + 1
+			results = append(results, result)
+		}
+		con.writeJSON(res, http.StatusOK, results)
+	}
+}
+
+// importLink checks and stores an imported link. Rows rejected by the checks are reported in the result;
+// an error is returned only if the link options could not be built.
+func (con *Controller) importLink(req *http.Request, userID string, e importEntry) (importResult, error) {
+	if e.IsDeleted {
+		return importResult{Status: importSkipped}, nil
+	}
+
+	entry := batchRequestEntity{OriginalURL: e.OriginalURL}
+	entry.LinkMetadata = models.LinkMetadata{Title: e.Title, Notes: e.Notes, Tags: e.Tags}
+	originalURL, opts, err := con.prepareBatchURL(userID, entry)
+	var entryErr *batchEntryError
+	if errors.As(err, &entryErr) {
+		return importResult{Status: importFailed, Error: &entryErr.details}, nil
+	}
+	if errors.Is(err, errBadLinkOptions) {
+		return importResult{Status: importFailed, Error: &errorDetails{Code: "invalid_options", Message: err.Error()}}, nil
+	}
+	if err != nil {
+		return importResult{}, err
+	}
+
+	if validAlias(e.ShortID) {
+		opts.Alias = e.ShortID
+	}
+	shortID, err := con.storeBatchURL(req, userID, originalURL, opts)
+	switch {
+	case errors.Is(err, repository.ErrDuplicateURL):
+		return importResult{Status: importExists, ShortURL: con.shortURL(shortID)}, nil
+	case err != nil:
+		con.sugar.Errorf("(importLink) UpdateData error: %s", err)
+		return importResult{Status: importFailed, Error: &errorDetails{Code: "internal", Message: "the link could not be stored"}}, nil
+	}
+
+	status := importCreated
+	if e.ShortID != "" && shortID != e.ShortID {
+		status = importRenamed
+	}
+	return importResult{Status: status, ShortURL: con.shortURL(shortID)}, nil
+}
+
+// validAlias reports whether the short ID can be requested for an imported link.
+// The reserved path segments of the service routes are not valid aliases.
+func validAlias(alias string) bool {
+	return aliasPattern.MatchString(alias) && !routes.IsReserved(alias)
+}
+
+// readImportJSON reads the links of a JSON array.
+func readImportJSON(r io.Reader) ([]importEntry, error) {
+	var entries []importEntry
+	if err := json.NewDecoder(r).Decode(&entries); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("%w: %v", errBadImport, err)
+	}
+	return entries, nil
+}
+
+// readImportCSV reads the links of a CSV file. The header row names the columns
+// (see exportColumns); original_url is required, unknown columns are ignored.
+func readImportCSV(r io.Reader) ([]importEntry, error) {
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if err != nil {
+		return nil, csvImportError(err)
+	}
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["original_url"]; !ok {
+		return nil, fmt.Errorf("%w: the header has no original_url column", errBadImport)
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var entries []importEntry
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, csvImportError(err)
+		}
+
+		e := importEntry{
+			ShortID:     field(record, "short_id"),
+			OriginalURL: field(record, "original_url"),
+			Title:       field(record, "title"),
+			Notes:       field(record, "notes"),
+		}
+		for _, tag := range strings.Split(field(record, "tags"), ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				e.Tags = append(e.Tags, tag)
+			}
+		}
+		if v := field(record, "is_deleted"); v != "" {
+			if e.IsDeleted, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("%w: row %d: is_deleted must be \"true\" or \"false\"", errBadImport, len(entries)+1)
+			}
+		}
+		entries = append(entries, e)
+	}
+}
+
+// csvImportError wraps the error of the CSV reader, keeping the error of a too large body.
+func csvImportError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return err
+	}
+	return fmt.Errorf("%w: %v", errBadImport, err)
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"shortener/internal/domain/models"
+	"shortener/internal/repository"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIExportUserURLs(t *testing.T) {
+	created := time.Date(2025, 3, 12, 10, 0, 0, 0, time.UTC)
+	next := models.LinkCursor{Sort: models.SortCreated, Ascending: true, CreatedAt: created, ShortID: "url1"}
+	first := models.LinkQuery{Limit: models.MaxPageSize, Sort: models.SortCreated, Ascending: true}
+	second := first
+	second.Cursor = &next
+
+	tests := []struct {
+		name        string
+		format      string
+		contentType string
+		check       func(t *testing.T, body string)
+	}{
+		{
+			name:        "json",
+			format:      "",
+			contentType: "application/json",
+			check: func(t *testing.T, body string) {
+				var entries []exportEntry
+				require.NoError(t, json.Unmarshal([]byte(body), &entries))
+				require.Len(t, entries, 2)
+				assert.Equal(t, "url1", entries[0].ShortID)
+				assert.Equal(t, []string{"news", "spring"}, entries[0].Tags)
+				assert.Equal(t, "http://example.com/2", entries[1].OriginalURL)
+				assert.Equal(t, []string{}, entries[1].Tags)
+				assert.True(t, entries[1].IsDeleted)
+			},
+		},
+		{
+			name:        "csv",
+			format:      "csv",
+			contentType: "text/csv; charset=utf-8",
+			check: func(t *testing.T, body string) {
+				records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+				require.NoError(t, err)
+				require.Len(t, records, 3)
+				assert.Equal(t, exportColumns, records[0])
+				assert.Equal(t, []string{"url1", "http://localhost:8080/url1", "http://example.com/1", "One", "first, of two",
+					"news,spring", "4", "false", "2025-03-12T10:00:00Z"}, records[1])
+				assert.Equal(t, "", records[2][8])
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller := prepare_(t)
+			storSrv.EXPECT().ListUserLinks("testUserID", first).Return(models.LinkPage{
+				Links: []models.UserLink{{ShortID: "url1", URLData: models.URLData{
+					OriginalURL: "http://example.com/1",
+					LinkOptions: models.LinkOptions{Clicks: 4, CreatedAt: created, LinkMetadata: models.LinkMetadata{
+						Title: "One", Notes: "first, of two", Tags: []string{"news", "spring"},
+					}},
+				}}},
+				Next: &next,
+			}, nil)
+			storSrv.EXPECT().ListUserLinks("testUserID", second).Return(models.LinkPage{
+				Links: []models.UserLink{{ShortID: "url2", URLData: models.URLData{OriginalURL: "http://example.com/2", IsDeleted: true}}},
+			}, nil)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls/export?format="+tt.format, nil)
+			req.Header.Set("User-ID", "testUserID")
+			w := httptest.NewRecorder()
+
+			handler := controller.APIExportUserURLs()
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+			tt.check(t, w.Body.String())
+		})
+	}
+}
+
+func TestAPIExportUserURLsBadFormat(t *testing.T) {
+	_, _, controller := prepare_(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls/export?format=xml", nil)
+	req.Header.Set("User-ID", "testUserID")
+	w := httptest.NewRecorder()
+
+	handler := controller.APIExportUserURLs()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestAPIImportUserURLs(t *testing.T) {
+	csvBody := "short_id,original_url,title,tags,is_deleted\n" +
+		"keep1,http://example.com/1,One,\"News, spring\",false\n" +
+		"taken,http://example.com/2,,,\n" +
+		"ping,http://example.com/3,,,\n" +
+		"old,http://example.com/4,,,true\n" +
+		",not a url,,,\n" +
+		",http://example.com/5,,,\n"
+	jsonBody := `[
+		{"short_id":"keep1","original_url":"http://example.com/1","title":"One","tags":["News"," spring"]},
+		{"short_id":"taken","original_url":"http://example.com/2"},
+		{"short_id":"ping","original_url":"http://example.com/3"},
+		{"short_id":"old","original_url":"http://example.com/4","is_deleted":true},
+		{"original_url":"not a url"},
+		{"original_url":"http://example.com/5","clicks":3}
+	]`
+
+	tests := []struct {
+		name        string
+		url         string
+		contentType string
+		body        string
+	}{
+		{name: "csv by content type", url: "/api/user/urls/import", contentType: "text/csv", body: csvBody},
+		{name: "csv by format", url: "/api/user/urls/import?format=csv", body: csvBody},
+		{name: "json", url: "/api/user/urls/import", contentType: "application/json", body: jsonBody},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, userSrv, controller := prepare_(t)
+			uid := "testUserID"
+			base := controller.conf.BaseURL
+
+			meta := models.LinkMetadata{Title: "One", Tags: []string{"news", "spring"}}
+			storSrv.EXPECT().UpdateData(gomock.Any(), "http://example.com/1", uid, models.LinkOptions{LinkMetadata: meta, Alias: "keep1"}).Return("keep1", nil)
+			userSrv.EXPECT().AddURLs(base, uid, "keep1", "http://example.com/1", meta)
+			storSrv.EXPECT().UpdateData(gomock.Any(), "http://example.com/2", uid, models.LinkOptions{Alias: "taken"}).Return("newID", nil)
+			userSrv.EXPECT().AddURLs(base, uid, "newID", "http://example.com/2", models.LinkMetadata{})
+			storSrv.EXPECT().UpdateData(gomock.Any(), "http://example.com/3", uid, models.LinkOptions{}).Return("genID", nil)
+			userSrv.EXPECT().AddURLs(base, uid, "genID", "http://example.com/3", models.LinkMetadata{})
+			storSrv.EXPECT().UpdateData(gomock.Any(), "http://example.com/5", uid, models.LinkOptions{}).Return("existing", repository.ErrDuplicateURL)
+
+			req := httptest.NewRequest(http.MethodPost, tt.url, bytes.NewBufferString(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			req.Header.Set("User-ID", uid)
+			w := httptest.NewRecorder()
+
+			handler := controller.APIImportUserURLs()
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			var results []importResult
+			require.NoError(t, json.NewDecoder(w.Body).Decode(&results))
+			require.Len(t, results, 6)
+
+			assert.Equal(t, importResult{Row: 1, Status: importCreated, ShortURL: base + "/keep1"}, results[0])
+			assert.Equal(t, importResult{Row: 2, Status: importRenamed, ShortURL: base + "/newID"}, results[1])
+			assert.Equal(t, importResult{Row: 3, Status: importRenamed, ShortURL: base + "/genID"}, results[2])
+			assert.Equal(t, importResult{Row: 4, Status: importSkipped}, results[3])
+			assert.Equal(t, importFailed, results[4].Status)
+			require.NotNil(t, results[4].Error)
+			assert.Equal(t, "original_url", results[4].Error.Field)
+			assert.Equal(t, importResult{Row: 6, Status: importExists, ShortURL: base + "/existing"}, results[5])
+		})
+	}
+}
+
+func TestAPIImportUserURLsBadFile(t *testing.T) {
+	tests := []struct {
+		name           string
+		url            string
+		body           string
+		expectedStatus int
+	}{
+		{name: "unknown format", url: "/api/user/urls/import?format=xml", body: "<urls/>", expectedStatus: http.StatusBadRequest},
+		{name: "invalid json", url: "/api/user/urls/import", body: "{", expectedStatus: http.StatusBadRequest},
+		{name: "csv without original_url", url: "/api/user/urls/import?format=csv", body: "short_id,url\nab,http://example.com\n", expectedStatus: http.StatusBadRequest},
+		{name: "csv with bad is_deleted", url: "/api/user/urls/import?format=csv", body: "original_url,is_deleted\nhttp://example.com,maybe\n", expectedStatus: http.StatusBadRequest},
+		{name: "too large", url: "/api/user/urls/import", body: "[" + strings.Repeat(" ", maxImportSize) + "]", expectedStatus: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, controller := prepare_(t)
+
+			req := httptest.NewRequest(http.MethodPost, tt.url, strings.NewReader(tt.body))
+			req.Header.Set("User-ID", "testUserID")
+			w := httptest.NewRecorder()
+
+			handler := controller.APIImportUserURLs()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// clientIP returns the address of the visitor. If the request comes from a trusted proxy,
+// the address is taken from X-Forwarded-For (the rightmost address that is not a trusted proxy)
+// or X-Real-IP. Returns an invalid address if it cannot be determined.
+func (con *Controller) clientIP(req *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	remote = remote.Unmap()
+
+	if !con.isTrustedProxy(remote) {
+		return remote
+	}
+
+	if values := req.Header.Values("X-Forwarded-For"); len(values) > 0 {
+		forwarded := strings.Split(strings.Join(values, ","), ",")
+		for i := len(forwarded) - 1; i >= 0; i-- {
+			addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+			if err != nil {
+				break
+			}
+			addr = addr.Unmap()
+			if !con.isTrustedProxy(addr) {
+				return addr
+			}
+			remote = addr
+		}
+		return remote
+	}
+
+	if realIP, err := netip.ParseAddr(strings.TrimSpace(req.Header.Get("X-Real-IP"))); err == nil {
+		return realIP.Unmap()
+	}
+	return remote
+}
+
+func (con *Controller) isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range con.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// visitorCountry returns the country code of the visitor (empty if unknown or GeoIP is disabled).
+func (con *Controller) visitorCountry(req *http.Request) string {
+	if con.geoIP == nil {
+		return ""
+	}
+	ip := con.clientIP(req)
+	if !ip.IsValid() {
+		return ""
+	}
+	return con.geoIP.Country(ip)
+}
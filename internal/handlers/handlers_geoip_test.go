@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"shortener/internal/domain/models"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+// staticGeoIP resolves countries from a fixed table.
+type staticGeoIP map[string]string
+
+func (g staticGeoIP) Country(ip netip.Addr) string {
+	return g[ip.String()]
+}
+
+func TestClientIP(t *testing.T) {
+	_, _, controller := prepare_(t)
+	controller.trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		realIP       string
+		expectedIP   string
+	}{
+		{name: "direct", remoteAddr: "192.0.2.1:1234", forwardedFor: "198.51.100.1", expectedIP: "192.0.2.1"},
+		{name: "trusted proxy", remoteAddr: "10.0.0.1:1234", forwardedFor: "203.0.113.9, 198.51.100.1, 10.0.0.2", expectedIP: "198.51.100.1"},
+		{name: "trusted proxy real ip", remoteAddr: "10.0.0.1:1234", realIP: "198.51.100.2", expectedIP: "198.51.100.2"},
+		{name: "only proxies", remoteAddr: "10.0.0.1:1234", forwardedFor: "10.0.0.3", expectedIP: "10.0.0.3"},
+		{name: "invalid forwarded address", remoteAddr: "10.0.0.1:1234", forwardedFor: "bogus", expectedIP: "10.0.0.1"},
+		{name: "mapped address", remoteAddr: "[::ffff:192.0.2.1]:1234", expectedIP: "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ab", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			assert.Equal(t, tt.expectedIP, controller.clientIP(req).String())
+		})
+	}
+}
+
+func TestGetOriginalURLCountry(t *testing.T) {
+	storSrv, _, controller := prepare_(t)
+	controller.geoIP = staticGeoIP{"198.51.100.1": "US"}
+	controller.trustedProxies = []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	storSrv.EXPECT().GetData("urlgeo").Return("http://example.com/eu", false, nil).Times(2)
+	storSrv.EXPECT().GetLinkOptions("urlgeo").Return(models.LinkOptions{
+		Rules: []models.TargetingRule{{Country: "US", URL: "http://example.com/us"}},
+	}, nil).Times(2)
+	storSrv.EXPECT().RegisterClick("urlgeo", models.Click{Variant: -1, Country: "US"}).Return(true, nil)
+	storSrv.EXPECT().RegisterClick("urlgeo", models.Click{Variant: -1}).Return(true, nil)
+
+	for remoteAddr, expectedLocation := range map[string]string{
+		"10.0.0.1:1234":  "http://example.com/us",
+		"192.0.2.1:1234": "http://example.com/eu",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/urlgeo", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("X-Forwarded-For", "198.51.100.1")
+		w := httptest.NewRecorder()
+
+		controller.GetOriginalURL().ServeHTTP(w, req)
+
+		resp := w.Result()
+		if err := resp.Body.Close(); err != nil {
+			controller.sugar.Errorf("resp.Body.Close() error")
+		}
+		assert.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+		assert.Equal(t, expectedLocation, resp.Header.Get("Location"), remoteAddr)
+	}
+}
+
+func TestAPIShortenURLIgnoresCountryClicks(t *testing.T) {
+	storSrv, userSrv, controller := prepare_(t)
+	storSrv.EXPECT().UpdateData(gomock.Any(), "https://example.com", "testUserID", gomock.Any()).
+		DoAndReturn(func(_ *http.Request, _, _ string, opts models.LinkOptions) (string, error) {
+			assert.Empty(t, opts.CountryClicks, "Expected country clicks supplied by the user to be ignored")
+			assert.Zero(t, opts.Clicks, "Expected clicks supplied by the user to be ignored")
+			return "abc", nil
+		})
+	userSrv.EXPECT().AddURLs(controller.conf.BaseURL, "testUserID", "abc", "https://example.com", models.LinkMetadata{})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten",
+		bytes.NewBufferString(`{"url":"https://example.com","clicks":5,"country_clicks":{"US":1000}}`))
+	req.Header.Set("User-ID", "testUserID")
+	w := httptest.NewRecorder()
+
+	controller.APIShortenURL().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"shortener/internal/domain/models"
+	"shortener/internal/repository"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// linkDetails - link settings and click statistics returned to the owner of the link.
+type linkDetails struct {
+	ShortURL     string                 `json:"short_url"`
+	OriginalURL  string                 `json:"original_url"`
+	Title        string                 `json:"title"`
+	Notes        string                 `json:"notes"`
+	Tags         []string               `json:"tags"`
+	Interstitial bool                   `json:"interstitial"`
+	CreatedAt    time.Time              `json:"created_at"`
+	IsDeleted    bool                   `json:"is_deleted"`
+	MaxClicks    int                    `json:"max_clicks"`
+	Clicks       int                    `json:"clicks"`
+	Destinations []models.Destination   `json:"destinations"`
+	Rules        []models.TargetingRule `json:"rules"`
+	// CountryClicks: clicks per visitor country; visitors with unknown country are counted only in Clicks.
+	CountryClicks map[string]int `json:"country_clicks"`
+	// DisabledReason: why the link was disabled by moderation (omitted if the link is enabled).
+	DisabledReason string `json:"disabled_reason,omitempty"`
+}
+
+// linkEditRequest - body of the request to change the link settings. Omitted fields are left unchanged.
+type linkEditRequest struct {
+	Destinations *[]models.Destination   `json:"destinations"`
+	Rules        *[]models.TargetingRule `json:"rules"`
+	Title        *string                 `json:"title"`
+	Notes        *string                 `json:"notes"`
+	Tags         *[]string               `json:"tags"`
+}
+
+func (con *Controller) newLinkDetails(shortID string, data models.URLData) linkDetails {
+	destinations := data.Destinations
+	if destinations == nil {
+		destinations = []models.Destination{}
+	}
+	rules := data.Rules
+	if rules == nil {
+		rules = []models.TargetingRule{}
+	}
+	tags := data.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	countryClicks := data.CountryClicks
+	if countryClicks == nil {
+		countryClicks = map[string]int{}
+	}
+	return linkDetails{
+		ShortURL:       con.shortURL(shortID),
+		OriginalURL:    data.OriginalURL,
+		Title:          data.Title,
+		Notes:          data.Notes,
+		Tags:           tags,
+		Interstitial:   data.Interstitial,
+		CreatedAt:      data.CreatedAt,
+		IsDeleted:      data.IsDeleted,
+		MaxClicks:      data.MaxClicks,
+		Clicks:         data.Clicks,
+		Destinations:   destinations,
+		Rules:          rules,
+		CountryClicks:  countryClicks,
+		DisabledReason: data.DisabledReason,
+	}
+}
+
+// APIGetUserURL handles requests to retrieve the settings and click statistics of a user's link,
+// including the clicks of each destination and of each visitor country.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 404 Not Found: if the user has no link with the given ID.
+//   - 200 OK: successful retrieval of the link in JSON format.
+//   - 500 Internal Server Error: if the link could not be retrieved.
+func (con *Controller) APIGetUserURL() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		shortID := chi.URLParam(req, "id")
+		data, err := con.storageService.GetUserLink(userID, shortID)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(res, "Not Found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			con.sugar.Errorf("(APIGetUserURL) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		con.writeJSON(res, http.StatusOK, con.newLinkDetails(shortID, data))
+	}
+}
+
+// APIEditUserURL handles requests to change the weighted destinations, targeting rules, title, notes
+// and tags of a user's link.
+// Destinations keep their click counters if their URL is unchanged; an empty list
+// removes the destinations, the rules or the tags.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 400 Bad Request: if the request body, the destinations, the rules or the metadata are invalid.
+//   - 403 Forbidden: if one of the destination or rule URLs is blocked (the body gives the reason in JSON).
+//   - 404 Not Found: if the user has no link with the given ID.
+//   - 200 OK: the link was changed, its settings are returned in JSON format.
+//   - 500 Internal Server Error: if the link could not be changed.
+func (con *Controller) APIEditUserURL() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var body linkEditRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(res, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		var edit models.LinkEdit
+		if body.Destinations != nil {
+			destinations, err := checkDestinations(*body.Destinations)
+			if err != nil {
+				http.Error(res, "Bad Request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			for _, d := range destinations {
+				if e, blocked := con.blocklist.Check(d.URL); blocked {
+					con.blockedError(res, "destinations", "", e)
+					return
+				}
+			}
+			edit.Destinations = &destinations
+		}
+		if body.Rules != nil {
+			rules, err := checkRules(*body.Rules)
+			if err != nil {
+				http.Error(res, "Bad Request: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			for _, r := range rules {
+				if e, blocked := con.blocklist.Check(r.URL); blocked {
+					con.blockedError(res, "rules", "", e)
+					return
+				}
+			}
+			edit.Rules = &rules
+		}
+		if err := checkMetadataEdit(&body, &edit); err != nil {
+			http.Error(res, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		shortID := chi.URLParam(req, "id")
+		before, err := con.storageService.GetUserLink(userID, shortID)
+		if err == nil {
+			err = con.storageService.EditLink(userID, shortID, edit)
+		}
+		if err == nil {
+			var data models.URLData
+			data, err = con.storageService.GetUserLink(userID, shortID)
+			if err == nil {
+				base, id := con.linkBase(shortID)
+				con.userService.SetURLMetadata(base, userID, id, data.LinkMetadata)
+				con.publishLinkEvent(models.EventLinkEdited, userID, shortID, data.OriginalURL)
+				con.recordAudit(con.newAuditSource(req, userID), models.AuditLinkEdit, shortID, userID, auditLink(before), auditLink(data))
+				con.writeJSON(res, http.StatusOK, con.newLinkDetails(shortID, data))
+				return
+			}
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(res, "Not Found", http.StatusNotFound)
+			return
+		}
+		con.sugar.Errorf("(APIEditUserURL) %s", err.Error())
+		http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+	}
+}
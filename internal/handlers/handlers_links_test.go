@@ -0,0 +1,200 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"shortener/internal/domain/models"
+	"shortener/internal/mocks"
+	"shortener/internal/repository"
+	"shortener/internal/user"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChooseDestination(t *testing.T) {
+	destinations := []models.Destination{
+		{URL: "http://a.example", Weight: 70},
+		{URL: "http://b.example", Weight: 30},
+	}
+
+	counts := make([]int, len(destinations))
+	for i := 0; i < 10000; i++ {
+		visitor := fmt.Sprintf("visitor%d", i)
+		variant := chooseDestination(destinations, visitor, "ab")
+		require.Equal(t, variant, chooseDestination(destinations, visitor, "ab"), "Expected visitor to keep the destination")
+		counts[variant]++
+	}
+
+	assert.InDelta(t, 7000, counts[0], 300, "Expected redirects to follow the weights")
+	assert.InDelta(t, 3000, counts[1], 300, "Expected redirects to follow the weights")
+}
+
+func TestVisitorKey(t *testing.T) {
+	_, _, controller := prepare_(t)
+	controller.userService = user.NewUserService()
+
+	req := httptest.NewRequest(http.MethodGet, "/ab", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	assert.Equal(t, "192.0.2.1", controller.visitorKey(req))
+
+	req.Header.Set("User-ID", "forgedUserID")
+	assert.Equal(t, "192.0.2.1", controller.visitorKey(req), "Expected the User-ID header to be ignored")
+
+	w := httptest.NewRecorder()
+	require.NoError(t, controller.userService.SetUserIDCookie(w, "testUserID"))
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	assert.Equal(t, "testUserID", controller.visitorKey(req))
+}
+
+func TestGetOriginalURLForgedUserID(t *testing.T) {
+	storSrv, userSrv, controller := prepare_(t)
+	destinations := []models.Destination{
+		{URL: "http://a.example", Weight: 1},
+		{URL: "http://b.example", Weight: 1},
+	}
+	variant := chooseDestination(destinations, "192.0.2.1", "ab")
+	forged := "forgedUserID"
+	for i := 0; chooseDestination(destinations, forged, "ab") == variant; i++ {
+		forged = fmt.Sprintf("forgedUserID%d", i)
+	}
+
+	storSrv.EXPECT().GetData("ab").Return("http://example.com", false, nil)
+	storSrv.EXPECT().GetLinkOptions("ab").Return(models.LinkOptions{Destinations: destinations}, nil)
+	storSrv.EXPECT().RegisterClick("ab", models.Click{Variant: variant}).Return(true, nil)
+	userSrv.EXPECT().GetUserIDFromCookie(gomock.Any()).Return("", http.ErrNoCookie)
+
+	req := httptest.NewRequest(http.MethodGet, "/ab", nil)
+	req.RemoteAddr = "192.0.2.1:1234"
+	req.Header.Set("User-ID", forged)
+	w := httptest.NewRecorder()
+	controller.GetOriginalURL().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusTemporaryRedirect, w.Code)
+	assert.Equal(t, destinations[variant].URL, w.Header().Get("Location"), "Expected a forged User-ID header not to choose the destination")
+}
+
+func TestAPIEditUserURL(t *testing.T) {
+	tests := []struct {
+		mockSetup      func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService)
+		name           string
+		userID         string
+		requestBody    string
+		expectedStatus int
+	}{
+		{
+			name:        "APIEditUserURL ok",
+			userID:      "testUserID",
+			requestBody: `{"destinations":[{"url":"http://a.example","weight":70,"clicks":100},{"url":"http://b.example","weight":30}]}`,
+			mockSetup: func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService) {
+				storSrv.EXPECT().GetUserLink("testUserID", "ab").Return(models.URLData{OriginalURL: "http://example.com"}, nil)
+				storSrv.EXPECT().EditLink("testUserID", "ab", gomock.Any()).DoAndReturn(func(userID, shortID string, edit models.LinkEdit) error {
+					assert.Equal(t, []models.Destination{
+						{URL: "http://a.example", Weight: 70},
+						{URL: "http://b.example", Weight: 30},
+					}, *edit.Destinations, "Expected clicks supplied by the user to be ignored")
+					return nil
+				})
+				storSrv.EXPECT().GetUserLink("testUserID", "ab").Return(models.URLData{OriginalURL: "http://example.com"}, nil)
+				userSrv.EXPECT().SetURLMetadata(gomock.Any(), "testUserID", "ab", models.LinkMetadata{})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "APIEditUserURL zero weight",
+			userID:         "testUserID",
+			requestBody:    `{"destinations":[{"url":"http://a.example","weight":0}]}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "APIEditUserURL weight too large",
+			userID:         "testUserID",
+			requestBody:    `{"destinations":[{"url":"http://a.example","weight":9223372036854775807},{"url":"http://b.example","weight":1}]}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "APIEditUserURL not owned",
+			userID:      "testUserID",
+			requestBody: `{"destinations":[]}`,
+			mockSetup: func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService) {
+				storSrv.EXPECT().GetUserLink("testUserID", "ab").Return(models.URLData{}, repository.ErrNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "APIEditUserURL Unauthorized",
+			requestBody:    `{"destinations":[]}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, userSrv, controller := prepare_(t)
+			tt.mockSetup(storSrv, userSrv)
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/user/urls/ab", bytes.NewBufferString(tt.requestBody))
+			req.Header.Set("User-ID", tt.userID)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "ab")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+
+			handler := controller.APIEditUserURL()
+			handler.ServeHTTP(w, req)
+
+			resp := w.Result()
+			if err := resp.Body.Close(); err != nil {
+				controller.sugar.Errorf("resp.Body.Close() error")
+			}
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestAPIGetUserURL(t *testing.T) {
+	storSrv, _, controller := prepare_(t)
+	storSrv.EXPECT().GetUserLink("testUserID", "ab").Return(models.URLData{
+		OriginalURL: "http://example.com",
+		LinkOptions: models.LinkOptions{Clicks: 3, Destinations: []models.Destination{
+			{URL: "http://a.example", Weight: 70, Clicks: 2},
+			{URL: "http://b.example", Weight: 30, Clicks: 1},
+		}},
+	}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls/ab", nil)
+	req.Header.Set("User-ID", "testUserID")
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "ab")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	handler := controller.APIGetUserURL()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			controller.sugar.Errorf("resp.Body.Close() error")
+		}
+	}()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var details linkDetails
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&details))
+	assert.Equal(t, 3, details.Clicks)
+	assert.Equal(t, []int{2, 1}, []int{details.Destinations[0].Clicks, details.Destinations[1].Clicks})
+}
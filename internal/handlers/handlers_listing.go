@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"shortener/internal/domain/models"
+	"strconv"
+	"time"
+)
+
+// errBadListQuery - error when a query parameter of the URL listing is invalid.
+var errBadListQuery = errors.New("invalid listing parameters")
+
+// userLinkEntry - URL of the user listing.
+type userLinkEntry struct {
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+	models.LinkMetadata
+	IsDeleted bool      `json:"is_deleted"`
+	Clicks    int       `json:"clicks"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (con *Controller) newUserLinkEntry(link models.UserLink) userLinkEntry {
+	return userLinkEntry{
+		ShortURL:     con.shortURL(link.ShortID),
+		OriginalURL:  link.OriginalURL,
+		LinkMetadata: link.LinkMetadata,
+		IsDeleted:    link.IsDeleted,
+		Clicks:       link.Clicks,
+		CreatedAt:    link.CreatedAt,
+	}
+}
+
+// parseLinkQuery reads the pagination, sorting and filter parameters of the URL listing.
+func parseLinkQuery(values url.Values) (models.LinkQuery, error) {
+	q := models.LinkQuery{
+		Limit:  models.DefaultPageSize,
+		Sort:   models.SortCreated,
+		Search: values.Get("q"),
+		Tag:    normalizeTag(values.Get("tag")),
+	}
+
+	if v := values.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > models.MaxPageSize {
+			return q, fmt.Errorf("%w: limit must be between 1 and %d", errBadListQuery, models.MaxPageSize)
+		}
+		q.Limit = limit
+	}
+
+	switch v := values.Get("sort"); v {
+	case "", models.SortCreated:
+	case models.SortClicks:
+		q.Sort = models.SortClicks
+	default:
+		return q, fmt.Errorf("%w: sort must be %q or %q", errBadListQuery, models.SortCreated, models.SortClicks)
+	}
+
+	switch values.Get("order") {
+	case "", "desc":
+	case "asc":
+		q.Ascending = true
+	default:
+		return q, fmt.Errorf("%w: order must be \"asc\" or \"desc\"", errBadListQuery)
+	}
+
+	var err error
+	if q.Deleted, err = parseBoolFilter(values, "deleted"); err != nil {
+		return q, err
+	}
+	if q.Expired, err = parseBoolFilter(values, "expired"); err != nil {
+		return q, err
+	}
+
+	if v := values.Get("cursor"); v != "" {
+		cursor, err := models.DecodeCursor(v)
+		if err != nil || cursor.Sort != q.Sort || cursor.Ascending != q.Ascending {
+			return q, fmt.Errorf("%w: %w", errBadListQuery, models.ErrInvalidCursor)
+		}
+		q.Cursor = &cursor
+	}
+	return q, nil
+}
+
+// parseBoolFilter reads an optional boolean filter; nil means the filter is not set.
+func parseBoolFilter(values url.Values, name string) (*bool, error) {
+	v := values.Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s must be \"true\" or \"false\"", errBadListQuery, name)
+	}
+	return &b, nil
+}
+
+// nextPageLink returns the Link header value pointing at the page after the cursor,
+// keeping the other parameters of the request.
+func nextPageLink(u *url.URL, next models.LinkCursor) string {
+	values := u.Query()
+	values.Set("cursor", next.Encode())
+	return fmt.Sprintf("<%s?%s>; rel=\"next\"", u.Path, values.Encode())
+}
+
+// writeLinkPage writes the page of the URL listing: 204 No Content if it is empty, otherwise
+// the URLs in JSON with the next page linked by the Link header.
+func (con *Controller) writeLinkPage(res http.ResponseWriter, req *http.Request, page models.LinkPage) {
+	if len(page.Links) == 0 {
+		con.sugar.Debug("(writeLinkPage) StatusNoContent")
+		res.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	urls := make([]userLinkEntry, 0, len(page.Links))
+	for _, link := range page.Links {
+		urls = append(urls, con.newUserLinkEntry(link))
+	}
+	response, err := json.Marshal(urls)
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	if page.Next != nil {
+		res.Header().Set("Link", nextPageLink(req.URL, *page.Next))
+	}
+	_, err = res.Write(response)
+	if err != nil {
+		http.Error(res, "Bad Request", http.StatusBadRequest)
+		return
+	}
+}
@@ -0,0 +1,125 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"shortener/internal/domain/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLinkQuery(t *testing.T) {
+	yes := true
+	no := false
+	cursor := models.LinkCursor{Sort: models.SortClicks, Ascending: true, Clicks: 3, ShortID: "abc"}
+
+	tests := []struct {
+		name     string
+		query    string
+		expected models.LinkQuery
+		wantErr  bool
+	}{
+		{
+			name:     "defaults",
+			query:    "",
+			expected: models.LinkQuery{Limit: models.DefaultPageSize, Sort: models.SortCreated},
+		},
+		{
+			name:  "all parameters",
+			query: "limit=10&sort=clicks&order=asc&q=Shop&tag=%20Spring&deleted=false&expired=true&cursor=" + cursor.Encode(),
+			expected: models.LinkQuery{
+				Limit: 10, Sort: models.SortClicks, Ascending: true, Search: "Shop", Tag: "spring",
+				Deleted: &no, Expired: &yes, Cursor: &cursor,
+			},
+		},
+		{name: "zero limit", query: "limit=0", wantErr: true},
+		{name: "limit too large", query: "limit=1001", wantErr: true},
+		{name: "unknown sort", query: "sort=title", wantErr: true},
+		{name: "unknown order", query: "order=up", wantErr: true},
+		{name: "bad boolean", query: "deleted=maybe", wantErr: true},
+		{name: "bad cursor", query: "cursor=%21%21", wantErr: true},
+		{name: "cursor of another order", query: "sort=clicks&cursor=" + cursor.Encode(), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+
+			q, err := parseLinkQuery(values)
+			if tt.wantErr {
+				assert.ErrorIs(t, err, errBadListQuery)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, q)
+		})
+	}
+}
+
+func TestAPIGetUserURLsPage(t *testing.T) {
+	storSrv, _, controller := prepare_(t)
+	created := time.Date(2025, 3, 12, 10, 0, 0, 0, time.UTC)
+	next := models.LinkCursor{Sort: models.SortCreated, CreatedAt: created, ShortID: "url1"}
+
+	storSrv.EXPECT().ListUserLinks("testUserID", models.LinkQuery{Limit: 1, Sort: models.SortCreated, Tag: "spring"}).Return(models.LinkPage{
+		Links: []models.UserLink{{ShortID: "url1", URLData: models.URLData{
+			OriginalURL: "http://example.com/1",
+			LinkOptions: models.LinkOptions{Clicks: 2, CreatedAt: created, LinkMetadata: models.LinkMetadata{Title: "One", Tags: []string{"spring"}}},
+		}}},
+		Next: &next,
+	}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls?limit=1&tag=Spring", nil)
+	req.Header.Set("User-ID", "testUserID")
+	w := httptest.NewRecorder()
+
+	handler := controller.APIGetUserURLs()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			controller.sugar.Errorf("resp.Body.Close() error")
+		}
+	}()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var urls []userLinkEntry
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&urls))
+	require.Len(t, urls, 1)
+	assert.Equal(t, controller.conf.BaseURL+"/url1", urls[0].ShortURL)
+	assert.Equal(t, "One", urls[0].Title)
+	assert.Equal(t, 2, urls[0].Clicks)
+	assert.True(t, created.Equal(urls[0].CreatedAt))
+
+	link := resp.Header.Get("Link")
+	require.True(t, strings.HasPrefix(link, "</api/user/urls?"), link)
+	require.True(t, strings.HasSuffix(link, `>; rel="next"`), link)
+	nextURL, err := url.Parse(strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`))
+	require.NoError(t, err)
+	assert.Equal(t, "1", nextURL.Query().Get("limit"))
+	assert.Equal(t, "Spring", nextURL.Query().Get("tag"))
+	assert.Equal(t, next.Encode(), nextURL.Query().Get("cursor"))
+}
+
+func TestAPIGetUserURLsBadQuery(t *testing.T) {
+	_, _, controller := prepare_(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls?sort=title", nil)
+	req.Header.Set("User-ID", "testUserID")
+	w := httptest.NewRecorder()
+
+	handler := controller.APIGetUserURLs()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "sort must be")
+}
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"fmt"
+	"shortener/internal/domain/models"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits of the link metadata.
+const (
+	// maxTitleLength - maximum length of the link title in characters.
+	maxTitleLength = 200
+	// maxNotesLength - maximum length of the link notes in characters.
+	maxNotesLength = 2000
+	// maxTags - maximum number of tags of a link.
+	maxTags = 20
+	// maxTagLength - maximum length of a tag in characters.
+	maxTagLength = 50
+)
+
+// checkMetadata checks the title, notes and tags supplied by the user.
+// The title and notes are trimmed; tags are trimmed, lower-cased and deduplicated.
+func checkMetadata(meta models.LinkMetadata) (models.LinkMetadata, error) {
+	var err error
+	if meta.Title, err = checkText("title", meta.Title, maxTitleLength); err != nil {
+		return models.LinkMetadata{}, err
+	}
+	if meta.Notes, err = checkText("notes", meta.Notes, maxNotesLength); err != nil {
+		return models.LinkMetadata{}, err
+	}
+	if meta.Tags, err = checkTags(meta.Tags); err != nil {
+		return models.LinkMetadata{}, err
+	}
+	return meta, nil
+}
+
+// checkText trims the text and checks its length.
+func checkText(field, text string, maxLength int) (string, error) {
+	text = strings.TrimSpace(text)
+	if utf8.RuneCountInString(text) > maxLength {
+		return "", fmt.Errorf("%w: %s is longer than %d characters", errBadLinkOptions, field, maxLength)
+	}
+	return text, nil
+}
+
+// checkTags normalizes the tags and checks their number and length.
+func checkTags(tags []string) ([]string, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+
+	checked := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = normalizeTag(tag)
+		if tag == "" || utf8.RuneCountInString(tag) > maxTagLength || strings.IndexFunc(tag, unicode.IsControl) >= 0 {
+			return nil, fmt.Errorf("%w: tags must be 1 to %d characters long", errBadLinkOptions, maxTagLength)
+		}
+		if !slices.Contains(checked, tag) {
+			checked = append(checked, tag)
+		}
+	}
+	if len(checked) > maxTags {
+		return nil, fmt.Errorf("%w: a link can have at most %d tags", errBadLinkOptions, maxTags)
+	}
+	return checked, nil
+}
+
+// normalizeTag trims and lower-cases the tag, so tags are matched case-insensitively.
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+// checkMetadataEdit checks the title, notes and tags of the edit request and adds them to the edit.
+func checkMetadataEdit(body *linkEditRequest, edit *models.LinkEdit) error {
+	if body.Title != nil {
+		title, err := checkText("title", *body.Title, maxTitleLength)
+		if err != nil {
+			return err
+		}
+		edit.Title = &title
+	}
+	if body.Notes != nil {
+		notes, err := checkText("notes", *body.Notes, maxNotesLength)
+		if err != nil {
+			return err
+		}
+		edit.Notes = &notes
+	}
+	if body.Tags != nil {
+		tags, err := checkTags(*body.Tags)
+		if err != nil {
+			return err
+		}
+		edit.Tags = &tags
+	}
+	return nil
+}
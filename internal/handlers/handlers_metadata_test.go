@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"shortener/internal/domain/models"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckMetadata(t *testing.T) {
+	meta, err := checkMetadata(models.LinkMetadata{
+		Title: "  Spring sale ",
+		Notes: "printed on flyers\n",
+		Tags:  []string{" Spring", "print", "spring"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, models.LinkMetadata{Title: "Spring sale", Notes: "printed on flyers", Tags: []string{"spring", "print"}}, meta)
+
+	tooManyTags := make([]string, maxTags+1)
+	for i := range tooManyTags {
+		tooManyTags[i] = strings.Repeat("t", i+1)
+	}
+	for _, invalid := range []models.LinkMetadata{
+		{Title: strings.Repeat("a", maxTitleLength+1)},
+		{Notes: strings.Repeat("a", maxNotesLength+1)},
+		{Tags: []string{" "}},
+		{Tags: []string{strings.Repeat("a", maxTagLength+1)}},
+		{Tags: tooManyTags},
+	} {
+		_, err := checkMetadata(invalid)
+		assert.ErrorIs(t, err, errBadLinkOptions)
+	}
+}
+
+func TestAPIShortenURLWithMetadata(t *testing.T) {
+	storSrv, userSrv, controller := prepare_(t)
+	meta := models.LinkMetadata{Title: "Sale", Notes: "flyer", Tags: []string{"spring"}}
+	storSrv.EXPECT().UpdateData(gomock.Any(), "https://example.com", "testUserID", models.LinkOptions{LinkMetadata: meta}).Return("abc", nil)
+	userSrv.EXPECT().AddURLs(controller.conf.BaseURL, "testUserID", "abc", "https://example.com", meta)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten",
+		bytes.NewBufferString(`{"url":"https://example.com","title":"Sale","notes":"flyer","tags":["Spring"]}`))
+	req.Header.Set("User-ID", "testUserID")
+	w := httptest.NewRecorder()
+
+	handler := controller.APIShortenURL()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	if err := resp.Body.Close(); err != nil {
+		controller.sugar.Errorf("resp.Body.Close() error")
+	}
+	assert.Equal(t, http.StatusCreated, resp.StatusCode)
+}
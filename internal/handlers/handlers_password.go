@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"container/list"
+	"errors"
+	"html/template"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// maxPasswordAttempts - number of wrong passwords of a client after which the link is locked for it.
+	maxPasswordAttempts = 5
+	// maxLinkPasswordAttempts - number of wrong passwords of all clients after which the link is locked for everyone,
+	// so that guessing from many addresses is limited too.
+	maxLinkPasswordAttempts = 50
+	// passwordLockout - period in which wrong passwords are counted and for which the link is locked.
+	passwordLockout = 15 * time.Minute
+	// maxTrackedAttempts - maximum number of counted keys; the oldest windows are dropped above it.
+	maxTrackedAttempts = 10000
+)
+
+var passwordPrompt = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Password required</title></head>
+<body>
+<form method="post" action="{{.Action}}">
+<p>This link is password protected.</p>
+{{if .Message}}<p>{{.Message}}</p>{{end}}
+<input type="password" name="password" autofocus required>
+<button type="submit">Open</button>
+</form>
+</body>
+</html>
+`))
+
+// UnlockOriginalURL checks the password submitted from the form returned by ctrl.GetOriginalURL()
+// and redirects to the original URL if it is correct.
+// After maxPasswordAttempts wrong passwords from a client the link is locked for that client for passwordLockout,
+// so the other visitors can still open it. After maxLinkPasswordAttempts wrong passwords from all clients
+// the link is locked for everyone.
+//
+// HTTP Responses:
+//   - 303 See Other: redirect to the original URL if the password is correct.
+//   - 401 Unauthorized: password prompt if the password is wrong.
+//   - 429 Too Many Requests: if the link is locked for the client or for everyone after wrong passwords.
+//   - 410 Gone: if the URL has been deleted or its click limit is reached.
+//   - 404 Not Found: if the request has trailing path segments and passthrough is disabled.
+//   - 400 Bad Request: if there was an error retrieving the data.
+func (con *Controller) UnlockOriginalURL() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		link, ok := con.findLink(res, req)
+		if !ok {
+			return
+		}
+
+		if link.opts.PasswordHash != "" {
+			key := con.passwordAttemptKey(req, link.id)
+			if wait, locked := con.passwordLocked(link.id, key, time.Now()); locked {
+				res.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+				http.Error(res, "Too Many Requests", http.StatusTooManyRequests)
+				return
+			}
+
+			err := bcrypt.CompareHashAndPassword([]byte(link.opts.PasswordHash), []byte(req.PostFormValue("password")))
+			if err != nil {
+				con.passwordAttempts.fail(key, time.Now())
+				con.linkPasswordAttempts.fail(link.id, time.Now())
+				con.writePasswordPrompt(res, req, http.StatusUnauthorized, "Wrong password.")
+				return
+			}
+			con.passwordAttempts.reset(key)
+		}
+
+		destination, err := con.destinationURL(link, req.URL.Query())
+		if errors.Is(err, errNoPassthrough) {
+			http.NotFound(res, req)
+			return
+		}
+		if err != nil {
+			http.Error(res, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if !con.registerClick(res, link) {
+			return
+		}
+
+		http.Redirect(res, req, destination, http.StatusSeeOther)
+	}
+}
+
+// writePasswordPrompt writes the HTML form asking for the password of the link.
+// The form is submitted to the same path and query as the request.
+func (con *Controller) writePasswordPrompt(res http.ResponseWriter, req *http.Request, status int, message string) {
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.Header().Set("Cache-Control", "no-store")
+	res.WriteHeader(status)
+	if req.Method == http.MethodHead {
+		return
+	}
+
+	data := struct {
+		Action  string
+		Message string
+	}{Action: req.URL.RequestURI(), Message: message}
+	if err := passwordPrompt.Execute(res, data); err != nil {
+		con.sugar.Errorf("(writePasswordPrompt) %s", err.Error())
+	}
+}
+
+// passwordAttemptKey identifies the wrong passwords of the client for the link:
+// the short link and the client address.
+func (con *Controller) passwordAttemptKey(req *http.Request, id string) string {
+	addr := req.RemoteAddr
+	if ip := con.clientIP(req); ip.IsValid() {
+		addr = ip.String()
+	}
+	return id + "\x00" + addr
+}
+
+// passwordLocked reports whether the link is locked for everyone or for the client
+// with the key (see passwordAttemptKey), and for how long.
+func (con *Controller) passwordLocked(id, key string, now time.Time) (time.Duration, bool) {
+	if wait, locked := con.linkPasswordAttempts.locked(id, now); locked {
+		return wait, true
+	}
+	return con.passwordAttempts.locked(key, now)
+}
+
+// hashPassword returns the bcrypt hash of the link password.
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// passwordAttempts counts wrong passwords per key and locks the keys with limit wrong passwords.
+// At most maxTrackedAttempts keys are counted.
+type passwordAttempts struct {
+	failures map[string]*list.Element
+	// order holds the *attemptWindow values from the oldest start.
+	order *list.List
+	limit int
+	mu    sync.Mutex
+}
+
+// attemptWindow - wrong passwords of the key counted since start.
+type attemptWindow struct {
+	start time.Time
+	key   string
+	count int
+}
+
+// newPasswordAttempts creates an empty counter locking keys with limit wrong passwords.
+func newPasswordAttempts(limit int) *passwordAttempts {
+	return &passwordAttempts{
+		failures: make(map[string]*list.Element),
+		order:    list.New(),
+		limit:    limit,
+	}
+}
+
+// locked reports whether the key is locked and for how long.
+func (p *passwordAttempts) locked(key string, now time.Time) (time.Duration, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e, exists := p.failures[key]
+	if !exists {
+		return 0, false
+	}
+	w := e.Value.(*attemptWindow)
+	if now.Sub(w.start) >= passwordLockout {
+		p.remove(e)
+		return 0, false
+	}
+	if w.count < p.limit {
+		return 0, false
+	}
+	return w.start.Add(passwordLockout).Sub(now), true
+}
+
+// fail counts a wrong password for the key. The expired windows are dropped, and if maxTrackedAttempts keys
+// are still counted, the oldest window is dropped to count the new key.
+func (p *passwordAttempts) fail(key string, now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for e := p.order.Front(); e != nil && now.Sub(e.Value.(*attemptWindow).start) >= passwordLockout; e = p.order.Front() {
+		p.remove(e)
+	}
+
+	if e, exists := p.failures[key]; exists {
+		e.Value.(*attemptWindow).count++
+		return
+	}
+	if len(p.failures) >= maxTrackedAttempts {
+		p.remove(p.order.Front())
+	}
+	p.failures[key] = p.order.PushBack(&attemptWindow{start: now, key: key, count: 1})
+}
+
+// reset forgets wrong passwords of the key.
+func (p *passwordAttempts) reset(key string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if e, exists := p.failures[key]; exists {
+		p.remove(e)
+	}
+}
+
+// remove drops the window of the element; p.mu must be held.
+func (p *passwordAttempts) remove(e *list.Element) {
+	delete(p.failures, e.Value.(*attemptWindow).key)
+	p.order.Remove(e)
+}
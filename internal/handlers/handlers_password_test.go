@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"shortener/internal/domain/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPasswordProtectedLink(t *testing.T) {
+	storSrv, _, controller := prepare_(t)
+
+	hash, err := hashPassword("secret")
+	require.NoError(t, err)
+	storSrv.EXPECT().GetData("locked").Return("http://example.com/doc", false, nil).AnyTimes()
+	storSrv.EXPECT().GetLinkOptions("locked").Return(models.LinkOptions{PasswordHash: hash}, nil).AnyTimes()
+
+	unlockFrom := func(remoteAddr, password string) *http.Response {
+		form := url.Values{"password": {password}}
+		req := httptest.NewRequest(http.MethodPost, "/locked", strings.NewReader(form.Encode()))
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		controller.UnlockOriginalURL().ServeHTTP(w, req)
+		return w.Result()
+	}
+	unlock := func(password string) *http.Response {
+		return unlockFrom("192.0.2.1:1234", password)
+	}
+
+	t.Run("GetOriginalURL returns password prompt", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/locked?x=1", nil)
+		w := httptest.NewRecorder()
+		controller.GetOriginalURL().ServeHTTP(w, req)
+
+		resp := w.Result()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Empty(t, resp.Header.Get("Location"))
+		assert.Contains(t, w.Body.String(), `action="/locked?x=1"`)
+		if err := resp.Body.Close(); err != nil {
+			controller.sugar.Errorf("resp.Body.Close() error")
+		}
+	})
+
+	t.Run("UnlockOriginalURL wrong password", func(t *testing.T) {
+		resp := unlock("wrong")
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		if err := resp.Body.Close(); err != nil {
+			controller.sugar.Errorf("resp.Body.Close() error")
+		}
+	})
+
+	t.Run("UnlockOriginalURL correct password", func(t *testing.T) {
+		storSrv.EXPECT().RegisterClick("locked", models.Click{Variant: -1}).Return(true, nil)
+		resp := unlock("secret")
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode)
+		assert.Equal(t, "http://example.com/doc", resp.Header.Get("Location"))
+		if err := resp.Body.Close(); err != nil {
+			controller.sugar.Errorf("resp.Body.Close() error")
+		}
+	})
+
+	t.Run("UnlockOriginalURL locked after wrong passwords", func(t *testing.T) {
+		for i := 0; i < maxPasswordAttempts; i++ {
+			resp := unlock("wrong")
+			if err := resp.Body.Close(); err != nil {
+				controller.sugar.Errorf("resp.Body.Close() error")
+			}
+		}
+
+		resp := unlock("secret")
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+		if err := resp.Body.Close(); err != nil {
+			controller.sugar.Errorf("resp.Body.Close() error")
+		}
+	})
+
+	t.Run("UnlockOriginalURL not locked for other clients", func(t *testing.T) {
+		storSrv.EXPECT().RegisterClick("locked", models.Click{Variant: -1}).Return(true, nil)
+		resp := unlockFrom("198.51.100.7:1234", "secret")
+		assert.Equal(t, http.StatusSeeOther, resp.StatusCode, "Expected wrong passwords of one client not to lock out the others")
+		if err := resp.Body.Close(); err != nil {
+			controller.sugar.Errorf("resp.Body.Close() error")
+		}
+	})
+
+	t.Run("UnlockOriginalURL locked for everyone after wrong passwords from many clients", func(t *testing.T) {
+		for i := 0; i < maxLinkPasswordAttempts; i++ {
+			resp := unlockFrom("203.0.113."+strconv.Itoa(i)+":1234", "wrong")
+			if err := resp.Body.Close(); err != nil {
+				controller.sugar.Errorf("resp.Body.Close() error")
+			}
+		}
+
+		resp := unlockFrom("198.51.100.8:1234", "secret")
+		assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+		assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+		if err := resp.Body.Close(); err != nil {
+			controller.sugar.Errorf("resp.Body.Close() error")
+		}
+	})
+}
+
+func TestPasswordAttempts(t *testing.T) {
+	attempts := newPasswordAttempts(maxPasswordAttempts)
+	now := time.Now()
+
+	for i := 0; i < maxPasswordAttempts; i++ {
+		_, locked := attempts.locked("id", now)
+		require.False(t, locked)
+		attempts.fail("id", now)
+	}
+
+	wait, locked := attempts.locked("id", now.Add(time.Minute))
+	require.True(t, locked)
+	require.Equal(t, passwordLockout-time.Minute, wait)
+
+	_, locked = attempts.locked("other", now)
+	require.False(t, locked, "Expected other links not to be locked")
+
+	_, locked = attempts.locked("id", now.Add(passwordLockout))
+	require.False(t, locked, "Expected lock to expire")
+
+	for i := 0; i < maxTrackedAttempts; i++ {
+		attempts.fail(strconv.Itoa(i), now)
+	}
+	attempts.fail("late", now.Add(passwordLockout))
+	require.Len(t, attempts.failures, 1, "Expected expired windows to be dropped")
+
+	// without expired windows the oldest one is dropped
+	later := now.Add(2 * passwordLockout)
+	for i := 0; i < maxPasswordAttempts; i++ {
+		attempts.fail("locked", later)
+	}
+	for i := 0; i < maxTrackedAttempts; i++ {
+		attempts.fail(strconv.Itoa(i), later.Add(time.Second))
+	}
+	require.Len(t, attempts.failures, maxTrackedAttempts)
+	_, locked = attempts.locked("locked", later.Add(time.Second))
+	require.False(t, locked, "Expected the oldest window to be dropped")
+	_, exists := attempts.failures["0"]
+	require.True(t, exists, "Expected the newer windows to be kept")
+}
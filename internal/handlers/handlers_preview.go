@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"html/template"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// previewSuffix - suffix of the short link path requesting the preview page, e.g. "/abc+".
+	previewSuffix = "+"
+	// previewParam - query parameter requesting the preview page, e.g. "/abc?preview=1".
+	previewParam = "preview"
+)
+
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>{{if .Title}}{{.Title}}{{else}}Link preview{{end}}</title></head>
+<body>
+{{if .Warning}}<p><strong>Warning:</strong> the owner of this link asked to show where it goes before you follow it.
+Make sure you trust the destination.</p>{{end}}
+{{if .Title}}<h1>{{.Title}}</h1>{{end}}
+<p>This link goes to:</p>
+<p><code>{{.Destination}}</code></p>
+<p>Created: {{.Created}}</p>
+<form method="post" action="{{.Action}}">
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+// previewRequested reports whether the request asks for the preview page instead of the redirect.
+func previewRequested(link shortLink, query url.Values) bool {
+	return link.preview || query.Get(previewParam) == "1"
+}
+
+// writePreview writes the HTML page showing the destination of the link, its title and creation date.
+// The page is submitted to ctrl.UnlockOriginalURL() to follow the link.
+func (con *Controller) writePreview(res http.ResponseWriter, req *http.Request, link shortLink, destination string) {
+	query := req.URL.Query()
+	query.Del(previewParam)
+	action := "/" + link.id
+	if link.extraPath != "" {
+		action += "/" + link.extraPath
+	}
+	if len(query) > 0 {
+		action += "?" + query.Encode()
+	}
+
+	created := "unknown"
+	if !link.opts.CreatedAt.IsZero() {
+		created = link.opts.CreatedAt.UTC().Format(time.RFC1123)
+	}
+
+	res.Header().Set("Content-Type", "text/html; charset=utf-8")
+	res.Header().Set("Cache-Control", "no-store")
+	res.WriteHeader(http.StatusOK)
+	if req.Method == http.MethodHead {
+		return
+	}
+
+	data := struct {
+		Title       string
+		Destination string
+		Created     string
+		Action      string
+		Warning     bool
+	}{Title: link.opts.Title, Destination: destination, Created: created, Action: action, Warning: link.opts.Interstitial}
+	if err := previewPage.Execute(res, data); err != nil {
+		con.sugar.Errorf("(writePreview) %s", err.Error())
+	}
+}
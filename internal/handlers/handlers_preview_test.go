@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"shortener/internal/domain/models"
+	"shortener/internal/mocks"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetOriginalURLPreview(t *testing.T) {
+	createdAt := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		mockSetup   func(storSrv *mocks.MockStorageService)
+		name        string
+		path        string
+		contains    []string
+		notContains []string
+	}{
+		{
+			name: "plus suffix",
+			path: "/ab+",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetData("ab").Return("https://example.com/sale", false, nil)
+				storSrv.EXPECT().GetLinkOptions("ab").Return(models.LinkOptions{LinkMetadata: models.LinkMetadata{Title: "Spring <sale>"}, CreatedAt: createdAt}, nil)
+			},
+			contains:    []string{"https://example.com/sale", "Spring &lt;sale&gt;", "Mon, 10 Mar 2025 12:00:00 UTC", `action="/ab"`},
+			notContains: []string{"Warning"},
+		},
+		{
+			name: "preview parameter with passthrough",
+			path: "/ab/docs?preview=1&lang=de",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetData("ab").Return("https://example.com", false, nil)
+				storSrv.EXPECT().GetLinkOptions("ab").Return(models.LinkOptions{Passthrough: true}, nil)
+			},
+			contains:    []string{"https://example.com/docs?lang=de", "Created: unknown", `action="/ab/docs?lang=de"`},
+			notContains: []string{"preview=1"},
+		},
+		{
+			name: "interstitial",
+			path: "/ab",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetData("ab").Return("https://untrusted.example", false, nil)
+				storSrv.EXPECT().GetLinkOptions("ab").Return(models.LinkOptions{Interstitial: true}, nil)
+			},
+			contains: []string{"Warning", "https://untrusted.example"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller := prepare_(t)
+			tt.mockSetup(storSrv)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			handler := controller.GetOriginalURL()
+			handler.ServeHTTP(w, req)
+
+			resp := w.Result()
+			if err := resp.Body.Close(); err != nil {
+				controller.sugar.Errorf("resp.Body.Close() error")
+			}
+			assert.Equal(t, http.StatusOK, resp.StatusCode, "Expected the preview page instead of the redirect")
+			for _, s := range tt.contains {
+				assert.Contains(t, w.Body.String(), s)
+			}
+			for _, s := range tt.notContains {
+				assert.NotContains(t, w.Body.String(), s)
+			}
+		})
+	}
+}
+
+func TestShortenURLTitleTooLong(t *testing.T) {
+	_, _, controller := prepare_(t)
+
+	body := `{"url":"https://example.com","title":"` + strings.Repeat("a", maxTitleLength+1) + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(body))
+	req.Header.Set("User-ID", "testUserID")
+	w := httptest.NewRecorder()
+
+	handler := controller.APIShortenURL()
+	handler.ServeHTTP(w, req)
+
+	resp := w.Result()
+	if err := resp.Body.Close(); err != nil {
+		controller.sugar.Errorf("resp.Body.Close() error")
+	}
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"shortener/internal/domain/models"
+	"shortener/internal/qr"
+	"shortener/internal/repository"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// qrMaxAge - how long clients may cache QR codes without revalidation, in seconds.
+const qrMaxAge = "86400"
+
+// GetLinkQR returns the QR code of the short link "id" of the domain addressed by the Host header.
+// The image is configured by the query parameters format (png or svg), size (pixels),
+// margin (modules) and ec (error-correction level L, M, Q or H).
+//
+// HTTP Responses:
+//   - 200 OK: the QR code image.
+//   - 304 Not Modified: if If-None-Match contains the ETag of the image.
+//   - 400 Bad Request: if the query parameters are invalid.
+//   - 404 Not Found: if the link does not exist.
+//   - 410 Gone: if the link has been deleted.
+//   - 500 Internal Server Error: if the link could not be retrieved.
+func (con *Controller) GetLinkQR() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		shortID, ok := con.requestKey(req, chi.URLParam(req, "id"))
+		if !ok {
+			http.NotFound(res, req)
+			return
+		}
+		// unlike GetData, GetLink tells a missing link from a deleted one in every storage
+		data, err := con.storageService.GetLink(shortID)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.NotFound(res, req)
+			return
+		}
+		if err != nil {
+			con.sugar.Errorf("(GetLinkQR) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if data.IsDeleted {
+			http.Error(res, "Gone", http.StatusGone)
+			return
+		}
+
+		con.writeQR(res, req, con.shortURL(shortID), "public")
+	}
+}
+
+// APIGetUserURLQR returns the QR code of a user's short link, configured like ctrl.GetLinkQR().
+// The link of a branded domain is addressed as "id@domain" and its QR code points to that domain.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 200 OK: the QR code image.
+//   - 304 Not Modified: if If-None-Match contains the ETag of the image.
+//   - 400 Bad Request: if the query parameters are invalid.
+//   - 404 Not Found: if the user has no link with the given ID.
+//   - 500 Internal Server Error: if the link could not be retrieved.
+func (con *Controller) APIGetUserURLQR() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		shortID, ok := userLinkKey(chi.URLParam(req, "id"))
+		if !ok {
+			http.Error(res, "Not Found", http.StatusNotFound)
+			return
+		}
+		_, err := con.storageService.GetUserLink(userID, shortID)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(res, "Not Found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			con.sugar.Errorf("(APIGetUserURLQR) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		con.writeQR(res, req, con.shortURL(shortID), "private")
+	}
+}
+
+// userLinkKey returns the storage key of a user's link addressed as "id" or "id@domain"
+// (see models.QualifyShortID), with the domain in lower case like in the stored keys.
+func userLinkKey(id string) (string, bool) {
+	shortID, domain := models.SplitShortID(id)
+	if shortID == "" {
+		return "", false
+	}
+	if domain == "" {
+		return shortID, true
+	}
+	name, ok := models.NormalizeDomain(domain)
+	if !ok {
+		return "", false
+	}
+	return models.QualifyShortID(shortID, name), true
+}
+
+// writeQR writes the QR code of the content rendered with the options of the request.
+// cacheScope is the visibility of the response in Cache-Control ("public" or "private").
+func (con *Controller) writeQR(res http.ResponseWriter, req *http.Request, content, cacheScope string) {
+	opts, err := qr.ParseOptions(req.URL.Query().Get)
+	if err != nil {
+		http.Error(res, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	etag := opts.ETag(content)
+	res.Header().Set("ETag", etag)
+	res.Header().Set("Cache-Control", cacheScope+", max-age="+qrMaxAge)
+	if etagMatches(req.Header.Get("If-None-Match"), etag) {
+		res.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	image, err := qr.Render(content, opts)
+	if err != nil {
+		con.sugar.Errorf("(writeQR) %s", err.Error())
+		http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", opts.ContentType())
+	res.WriteHeader(http.StatusOK)
+	if req.Method == http.MethodHead {
+		return
+	}
+	if _, err := res.Write(image); err != nil {
+		con.sugar.Errorf("res.Write() error: %s", err.Error())
+	}
+}
+
+// etagMatches reports whether the If-None-Match header contains the entity tag.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"shortener/internal/config"
+	"shortener/internal/domain/models"
+	"shortener/internal/logger"
+	"shortener/internal/mocks"
+	"shortener/internal/qr"
+	"shortener/internal/repository"
+	"shortener/internal/storage"
+	"shortener/internal/user"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLinkQR(t *testing.T) {
+	tests := []struct {
+		mockSetup           func(storSrv *mocks.MockStorageService)
+		name                string
+		query               string
+		expectedStatus      int
+		expectedContentType string
+	}{
+		{
+			name: "png",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetLink("ab").Return(models.URLData{OriginalURL: "https://example.com"}, nil)
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "image/png",
+		},
+		{
+			name:  "svg",
+			query: "?format=svg&size=512&margin=1&ec=H",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetLink("ab").Return(models.URLData{OriginalURL: "https://example.com"}, nil)
+			},
+			expectedStatus:      http.StatusOK,
+			expectedContentType: "image/svg+xml",
+		},
+		{
+			name:  "invalid size",
+			query: "?size=1",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetLink("ab").Return(models.URLData{OriginalURL: "https://example.com"}, nil)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name: "deleted",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetLink("ab").Return(models.URLData{OriginalURL: "https://example.com", IsDeleted: true}, nil)
+			},
+			expectedStatus: http.StatusGone,
+		},
+		{
+			name: "not found",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetLink("ab").Return(models.URLData{}, repository.ErrNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name: "storage error",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetLink("ab").Return(models.URLData{}, errors.New("connection refused"))
+			},
+			expectedStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller := prepare_(t)
+			tt.mockSetup(storSrv)
+
+			req := httptest.NewRequest(http.MethodGet, "/ab/qr"+tt.query, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "ab")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+
+			handler := controller.GetLinkQR()
+			handler.ServeHTTP(w, req)
+
+			resp := w.Result()
+			if err := resp.Body.Close(); err != nil {
+				controller.sugar.Errorf("resp.Body.Close() error")
+			}
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			if tt.expectedContentType != "" {
+				assert.Equal(t, tt.expectedContentType, resp.Header.Get("Content-Type"))
+				assert.NotEmpty(t, resp.Header.Get("ETag"))
+				assert.NotEmpty(t, w.Body.Bytes())
+			}
+		})
+	}
+}
+
+func TestGetLinkQRStorageDB(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer db.Close()
+
+	sugarLogger, _ := logger.NewLogger()
+	controller := NewController(config.NewConfig(), &storage.StorageDB{DBConn: db}, sugarLogger, user.NewUserService())
+	defer close(controller.stop)
+
+	// a short ID unknown to the database is not reported as deleted
+	mock.ExpectQuery("FROM urls WHERE short_url").WithArgs("missing").WillReturnError(sql.ErrNoRows)
+
+	req := httptest.NewRequest(http.MethodGet, "/missing/qr", nil)
+	req.Host = "localhost:8080"
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "missing")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	controller.GetLinkQR().ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAPIGetUserURLQRBrandedDomain(t *testing.T) {
+	storSrv, _, controller := prepare_(t)
+	storSrv.EXPECT().GetUserLink("testUserID", "ab@go.brand.com").Return(models.URLData{OriginalURL: "https://example.com"}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/urls/ab@Go.Brand.com/qr", nil)
+	req.Header.Set("User-ID", "testUserID")
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "ab@Go.Brand.com")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+	w := httptest.NewRecorder()
+
+	controller.APIGetUserURLQR().ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	opts, err := qr.ParseOptions(url.Values{}.Get)
+	require.NoError(t, err)
+	assert.Equal(t, opts.ETag("http://go.brand.com/ab"), w.Header().Get("ETag"), "Expected the QR code of the branded domain")
+}
+
+func TestAPIGetUserURLQRNotModified(t *testing.T) {
+	storSrv, _, controller := prepare_(t)
+	storSrv.EXPECT().GetUserLink("testUserID", "ab").Return(models.URLData{OriginalURL: "https://example.com"}, nil).Times(2)
+	storSrv.EXPECT().GetUserLink("testUserID", "other").Return(models.URLData{}, repository.ErrNotFound)
+
+	request := func(shortID, ifNoneMatch string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/user/urls/"+shortID+"/qr", nil)
+		req.Header.Set("User-ID", "testUserID")
+		req.Header.Set("If-None-Match", ifNoneMatch)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", shortID)
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+		w := httptest.NewRecorder()
+
+		handler := controller.APIGetUserURLQR()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	first := request("ab", "")
+	require.Equal(t, http.StatusOK, first.Code)
+	etag := first.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	assert.Equal(t, "private, max-age="+qrMaxAge, first.Header().Get("Cache-Control"))
+
+	second := request("ab", `"other", `+etag)
+	assert.Equal(t, http.StatusNotModified, second.Code)
+	assert.Empty(t, second.Body.Bytes())
+
+	assert.Equal(t, http.StatusNotFound, request("other", "").Code)
+}
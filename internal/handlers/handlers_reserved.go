@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"shortener/internal/domain/models"
+	"shortener/internal/repository"
+	"shortener/internal/routes"
+	"strings"
+)
+
+// errReservedShortIDs - error when stored links have short IDs taking reserved path segments of the service routes.
+var errReservedShortIDs = errors.New("short IDs conflict with service routes")
+
+// shortIDRef - short ID recorded by the audit records of renames.
+type shortIDRef struct {
+	ShortID string `json:"short_id"`
+}
+
+// CheckReservedShortIDs checks at startup that no stored link, in any namespace, has a short ID taking
+// a reserved path segment (see routes.IsReserved), since such a link and the service route would shadow
+// each other. With conf.RenameReserved the links get new generated short IDs; otherwise an error listing
+// them is returned. It must be called after the routes are registered.
+func (con *Controller) CheckReservedShortIDs() error {
+	var conflicts []models.UserLink
+	err := con.storageService.ScanLinks(func(shortID string, data models.URLData) error {
+		if id, _ := models.SplitShortID(shortID); routes.IsReserved(id) {
+			conflicts = append(conflicts, models.UserLink{ShortID: shortID, URLData: data})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	if !con.conf.RenameReserved {
+		ids := make([]string, 0, len(conflicts))
+		for _, link := range conflicts {
+			ids = append(ids, link.ShortID)
+		}
+		return fmt.Errorf("%w: %s (rename them with -rename-reserved)", errReservedShortIDs, strings.Join(ids, ", "))
+	}
+	for _, link := range conflicts {
+		newShortID, err := con.renameReserved(link)
+		if err != nil {
+			return fmt.Errorf("renaming %s: %w", link.ShortID, err)
+		}
+		con.sugar.Infof("Renamed short ID %s to %s", link.ShortID, newShortID)
+	}
+	return nil
+}
+
+// renameReserved gives the link a new generated short ID in the namespace of its domain
+// and records the rename in the audit log.
+func (con *Controller) renameReserved(link models.UserLink) (string, error) {
+	_, domain := models.SplitShortID(link.ShortID)
+	id, err := repository.NewShortID(func(shortID string) (bool, error) {
+		_, err := con.storageService.GetLink(models.QualifyShortID(shortID, domain))
+		if errors.Is(err, repository.ErrNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	})
+	if err != nil {
+		return "", err
+	}
+	newShortID := models.QualifyShortID(id, domain)
+	if err := con.storageService.RenameLink(link.ShortID, newShortID); err != nil {
+		return "", err
+	}
+
+	con.recordAudit(auditSource{actor: models.ActorSystem}, models.AuditLinkRename, newShortID, link.UserID,
+		shortIDRef{ShortID: link.ShortID}, shortIDRef{ShortID: newShortID})
+	return newShortID, nil
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"testing"
+
+	"shortener/internal/domain/models"
+	"shortener/internal/mocks"
+	"shortener/internal/repository"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func expectScanLinks(storSrv *mocks.MockStorageService, shortIDs ...string) {
+	storSrv.EXPECT().ScanLinks(gomock.Any()).DoAndReturn(func(fn func(shortID string, data models.URLData) error) error {
+		for _, shortID := range shortIDs {
+			if err := fn(shortID, models.URLData{OriginalURL: "http://example.com", UserID: "alice"}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func TestCheckReservedShortIDs(t *testing.T) {
+	storSrv, _, controller := prepare_(t)
+	controller.conf.RenameReserved = false
+
+	expectScanLinks(storSrv, "ab", "pinger")
+	require.NoError(t, controller.CheckReservedShortIDs())
+
+	expectScanLinks(storSrv, "ab", "API", "ping@go.brand-a.com")
+	err := controller.CheckReservedShortIDs()
+	require.ErrorIs(t, err, errReservedShortIDs)
+	assert.Contains(t, err.Error(), "API, ping@go.brand-a.com")
+}
+
+func TestCheckReservedShortIDsRename(t *testing.T) {
+	storSrv, _, controller, audit := prepareAudit_(t)
+	controller.conf.RenameReserved = true
+	defer func() { controller.conf.RenameReserved = false }()
+
+	expectScanLinks(storSrv, "ab", "ping@go.brand-a.com")
+	var checked []string
+	storSrv.EXPECT().GetLink(gomock.Any()).DoAndReturn(func(shortID string) (models.URLData, error) {
+		checked = append(checked, shortID)
+		if len(checked) == 1 {
+			return models.URLData{}, nil
+		}
+		return models.URLData{}, repository.ErrNotFound
+	}).Times(2)
+	var renamed string
+	storSrv.EXPECT().RenameLink("ping@go.brand-a.com", gomock.Any()).DoAndReturn(func(_, newShortID string) error {
+		renamed = newShortID
+		return nil
+	})
+	require.NoError(t, controller.CheckReservedShortIDs())
+
+	require.Len(t, checked, 2)
+	assert.NotEqual(t, checked[0], checked[1], "Expected a new short ID after a taken one")
+	assert.Equal(t, checked[1], renamed)
+	id, domain := models.SplitShortID(renamed)
+	assert.NotEqual(t, "ping", id)
+	assert.Equal(t, "go.brand-a.com", domain, "Expected the link to stay in the namespace of its domain")
+
+	records := audit.get()
+	require.Len(t, records, 1)
+	assert.Equal(t, models.AuditLinkRename, records[0].Action)
+	assert.Equal(t, models.ActorSystem, records[0].Actor)
+	assert.Equal(t, renamed, records[0].ShortID)
+	assert.Equal(t, "alice", records[0].UserID)
+	assert.JSONEq(t, `{"short_id":"ping@go.brand-a.com"}`, string(records[0].Before))
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"shortener/internal/domain/models"
+	"shortener/internal/urlnorm"
+	"strconv"
+	"strings"
+)
+
+// languageTag matches the language tags accepted in targeting rules (e.g. "de", "pt-BR", "zh-Hant").
+var languageTag = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// checkRules checks the targeting rules supplied by the user.
+func checkRules(rules []models.TargetingRule) ([]models.TargetingRule, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	checked := make([]models.TargetingRule, 0, len(rules))
+	for _, r := range rules {
+		u, err := urlnorm.Normalize(r.URL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: rule url: %v", errBadLinkOptions, err)
+		}
+		r.URL = u
+		switch r.Platform {
+		case "", models.PlatformIOS, models.PlatformAndroid, models.PlatformDesktop:
+		default:
+			return nil, fmt.Errorf("%w: unsupported rule platform %s", errBadLinkOptions, r.Platform)
+		}
+		if r.Language != "" && !languageTag.MatchString(r.Language) {
+			return nil, fmt.Errorf("%w: invalid rule language %s", errBadLinkOptions, r.Language)
+		}
+		if r.Country != "" {
+			if len(r.Country) != 2 || !isASCIILetters(r.Country) {
+				return nil, fmt.Errorf("%w: invalid rule country %s", errBadLinkOptions, r.Country)
+			}
+			r.Country = strings.ToUpper(r.Country)
+		}
+		if r.Platform == "" && r.Language == "" && r.Country == "" {
+			return nil, fmt.Errorf("%w: rule must have a platform, a language or a country", errBadLinkOptions)
+		}
+		checked = append(checked, r)
+	}
+	return checked, nil
+}
+
+func isASCIILetters(s string) bool {
+	for _, c := range s {
+		if (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// targetURL returns the URL of the first targeting rule matching the visitor from the country.
+func targetURL(rules []models.TargetingRule, req *http.Request, country string) (string, bool) {
+	if len(rules) == 0 {
+		return "", false
+	}
+
+	platform := detectPlatform(req.UserAgent())
+	language := preferredLanguage(req.Header.Get("Accept-Language"))
+
+	for _, r := range rules {
+		if r.Platform != "" && r.Platform != platform {
+			continue
+		}
+		if r.Language != "" && !matchLanguage(r.Language, language) {
+			continue
+		}
+		if r.Country != "" && r.Country != country {
+			continue
+		}
+		return r.URL, true
+	}
+	return "", false
+}
+
+// detectPlatform determines the device platform from the User-Agent header.
+// An empty User-Agent matches no platform.
+func detectPlatform(userAgent string) string {
+	ua := strings.ToLower(userAgent)
+	switch {
+	case ua == "":
+		return ""
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return models.PlatformIOS
+	case strings.Contains(ua, "android"):
+		return models.PlatformAndroid
+	default:
+		return models.PlatformDesktop
+	}
+}
+
+// preferredLanguage returns the language with the highest quality in the Accept-Language header.
+// Of languages with equal quality the first one wins; "*" is ignored.
+func preferredLanguage(acceptLanguage string) string {
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if q > bestQ {
+			best, bestQ = tag, q
+		}
+	}
+	return best
+}
+
+// matchLanguage reports whether the visitor language is the rule language or one of its subtags,
+// e.g. rule "pt" matches "pt-BR", rule "pt-BR" matches only "pt-BR".
+func matchLanguage(rule, language string) bool {
+	if language == "" {
+		return false
+	}
+	if strings.EqualFold(rule, language) {
+		return true
+	}
+	return len(language) > len(rule) && language[len(rule)] == '-' && strings.EqualFold(rule, language[:len(rule)])
+}
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"shortener/internal/domain/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectPlatform(t *testing.T) {
+	tests := map[string]string{
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15": models.PlatformIOS,
+		"Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15":          models.PlatformIOS,
+		"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Mobile":          models.PlatformAndroid,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36":                models.PlatformDesktop,
+		"": "",
+	}
+	for userAgent, expected := range tests {
+		assert.Equal(t, expected, detectPlatform(userAgent), userAgent)
+	}
+}
+
+func TestPreferredLanguage(t *testing.T) {
+	tests := map[string]string{
+		"de-DE,de;q=0.9,en;q=0.8": "de-DE",
+		"en;q=0.5, fr;q=0.8":      "fr",
+		"*, pt-BR;q=0.7":          "pt-BR",
+		"es;q=0":                  "",
+		"":                        "",
+	}
+	for header, expected := range tests {
+		assert.Equal(t, expected, preferredLanguage(header), header)
+	}
+}
+
+func TestTargetURL(t *testing.T) {
+	rules := []models.TargetingRule{
+		{Platform: models.PlatformIOS, URL: "http://apps.apple.example"},
+		{Platform: models.PlatformAndroid, URL: "http://play.example"},
+		{Platform: models.PlatformDesktop, Language: "de", URL: "http://example.de"},
+		{Country: "US", URL: "http://example.us"},
+	}
+
+	tests := []struct {
+		name           string
+		userAgent      string
+		acceptLanguage string
+		country        string
+		expectedURL    string
+		expectedMatch  bool
+	}{
+		{name: "iOS", userAgent: "Mozilla/5.0 (iPhone)", expectedURL: "http://apps.apple.example", expectedMatch: true},
+		{name: "Android", userAgent: "Mozilla/5.0 (Linux; Android 14)", acceptLanguage: "de", expectedURL: "http://play.example", expectedMatch: true},
+		{name: "German desktop", userAgent: "Mozilla/5.0 (X11; Linux x86_64)", acceptLanguage: "de-AT,en;q=0.5", expectedURL: "http://example.de", expectedMatch: true},
+		{name: "English desktop falls back", userAgent: "Mozilla/5.0 (X11; Linux x86_64)", acceptLanguage: "en-US,de;q=0.5"},
+		{name: "US visitor", userAgent: "Mozilla/5.0 (X11; Linux x86_64)", country: "US", expectedURL: "http://example.us", expectedMatch: true},
+		{name: "unknown country falls back", userAgent: "Mozilla/5.0 (X11; Linux x86_64)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/urlapp", nil)
+			req.Header.Set("User-Agent", tt.userAgent)
+			req.Header.Set("Accept-Language", tt.acceptLanguage)
+
+			target, ok := targetURL(rules, req, tt.country)
+			assert.Equal(t, tt.expectedMatch, ok)
+			assert.Equal(t, tt.expectedURL, target)
+		})
+	}
+}
+
+func TestCheckRules(t *testing.T) {
+	_, err := checkRules([]models.TargetingRule{{Platform: "windows", URL: "http://example.com"}})
+	assert.ErrorIs(t, err, errBadLinkOptions)
+
+	_, err = checkRules([]models.TargetingRule{{URL: "http://example.com"}})
+	assert.ErrorIs(t, err, errBadLinkOptions, "Expected rule matching everyone to be rejected")
+
+	_, err = checkRules([]models.TargetingRule{{Language: "de_DE", URL: "http://example.com"}})
+	assert.ErrorIs(t, err, errBadLinkOptions)
+
+	_, err = checkRules([]models.TargetingRule{{Country: "USA", URL: "http://example.com"}})
+	assert.ErrorIs(t, err, errBadLinkOptions)
+
+	rules, err := checkRules([]models.TargetingRule{{Country: "us", URL: "http://example.com"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "US", rules[0].Country, "Expected country code to be upper case")
+
+	rules, err = checkRules([]models.TargetingRule{{Platform: models.PlatformIOS, Language: "pt-BR", URL: "http://example.com"}})
+	assert.NoError(t, err)
+	assert.Len(t, rules, 1)
+}
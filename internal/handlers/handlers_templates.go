@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"shortener/internal/domain/models"
+	"shortener/internal/repository"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// utmTemplateRequest - body of the request to create or update a UTM template.
+type utmTemplateRequest struct {
+	Name   string            `json:"name"`
+	Params map[string]string `json:"params"`
+}
+
+// validate checks that the template has a name and only non-empty utm_* parameters.
+func (t utmTemplateRequest) validate() error {
+	if strings.TrimSpace(t.Name) == "" {
+		return errors.New("name is required")
+	}
+	if len(t.Params) == 0 {
+		return errors.New("params are required")
+	}
+	for key, value := range t.Params {
+		if !strings.HasPrefix(key, "utm_") || len(key) == len("utm_") {
+			return errors.New("unsupported parameter " + key)
+		}
+		if value == "" {
+			return errors.New("empty value of parameter " + key)
+		}
+	}
+	return nil
+}
+
+// APIGetUserTemplates handles requests to retrieve the UTM templates of a user.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 204 No Content: if the user has no templates.
+//   - 200 OK: successful retrieval of the templates in JSON format.
+//   - 500 Internal Server Error: if the templates could not be retrieved.
+func (con *Controller) APIGetUserTemplates() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		templates, err := con.storageService.GetUTMTemplates(userID)
+		if err != nil {
+			con.sugar.Errorf("(APIGetUserTemplates) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if len(templates) == 0 {
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		con.writeJSON(res, http.StatusOK, templates)
+	}
+}
+
+// APISaveUserTemplate handles requests to create a UTM template or to replace
+// the parameters of the user's template with the same name.
+// Links using the template get the new parameters on the next redirect.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 400 Bad Request: if the template is invalid.
+//   - 201 Created: if the template was created.
+//   - 200 OK: if the template was updated.
+//   - 500 Internal Server Error: if the template could not be saved.
+func (con *Controller) APISaveUserTemplate() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var body utmTemplateRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(res, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		if err := body.validate(); err != nil {
+			http.Error(res, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		saved, created, err := con.storageService.SaveUTMTemplate(models.UTMTemplate{
+			ID:     uuid.New().String(),
+			UserID: userID,
+			Name:   body.Name,
+			Params: body.Params,
+		})
+		if err != nil {
+			con.sugar.Errorf("(APISaveUserTemplate) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		con.writeJSON(res, status, saved)
+	}
+}
+
+// APIDeleteUserTemplate handles requests to delete the user's UTM template by name.
+// Links using the template are redirected without its parameters.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 204 No Content: if the template was deleted.
+//   - 404 Not Found: if the user has no template with this name.
+//   - 500 Internal Server Error: if the template could not be deleted.
+func (con *Controller) APIDeleteUserTemplate() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		err := con.storageService.DeleteUTMTemplate(userID, chi.URLParam(req, "name"))
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(res, "Not Found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			con.sugar.Errorf("(APIDeleteUserTemplate) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// applyUTMTemplate adds the parameters of the template to the original URL.
+// A deleted template leaves the original URL unchanged.
+func (con *Controller) applyUTMTemplate(originalURL, templateID string) (string, error) {
+	tpl, err := con.storageService.GetUTMTemplate(templateID)
+	if errors.Is(err, repository.ErrNotFound) {
+		return originalURL, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return utmTemplateURL(originalURL, tpl)
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"shortener/internal/domain/models"
+	"shortener/internal/mocks"
+	"shortener/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPISaveUserTemplate(t *testing.T) {
+	tests := []struct {
+		mockSetup      func(storSrv *mocks.MockStorageService)
+		name           string
+		userID         string
+		requestBody    string
+		expectedStatus int
+	}{
+		{
+			name:        "APISaveUserTemplate created",
+			userID:      "testUserID",
+			requestBody: `{"name":"spring","params":{"utm_source":"newsletter","utm_campaign":"spring"}}`,
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().SaveUTMTemplate(gomock.Any()).DoAndReturn(func(tpl models.UTMTemplate) (models.UTMTemplate, bool, error) {
+					return tpl, true, nil
+				})
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:        "APISaveUserTemplate updated",
+			userID:      "testUserID",
+			requestBody: `{"name":"spring","params":{"utm_source":"blog"}}`,
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().SaveUTMTemplate(gomock.Any()).Return(models.UTMTemplate{ID: "tpl1", Name: "spring"}, false, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "APISaveUserTemplate not utm parameter",
+			userID:         "testUserID",
+			requestBody:    `{"name":"spring","params":{"ref":"x"}}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "APISaveUserTemplate without name",
+			userID:         "testUserID",
+			requestBody:    `{"params":{"utm_source":"x"}}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "APISaveUserTemplate Unauthorized",
+			requestBody:    `{"name":"spring","params":{"utm_source":"x"}}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller := prepare_(t)
+			tt.mockSetup(storSrv)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user/templates", bytes.NewBufferString(tt.requestBody))
+			req.Header.Set("User-ID", tt.userID)
+			w := httptest.NewRecorder()
+
+			handler := controller.APISaveUserTemplate()
+			handler.ServeHTTP(w, req)
+
+			resp := w.Result()
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			if err := resp.Body.Close(); err != nil {
+				controller.sugar.Errorf("resp.Body.Close() error")
+			}
+		})
+	}
+}
+
+func TestAPIGetUserTemplates(t *testing.T) {
+	tests := []struct {
+		mockSetup      func(storSrv *mocks.MockStorageService)
+		name           string
+		expectedStatus int
+	}{
+		{
+			name: "APIGetUserTemplates ok",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetUTMTemplates("testUserID").Return([]models.UTMTemplate{
+					{ID: "tpl1", Name: "spring", Params: map[string]string{"utm_source": "newsletter"}},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "APIGetUserTemplates StatusNoContent",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetUTMTemplates("testUserID").Return([]models.UTMTemplate{}, nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller := prepare_(t)
+			tt.mockSetup(storSrv)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/user/templates", nil)
+			req.Header.Set("User-ID", "testUserID")
+			w := httptest.NewRecorder()
+
+			handler := controller.APIGetUserTemplates()
+			handler.ServeHTTP(w, req)
+
+			resp := w.Result()
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			if err := resp.Body.Close(); err != nil {
+				controller.sugar.Errorf("resp.Body.Close() error")
+			}
+		})
+	}
+}
+
+func TestAPIDeleteUserTemplate(t *testing.T) {
+	tests := []struct {
+		err            error
+		name           string
+		expectedStatus int
+	}{
+		{name: "APIDeleteUserTemplate ok", err: nil, expectedStatus: http.StatusNoContent},
+		{name: "APIDeleteUserTemplate not found", err: repository.ErrNotFound, expectedStatus: http.StatusNotFound},
+		{name: "APIDeleteUserTemplate storage error", err: errors.New("db"), expectedStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller := prepare_(t)
+			storSrv.EXPECT().DeleteUTMTemplate("testUserID", "spring").Return(tt.err)
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("name", "spring")
+			req := httptest.NewRequest(http.MethodDelete, "/api/user/templates/spring", nil)
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			req.Header.Set("User-ID", "testUserID")
+			w := httptest.NewRecorder()
+
+			handler := controller.APIDeleteUserTemplate()
+			handler.ServeHTTP(w, req)
+
+			resp := w.Result()
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			if err := resp.Body.Close(); err != nil {
+				controller.sugar.Errorf("resp.Body.Close() error")
+			}
+		})
+	}
+}
+
+func TestAPIShortenURLWithUTMTemplate(t *testing.T) {
+	storSrv, userSrv, controller := prepare_(t)
+
+	storSrv.EXPECT().GetUTMTemplates("testUserID").Return([]models.UTMTemplate{{ID: "tpl1", Name: "spring"}}, nil).Times(2)
+	storSrv.EXPECT().UpdateData(gomock.Any(), "https://example.com", "testUserID", models.LinkOptions{UTMTemplateID: "tpl1"}).Return("abc", nil)
+	userSrv.EXPECT().AddURLs(controller.conf.BaseURL, "testUserID", "abc", "https://example.com", models.LinkMetadata{})
+
+	for body, expectedStatus := range map[string]int{
+		`{"url":"https://example.com","utm_template":"spring"}`:  http.StatusCreated,
+		`{"url":"https://example.com","utm_template":"unknown"}`: http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(body))
+		req.Header.Set("User-ID", "testUserID")
+		w := httptest.NewRecorder()
+
+		handler := controller.APIShortenURL()
+		handler.ServeHTTP(w, req)
+
+		resp := w.Result()
+		assert.Equal(t, expectedStatus, resp.StatusCode)
+		if err := resp.Body.Close(); err != nil {
+			controller.sugar.Errorf("resp.Body.Close() error")
+		}
+	}
+}
@@ -8,12 +8,18 @@ import (
 	"log"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
 	"testing"
 
 	"shortener/internal/config"
+	"shortener/internal/domain/models"
 	"shortener/internal/logger"
 	"shortener/internal/mocks"
+	"shortener/internal/repository"
 	"shortener/internal/storage"
+	"shortener/internal/urlnorm"
 	"shortener/internal/user"
 
 	"github.com/golang/mock/gomock"
@@ -36,7 +42,8 @@ func SelectStorage(c *config.Config) storage.StorageService {
 			if err != nil {
 				log.Printf(" restore error\n")
 			} else {
-				storage.AutoSave(s)
+				sugarLogger, _ := logger.NewLogger()
+				storage.AutoSave(s, sugarLogger)
 				return s
 			}
 		} else {
@@ -70,7 +77,7 @@ func TestAPIShortenURL(t *testing.T) {
 			r := httptest.NewRequest(tc.method, "/api/shorten", bytes.NewBufferString(fmt.Sprintf(`{"url":"%s"}`, tc.data)))
 			w := httptest.NewRecorder()
 
-			handler := controller.Authenticate(controller.ShortenURL())
+			handler := controller.Authenticate(controller.APIShortenURL())
 			handler.ServeHTTP(w, r)
 
 			res := w.Result()
@@ -85,6 +92,36 @@ func TestAPIShortenURL(t *testing.T) {
 	}
 }
 
+func TestAPIShortenURLInvalidRedirectType(t *testing.T) {
+	_, _, controller := prepare_(t)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"url":"https://example.com","redirect_type":200}`))
+	r.Header.Set("User-ID", "testUserID")
+	w := httptest.NewRecorder()
+
+	handler := controller.APIShortenURL()
+	handler.ServeHTTP(w, r)
+
+	res := w.Result()
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	if err := res.Body.Close(); err != nil {
+		controller.sugar.Errorf("res.Body.Close() error")
+	}
+}
+
+func TestAPIShortenURLNoFreeShortID(t *testing.T) {
+	storSrv, _, controller := prepare_(t)
+	storSrv.EXPECT().UpdateData(gomock.Any(), "https://example.com/", "testUserID", gomock.Any()).
+		Return("", repository.ErrShortIDExhausted)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/shorten", bytes.NewBufferString(`{"url":"https://example.com/"}`))
+	r.Header.Set("User-ID", "testUserID")
+	w := httptest.NewRecorder()
+	controller.APIShortenURL().ServeHTTP(w, r)
+
+	require.Equal(t, http.StatusInternalServerError, w.Code, "Expected a failed insert not to be reported as created")
+}
+
 func TestShortenURL(t *testing.T) {
 	testCases := []struct {
 		method       string
@@ -122,6 +159,32 @@ func TestShortenURL(t *testing.T) {
 }
 
 func prepare_(t *testing.T) (*mocks.MockStorageService, *mocks.MockUserService, *Controller) {
+	mockStorageService, mockUserService, controller, _ := prepareAudit_(t)
+	return mockStorageService, mockUserService, controller
+}
+
+// auditRecorder collects the audit records appended through the mocked storage.
+type auditRecorder struct {
+	records []models.AuditRecord
+	mu      sync.Mutex
+}
+
+func (a *auditRecorder) append(record models.AuditRecord) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records = append(a.records, record)
+	return nil
+}
+
+// get returns the collected records, oldest first.
+func (a *auditRecorder) get() []models.AuditRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return slices.Clone(a.records)
+}
+
+// prepareAudit_ is prepare_ that also returns the recorder of the appended audit records.
+func prepareAudit_(t *testing.T) (*mocks.MockStorageService, *mocks.MockUserService, *Controller, *auditRecorder) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -130,17 +193,25 @@ func prepare_(t *testing.T) (*mocks.MockStorageService, *mocks.MockUserService,
 	// _ = config.Init(conf) // TODO ???
 	mockStorageService := mocks.NewMockStorageService(ctrl)
 	mockUserService := mocks.NewMockUserService(ctrl)
+	// link lifecycle events are checked by the webhook tests
+	mockStorageService.EXPECT().EnqueueWebhookEvent(gomock.Any()).Return(nil).AnyTimes()
+	audit := &auditRecorder{}
+	mockStorageService.EXPECT().AppendAudit(gomock.Any()).DoAndReturn(audit.append).AnyTimes()
+	// httptest requests are addressed to example.com, which is not a branded domain
+	mockStorageService.EXPECT().GetDomain("example.com").Return(models.Domain{}, repository.ErrNotFound).AnyTimes()
 
 	controller := NewController(conf, mockStorageService, sugarLogger, mockUserService)
 
-	return mockStorageService, mockUserService, controller
+	return mockStorageService, mockUserService, controller, audit
 }
 
 func TestGetOriginalURL(t *testing.T) {
 	tests := []struct {
 		mockSetup        func(storSrv *mocks.MockStorageService, controller *Controller)
 		name             string
+		method           string
 		requestPath      string
+		userAgent        string
 		expectedLocation string
 		expectedStatus   int
 	}{
@@ -149,10 +220,134 @@ func TestGetOriginalURL(t *testing.T) {
 			requestPath: "/url1",
 			mockSetup: func(storSrv *mocks.MockStorageService, controller *Controller) {
 				storSrv.EXPECT().GetData("url1").Return("http://example.com/1", false, nil)
+				storSrv.EXPECT().GetLinkOptions("url1").Return(models.LinkOptions{}, nil)
+				storSrv.EXPECT().RegisterClick("url1", models.Click{Variant: -1}).Return(true, nil)
 			},
 			expectedStatus:   http.StatusTemporaryRedirect,
 			expectedLocation: "http://example.com/1",
 		},
+		{
+			name:        "GetOriginalURL per-link redirect type",
+			requestPath: "/url301",
+			mockSetup: func(storSrv *mocks.MockStorageService, controller *Controller) {
+				storSrv.EXPECT().GetData("url301").Return("http://example.com/301", false, nil)
+				storSrv.EXPECT().GetLinkOptions("url301").Return(models.LinkOptions{RedirectType: http.StatusMovedPermanently}, nil)
+				storSrv.EXPECT().RegisterClick("url301", models.Click{Variant: -1}).Return(true, nil)
+			},
+			expectedStatus:   http.StatusMovedPermanently,
+			expectedLocation: "http://example.com/301",
+		},
+		{
+			name:        "GetOriginalURL weighted destination",
+			requestPath: "/urlab",
+			mockSetup: func(storSrv *mocks.MockStorageService, controller *Controller) {
+				storSrv.EXPECT().GetData("urlab").Return("http://example.com/ab", false, nil)
+				storSrv.EXPECT().GetLinkOptions("urlab").Return(models.LinkOptions{Destinations: []models.Destination{
+					{URL: "http://example.com/b", Weight: 1},
+				}}, nil)
+				storSrv.EXPECT().RegisterClick("urlab", models.Click{Variant: 0}).Return(true, nil)
+			},
+			expectedStatus:   http.StatusTemporaryRedirect,
+			expectedLocation: "http://example.com/b",
+		},
+		{
+			name:        "GetOriginalURL targeting rule",
+			requestPath: "/urlapp",
+			userAgent:   "Mozilla/5.0 (Linux; Android 14; Pixel 8) Mobile",
+			mockSetup: func(storSrv *mocks.MockStorageService, controller *Controller) {
+				storSrv.EXPECT().GetData("urlapp").Return("http://example.com/web", false, nil)
+				storSrv.EXPECT().GetLinkOptions("urlapp").Return(models.LinkOptions{
+					Rules: []models.TargetingRule{
+						{Platform: models.PlatformIOS, URL: "http://apps.apple.example"},
+						{Platform: models.PlatformAndroid, URL: "http://play.example"},
+					},
+					Destinations: []models.Destination{{URL: "http://example.com/b", Weight: 1}},
+				}, nil)
+				storSrv.EXPECT().RegisterClick("urlapp", models.Click{Variant: -1}).Return(true, nil)
+			},
+			expectedStatus:   http.StatusTemporaryRedirect,
+			expectedLocation: "http://play.example",
+		},
+		{
+			name:        "GetOriginalURL passthrough",
+			requestPath: "/urlpass/docs/a%20b?utm_source=newsletter&ref=req",
+			mockSetup: func(storSrv *mocks.MockStorageService, controller *Controller) {
+				storSrv.EXPECT().GetData("urlpass").Return("http://example.com/base/?ref=link", false, nil)
+				storSrv.EXPECT().GetLinkOptions("urlpass").Return(models.LinkOptions{Passthrough: true}, nil)
+				storSrv.EXPECT().RegisterClick("urlpass", models.Click{Variant: -1}).Return(true, nil)
+			},
+			expectedStatus:   http.StatusTemporaryRedirect,
+			expectedLocation: "http://example.com/base/docs/a%20b?ref=link&utm_source=newsletter",
+		},
+		{
+			name:        "GetOriginalURL UTM template",
+			requestPath: "/urlutm?utm_source=visitor&x=1",
+			mockSetup: func(storSrv *mocks.MockStorageService, controller *Controller) {
+				storSrv.EXPECT().GetData("urlutm").Return("http://example.com/?utm_medium=link", false, nil)
+				storSrv.EXPECT().GetLinkOptions("urlutm").Return(models.LinkOptions{UTMTemplateID: "tpl1", Passthrough: true}, nil)
+				storSrv.EXPECT().GetUTMTemplate("tpl1").Return(models.UTMTemplate{
+					ID:     "tpl1",
+					Params: map[string]string{"utm_source": "newsletter", "utm_medium": "email"},
+				}, nil)
+				storSrv.EXPECT().RegisterClick("urlutm", models.Click{Variant: -1}).Return(true, nil)
+			},
+			expectedStatus:   http.StatusTemporaryRedirect,
+			expectedLocation: "http://example.com/?utm_medium=link&utm_source=newsletter&x=1",
+		},
+		{
+			name:        "GetOriginalURL deleted UTM template",
+			requestPath: "/urlutm",
+			mockSetup: func(storSrv *mocks.MockStorageService, controller *Controller) {
+				storSrv.EXPECT().GetData("urlutm").Return("http://example.com/", false, nil)
+				storSrv.EXPECT().GetLinkOptions("urlutm").Return(models.LinkOptions{UTMTemplateID: "tpl1"}, nil)
+				storSrv.EXPECT().GetUTMTemplate("tpl1").Return(models.UTMTemplate{}, repository.ErrNotFound)
+				storSrv.EXPECT().RegisterClick("urlutm", models.Click{Variant: -1}).Return(true, nil)
+			},
+			expectedStatus:   http.StatusTemporaryRedirect,
+			expectedLocation: "http://example.com/",
+		},
+		{
+			name:        "GetOriginalURL trailing path without passthrough",
+			requestPath: "/url1/extra",
+			mockSetup: func(storSrv *mocks.MockStorageService, controller *Controller) {
+				storSrv.EXPECT().GetData("url1").Return("http://example.com/1", false, nil)
+				storSrv.EXPECT().GetLinkOptions("url1").Return(models.LinkOptions{}, nil)
+			},
+			expectedStatus:   http.StatusNotFound,
+			expectedLocation: "",
+		},
+		{
+			name:        "GetOriginalURL click limit reached",
+			requestPath: "/urlonce",
+			mockSetup: func(storSrv *mocks.MockStorageService, controller *Controller) {
+				storSrv.EXPECT().GetData("urlonce").Return("http://example.com/once", false, nil)
+				storSrv.EXPECT().GetLinkOptions("urlonce").Return(models.LinkOptions{MaxClicks: 1, Clicks: 1}, nil)
+			},
+			expectedStatus:   http.StatusGone,
+			expectedLocation: "",
+		},
+		{
+			name:        "GetOriginalURL click limit reached concurrently",
+			requestPath: "/urlonce",
+			mockSetup: func(storSrv *mocks.MockStorageService, controller *Controller) {
+				storSrv.EXPECT().GetData("urlonce").Return("http://example.com/once", false, nil)
+				storSrv.EXPECT().GetLinkOptions("urlonce").Return(models.LinkOptions{MaxClicks: 1}, nil)
+				storSrv.EXPECT().RegisterClick("urlonce", models.Click{Variant: -1}).Return(false, nil)
+			},
+			expectedStatus:   http.StatusGone,
+			expectedLocation: "",
+		},
+		{
+			name:        "GetOriginalURL HEAD",
+			method:      http.MethodHead,
+			requestPath: "/url308",
+			mockSetup: func(storSrv *mocks.MockStorageService, controller *Controller) {
+				storSrv.EXPECT().GetData("url308").Return("http://example.com/308", false, nil)
+				storSrv.EXPECT().GetLinkOptions("url308").Return(models.LinkOptions{RedirectType: http.StatusPermanentRedirect}, nil)
+			},
+			expectedStatus:   http.StatusPermanentRedirect,
+			expectedLocation: "http://example.com/308",
+		},
 		{
 			name:        "GetOriginalURL url not found",
 			requestPath: "/notfound",
@@ -175,10 +370,16 @@ func TestGetOriginalURL(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			storSrv, _, controller := prepare_(t)
+			storSrv, userSrv, controller := prepare_(t)
+			userSrv.EXPECT().GetUserIDFromCookie(gomock.Any()).Return("", http.ErrNoCookie).AnyTimes()
 			tt.mockSetup(storSrv, controller)
 
-			req := httptest.NewRequest("GET", tt.requestPath, nil)
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tt.requestPath, nil)
+			req.Header.Set("User-Agent", tt.userAgent)
 			w := httptest.NewRecorder()
 
 			handler := controller.GetOriginalURL()
@@ -186,6 +387,9 @@ func TestGetOriginalURL(t *testing.T) {
 
 			resp := w.Result()
 			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			if method == http.MethodHead {
+				assert.Empty(t, w.Body.String())
+			}
 
 			if tt.expectedLocation != "" {
 				location, err := resp.Location()
@@ -214,7 +418,7 @@ func TestDeleteUserURLs(t *testing.T) {
 				userSrv.EXPECT().SetUserIDCookie(w, uid).Return(nil)
 				req.Header.Set("User-ID", uid)
 
-				storSrv.EXPECT().BatchDeleteURLs(uid, gomock.Any()).Return(nil)
+				storSrv.EXPECT().BatchDeleteURLs(uid, gomock.Any()).Return([]string{"url1"}, nil)
 			},
 			expectedStatus: http.StatusAccepted,
 		},
@@ -272,10 +476,12 @@ func TestAPIGetUserURLs(t *testing.T) {
 				userSrv.EXPECT().SetUserIDCookie(w, uid).Return(nil)
 				req.Header.Set("User-ID", uid)
 
-				userSrv.EXPECT().GetUserURLs(uid).Return([]user.UserURL{
-					{ShortURL: "url1", OriginalURL: "http://example.com/1"},
-					{ShortURL: "url2", OriginalURL: "http://example.com/2"},
-				}, true)
+				storSrv.EXPECT().ListUserLinks(uid, models.LinkQuery{Limit: models.DefaultPageSize, Sort: models.SortCreated}).Return(models.LinkPage{
+					Links: []models.UserLink{
+						{ShortID: "url1", URLData: models.URLData{OriginalURL: "http://example.com/1"}},
+						{ShortID: "url2", URLData: models.URLData{OriginalURL: "http://example.com/2"}},
+					},
+				}, nil)
 			},
 			expectedStatus: http.StatusOK,
 		},
@@ -286,17 +492,14 @@ func TestAPIGetUserURLs(t *testing.T) {
 			expectedStatus: http.StatusUnauthorized,
 		},
 		{
-			name: "APIGetUserURLs StatusUnauthorized (URL doesn't exists)",
+			name: "APIGetUserURLs StatusInternalServerError",
 			mockSetup: func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService, w *httptest.ResponseRecorder, req *http.Request) {
 				uid := "testUserID"
 				userSrv.EXPECT().SetUserIDCookie(w, uid).Return(nil)
 				req.Header.Set("User-ID", uid)
-				userSrv.EXPECT().GetUserURLs(uid).Return([]user.UserURL{
-					{ShortURL: "url1", OriginalURL: "http://example.com/1"},
-					{ShortURL: "url2", OriginalURL: "http://example.com/2"},
-				}, false)
+				storSrv.EXPECT().ListUserLinks(uid, gomock.Any()).Return(models.LinkPage{}, errors.New("connection refused"))
 			},
-			expectedStatus: http.StatusUnauthorized,
+			expectedStatus: http.StatusInternalServerError,
 		},
 		{
 			name: "APIGetUserURLs StatusNoContent",
@@ -304,7 +507,7 @@ func TestAPIGetUserURLs(t *testing.T) {
 				uid := "testUserID"
 				userSrv.EXPECT().SetUserIDCookie(w, uid).Return(nil)
 				req.Header.Set("User-ID", uid)
-				userSrv.EXPECT().GetUserURLs(uid).Return([]user.UserURL{}, true)
+				storSrv.EXPECT().ListUserLinks(uid, gomock.Any()).Return(models.LinkPage{}, nil)
 			},
 			expectedStatus: http.StatusNoContent,
 		},
@@ -352,8 +555,8 @@ func TestAPIShortenBatchURL(t *testing.T) {
 				userSrv.EXPECT().SetUserIDCookie(w, uid).Return(nil)
 				req.Header.Set("User-ID", uid)
 
-				storSrv.EXPECT().UpdateData(req, "http://example.com/1", uid).Return("url1", nil)
-				userSrv.EXPECT().AddURLs(controller.conf.BaseURL, uid, "url1", "http://example.com/1")
+				storSrv.EXPECT().UpdateData(req, "http://example.com/1", uid, models.LinkOptions{}).Return("url1", nil)
+				userSrv.EXPECT().AddURLs(controller.conf.BaseURL, uid, "url1", "http://example.com/1", models.LinkMetadata{})
 			},
 			expectedStatus: http.StatusCreated,
 			expectedBody: []batchResponseEntity{
@@ -453,3 +656,155 @@ func TestPingHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestPassthroughURL(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		extraPath   string
+		query       string
+		expected    string
+	}{
+		{
+			name:        "nothing to pass",
+			destination: "http://example.com/path?b=2&a=1",
+			expected:    "http://example.com/path?b=2&a=1",
+		},
+		{
+			name:        "path appended",
+			destination: "http://example.com/base",
+			extraPath:   "extra/path",
+			expected:    "http://example.com/base/extra/path",
+		},
+		{
+			name:        "destination parameters take precedence",
+			destination: "http://example.com/?utm_source=site",
+			query:       "utm_source=newsletter&utm_medium=email",
+			expected:    "http://example.com/?utm_medium=email&utm_source=site",
+		},
+		{
+			name:        "fragment is kept",
+			destination: "http://example.com/page#top",
+			extraPath:   "sub",
+			query:       "x=1",
+			expected:    "http://example.com/page/sub?x=1#top",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+
+			result, err := passthroughURL(tt.destination, tt.extraPath, query)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, result)
+		})
+	}
+}
+
+func TestShortenURLValidation(t *testing.T) {
+	tests := []struct {
+		mockSetup      func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService)
+		name           string
+		contentType    string
+		body           string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{
+			name: "normalized",
+			body: " HTTPS://Example.COM:443/a\n",
+			mockSetup: func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService) {
+				storSrv.EXPECT().UpdateData(gomock.Any(), "https://example.com/a", "testUserID", models.LinkOptions{}).Return("abc", nil)
+				userSrv.EXPECT().AddURLs(gomock.Any(), "testUserID", "abc", "https://example.com/a", models.LinkMetadata{})
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "javascript",
+			body:           "javascript:alert(1)",
+			mockSetup:      func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   urlnorm.CodeSchemeNotAllowed,
+		},
+		{
+			name:           "empty",
+			body:           "",
+			mockSetup:      func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService) {},
+			expectedStatus: http.StatusBadRequest,
+			expectedCode:   urlnorm.CodeEmpty,
+		},
+		{
+			name:           "invalid json",
+			contentType:    "application/json",
+			body:           `{"url":`,
+			mockSetup:      func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "html without link",
+			contentType:    "text/html",
+			body:           `<p>no link</p>`,
+			mockSetup:      func(storSrv *mocks.MockStorageService, userSrv *mocks.MockUserService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, userSrv, controller := prepare_(t)
+			tt.mockSetup(storSrv, userSrv)
+
+			r := httptest.NewRequest(http.MethodPost, "/", bytes.NewBufferString(tt.body))
+			r.Header.Set("User-ID", "testUserID")
+			r.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+
+			controller.ShortenURL().ServeHTTP(w, r)
+
+			res := w.Result()
+			defer func() {
+				if err := res.Body.Close(); err != nil {
+					controller.sugar.Errorf("res.Body.Close() error")
+				}
+			}()
+			require.Equal(t, tt.expectedStatus, res.StatusCode)
+
+			if tt.expectedCode != "" {
+				var body errorResponse
+				require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+				assert.Equal(t, tt.expectedCode, body.Error.Code)
+				assert.Equal(t, "url", body.Error.Field)
+			}
+		})
+	}
+}
+
+func TestAPIShortenBatchURLValidation(t *testing.T) {
+	_, _, controller := prepare_(t)
+
+	r := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", bytes.NewBufferString(
+		`[{"correlation_id":"1","original_url":"https://example.com"},{"correlation_id":"2","original_url":"ftp://example.com/file"}]`))
+	r.Header.Set("User-ID", "testUserID")
+	w := httptest.NewRecorder()
+
+	controller.APIShortenBatchURL().ServeHTTP(w, r)
+
+	res := w.Result()
+	defer func() {
+		if err := res.Body.Close(); err != nil {
+			controller.sugar.Errorf("res.Body.Close() error")
+		}
+	}()
+	require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+	var body errorResponse
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&body))
+	assert.Equal(t, errorDetails{
+		Code:          urlnorm.CodeSchemeNotAllowed,
+		Message:       "scheme ftp is not allowed",
+		Field:         "original_url",
+		CorrelationID: "2",
+	}, body.Error)
+}
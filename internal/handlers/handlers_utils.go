@@ -3,27 +3,47 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
 	"regexp"
+	"shortener/internal/domain/models"
+	"shortener/internal/urlnorm"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
 var shorturl struct {
 	URL string `json:"result"`
 }
 
-var origurl struct {
+// linkRequestOptions - link settings accepted by the shorten handlers.
+type linkRequestOptions struct {
+	models.LinkOptions
+	UTMTemplate string `json:"utm_template,omitempty"`
+	Password    string `json:"password,omitempty"`
+	// Domain: branded domain to create the link on (the default domain if empty).
+	Domain string `json:"domain,omitempty"`
+}
+
+type shortenRequestEntity struct {
 	URL string `json:"url"`
+	linkRequestOptions
 }
 
 type batchRequestEntity struct {
 	CorrelationID string `json:"correlation_id"`
 	OriginalURL   string `json:"original_url"`
+	linkRequestOptions
 }
 
 type batchResponseEntity struct {
@@ -72,7 +92,24 @@ func (w gzipWriter) Write(b []byte) (int, error) {
 	return w.Writer.Write(b)
 }
 
-func extractURLfromHTML(res http.ResponseWriter, req *http.Request) string {
+// writeJSON writes v to the HTTP response as JSON with the given status code.
+func (con *Controller) writeJSON(res http.ResponseWriter, status int, v any) {
+	resp, err := json.Marshal(v)
+	if err != nil {
+		http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.WriteHeader(status)
+	if _, err := res.Write(resp); err != nil {
+		con.sugar.Errorf("res.Write() error: %s", err.Error())
+	}
+}
+
+// extractURLfromHTML returns the first link of the HTML body.
+// If there is no link, the error response is written and false is returned.
+func extractURLfromHTML(res http.ResponseWriter, req *http.Request) (string, bool) {
 	b, _ := io.ReadAll(req.Body)
 	body := string(b)
 
@@ -80,19 +117,418 @@ func extractURLfromHTML(res http.ResponseWriter, req *http.Request) string {
 	matches := re.FindStringSubmatch(body)
 
 	if len(matches) > 1 {
-		return matches[1]
+		return matches[1], true
 	} else {
 		http.Error(res, "Bad Request", http.StatusBadRequest)
-		return ""
+		return "", false
 	}
 }
 
-func extractURLfromJSON(res http.ResponseWriter, req *http.Request) string {
-	if err := json.NewDecoder(req.Body).Decode(&origurl); err != nil {
+// extractURLfromJSON decodes the JSON body of the shorten request.
+// If the body is invalid, the error response is written and false is returned.
+func extractURLfromJSON(res http.ResponseWriter, req *http.Request) (shortenRequestEntity, bool) {
+	var body shortenRequestEntity
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
 		http.Error(res, "Bad Request", http.StatusBadRequest)
-		return ""
+		return shortenRequestEntity{}, false
+	}
+	return body, true
+}
+
+// errorDetails - description of the error in structured error responses.
+type errorDetails struct {
+	Code          string `json:"code"`
+	Message       string `json:"message"`
+	Field         string `json:"field,omitempty"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// errorResponse - body of structured error responses.
+type errorResponse struct {
+	Error errorDetails `json:"error"`
+}
+
+// invalidURLError writes the 400 response for a destination URL rejected by urlnorm.Normalize.
+func (con *Controller) invalidURLError(res http.ResponseWriter, field, correlationID string, err error) {
+	con.writeJSON(res, http.StatusBadRequest, errorResponse{Error: invalidURLDetails(field, correlationID, err)})
+}
+
+// invalidURLDetails describes a destination URL rejected by urlnorm.Normalize.
+func invalidURLDetails(field, correlationID string, err error) errorDetails {
+	details := errorDetails{Code: urlnorm.CodeMalformed, Message: err.Error(), Field: field, CorrelationID: correlationID}
+	var urlErr *urlnorm.Error
+	if errors.As(err, &urlErr) {
+		details.Code = urlErr.Code
+	}
+	return details
+}
+
+// batchEntryError - error of a batch entry whose URL is invalid or blocked, with the details of the error response.
+type batchEntryError struct {
+	status  int
+	details errorDetails
+}
+
+func (e *batchEntryError) Error() string {
+	return e.details.Message
+}
+
+// prepareBatchURL normalizes the original URL of the batch entry and builds its link options.
+// Returns a *batchEntryError if the URL is invalid or blocked, and an error wrapping
+// errBadLinkOptions if the link options are invalid.
+func (con *Controller) prepareBatchURL(userID string, url batchRequestEntity) (string, models.LinkOptions, error) {
+	originalURL, err := urlnorm.Normalize(url.OriginalURL)
+	if err != nil {
+		return "", models.LinkOptions{}, &batchEntryError{
+			status:  http.StatusBadRequest,
+			details: invalidURLDetails("original_url", url.CorrelationID, err),
+		}
+	}
+
+	opts, err := con.buildLinkOptions(userID, url.linkRequestOptions)
+	if err != nil {
+		return "", models.LinkOptions{}, err
+	}
+	if e, blocked := blockedLink(originalURL, opts, con.blocklist.Check); blocked {
+		return "", models.LinkOptions{}, &batchEntryError{
+			status:  http.StatusForbidden,
+			details: errorDetails{Code: codeBlocked, Message: e.Reason, Field: "original_url", CorrelationID: url.CorrelationID},
+		}
+	}
+	return originalURL, opts, nil
+}
+
+// storeBatchURL stores the link of a batch entry and adds it to the user's URLs.
+// For an original URL that is already shortened, the existing short ID is returned with repository.ErrDuplicateURL.
+func (con *Controller) storeBatchURL(req *http.Request, userID, originalURL string, opts models.LinkOptions) (string, error) {
+	shortID, err := con.storageService.UpdateData(req, originalURL, userID, opts)
+	if err == nil {
+		base, id := con.linkBase(shortID)
+		con.userService.AddURLs(base, userID, id, originalURL, opts.LinkMetadata)
+		con.publishLinkEvent(models.EventLinkCreated, userID, shortID, originalURL)
+		con.auditLinkCreated(req, userID, shortID, originalURL, opts)
+	}
+	return shortID, err
+}
+
+// errBadLinkOptions - error when the link settings supplied on creation are invalid.
+var errBadLinkOptions = errors.New("bad link options")
+
+// buildLinkOptions checks the link settings supplied on creation and converts them
+// to the settings stored with the link.
+func (con *Controller) buildLinkOptions(userID string, ro linkRequestOptions) (models.LinkOptions, error) {
+	opts := ro.LinkOptions
+
+	if opts.RedirectType != 0 && !models.IsValidRedirectType(opts.RedirectType) {
+		return models.LinkOptions{}, fmt.Errorf("%w: unsupported redirect_type", errBadLinkOptions)
+	}
+	if opts.MaxClicks < 0 {
+		return models.LinkOptions{}, fmt.Errorf("%w: max_clicks must not be negative", errBadLinkOptions)
+	}
+	opts.Clicks = 0
+	opts.CountryClicks = nil
+	opts.DisabledReason = ""
+	opts.CreatedAt = time.Time{}
+
+	meta, err := checkMetadata(opts.LinkMetadata)
+	if err != nil {
+		return models.LinkOptions{}, err
+	}
+	opts.LinkMetadata = meta
+
+	destinations, err := checkDestinations(opts.Destinations)
+	if err != nil {
+		return models.LinkOptions{}, err
+	}
+	opts.Destinations = destinations
+
+	rules, err := checkRules(opts.Rules)
+	if err != nil {
+		return models.LinkOptions{}, err
+	}
+	opts.Rules = rules
+
+	opts.PasswordHash = ""
+	if ro.Password != "" {
+		hash, err := hashPassword(ro.Password)
+		if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			return models.LinkOptions{}, fmt.Errorf("%w: password is too long", errBadLinkOptions)
+		}
+		if err != nil {
+			return models.LinkOptions{}, err
+		}
+		opts.PasswordHash = hash
+	}
+
+	opts.UTMTemplateID = ""
+	if ro.UTMTemplate != "" {
+		templates, err := con.storageService.GetUTMTemplates(userID)
+		if err != nil {
+			return models.LinkOptions{}, err
+		}
+		for _, tpl := range templates {
+			if tpl.Name == ro.UTMTemplate {
+				opts.UTMTemplateID = tpl.ID
+			}
+		}
+		if opts.UTMTemplateID == "" {
+			return models.LinkOptions{}, fmt.Errorf("%w: unknown utm_template %s", errBadLinkOptions, ro.UTMTemplate)
+		}
+	}
+
+	opts.Domain = ""
+	if ro.Domain != "" {
+		if opts.Domain, err = con.userDomain(userID, ro.Domain); err != nil {
+			return models.LinkOptions{}, err
+		}
+	}
+
+	return opts, nil
+}
+
+// linkOptionsError writes the response for an error returned by buildLinkOptions.
+func (con *Controller) linkOptionsError(res http.ResponseWriter, err error) {
+	if errors.Is(err, errBadLinkOptions) {
+		http.Error(res, "Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, errDomainForbidden) {
+		http.Error(res, "Forbidden: "+err.Error(), http.StatusForbidden)
+		return
+	}
+	con.sugar.Errorf("(buildLinkOptions) %s", err.Error())
+	http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+}
+
+// maxDestinationWeight - maximum weight of a destination, so the sum of the weights cannot overflow.
+const maxDestinationWeight = 10000
+
+// checkDestinations checks the weighted destinations supplied by the user and resets their click counters.
+func checkDestinations(destinations []models.Destination) ([]models.Destination, error) {
+	if len(destinations) == 0 {
+		return nil, nil
+	}
+
+	checked := make([]models.Destination, 0, len(destinations))
+	for _, d := range destinations {
+		u, err := urlnorm.Normalize(d.URL)
+		if err != nil {
+			return nil, fmt.Errorf("%w: destination url: %v", errBadLinkOptions, err)
+		}
+		if d.Weight <= 0 || d.Weight > maxDestinationWeight {
+			return nil, fmt.Errorf("%w: destination weight must be between 1 and %d", errBadLinkOptions, maxDestinationWeight)
+		}
+		checked = append(checked, models.Destination{URL: u, Weight: d.Weight})
+	}
+	return checked, nil
+}
+
+// shortLink - short link addressed by the request path.
+type shortLink struct {
+	id          string
+	extraPath   string
+	originalURL string
+	opts        models.LinkOptions
+	// variant: index of the destination chosen for the visitor (-1 if the link has no destinations
+	// or a targeting rule matched).
+	variant int
+	// country: country code of the visitor (empty if unknown).
+	country string
+	// preview: the path requests the preview page ("/{id}+").
+	preview bool
+}
+
+// findLink retrieves the short link addressed by the first segment of the request path
+// in the namespace of the domain addressed by the Host header.
+// If the link cannot be used, the error response is written and false is returned.
+func (con *Controller) findLink(res http.ResponseWriter, req *http.Request) (shortLink, bool) {
+	id, extraPath, _ := strings.Cut(strings.TrimPrefix(req.URL.EscapedPath(), "/"), "/")
+	id, preview := strings.CutSuffix(id, previewSuffix)
+	id, ok := con.requestKey(req, id)
+	if !ok {
+		http.Error(res, "Bad Request", http.StatusBadRequest)
+		return shortLink{}, false
+	}
+
+	originalURL, isDeleted, err := con.storageService.GetData(id)
+
+	if err != nil {
+		http.Error(res, "Bad Request", http.StatusBadRequest)
+		return shortLink{}, false
+	}
+	if isDeleted {
+		res.WriteHeader(http.StatusGone)
+		http.Error(res, "Gone", http.StatusGone)
+		return shortLink{}, false
+	}
+
+	opts, err := con.storageService.GetLinkOptions(id)
+	if err != nil {
+		http.Error(res, "Bad Request", http.StatusBadRequest)
+		return shortLink{}, false
+	}
+	if opts.ClicksExhausted() {
+		http.Error(res, "Gone", http.StatusGone)
+		return shortLink{}, false
+	}
+	if opts.DisabledReason != "" {
+		http.Error(res, "Forbidden: "+opts.DisabledReason, http.StatusForbidden)
+		return shortLink{}, false
+	}
+
+	link := shortLink{id: id, extraPath: extraPath, originalURL: originalURL, opts: opts, variant: -1,
+		country: con.visitorCountry(req), preview: preview}
+	if target, ok := targetURL(opts.Rules, req, link.country); ok {
+		link.originalURL = target
+	} else if len(opts.Destinations) > 0 {
+		link.variant = chooseDestination(opts.Destinations, con.visitorKey(req), id)
+		link.originalURL = opts.Destinations[link.variant].URL
+	}
+	if e, blocked := con.blocklist.Check(link.originalURL); blocked {
+		http.Error(res, "Forbidden: "+e.Reason, http.StatusForbidden)
+		return shortLink{}, false
+	}
+	return link, true
+}
+
+// visitorKey identifies the visitor for the choice of destination:
+// the user ID from the signed cookie or, if it is missing or invalid, the client address.
+// The User-ID header is not used: redirects are not authenticated, so it is set by the client.
+func (con *Controller) visitorKey(req *http.Request) string {
+	if userID, err := con.userService.GetUserIDFromCookie(req); err == nil && userID != "" {
+		return userID
+	}
+	if ip := con.clientIP(req); ip.IsValid() {
+		return ip.String()
+	}
+	return req.RemoteAddr
+}
+
+// chooseDestination returns the index of the destination for the visitor.
+// The choice depends only on the visitor key and the link, so a visitor keeps
+// getting the same destination while the destinations are unchanged.
+func chooseDestination(destinations []models.Destination, visitor, shortID string) int {
+	total := 0
+	for _, d := range destinations {
+		total += d.Weight
+	}
+	if total <= 0 {
+		return 0
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(shortID + "\x00" + visitor))
+	point := int(h.Sum64() % uint64(total))
+
+	for i, d := range destinations {
+		if point < d.Weight {
+			return i
+		}
+		point -= d.Weight
+	}
+	return len(destinations) - 1
+}
+
+// registerClick counts the redirect via the link. If the click limit of the link
+// is reached, the error response is written and false is returned.
+func (con *Controller) registerClick(res http.ResponseWriter, link shortLink) bool {
+	allowed, err := con.storageService.RegisterClick(link.id, models.Click{Variant: link.variant, Country: link.country})
+	if err != nil {
+		con.sugar.Errorf("(registerClick) %s", err.Error())
+		if link.opts.MaxClicks == 0 {
+			return true
+		}
+		http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+	if !allowed {
+		http.Error(res, "Gone", http.StatusGone)
+		return false
+	}
+	return true
+}
+
+// errNoPassthrough - error when the request has trailing path segments but passthrough is disabled.
+var errNoPassthrough = errors.New("passthrough is disabled")
+
+// destinationURL builds the URL to redirect to from the original URL of the link,
+// its UTM template and, if passthrough is enabled, the request path and query.
+func (con *Controller) destinationURL(link shortLink, query url.Values) (string, error) {
+	destination := link.originalURL
+	var err error
+
+	if link.opts.UTMTemplateID != "" {
+		destination, err = con.applyUTMTemplate(destination, link.opts.UTMTemplateID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if con.conf.Passthrough || link.opts.Passthrough {
+		return passthroughURL(destination, link.extraPath, query)
+	}
+	if link.extraPath != "" {
+		return "", errNoPassthrough
+	}
+	return destination, nil
+}
+
+// passthroughURL appends the escaped extraPath to the path of the destination URL and adds
+// query parameters that the destination does not define yet.
+func passthroughURL(destination, extraPath string, query url.Values) (string, error) {
+	if extraPath == "" && len(query) == 0 {
+		return destination, nil
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	if extraPath != "" {
+		escaped := strings.TrimSuffix(u.EscapedPath(), "/") + "/" + extraPath
+		unescaped, err := url.PathUnescape(escaped)
+		if err != nil {
+			return "", err
+		}
+		u.Path, u.RawPath = unescaped, escaped
+	}
+
+	mergeQuery(u, query)
+
+	return u.String(), nil
+}
+
+// utmTemplateURL adds the template parameters that the destination URL does not define yet.
+func utmTemplateURL(destination string, tpl models.UTMTemplate) (string, error) {
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	for key, value := range tpl.Params {
+		params.Set(key, value)
+	}
+	mergeQuery(u, params)
+
+	return u.String(), nil
+}
+
+// mergeQuery adds parameters to the query of u. Parameters already present in u are kept unchanged.
+func mergeQuery(u *url.URL, params url.Values) {
+	q := u.Query()
+	added := false
+	for key, values := range params {
+		if _, exists := q[key]; exists {
+			continue
+		}
+		q[key] = values
+		added = true
+	}
+	if added {
+		u.RawQuery = q.Encode()
 	}
-	return origurl.URL
 }
 
 func extractURLsfromJSONBatchRequest(req *http.Request) []batchRequestEntity {
@@ -133,7 +569,7 @@ func distributeDeleteTasks(doneCh chan struct{}, inputCh chan []string, numWorke
 				case <-doneCh:
 					return
 				default:
-					err := con.storageService.BatchDeleteURLs(userID, urlsToDeleteArray)
+					deleted, err := con.storageService.BatchDeleteURLs(userID, urlsToDeleteArray)
 					if err != nil {
 						con.sugar.Errorf(" Error Updating flag to URLs %s\n", err.Error())
 
@@ -141,7 +577,7 @@ func distributeDeleteTasks(doneCh chan struct{}, inputCh chan []string, numWorke
 						return
 					}
 
-					for _, d := range urlsToDeleteArray {
+					for _, d := range deleted {
 						ch <- d
 					}
 				}
@@ -180,32 +616,32 @@ func collectDeletionResults(channels ...chan string) chan string {
 	return finalCh
 }
 
-// HandleGracefulShutdown handles termination signals.
-func (con *Controller) HandleGracefulShutdown(server *http.Server) {
+// HandleGracefulShutdown handles termination signals, shuts the servers down and then closes the storage.
+func (con *Controller) HandleGracefulShutdown(servers ...*http.Server) {
 	notifyCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 	defer stop()
 
 	// Ждем получения первого сигнала
 	<-notifyCtx.Done()
 	con.sugar.Infof("Received shutdown signal")
+	close(con.stop)
 
 	// Отключаем прием новых подключений и дожидаемся завершения активных запросов
 	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(con.conf.Timeout)*time.Second)
 	defer cancel()
 
-	// Закрываем соединение с базой данных.
-	go func() {
-		if con.conf.DBConnection != "" {
-			con.sugar.Infof("Closing database connection...")
-			if err := con.storageService.Close(); err != nil {
-				con.sugar.Errorf("Failed to close database connection: %v", err)
-			}
+	con.sugar.Infof("Shutting down gracefully...")
+	for _, server := range servers {
+		if err := server.Shutdown(ctx); err != nil {
+			con.sugar.Infof("HTTP server shutdown error: %v", err)
 		}
-	}()
+	}
 
-	con.sugar.Infof("Shutting down gracefully...")
-	if err := server.Shutdown(ctx); err != nil {
-		con.sugar.Infof("HTTP server shutdown error: %v", err)
+	// Закрываем хранилище, когда запросы завершены: БД закрывает соединение,
+	// файловое хранилище сохраняет накопленные клики.
+	con.sugar.Infof("Closing storage...")
+	if err := con.storageService.Close(); err != nil {
+		con.sugar.Errorf("Failed to close storage: %v", err)
 	}
 
 	con.sugar.Infof("Server has been shut down.")
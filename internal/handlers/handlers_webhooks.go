@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"shortener/internal/domain/models"
+	"shortener/internal/repository"
+	"shortener/internal/urlnorm"
+	"shortener/internal/webhook"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// Limits of the webhooks.
+const (
+	// maxWebhooks - maximum number of webhooks of a user.
+	maxWebhooks = 10
+	// secretBytes - number of random bytes of a generated webhook secret.
+	secretBytes = 32
+	// defaultDeliveries, maxDeliveries - default and maximum number of deliveries returned at once.
+	defaultDeliveries = 50
+	maxDeliveries     = 500
+)
+
+// webhookRequest - body of the request to create a webhook.
+type webhookRequest struct {
+	URL string `json:"url"`
+	// Events: event types to receive (empty means all).
+	Events []string `json:"events"`
+	// Secret: key of the signatures (generated if empty).
+	Secret string `json:"secret"`
+}
+
+// webhookResponse - webhook returned to its owner. The secret is only returned on creation.
+type webhookResponse struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Events    []string  `json:"events"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func newWebhookResponse(hook models.Webhook) webhookResponse {
+	events := hook.Events
+	if events == nil {
+		events = []string{}
+	}
+	return webhookResponse{ID: hook.ID, URL: hook.URL, Events: events, CreatedAt: hook.CreatedAt}
+}
+
+// StartWebhookDelivery starts delivering the webhook events of the outbox until the server shuts down.
+func (con *Controller) StartWebhookDelivery() {
+	go webhook.NewWorker(con.storageService, con.conf.ShortLinkBase(), con.sugar).Run(con.stop)
+}
+
+// publishLinkEvent records the event of the user's link in the webhook outbox.
+// A failure is logged and does not fail the request that caused the event.
+func (con *Controller) publishLinkEvent(eventType, userID, shortID, originalURL string) {
+	err := con.storageService.EnqueueWebhookEvent(models.WebhookEvent{
+		ID:         uuid.New().String(),
+		Type:       eventType,
+		UserID:     userID,
+		OccurredAt: time.Now().UTC(),
+		Link:       models.EventLink{ShortID: shortID, OriginalURL: originalURL},
+	})
+	if err != nil {
+		con.sugar.Errorf("(publishLinkEvent) %s event of %s is lost: %s", eventType, shortID, err)
+	}
+}
+
+// APICreateWebhook handles requests to register a webhook receiving the events of the user's links:
+// models.EventLinkCreated, models.EventLinkEdited, models.EventLinkDeleted and models.EventLinkClicked.
+// The response contains the secret the deliveries are signed with (see package webhook).
+// The host of the URL must resolve only to public addresses (see webhook.CheckURL).
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 400 Bad Request: if the URL or the event types are invalid, the host of the URL is not public
+//     or cannot be resolved, or the user already has 10 webhooks.
+//   - 201 Created: the webhook with its secret in JSON.
+//   - 500 Internal Server Error: if the webhook could not be saved.
+func (con *Controller) APICreateWebhook() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var body webhookRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(res, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		hookURL, err := urlnorm.Normalize(body.URL)
+		if err != nil {
+			con.invalidURLError(res, "url", "", err)
+			return
+		}
+		if err := webhook.CheckURL(req.Context(), con.webhookResolver, hookURL); err != nil {
+			http.Error(res, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, event := range body.Events {
+			if !slices.Contains(models.WebhookEventTypes, event) {
+				http.Error(res, "Bad Request: unknown event type "+event, http.StatusBadRequest)
+				return
+			}
+		}
+
+		hooks, err := con.storageService.GetWebhooks(userID)
+		if err != nil {
+			con.sugar.Errorf("(APICreateWebhook) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if len(hooks) >= maxWebhooks {
+			http.Error(res, "Bad Request: at most "+strconv.Itoa(maxWebhooks)+" webhooks are allowed", http.StatusBadRequest)
+			return
+		}
+
+		secret := body.Secret
+		if secret == "" {
+			key := make([]byte, secretBytes)
+			if _, err := rand.Read(key); err != nil {
+				con.sugar.Errorf("(APICreateWebhook) %s", err.Error())
+				http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			secret = hex.EncodeToString(key)
+		}
+
+		hook := models.Webhook{
+			ID:        uuid.New().String(),
+			UserID:    userID,
+			URL:       hookURL,
+			Secret:    secret,
+			Events:    slices.Compact(slices.Sorted(slices.Values(body.Events))),
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := con.storageService.SaveWebhook(hook); err != nil {
+			con.sugar.Errorf("(APICreateWebhook) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		resp := newWebhookResponse(hook)
+		resp.Secret = hook.Secret
+		con.writeJSON(res, http.StatusCreated, resp)
+	}
+}
+
+// APIGetWebhooks handles requests to retrieve the webhooks of a user, without their secrets.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 204 No Content: if the user has no webhooks.
+//   - 200 OK: the webhooks in JSON.
+//   - 500 Internal Server Error: if the webhooks could not be retrieved.
+func (con *Controller) APIGetWebhooks() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		hooks, err := con.storageService.GetWebhooks(userID)
+		if err != nil {
+			con.sugar.Errorf("(APIGetWebhooks) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if len(hooks) == 0 {
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		resp := make([]webhookResponse, 0, len(hooks))
+		for _, hook := range hooks {
+			resp = append(resp, newWebhookResponse(hook))
+		}
+		con.writeJSON(res, http.StatusOK, resp)
+	}
+}
+
+// APIDeleteWebhook handles requests to delete the user's webhook; its pending deliveries are dropped.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 204 No Content: if the webhook was deleted.
+//   - 404 Not Found: if the user has no webhook with this ID.
+//   - 500 Internal Server Error: if the webhook could not be deleted.
+func (con *Controller) APIDeleteWebhook() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		err := con.storageService.DeleteWebhook(userID, chi.URLParam(req, "id"))
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(res, "Not Found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			con.sugar.Errorf("(APIDeleteWebhook) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// APIGetWebhookDeliveries handles requests to inspect the latest deliveries of the user's webhook,
+// newest first, with their status and attempts. The query parameter limit sets their number
+// (50 by default, at most 500).
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 400 Bad Request: if the limit is invalid.
+//   - 404 Not Found: if the user has no webhook with this ID.
+//   - 200 OK: the deliveries in JSON.
+//   - 500 Internal Server Error: if the deliveries could not be retrieved.
+func (con *Controller) APIGetWebhookDeliveries() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		limit := defaultDeliveries
+		if v := req.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxDeliveries {
+				http.Error(res, "Bad Request: limit must be between 1 and "+strconv.Itoa(maxDeliveries), http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+
+		deliveries, err := con.storageService.GetWebhookDeliveries(userID, chi.URLParam(req, "id"), limit)
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(res, "Not Found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			con.sugar.Errorf("(APIGetWebhookDeliveries) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		con.writeJSON(res, http.StatusOK, deliveries)
+	}
+}
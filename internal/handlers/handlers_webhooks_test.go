@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"shortener/internal/domain/models"
+	"shortener/internal/mocks"
+	"shortener/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// hostsResolver resolves the hosts from the map and fails for the others.
+type hostsResolver map[string][]netip.Addr
+
+func (r hostsResolver) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+func TestAPICreateWebhook(t *testing.T) {
+	tests := []struct {
+		mockSetup      func(storSrv *mocks.MockStorageService)
+		name           string
+		userID         string
+		requestBody    string
+		expectedStatus int
+	}{
+		{
+			name:        "APICreateWebhook created",
+			userID:      "testUserID",
+			requestBody: `{"url":"https://hooks.example/links","events":["link.deleted","link.created","link.deleted"]}`,
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetWebhooks("testUserID").Return([]models.Webhook{}, nil)
+				storSrv.EXPECT().SaveWebhook(gomock.Any()).DoAndReturn(func(hook models.Webhook) error {
+					assert.Equal(t, "testUserID", hook.UserID)
+					assert.Equal(t, []string{models.EventLinkCreated, models.EventLinkDeleted}, hook.Events)
+					assert.Len(t, hook.Secret, 2*secretBytes)
+					return nil
+				})
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "APICreateWebhook unknown event",
+			userID:         "testUserID",
+			requestBody:    `{"url":"https://hooks.example","events":["link.renamed"]}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "APICreateWebhook invalid url",
+			userID:         "testUserID",
+			requestBody:    `{"url":"not a url"}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:        "APICreateWebhook too many",
+			userID:      "testUserID",
+			requestBody: `{"url":"https://hooks.example"}`,
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetWebhooks("testUserID").Return(make([]models.Webhook, maxWebhooks), nil)
+			},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "APICreateWebhook metadata service",
+			userID:         "testUserID",
+			requestBody:    `{"url":"http://169.254.169.254/latest/meta-data"}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "APICreateWebhook loopback host",
+			userID:         "testUserID",
+			requestBody:    `{"url":"http://localhost:8080/hook"}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "APICreateWebhook host resolving to a private address",
+			userID:         "testUserID",
+			requestBody:    `{"url":"https://intranet.example/hook"}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "APICreateWebhook unresolvable host",
+			userID:         "testUserID",
+			requestBody:    `{"url":"https://unknown.example/hook"}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+		{
+			name:           "APICreateWebhook Unauthorized",
+			requestBody:    `{"url":"https://hooks.example"}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller := prepare_(t)
+			controller.webhookResolver = hostsResolver{
+				"hooks.example":    {netip.MustParseAddr("93.184.216.34")},
+				"localhost":        {netip.MustParseAddr("127.0.0.1"), netip.MustParseAddr("::1")},
+				"intranet.example": {netip.MustParseAddr("10.0.0.5")},
+			}
+			tt.mockSetup(storSrv)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/user/webhooks", bytes.NewBufferString(tt.requestBody))
+			req.Header.Set("User-ID", tt.userID)
+			w := httptest.NewRecorder()
+
+			handler := controller.APICreateWebhook()
+			handler.ServeHTTP(w, req)
+
+			require.Equal(t, tt.expectedStatus, w.Code, w.Body.String())
+			if w.Code == http.StatusCreated {
+				var resp webhookResponse
+				require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+				assert.NotEmpty(t, resp.ID)
+				assert.NotEmpty(t, resp.Secret, "Expected the secret to be returned on creation")
+			}
+		})
+	}
+}
+
+func TestAPIGetWebhooks(t *testing.T) {
+	storSrv, _, controller := prepare_(t)
+	storSrv.EXPECT().GetWebhooks("testUserID").Return([]models.Webhook{
+		{ID: "hook1", UserID: "testUserID", URL: "https://hooks.example", Secret: "s3cret"},
+	}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/user/webhooks", nil)
+	req.Header.Set("User-ID", "testUserID")
+	w := httptest.NewRecorder()
+
+	handler := controller.APIGetWebhooks()
+	handler.ServeHTTP(w, req)
+
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "s3cret")
+	assert.JSONEq(t, `[{"id":"hook1","url":"https://hooks.example","events":[],"created_at":"0001-01-01T00:00:00Z"}]`, w.Body.String())
+}
+
+func TestAPIDeleteWebhook(t *testing.T) {
+	tests := []struct {
+		err            error
+		name           string
+		expectedStatus int
+	}{
+		{name: "APIDeleteWebhook deleted", expectedStatus: http.StatusNoContent},
+		{name: "APIDeleteWebhook not found", err: repository.ErrNotFound, expectedStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller := prepare_(t)
+			storSrv.EXPECT().DeleteWebhook("testUserID", "hook1").Return(tt.err)
+
+			req := httptest.NewRequest(http.MethodDelete, "/api/user/webhooks/hook1", nil)
+			req.Header.Set("User-ID", "testUserID")
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "hook1")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+
+			handler := controller.APIDeleteWebhook()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestAPIGetWebhookDeliveries(t *testing.T) {
+	tests := []struct {
+		mockSetup      func(storSrv *mocks.MockStorageService)
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{
+			name:  "APIGetWebhookDeliveries ok",
+			query: "?limit=5",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetWebhookDeliveries("testUserID", "hook1", 5).Return([]models.WebhookDelivery{
+					{ID: "d1", WebhookID: "hook1", Status: models.DeliveryDead},
+				}, nil)
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name: "APIGetWebhookDeliveries not found",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetWebhookDeliveries("testUserID", "hook1", defaultDeliveries).Return(nil, repository.ErrNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "APIGetWebhookDeliveries bad limit",
+			query:          "?limit=0",
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller := prepare_(t)
+			tt.mockSetup(storSrv)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/user/webhooks/hook1/deliveries"+tt.query, nil)
+			req.Header.Set("User-ID", "testUserID")
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "hook1")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+
+			handler := controller.APIGetWebhookDeliveries()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
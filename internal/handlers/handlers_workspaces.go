@@ -0,0 +1,443 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"shortener/internal/domain/models"
+	"shortener/internal/repository"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// maxWorkspaceName - maximum length of a workspace name in characters.
+const maxWorkspaceName = 100
+
+// workspaceRequest - body of the request to create a workspace.
+type workspaceRequest struct {
+	Name string `json:"name"`
+}
+
+// memberRequest - body of the request to add a workspace member or change the member's role.
+type memberRequest struct {
+	Role string `json:"role"`
+}
+
+// moveResponse - response to the request to hand links over to a workspace.
+type moveResponse struct {
+	Moved int `json:"moved"`
+}
+
+// workspaceRole returns the identifier of the workspace of the request and the role of the user in it.
+// If the user is not a member, 404 Not Found is written, so that other workspaces are not disclosed.
+func (con *Controller) workspaceRole(res http.ResponseWriter, req *http.Request, userID, caller string) (string, string, bool) {
+	workspaceID := chi.URLParam(req, "id")
+	role, err := con.storageService.GetWorkspaceRole(workspaceID, userID)
+	if errors.Is(err, repository.ErrNotFound) {
+		http.Error(res, "Not Found", http.StatusNotFound)
+		return "", "", false
+	}
+	if err != nil {
+		con.sugar.Errorf("(%s) %s", caller, err.Error())
+		http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+		return "", "", false
+	}
+	return workspaceID, role, true
+}
+
+// keepsOwner reports whether the workspace still has an owner after the user's role changes to role
+// (an empty role means the user leaves).
+func (con *Controller) keepsOwner(workspaceID, userID, role string) (bool, error) {
+	if role == models.RoleOwner {
+		return true, nil
+	}
+	members, err := con.storageService.GetWorkspaceMembers(workspaceID)
+	if err != nil {
+		return false, err
+	}
+	for _, m := range members {
+		if m.Role == models.RoleOwner && m.UserID != userID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// APICreateWorkspace handles requests to create a workspace owned by the user.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 400 Bad Request: if the name is empty or longer than 100 characters.
+//   - 201 Created: the workspace with the user's role in JSON.
+//   - 500 Internal Server Error: if the workspace could not be saved.
+func (con *Controller) APICreateWorkspace() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var body workspaceRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(res, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		name := strings.TrimSpace(body.Name)
+		if name == "" || len([]rune(name)) > maxWorkspaceName {
+			http.Error(res, "Bad Request: name must have 1 to "+strconv.Itoa(maxWorkspaceName)+" characters", http.StatusBadRequest)
+			return
+		}
+
+		ws := models.Workspace{ID: uuid.New().String(), Name: name, CreatedAt: time.Now().UTC()}
+		if err := con.storageService.CreateWorkspace(ws, userID); err != nil {
+			con.sugar.Errorf("(APICreateWorkspace) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		con.recordAudit(con.newAuditSource(req, userID), models.AuditWorkspaceCreate, "", userID, nil, ws)
+		con.writeJSON(res, http.StatusCreated, models.WorkspaceMembership{Workspace: ws, Role: models.RoleOwner})
+	}
+}
+
+// APIGetWorkspaces handles requests to retrieve the workspaces the user is a member of, with the user's roles.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 204 No Content: if the user is not a member of any workspace.
+//   - 200 OK: the workspaces in JSON.
+//   - 500 Internal Server Error: if the workspaces could not be retrieved.
+func (con *Controller) APIGetWorkspaces() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		memberships, err := con.storageService.GetUserWorkspaces(userID)
+		if err != nil {
+			con.sugar.Errorf("(APIGetWorkspaces) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if len(memberships) == 0 {
+			res.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		con.writeJSON(res, http.StatusOK, memberships)
+	}
+}
+
+// APIGetWorkspaceMembers handles requests of workspace members to retrieve all members with their roles.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 404 Not Found: if the user is not a member of the workspace.
+//   - 200 OK: the members in JSON.
+//   - 500 Internal Server Error: if the members could not be retrieved.
+func (con *Controller) APIGetWorkspaceMembers() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		workspaceID, _, ok := con.workspaceRole(res, req, userID, "APIGetWorkspaceMembers")
+		if !ok {
+			return
+		}
+
+		members, err := con.storageService.GetWorkspaceMembers(workspaceID)
+		if err != nil {
+			con.sugar.Errorf("(APIGetWorkspaceMembers) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		con.writeJSON(res, http.StatusOK, members)
+	}
+}
+
+// APISetWorkspaceMember handles requests of workspace owners to add a member or change a member's role
+// ("owner", "editor" or "viewer").
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 400 Bad Request: if the role is invalid.
+//   - 403 Forbidden: if the user is not an owner of the workspace.
+//   - 404 Not Found: if the user is not a member of the workspace.
+//   - 409 Conflict: if the last owner would be demoted.
+//   - 200 OK: the member in JSON.
+//   - 500 Internal Server Error: if the member could not be saved.
+func (con *Controller) APISetWorkspaceMember() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var body memberRequest
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			http.Error(res, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		if !models.IsValidRole(body.Role) {
+			http.Error(res, "Bad Request: role must be owner, editor or viewer", http.StatusBadRequest)
+			return
+		}
+
+		workspaceID, role, ok := con.workspaceRole(res, req, userID, "APISetWorkspaceMember")
+		if !ok {
+			return
+		}
+		if role != models.RoleOwner {
+			http.Error(res, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		member := models.WorkspaceMember{
+			WorkspaceID: workspaceID,
+			UserID:      chi.URLParam(req, "userID"),
+			Role:        body.Role,
+			AddedAt:     time.Now().UTC(),
+		}
+		keeps, err := con.keepsOwner(workspaceID, member.UserID, member.Role)
+		if err == nil && !keeps {
+			http.Error(res, "Conflict: the workspace must keep an owner", http.StatusConflict)
+			return
+		}
+		if err == nil {
+			err = con.storageService.SetWorkspaceMember(member)
+		}
+		if err != nil {
+			con.sugar.Errorf("(APISetWorkspaceMember) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		con.recordAudit(con.newAuditSource(req, userID), models.AuditMemberSet, "", member.UserID, nil, member)
+		con.writeJSON(res, http.StatusOK, member)
+	}
+}
+
+// APIRemoveWorkspaceMember handles requests to remove a member from a workspace: owners remove any member,
+// other members may only leave. The links stay in the workspace.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 403 Forbidden: if a member who is not an owner removes somebody else.
+//   - 404 Not Found: if the user or the removed user is not a member of the workspace.
+//   - 409 Conflict: if the last owner would be removed.
+//   - 204 No Content: if the member was removed.
+//   - 500 Internal Server Error: if the member could not be removed.
+func (con *Controller) APIRemoveWorkspaceMember() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		workspaceID, role, ok := con.workspaceRole(res, req, userID, "APIRemoveWorkspaceMember")
+		if !ok {
+			return
+		}
+		memberID := chi.URLParam(req, "userID")
+		if role != models.RoleOwner && memberID != userID {
+			http.Error(res, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		keeps, err := con.keepsOwner(workspaceID, memberID, "")
+		if err == nil && !keeps {
+			http.Error(res, "Conflict: the workspace must keep an owner", http.StatusConflict)
+			return
+		}
+		if err == nil {
+			err = con.storageService.RemoveWorkspaceMember(workspaceID, memberID)
+		}
+		if errors.Is(err, repository.ErrNotFound) {
+			http.Error(res, "Not Found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			con.sugar.Errorf("(APIRemoveWorkspaceMember) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		con.recordAudit(con.newAuditSource(req, userID), models.AuditMemberRemove, "", memberID, workspaceRef{WorkspaceID: workspaceID}, nil)
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// APIMoveLinksToWorkspace handles requests of workspace owners and editors to hand links they created
+// over to the workspace. The body is a JSON array of short IDs; links of other users or of another
+// workspace are skipped.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 400 Bad Request: if the body is not an array of short IDs.
+//   - 403 Forbidden: if the user is a viewer.
+//   - 404 Not Found: if the user is not a member of the workspace.
+//   - 200 OK: the number of moved links in JSON.
+//   - 500 Internal Server Error: if the links could not be moved.
+func (con *Controller) APIMoveLinksToWorkspace() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var shortIDs []string
+		if err := json.NewDecoder(req.Body).Decode(&shortIDs); err != nil {
+			http.Error(res, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		workspaceID, _, ok := con.workspaceRole(res, req, userID, "APIMoveLinksToWorkspace")
+		if !ok {
+			return
+		}
+
+		moved, err := con.storageService.MoveLinksToWorkspace(userID, workspaceID, shortIDs)
+		if errors.Is(err, repository.ErrForbidden) {
+			http.Error(res, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			con.sugar.Errorf("(APIMoveLinksToWorkspace) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		src := con.newAuditSource(req, userID)
+		for _, shortID := range moved {
+			con.recordAudit(src, models.AuditLinkMove, shortID, userID, workspaceRef{}, workspaceRef{WorkspaceID: workspaceID})
+		}
+		con.writeJSON(res, http.StatusOK, moveResponse{Moved: len(moved)})
+	}
+}
+
+// APIGetWorkspaceURLs handles requests of workspace members to retrieve the links of the workspace,
+// page by page. The query parameters and the response are the same as of APIGetUserURLs.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 400 Bad Request: if a query parameter is invalid.
+//   - 404 Not Found: if the user is not a member of the workspace.
+//   - 204 No Content: if the page is empty.
+//   - 200 OK: the links in JSON.
+//   - 500 Internal Server Error: if the links could not be retrieved.
+func (con *Controller) APIGetWorkspaceURLs() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		query, err := parseLinkQuery(req.URL.Query())
+		if err != nil {
+			http.Error(res, "Bad Request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		workspaceID, _, ok := con.workspaceRole(res, req, userID, "APIGetWorkspaceURLs")
+		if !ok {
+			return
+		}
+
+		page, err := con.storageService.ListWorkspaceLinks(workspaceID, query)
+		if err != nil {
+			con.sugar.Errorf("(APIGetWorkspaceURLs) ListWorkspaceLinks error: %s", err)
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		con.writeLinkPage(res, req, page)
+	}
+}
+
+// APIDeleteWorkspaceURLs handles requests of workspace owners and editors to delete links of the workspace.
+// The body is a JSON array of short IDs; links of other workspaces are skipped.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 400 Bad Request: if the body is not an array of short IDs.
+//   - 403 Forbidden: if the user is a viewer.
+//   - 404 Not Found: if the user is not a member of the workspace.
+//   - 204 No Content: if the links were deleted.
+//   - 500 Internal Server Error: if the links could not be deleted.
+func (con *Controller) APIDeleteWorkspaceURLs() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var shortIDs []string
+		if err := json.NewDecoder(req.Body).Decode(&shortIDs); err != nil {
+			http.Error(res, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		workspaceID, _, ok := con.workspaceRole(res, req, userID, "APIDeleteWorkspaceURLs")
+		if !ok {
+			return
+		}
+
+		deleted, err := con.storageService.DeleteWorkspaceURLs(userID, workspaceID, shortIDs)
+		if errors.Is(err, repository.ErrForbidden) {
+			http.Error(res, "Forbidden", http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			con.sugar.Errorf("(APIDeleteWorkspaceURLs) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		src := con.newAuditSource(req, userID)
+		for _, shortID := range deleted {
+			con.recordAudit(src, models.AuditLinkDelete, shortID, userID, linkDeletion{}, linkDeletion{IsDeleted: true})
+		}
+		res.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// APIGetWorkspaceStats handles requests of workspace members to retrieve the numbers of links,
+// deleted links, clicks and members of the workspace.
+//
+// HTTP Responses:
+//   - 401 Unauthorized: if the user is not authenticated.
+//   - 404 Not Found: if the user is not a member of the workspace.
+//   - 200 OK: the statistics in JSON.
+//   - 500 Internal Server Error: if the statistics could not be retrieved.
+func (con *Controller) APIGetWorkspaceStats() http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		userID := req.Header.Get("User-ID")
+		if userID == "" {
+			http.Error(res, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		workspaceID, _, ok := con.workspaceRole(res, req, userID, "APIGetWorkspaceStats")
+		if !ok {
+			return
+		}
+
+		stats, err := con.storageService.GetWorkspaceStats(workspaceID)
+		if err != nil {
+			con.sugar.Errorf("(APIGetWorkspaceStats) %s", err.Error())
+			http.Error(res, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		con.writeJSON(res, http.StatusOK, stats)
+	}
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"shortener/internal/domain/models"
+	"shortener/internal/mocks"
+	"shortener/internal/repository"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// workspaceRequestWithParams returns a request of testUserID with the chi URL parameters.
+func workspaceRequestWithParams(method, target, body string, params map[string]string) *http.Request {
+	req := httptest.NewRequest(method, target, bytes.NewBufferString(body))
+	req.Header.Set("User-ID", "testUserID")
+	rctx := chi.NewRouteContext()
+	for k, v := range params {
+		rctx.URLParams.Add(k, v)
+	}
+	return req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestAPICreateWorkspace(t *testing.T) {
+	tests := []struct {
+		mockSetup      func(storSrv *mocks.MockStorageService)
+		name           string
+		requestBody    string
+		expectedStatus int
+	}{
+		{
+			name:        "APICreateWorkspace created",
+			requestBody: `{"name":" Marketing "}`,
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().CreateWorkspace(gomock.Any(), "testUserID").DoAndReturn(func(ws models.Workspace, ownerID string) error {
+					assert.Equal(t, "Marketing", ws.Name)
+					assert.NotEmpty(t, ws.ID)
+					return nil
+				})
+			},
+			expectedStatus: http.StatusCreated,
+		},
+		{
+			name:           "APICreateWorkspace without name",
+			requestBody:    `{"name":"  "}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller := prepare_(t)
+			tt.mockSetup(storSrv)
+
+			req := workspaceRequestWithParams(http.MethodPost, "/api/workspaces", tt.requestBody, nil)
+			w := httptest.NewRecorder()
+
+			handler := controller.APICreateWorkspace()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestAPISetWorkspaceMember(t *testing.T) {
+	tests := []struct {
+		mockSetup      func(storSrv *mocks.MockStorageService)
+		name           string
+		member         string
+		requestBody    string
+		expectedStatus int
+	}{
+		{
+			name:        "APISetWorkspaceMember added",
+			member:      "bob",
+			requestBody: `{"role":"editor"}`,
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetWorkspaceRole("ws1", "testUserID").Return(models.RoleOwner, nil)
+				storSrv.EXPECT().GetWorkspaceMembers("ws1").Return([]models.WorkspaceMember{{UserID: "testUserID", Role: models.RoleOwner}}, nil)
+				storSrv.EXPECT().SetWorkspaceMember(gomock.Any()).DoAndReturn(func(m models.WorkspaceMember) error {
+					assert.Equal(t, models.WorkspaceMember{WorkspaceID: "ws1", UserID: "bob", Role: models.RoleEditor, AddedAt: m.AddedAt}, m)
+					return nil
+				})
+			},
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:        "APISetWorkspaceMember last owner demoted",
+			member:      "testUserID",
+			requestBody: `{"role":"viewer"}`,
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetWorkspaceRole("ws1", "testUserID").Return(models.RoleOwner, nil)
+				storSrv.EXPECT().GetWorkspaceMembers("ws1").Return([]models.WorkspaceMember{
+					{UserID: "testUserID", Role: models.RoleOwner}, {UserID: "bob", Role: models.RoleEditor},
+				}, nil)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+		{
+			name:        "APISetWorkspaceMember by editor",
+			member:      "bob",
+			requestBody: `{"role":"owner"}`,
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetWorkspaceRole("ws1", "testUserID").Return(models.RoleEditor, nil)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:        "APISetWorkspaceMember not a member",
+			member:      "bob",
+			requestBody: `{"role":"viewer"}`,
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetWorkspaceRole("ws1", "testUserID").Return("", repository.ErrNotFound)
+			},
+			expectedStatus: http.StatusNotFound,
+		},
+		{
+			name:           "APISetWorkspaceMember invalid role",
+			member:         "bob",
+			requestBody:    `{"role":"admin"}`,
+			mockSetup:      func(storSrv *mocks.MockStorageService) {},
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller := prepare_(t)
+			tt.mockSetup(storSrv)
+
+			req := workspaceRequestWithParams(http.MethodPut, "/api/workspaces/ws1/members/"+tt.member, tt.requestBody,
+				map[string]string{"id": "ws1", "userID": tt.member})
+			w := httptest.NewRecorder()
+
+			handler := controller.APISetWorkspaceMember()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestAPIRemoveWorkspaceMember(t *testing.T) {
+	tests := []struct {
+		mockSetup      func(storSrv *mocks.MockStorageService)
+		name           string
+		member         string
+		expectedStatus int
+	}{
+		{
+			name:   "APIRemoveWorkspaceMember leaves",
+			member: "testUserID",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetWorkspaceRole("ws1", "testUserID").Return(models.RoleViewer, nil)
+				storSrv.EXPECT().GetWorkspaceMembers("ws1").Return([]models.WorkspaceMember{
+					{UserID: "alice", Role: models.RoleOwner}, {UserID: "testUserID", Role: models.RoleViewer},
+				}, nil)
+				storSrv.EXPECT().RemoveWorkspaceMember("ws1", "testUserID").Return(nil)
+			},
+			expectedStatus: http.StatusNoContent,
+		},
+		{
+			name:   "APIRemoveWorkspaceMember viewer removes another",
+			member: "alice",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetWorkspaceRole("ws1", "testUserID").Return(models.RoleViewer, nil)
+			},
+			expectedStatus: http.StatusForbidden,
+		},
+		{
+			name:   "APIRemoveWorkspaceMember last owner",
+			member: "testUserID",
+			mockSetup: func(storSrv *mocks.MockStorageService) {
+				storSrv.EXPECT().GetWorkspaceRole("ws1", "testUserID").Return(models.RoleOwner, nil)
+				storSrv.EXPECT().GetWorkspaceMembers("ws1").Return([]models.WorkspaceMember{{UserID: "testUserID", Role: models.RoleOwner}}, nil)
+			},
+			expectedStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storSrv, _, controller := prepare_(t)
+			tt.mockSetup(storSrv)
+
+			req := workspaceRequestWithParams(http.MethodDelete, "/api/workspaces/ws1/members/"+tt.member, "",
+				map[string]string{"id": "ws1", "userID": tt.member})
+			w := httptest.NewRecorder()
+
+			handler := controller.APIRemoveWorkspaceMember()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+		})
+	}
+}
+
+func TestAPIWorkspaceURLs(t *testing.T) {
+	storSrv, _, controller := prepare_(t)
+	params := map[string]string{"id": "ws1"}
+	storSrv.EXPECT().GetWorkspaceRole("ws1", "testUserID").Return(models.RoleViewer, nil).Times(4)
+
+	storSrv.EXPECT().ListWorkspaceLinks("ws1", models.LinkQuery{Limit: models.DefaultPageSize, Sort: models.SortCreated}).
+		Return(models.LinkPage{Links: []models.UserLink{{ShortID: "ab", URLData: models.URLData{OriginalURL: "http://example.com"}}}}, nil)
+	w := httptest.NewRecorder()
+	controller.APIGetWorkspaceURLs().ServeHTTP(w, workspaceRequestWithParams(http.MethodGet, "/api/workspaces/ws1/urls", "", params))
+	require.Equal(t, http.StatusOK, w.Code)
+	var links []userLinkEntry
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&links))
+	require.Len(t, links, 1)
+	assert.Equal(t, controller.conf.BaseURL+"/ab", links[0].ShortURL)
+
+	storSrv.EXPECT().DeleteWorkspaceURLs("testUserID", "ws1", []string{"ab"}).Return(nil, repository.ErrForbidden)
+	w = httptest.NewRecorder()
+	controller.APIDeleteWorkspaceURLs().ServeHTTP(w, workspaceRequestWithParams(http.MethodDelete, "/api/workspaces/ws1/urls", `["ab"]`, params))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	storSrv.EXPECT().MoveLinksToWorkspace("testUserID", "ws1", []string{"ab", "cd"}).Return([]string{"ab"}, nil)
+	w = httptest.NewRecorder()
+	controller.APIMoveLinksToWorkspace().ServeHTTP(w, workspaceRequestWithParams(http.MethodPost, "/api/workspaces/ws1/urls", `["ab","cd"]`, params))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"moved":1}`, w.Body.String())
+
+	storSrv.EXPECT().GetWorkspaceStats("ws1").Return(models.WorkspaceStats{Links: 3, Deleted: 1, Clicks: 12, Members: 2}, nil)
+	w = httptest.NewRecorder()
+	controller.APIGetWorkspaceStats().ServeHTTP(w, workspaceRequestWithParams(http.MethodGet, "/api/workspaces/ws1/stats", "", params))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.JSONEq(t, `{"links":3,"deleted":1,"clicks":12,"members":2}`, w.Body.String())
+}
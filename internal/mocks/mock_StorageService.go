@@ -7,6 +7,8 @@ package mocks
 import (
 	http "net/http"
 	reflect "reflect"
+	models "shortener/internal/domain/models"
+	time "time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -34,20 +36,50 @@ func (m *MockStorageService) EXPECT() *MockStorageServiceMockRecorder {
 	return m.recorder
 }
 
-// BatchDeleteURLs mocks base method.
-func (m *MockStorageService) BatchDeleteURLs(arg0 string, arg1 []string) error {
+// AppendAudit mocks base method.
+func (m *MockStorageService) AppendAudit(arg0 models.AuditRecord) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "BatchDeleteURLs", arg0, arg1)
+	ret := m.ctrl.Call(m, "AppendAudit", arg0)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
+// AppendAudit indicates an expected call of AppendAudit.
+func (mr *MockStorageServiceMockRecorder) AppendAudit(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AppendAudit", reflect.TypeOf((*MockStorageService)(nil).AppendAudit), arg0)
+}
+
+// BatchDeleteURLs mocks base method.
+func (m *MockStorageService) BatchDeleteURLs(arg0 string, arg1 []string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "BatchDeleteURLs", arg0, arg1)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
 // BatchDeleteURLs indicates an expected call of BatchDeleteURLs.
 func (mr *MockStorageServiceMockRecorder) BatchDeleteURLs(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "BatchDeleteURLs", reflect.TypeOf((*MockStorageService)(nil).BatchDeleteURLs), arg0, arg1)
 }
 
+// ClaimWebhookDeliveries mocks base method.
+func (m *MockStorageService) ClaimWebhookDeliveries(arg0, arg1 time.Time, arg2 int) ([]models.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ClaimWebhookDeliveries", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]models.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ClaimWebhookDeliveries indicates an expected call of ClaimWebhookDeliveries.
+func (mr *MockStorageServiceMockRecorder) ClaimWebhookDeliveries(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimWebhookDeliveries", reflect.TypeOf((*MockStorageService)(nil).ClaimWebhookDeliveries), arg0, arg1, arg2)
+}
+
 // Close mocks base method.
 func (m *MockStorageService) Close() error {
 	m.ctrl.T.Helper()
@@ -62,6 +94,120 @@ func (mr *MockStorageServiceMockRecorder) Close() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Close", reflect.TypeOf((*MockStorageService)(nil).Close))
 }
 
+// CreateWorkspace mocks base method.
+func (m *MockStorageService) CreateWorkspace(arg0 models.Workspace, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWorkspace", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateWorkspace indicates an expected call of CreateWorkspace.
+func (mr *MockStorageServiceMockRecorder) CreateWorkspace(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWorkspace", reflect.TypeOf((*MockStorageService)(nil).CreateWorkspace), arg0, arg1)
+}
+
+// DeleteDomain mocks base method.
+func (m *MockStorageService) DeleteDomain(arg0 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteDomain", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteDomain indicates an expected call of DeleteDomain.
+func (mr *MockStorageServiceMockRecorder) DeleteDomain(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteDomain", reflect.TypeOf((*MockStorageService)(nil).DeleteDomain), arg0)
+}
+
+// DeleteUTMTemplate mocks base method.
+func (m *MockStorageService) DeleteUTMTemplate(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteUTMTemplate", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteUTMTemplate indicates an expected call of DeleteUTMTemplate.
+func (mr *MockStorageServiceMockRecorder) DeleteUTMTemplate(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteUTMTemplate", reflect.TypeOf((*MockStorageService)(nil).DeleteUTMTemplate), arg0, arg1)
+}
+
+// DeleteWebhook mocks base method.
+func (m *MockStorageService) DeleteWebhook(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhook", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWebhook indicates an expected call of DeleteWebhook.
+func (mr *MockStorageServiceMockRecorder) DeleteWebhook(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhook", reflect.TypeOf((*MockStorageService)(nil).DeleteWebhook), arg0, arg1)
+}
+
+// DeleteWorkspaceURLs mocks base method.
+func (m *MockStorageService) DeleteWorkspaceURLs(arg0, arg1 string, arg2 []string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWorkspaceURLs", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// DeleteWorkspaceURLs indicates an expected call of DeleteWorkspaceURLs.
+func (mr *MockStorageServiceMockRecorder) DeleteWorkspaceURLs(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWorkspaceURLs", reflect.TypeOf((*MockStorageService)(nil).DeleteWorkspaceURLs), arg0, arg1, arg2)
+}
+
+// EditLink mocks base method.
+func (m *MockStorageService) EditLink(arg0, arg1 string, arg2 models.LinkEdit) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EditLink", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EditLink indicates an expected call of EditLink.
+func (mr *MockStorageServiceMockRecorder) EditLink(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EditLink", reflect.TypeOf((*MockStorageService)(nil).EditLink), arg0, arg1, arg2)
+}
+
+// EnqueueWebhookEvent mocks base method.
+func (m *MockStorageService) EnqueueWebhookEvent(arg0 models.WebhookEvent) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EnqueueWebhookEvent", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// EnqueueWebhookEvent indicates an expected call of EnqueueWebhookEvent.
+func (mr *MockStorageServiceMockRecorder) EnqueueWebhookEvent(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EnqueueWebhookEvent", reflect.TypeOf((*MockStorageService)(nil).EnqueueWebhookEvent), arg0)
+}
+
+// FindLinksByURL mocks base method.
+func (m *MockStorageService) FindLinksByURL(arg0 string) ([]models.UserLink, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "FindLinksByURL", arg0)
+	ret0, _ := ret[0].([]models.UserLink)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// FindLinksByURL indicates an expected call of FindLinksByURL.
+func (mr *MockStorageServiceMockRecorder) FindLinksByURL(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "FindLinksByURL", reflect.TypeOf((*MockStorageService)(nil).FindLinksByURL), arg0)
+}
+
 // GetData mocks base method.
 func (m *MockStorageService) GetData(arg0 string) (string, bool, error) {
 	m.ctrl.T.Helper()
@@ -78,6 +224,291 @@ func (mr *MockStorageServiceMockRecorder) GetData(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetData", reflect.TypeOf((*MockStorageService)(nil).GetData), arg0)
 }
 
+// GetDomain mocks base method.
+func (m *MockStorageService) GetDomain(arg0 string) (models.Domain, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDomain", arg0)
+	ret0, _ := ret[0].(models.Domain)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDomain indicates an expected call of GetDomain.
+func (mr *MockStorageServiceMockRecorder) GetDomain(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDomain", reflect.TypeOf((*MockStorageService)(nil).GetDomain), arg0)
+}
+
+// GetLink mocks base method.
+func (m *MockStorageService) GetLink(arg0 string) (models.URLData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLink", arg0)
+	ret0, _ := ret[0].(models.URLData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLink indicates an expected call of GetLink.
+func (mr *MockStorageServiceMockRecorder) GetLink(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLink", reflect.TypeOf((*MockStorageService)(nil).GetLink), arg0)
+}
+
+// GetLinkOptions mocks base method.
+func (m *MockStorageService) GetLinkOptions(arg0 string) (models.LinkOptions, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLinkOptions", arg0)
+	ret0, _ := ret[0].(models.LinkOptions)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetLinkOptions indicates an expected call of GetLinkOptions.
+func (mr *MockStorageServiceMockRecorder) GetLinkOptions(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLinkOptions", reflect.TypeOf((*MockStorageService)(nil).GetLinkOptions), arg0)
+}
+
+// GetUTMTemplate mocks base method.
+func (m *MockStorageService) GetUTMTemplate(arg0 string) (models.UTMTemplate, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUTMTemplate", arg0)
+	ret0, _ := ret[0].(models.UTMTemplate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUTMTemplate indicates an expected call of GetUTMTemplate.
+func (mr *MockStorageServiceMockRecorder) GetUTMTemplate(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUTMTemplate", reflect.TypeOf((*MockStorageService)(nil).GetUTMTemplate), arg0)
+}
+
+// GetUTMTemplates mocks base method.
+func (m *MockStorageService) GetUTMTemplates(arg0 string) ([]models.UTMTemplate, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUTMTemplates", arg0)
+	ret0, _ := ret[0].([]models.UTMTemplate)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUTMTemplates indicates an expected call of GetUTMTemplates.
+func (mr *MockStorageServiceMockRecorder) GetUTMTemplates(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUTMTemplates", reflect.TypeOf((*MockStorageService)(nil).GetUTMTemplates), arg0)
+}
+
+// GetUserLink mocks base method.
+func (m *MockStorageService) GetUserLink(arg0, arg1 string) (models.URLData, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserLink", arg0, arg1)
+	ret0, _ := ret[0].(models.URLData)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserLink indicates an expected call of GetUserLink.
+func (mr *MockStorageServiceMockRecorder) GetUserLink(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserLink", reflect.TypeOf((*MockStorageService)(nil).GetUserLink), arg0, arg1)
+}
+
+// GetUserWorkspaces mocks base method.
+func (m *MockStorageService) GetUserWorkspaces(arg0 string) ([]models.WorkspaceMembership, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserWorkspaces", arg0)
+	ret0, _ := ret[0].([]models.WorkspaceMembership)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserWorkspaces indicates an expected call of GetUserWorkspaces.
+func (mr *MockStorageServiceMockRecorder) GetUserWorkspaces(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserWorkspaces", reflect.TypeOf((*MockStorageService)(nil).GetUserWorkspaces), arg0)
+}
+
+// GetWebhook mocks base method.
+func (m *MockStorageService) GetWebhook(arg0 string) (models.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhook", arg0)
+	ret0, _ := ret[0].(models.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhook indicates an expected call of GetWebhook.
+func (mr *MockStorageServiceMockRecorder) GetWebhook(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhook", reflect.TypeOf((*MockStorageService)(nil).GetWebhook), arg0)
+}
+
+// GetWebhookDeliveries mocks base method.
+func (m *MockStorageService) GetWebhookDeliveries(arg0, arg1 string, arg2 int) ([]models.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhookDeliveries", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]models.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhookDeliveries indicates an expected call of GetWebhookDeliveries.
+func (mr *MockStorageServiceMockRecorder) GetWebhookDeliveries(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhookDeliveries", reflect.TypeOf((*MockStorageService)(nil).GetWebhookDeliveries), arg0, arg1, arg2)
+}
+
+// GetWebhooks mocks base method.
+func (m *MockStorageService) GetWebhooks(arg0 string) ([]models.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhooks", arg0)
+	ret0, _ := ret[0].([]models.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhooks indicates an expected call of GetWebhooks.
+func (mr *MockStorageServiceMockRecorder) GetWebhooks(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhooks", reflect.TypeOf((*MockStorageService)(nil).GetWebhooks), arg0)
+}
+
+// GetWorkspaceMembers mocks base method.
+func (m *MockStorageService) GetWorkspaceMembers(arg0 string) ([]models.WorkspaceMember, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWorkspaceMembers", arg0)
+	ret0, _ := ret[0].([]models.WorkspaceMember)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWorkspaceMembers indicates an expected call of GetWorkspaceMembers.
+func (mr *MockStorageServiceMockRecorder) GetWorkspaceMembers(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspaceMembers", reflect.TypeOf((*MockStorageService)(nil).GetWorkspaceMembers), arg0)
+}
+
+// GetWorkspaceRole mocks base method.
+func (m *MockStorageService) GetWorkspaceRole(arg0, arg1 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWorkspaceRole", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWorkspaceRole indicates an expected call of GetWorkspaceRole.
+func (mr *MockStorageServiceMockRecorder) GetWorkspaceRole(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspaceRole", reflect.TypeOf((*MockStorageService)(nil).GetWorkspaceRole), arg0, arg1)
+}
+
+// GetWorkspaceStats mocks base method.
+func (m *MockStorageService) GetWorkspaceStats(arg0 string) (models.WorkspaceStats, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWorkspaceStats", arg0)
+	ret0, _ := ret[0].(models.WorkspaceStats)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWorkspaceStats indicates an expected call of GetWorkspaceStats.
+func (mr *MockStorageServiceMockRecorder) GetWorkspaceStats(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWorkspaceStats", reflect.TypeOf((*MockStorageService)(nil).GetWorkspaceStats), arg0)
+}
+
+// ListAudit mocks base method.
+func (m *MockStorageService) ListAudit(arg0 models.AuditQuery) ([]models.AuditRecord, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListAudit", arg0)
+	ret0, _ := ret[0].([]models.AuditRecord)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListAudit indicates an expected call of ListAudit.
+func (mr *MockStorageServiceMockRecorder) ListAudit(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListAudit", reflect.TypeOf((*MockStorageService)(nil).ListAudit), arg0)
+}
+
+// ListDomains mocks base method.
+func (m *MockStorageService) ListDomains() ([]models.Domain, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListDomains")
+	ret0, _ := ret[0].([]models.Domain)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListDomains indicates an expected call of ListDomains.
+func (mr *MockStorageServiceMockRecorder) ListDomains() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListDomains", reflect.TypeOf((*MockStorageService)(nil).ListDomains))
+}
+
+// ListUserLinks mocks base method.
+func (m *MockStorageService) ListUserLinks(arg0 string, arg1 models.LinkQuery) (models.LinkPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUserLinks", arg0, arg1)
+	ret0, _ := ret[0].(models.LinkPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUserLinks indicates an expected call of ListUserLinks.
+func (mr *MockStorageServiceMockRecorder) ListUserLinks(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUserLinks", reflect.TypeOf((*MockStorageService)(nil).ListUserLinks), arg0, arg1)
+}
+
+// ListWorkspaceLinks mocks base method.
+func (m *MockStorageService) ListWorkspaceLinks(arg0 string, arg1 models.LinkQuery) (models.LinkPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListWorkspaceLinks", arg0, arg1)
+	ret0, _ := ret[0].(models.LinkPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListWorkspaceLinks indicates an expected call of ListWorkspaceLinks.
+func (mr *MockStorageServiceMockRecorder) ListWorkspaceLinks(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListWorkspaceLinks", reflect.TypeOf((*MockStorageService)(nil).ListWorkspaceLinks), arg0, arg1)
+}
+
+// MoveLinksToWorkspace mocks base method.
+func (m *MockStorageService) MoveLinksToWorkspace(arg0, arg1 string, arg2 []string) ([]string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "MoveLinksToWorkspace", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// MoveLinksToWorkspace indicates an expected call of MoveLinksToWorkspace.
+func (mr *MockStorageServiceMockRecorder) MoveLinksToWorkspace(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "MoveLinksToWorkspace", reflect.TypeOf((*MockStorageService)(nil).MoveLinksToWorkspace), arg0, arg1, arg2)
+}
+
+// NextSequence mocks base method.
+func (m *MockStorageService) NextSequence() (uint64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NextSequence")
+	ret0, _ := ret[0].(uint64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NextSequence indicates an expected call of NextSequence.
+func (mr *MockStorageServiceMockRecorder) NextSequence() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NextSequence", reflect.TypeOf((*MockStorageService)(nil).NextSequence))
+}
+
 // Ping mocks base method.
 func (m *MockStorageService) Ping() error {
 	m.ctrl.T.Helper()
@@ -92,17 +523,206 @@ func (mr *MockStorageServiceMockRecorder) Ping() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Ping", reflect.TypeOf((*MockStorageService)(nil).Ping))
 }
 
+// PruneAudit mocks base method.
+func (m *MockStorageService) PruneAudit(arg0 time.Time) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PruneAudit", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PruneAudit indicates an expected call of PruneAudit.
+func (mr *MockStorageServiceMockRecorder) PruneAudit(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PruneAudit", reflect.TypeOf((*MockStorageService)(nil).PruneAudit), arg0)
+}
+
+// PurgeUser mocks base method.
+func (m *MockStorageService) PurgeUser(arg0 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeUser", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeUser indicates an expected call of PurgeUser.
+func (mr *MockStorageServiceMockRecorder) PurgeUser(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeUser", reflect.TypeOf((*MockStorageService)(nil).PurgeUser), arg0)
+}
+
+// RecordWebhookAttempt mocks base method.
+func (m *MockStorageService) RecordWebhookAttempt(arg0 string, arg1 models.DeliveryAttempt, arg2 string, arg3 time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RecordWebhookAttempt", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RecordWebhookAttempt indicates an expected call of RecordWebhookAttempt.
+func (mr *MockStorageServiceMockRecorder) RecordWebhookAttempt(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RecordWebhookAttempt", reflect.TypeOf((*MockStorageService)(nil).RecordWebhookAttempt), arg0, arg1, arg2, arg3)
+}
+
+// RegisterClick mocks base method.
+func (m *MockStorageService) RegisterClick(arg0 string, arg1 models.Click) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegisterClick", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RegisterClick indicates an expected call of RegisterClick.
+func (mr *MockStorageServiceMockRecorder) RegisterClick(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegisterClick", reflect.TypeOf((*MockStorageService)(nil).RegisterClick), arg0, arg1)
+}
+
+// RemoveWorkspaceMember mocks base method.
+func (m *MockStorageService) RemoveWorkspaceMember(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveWorkspaceMember", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveWorkspaceMember indicates an expected call of RemoveWorkspaceMember.
+func (mr *MockStorageServiceMockRecorder) RemoveWorkspaceMember(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveWorkspaceMember", reflect.TypeOf((*MockStorageService)(nil).RemoveWorkspaceMember), arg0, arg1)
+}
+
+// RenameLink mocks base method.
+func (m *MockStorageService) RenameLink(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RenameLink", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RenameLink indicates an expected call of RenameLink.
+func (mr *MockStorageServiceMockRecorder) RenameLink(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RenameLink", reflect.TypeOf((*MockStorageService)(nil).RenameLink), arg0, arg1)
+}
+
+// SaveDomain mocks base method.
+func (m *MockStorageService) SaveDomain(arg0 models.Domain) (models.Domain, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveDomain", arg0)
+	ret0, _ := ret[0].(models.Domain)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SaveDomain indicates an expected call of SaveDomain.
+func (mr *MockStorageServiceMockRecorder) SaveDomain(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveDomain", reflect.TypeOf((*MockStorageService)(nil).SaveDomain), arg0)
+}
+
+// SaveUTMTemplate mocks base method.
+func (m *MockStorageService) SaveUTMTemplate(arg0 models.UTMTemplate) (models.UTMTemplate, bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveUTMTemplate", arg0)
+	ret0, _ := ret[0].(models.UTMTemplate)
+	ret1, _ := ret[1].(bool)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// SaveUTMTemplate indicates an expected call of SaveUTMTemplate.
+func (mr *MockStorageServiceMockRecorder) SaveUTMTemplate(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveUTMTemplate", reflect.TypeOf((*MockStorageService)(nil).SaveUTMTemplate), arg0)
+}
+
+// SaveWebhook mocks base method.
+func (m *MockStorageService) SaveWebhook(arg0 models.Webhook) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SaveWebhook", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SaveWebhook indicates an expected call of SaveWebhook.
+func (mr *MockStorageServiceMockRecorder) SaveWebhook(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveWebhook", reflect.TypeOf((*MockStorageService)(nil).SaveWebhook), arg0)
+}
+
+// ScanLinks mocks base method.
+func (m *MockStorageService) ScanLinks(arg0 func(string, models.URLData) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScanLinks", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ScanLinks indicates an expected call of ScanLinks.
+func (mr *MockStorageServiceMockRecorder) ScanLinks(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScanLinks", reflect.TypeOf((*MockStorageService)(nil).ScanLinks), arg0)
+}
+
+// SetLinkDisabled mocks base method.
+func (m *MockStorageService) SetLinkDisabled(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetLinkDisabled", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetLinkDisabled indicates an expected call of SetLinkDisabled.
+func (mr *MockStorageServiceMockRecorder) SetLinkDisabled(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetLinkDisabled", reflect.TypeOf((*MockStorageService)(nil).SetLinkDisabled), arg0, arg1)
+}
+
+// SetWorkspaceMember mocks base method.
+func (m *MockStorageService) SetWorkspaceMember(arg0 models.WorkspaceMember) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetWorkspaceMember", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetWorkspaceMember indicates an expected call of SetWorkspaceMember.
+func (mr *MockStorageServiceMockRecorder) SetWorkspaceMember(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetWorkspaceMember", reflect.TypeOf((*MockStorageService)(nil).SetWorkspaceMember), arg0)
+}
+
+// TransferLink mocks base method.
+func (m *MockStorageService) TransferLink(arg0, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "TransferLink", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// TransferLink indicates an expected call of TransferLink.
+func (mr *MockStorageServiceMockRecorder) TransferLink(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "TransferLink", reflect.TypeOf((*MockStorageService)(nil).TransferLink), arg0, arg1)
+}
+
 // UpdateData mocks base method.
-func (m *MockStorageService) UpdateData(arg0 *http.Request, arg1, arg2 string) (string, error) {
+func (m *MockStorageService) UpdateData(arg0 *http.Request, arg1, arg2 string, arg3 models.LinkOptions) (string, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "UpdateData", arg0, arg1, arg2)
+	ret := m.ctrl.Call(m, "UpdateData", arg0, arg1, arg2, arg3)
 	ret0, _ := ret[0].(string)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // UpdateData indicates an expected call of UpdateData.
-func (mr *MockStorageServiceMockRecorder) UpdateData(arg0, arg1, arg2 interface{}) *gomock.Call {
+func (mr *MockStorageServiceMockRecorder) UpdateData(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateData", reflect.TypeOf((*MockStorageService)(nil).UpdateData), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateData", reflect.TypeOf((*MockStorageService)(nil).UpdateData), arg0, arg1, arg2, arg3)
 }
@@ -7,6 +7,7 @@ package mocks
 import (
 	http "net/http"
 	reflect "reflect"
+	models "shortener/internal/domain/models"
 	user "shortener/internal/user"
 
 	gomock "github.com/golang/mock/gomock"
@@ -36,15 +37,15 @@ func (m *MockUserService) EXPECT() *MockUserServiceMockRecorder {
 }
 
 // AddURLs mocks base method.
-func (m *MockUserService) AddURLs(arg0, arg1, arg2, arg3 string) {
+func (m *MockUserService) AddURLs(arg0, arg1, arg2, arg3 string, arg4 models.LinkMetadata) {
 	m.ctrl.T.Helper()
-	m.ctrl.Call(m, "AddURLs", arg0, arg1, arg2, arg3)
+	m.ctrl.Call(m, "AddURLs", arg0, arg1, arg2, arg3, arg4)
 }
 
 // AddURLs indicates an expected call of AddURLs.
-func (mr *MockUserServiceMockRecorder) AddURLs(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+func (mr *MockUserServiceMockRecorder) AddURLs(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddURLs", reflect.TypeOf((*MockUserService)(nil).AddURLs), arg0, arg1, arg2, arg3)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddURLs", reflect.TypeOf((*MockUserService)(nil).AddURLs), arg0, arg1, arg2, arg3, arg4)
 }
 
 // GetUserIDFromCookie mocks base method.
@@ -89,6 +90,18 @@ func (mr *MockUserServiceMockRecorder) InitUserURLs(arg0 interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "InitUserURLs", reflect.TypeOf((*MockUserService)(nil).InitUserURLs), arg0)
 }
 
+// SetURLMetadata mocks base method.
+func (m *MockUserService) SetURLMetadata(arg0, arg1, arg2 string, arg3 models.LinkMetadata) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SetURLMetadata", arg0, arg1, arg2, arg3)
+}
+
+// SetURLMetadata indicates an expected call of SetURLMetadata.
+func (mr *MockUserServiceMockRecorder) SetURLMetadata(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetURLMetadata", reflect.TypeOf((*MockUserService)(nil).SetURLMetadata), arg0, arg1, arg2, arg3)
+}
+
 // SetUserIDCookie mocks base method.
 func (m *MockUserService) SetUserIDCookie(arg0 http.ResponseWriter, arg1 string) error {
 	m.ctrl.T.Helper()
@@ -0,0 +1,192 @@
+// Package qr renders QR codes of short links as PNG or SVG images.
+package qr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Image formats.
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+)
+
+// Limits and defaults of the rendering options.
+const (
+	DefaultSize   = 256
+	MinSize       = 64
+	MaxSize       = 2048
+	DefaultMargin = 4
+	MaxMargin     = 16
+	DefaultLevel  = "M"
+)
+
+// ErrOptions - error when the rendering options are invalid.
+var ErrOptions = errors.New("invalid qr options")
+
+// levels maps error-correction levels to the share of the code that can be restored (L 7%, M 15%, Q 25%, H 30%).
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// Options - rendering options of a QR code.
+type Options struct {
+	// Format: FormatPNG or FormatSVG.
+	Format string
+	// Size: width and height of the image in pixels.
+	Size int
+	// Margin: width of the quiet zone around the code in modules.
+	Margin int
+	// Level: error-correction level (L, M, Q or H).
+	Level string
+}
+
+// DefaultOptions returns the options used for omitted parameters.
+func DefaultOptions() Options {
+	return Options{Format: FormatPNG, Size: DefaultSize, Margin: DefaultMargin, Level: DefaultLevel}
+}
+
+// ParseOptions reads the options from the request parameters format, size, margin and ec;
+// get returns the value of a parameter (empty if it is omitted).
+func ParseOptions(get func(name string) string) (Options, error) {
+	o := DefaultOptions()
+
+	if v := get("format"); v != "" {
+		o.Format = strings.ToLower(v)
+	}
+	if o.Format != FormatPNG && o.Format != FormatSVG {
+		return Options{}, fmt.Errorf("%w: format must be png or svg", ErrOptions)
+	}
+
+	var err error
+	if o.Size, err = intParam(get("size"), DefaultSize, MinSize, MaxSize, "size"); err != nil {
+		return Options{}, err
+	}
+	if o.Margin, err = intParam(get("margin"), DefaultMargin, 0, MaxMargin, "margin"); err != nil {
+		return Options{}, err
+	}
+
+	if v := get("ec"); v != "" {
+		o.Level = strings.ToUpper(v)
+	}
+	if _, ok := levels[o.Level]; !ok {
+		return Options{}, fmt.Errorf("%w: ec must be L, M, Q or H", ErrOptions)
+	}
+	return o, nil
+}
+
+func intParam(v string, def, minValue, maxValue int, name string) (int, error) {
+	if v == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < minValue || n > maxValue {
+		return 0, fmt.Errorf("%w: %s must be between %d and %d", ErrOptions, name, minValue, maxValue)
+	}
+	return n, nil
+}
+
+// ContentType returns the MIME type of the format.
+func (o Options) ContentType() string {
+	if o.Format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// ETag returns the entity tag of the QR code of the content rendered with the options.
+// Equal content and options always produce the same image, so the tag does not depend on the image bytes.
+func (o Options) ETag(content string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%s\x00%d\x00%d\x00%s", content, o.Format, o.Size, o.Margin, o.Level)))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// Render encodes the content as a QR code and renders it with the options.
+func Render(content string, o Options) ([]byte, error) {
+	level, ok := levels[o.Level]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown ec level %s", ErrOptions, o.Level)
+	}
+	code, err := qrcode.New(content, level)
+	if err != nil {
+		return nil, err
+	}
+	code.DisableBorder = true
+	modules := code.Bitmap()
+
+	if o.Format == FormatSVG {
+		return renderSVG(modules, o), nil
+	}
+	return renderPNG(modules, o)
+}
+
+// renderPNG draws the modules scaled to the largest whole number of pixels that fits the size;
+// the remaining pixels are added to the quiet zone.
+func renderPNG(modules [][]bool, o Options) ([]byte, error) {
+	total := len(modules) + 2*o.Margin
+	scale := max(o.Size/total, 1)
+	size := max(o.Size, total*scale)
+	offset := (size - len(modules)*scale) / 2
+
+	img := image.NewPaletted(image.Rect(0, 0, size, size), color.Palette{color.White, color.Black})
+	for y, row := range modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex(offset+x*scale+dx, offset+y*scale+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// renderSVG draws the modules as a single path in a view box measured in modules.
+func renderSVG(modules [][]bool, o Options) []byte {
+	total := len(modules) + 2*o.Margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<?xml version="1.0" encoding="UTF-8"?>`+"\n"+
+		`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n",
+		o.Size, o.Size, total, total)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/>`+"\n", total, total)
+	buf.WriteString(`<path fill="#000" d="`)
+	for y, row := range modules {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			// merge horizontal runs of dark modules into one rectangle
+			run := 1
+			for x+run < len(row) && row[x+run] {
+				run++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", x+o.Margin, y+o.Margin, run, run)
+			x += run - 1
+		}
+	}
+	buf.WriteString(`"/>` + "\n</svg>\n")
+	return buf.Bytes()
+}
@@ -0,0 +1,86 @@
+package qr
+
+import (
+	"bytes"
+	"image/png"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOptions(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected Options
+		err      bool
+	}{
+		{name: "defaults", query: "", expected: DefaultOptions()},
+		{name: "all set", query: "format=SVG&size=512&margin=0&ec=h", expected: Options{Format: FormatSVG, Size: 512, Margin: 0, Level: "H"}},
+		{name: "unknown format", query: "format=gif", err: true},
+		{name: "size too small", query: "size=10", err: true},
+		{name: "size not a number", query: "size=big", err: true},
+		{name: "margin too large", query: "margin=17", err: true},
+		{name: "unknown level", query: "ec=X", err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+
+			o, err := ParseOptions(query.Get)
+			if tt.err {
+				require.ErrorIs(t, err, ErrOptions)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, o)
+		})
+	}
+}
+
+func TestRenderPNG(t *testing.T) {
+	o := Options{Format: FormatPNG, Size: 300, Margin: 4, Level: "L"}
+	data, err := Render("http://localhost:8080/abc123", o)
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	assert.Equal(t, 300, img.Bounds().Dx())
+	assert.Equal(t, 300, img.Bounds().Dy())
+
+	// Version 2 (25 modules) with a margin of 4 modules on each side: 33 modules of 9 pixels,
+	// the 3 remaining pixels are added to the quiet zone.
+	r, _, _, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, uint32(0xffff), r, "Expected the quiet zone to be white")
+	offset := (300 - 25*9) / 2
+	r, _, _, _ = img.At(offset, offset).RGBA()
+	assert.Equal(t, uint32(0), r, "Expected the finder pattern to start after the quiet zone")
+	r, _, _, _ = img.At(offset-1, offset-1).RGBA()
+	assert.Equal(t, uint32(0xffff), r)
+}
+
+func TestRenderSVG(t *testing.T) {
+	o := Options{Format: FormatSVG, Size: 128, Margin: 2, Level: "L"}
+	data, err := Render("http://localhost:8080/abc123", o)
+	require.NoError(t, err)
+
+	svg := string(data)
+	assert.True(t, strings.HasPrefix(svg, "<?xml"))
+	assert.Contains(t, svg, `width="128" height="128" viewBox="0 0 29 29"`)
+	assert.Contains(t, svg, `d="M2 2h7v1h-7z`, "Expected the top row of the finder pattern as one run")
+}
+
+func TestETag(t *testing.T) {
+	o := DefaultOptions()
+	assert.Equal(t, o.ETag("a"), o.ETag("a"))
+	assert.NotEqual(t, o.ETag("a"), o.ETag("b"))
+
+	svg := o
+	svg.Format = FormatSVG
+	assert.NotEqual(t, o.ETag("a"), svg.ETag("a"))
+}
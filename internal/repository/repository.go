@@ -3,15 +3,27 @@ package repository
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"shortener/internal/domain/models"
+	"time"
 
-	"github.com/9ssi7/nanoid"
+	"github.com/jackc/pgx/v5/pgconn"
 )
 
 // ErrDuplicateURL - error when the original URL already exists in the system.
 var ErrDuplicateURL = errors.New("duplicate URL")
 
+// ErrNotFound - error when the requested record does not exist in the storage.
+var ErrNotFound = errors.New("not found")
+
+// ErrForbidden - error when the user's role does not allow the change.
+var ErrForbidden = errors.New("forbidden")
+
+// ErrShortIDTaken - error when the short ID already belongs to another link.
+var ErrShortIDTaken = errors.New("short ID is taken")
+
 // Repository - interface for working with shortened URLs.
 type Repository interface {
 	GetShortURL_db(originalURL string) (string, error)
@@ -22,39 +34,134 @@ type Repo struct {
 }
 
 const insertRow = `
-INSERT INTO urls (user_id, short_url, original_url) VALUES ($1, $2, $3)
+INSERT INTO urls (user_id, short_url, original_url, redirect_type, passthrough, utm_template_id, password_hash, max_clicks, destinations, rules,
+	title, interstitial, created_at, notes, tags)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
 ON CONFLICT (original_url) DO NOTHING
 RETURNING short_url`
 
+const selectShortIDTaken = "SELECT EXISTS (SELECT 1 FROM urls WHERE short_url = $1)"
+
+// uniqueViolation - SQLSTATE of an insert violating a unique constraint.
+const uniqueViolation = "23505"
+
 // GetShortURLDB returns the shortened URL for the given original URL and user ID.
 // If the URL already exists, it returns the existing shortened URL with the error ErrDuplicateURL.
-func (s *Repo) GetShortURLDB(userID, originalURL string, db *sql.DB) (string, error) {
+// The alias of the options is used as the short ID if no link has it yet. The short ID is qualified
+// by the domain of the options (see models.QualifyShortID).
+//
+// A short ID taken by a concurrent insert after it was checked is detected by the unique constraint
+// of the table, and the link is inserted with a new generated short ID, at most MaxShortIDAttempts times;
+// then ErrShortIDExhausted is returned.
+func (s *Repo) GetShortURLDB(userID, originalURL string, opts models.LinkOptions, db *sql.DB) (string, error) {
 	var shortURL string
-	var retErr error
-	shortID := GenerateShortID()
+	taken := func(id string) (bool, error) {
+		var taken bool
+		if err := db.QueryRow(selectShortIDTaken, models.QualifyShortID(id, opts.Domain)).Scan(&taken); err != nil {
+			return false, fmt.Errorf("error select query: %w", err)
+		}
+		return taken, nil
+	}
+	shortID, err := AliasOrNewShortID(opts, taken)
+	if err != nil {
+		return "", err
+	}
+	opts.SetCreated(time.Now())
 
-	row := db.QueryRow(insertRow, userID, shortID, originalURL)
-	_ = row.Scan(&shortURL)
+	destinations, err := MarshalDestinations(opts.Destinations)
+	if err != nil {
+		return "", err
+	}
+	rules, err := MarshalRules(opts.Rules)
+	if err != nil {
+		return "", err
+	}
+	tags, err := MarshalTags(opts.Tags)
+	if err != nil {
+		return "", err
+	}
 
-	retErr = nil
+	for attempt := 1; ; attempt++ {
+		row := db.QueryRow(insertRow, userID, shortID, originalURL, opts.RedirectType, opts.Passthrough, opts.UTMTemplateID, opts.PasswordHash, opts.MaxClicks, destinations, rules,
+			opts.Title, opts.Interstitial, opts.CreatedAt, opts.Notes, tags)
+		err = row.Scan(&shortURL)
+		if err == nil {
+			return shortURL, nil
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if !isUniqueViolation(err) {
+			return "", fmt.Errorf("error insert query: %w", err)
+		}
+		if attempt == MaxShortIDAttempts {
+			return "", ErrShortIDExhausted
+		}
+		opts.Alias = ""
+		if shortID, err = AliasOrNewShortID(opts, taken); err != nil {
+			return "", err
+		}
+	}
+
+	// Получение существующего сокращенного URL
+	row := db.QueryRow(
+		"SELECT short_url FROM urls WHERE original_url = $1", originalURL)
+	if err := row.Scan(&shortURL); err != nil {
+		return "", fmt.Errorf("error select query: %v", err)
+	}
+	return shortURL, ErrDuplicateURL
+}
 
-	if shortURL == "" {
-		// Получение существующего сокращенного URL
-		row := db.QueryRow(
-			"SELECT short_url FROM urls WHERE original_url = $1", originalURL)
-		err := row.Scan(&shortURL)
+// isUniqueViolation reports whether the error of an insert is a violation of a unique constraint.
+// The conflicts on original_url are skipped by the insert, so it is a short ID taken by another link.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == uniqueViolation
+}
+
+// AliasOrNewShortID returns the storage key of the new link: the alias of the options if it is not taken,
+// otherwise a generated short ID (see NewShortID), qualified by the domain of the options.
+// taken checks the short IDs in the namespace of the domain.
+func AliasOrNewShortID(opts models.LinkOptions, taken func(shortID string) (bool, error)) (string, error) {
+	if opts.Alias != "" {
+		aliasTaken, err := taken(opts.Alias)
 		if err != nil {
-			return "", fmt.Errorf("error select query: %v", err)
+			return "", err
 		}
-		retErr = ErrDuplicateURL
-		fmt.Println("Existing short URL:", shortURL)
+		if !aliasTaken {
+			return models.QualifyShortID(opts.Alias, opts.Domain), nil
+		}
+	}
+	shortID, err := NewShortID(taken)
+	if err != nil {
+		return "", err
 	}
+	return models.QualifyShortID(shortID, opts.Domain), nil
+}
+
+// MarshalDestinations encodes the link destinations for the JSONB destinations column.
+func MarshalDestinations(destinations []models.Destination) (string, error) {
+	return marshalList("destinations", destinations)
+}
 
-	return shortURL, retErr
+// MarshalRules encodes the link targeting rules for the JSONB rules column.
+func MarshalRules(rules []models.TargetingRule) (string, error) {
+	return marshalList("rules", rules)
 }
 
-// GenerateShortID generates a unique identifier for a shortened URL.
-func GenerateShortID() string {
-	id, _ := nanoid.New()
-	return id
+// MarshalTags encodes the link tags for the JSONB tags column.
+func MarshalTags(tags []string) (string, error) {
+	return marshalList("tags", tags)
+}
+
+// marshalList encodes the list as a JSON array (a nil list becomes an empty array).
+func marshalList[T any](name string, list []T) (string, error) {
+	if list == nil {
+		list = []T{}
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return "", fmt.Errorf("error encoding %s: %w", name, err)
+	}
+	return string(data), nil
 }
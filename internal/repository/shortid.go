@@ -0,0 +1,325 @@
+package repository
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	mathrand "math/rand/v2"
+	"shortener/internal/routes"
+	"strings"
+	"sync"
+)
+
+// Strategies of the short ID generation.
+const (
+	// StrategyNanoid - random IDs of Length characters of Alphabet.
+	StrategyNanoid = "nanoid"
+	// StrategyBase62 - the next value of the storage sequence in base62.
+	StrategyBase62 = "base62"
+	// StrategyHashids - the next value of the storage sequence obfuscated by Salt, at least Length characters long.
+	StrategyHashids = "hashids"
+	// StrategyWords - random pairs of English words ("brave-otter").
+	StrategyWords = "words"
+)
+
+// MaxShortIDAttempts - number of short IDs a generator tries before it gives up.
+const MaxShortIDAttempts = 10
+
+// Defaults of the short ID generators.
+const (
+	nanoidAlphabet       = "_-0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	base62Alphabet       = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	defaultNanoidLength  = 10
+	defaultHashidsLength = 6
+	maxShortIDLength     = 64
+)
+
+// hashidsMultiplier - prime that scatters the sequence values of hashids IDs. It is coprime
+// with every alphabet size, so the multiplication is a bijection for each ID length.
+const hashidsMultiplier = 1_000_000_007
+
+// ErrShortIDExhausted - error when the generator found no free short ID in MaxShortIDAttempts attempts.
+var ErrShortIDExhausted = errors.New("no free short ID")
+
+// ErrShortIDOptions - error when the settings of the short ID generator are invalid.
+var ErrShortIDOptions = errors.New("invalid short ID generator options")
+
+// ShortIDGenerator generates the short IDs of new links.
+type ShortIDGenerator interface {
+	// Generate returns a short ID for which taken reports false and which is not a reserved path segment
+	// (see routes.IsReserved). Every generator retries in its own way: random generators draw a new ID,
+	// sequence generators take the next value. It gives up with ErrShortIDExhausted after MaxShortIDAttempts IDs.
+	Generate(taken func(shortID string) (bool, error)) (string, error)
+}
+
+// ShortIDOptions - settings of the short ID generator.
+type ShortIDOptions struct {
+	// Strategy: StrategyNanoid (default), StrategyBase62, StrategyHashids or StrategyWords.
+	Strategy string
+	// Alphabet: characters of nanoid and hashids IDs, letters, digits, '_' and '-'
+	// (default: those 64 characters for nanoid, letters and digits for hashids).
+	Alphabet string
+	// Length: length of nanoid IDs (default 10) and minimum length of hashids IDs (default 6).
+	Length int
+	// Salt: secret that shuffles the alphabet of hashids IDs.
+	Salt string
+}
+
+// Sequence returns the next value of a counter kept by the storage.
+type Sequence func() (uint64, error)
+
+// NewShortIDGenerator creates the generator of the strategy. The sequence strategies take their values from seq.
+func NewShortIDGenerator(opts ShortIDOptions, seq Sequence) (ShortIDGenerator, error) {
+	if opts.Length < 0 || opts.Length > maxShortIDLength {
+		return nil, fmt.Errorf("%w: length must be between 1 and %d", ErrShortIDOptions, maxShortIDLength)
+	}
+	if err := checkAlphabet(opts.Alphabet); err != nil {
+		return nil, err
+	}
+
+	switch opts.Strategy {
+	case "", StrategyNanoid:
+		return nanoidGenerator{alphabet: or(opts.Alphabet, nanoidAlphabet), length: orInt(opts.Length, defaultNanoidLength)}, nil
+	case StrategyBase62:
+		return base62Generator{seq: seq}, nil
+	case StrategyHashids:
+		return hashidsGenerator{
+			alphabet: shuffle(or(opts.Alphabet, base62Alphabet), opts.Salt),
+			length:   orInt(opts.Length, defaultHashidsLength),
+			seq:      seq,
+		}, nil
+	case StrategyWords:
+		return wordsGenerator{}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown strategy %q", ErrShortIDOptions, opts.Strategy)
+	}
+}
+
+// checkAlphabet checks that the alphabet has at least two distinct characters allowed in short IDs.
+// An empty alphabet selects the default one.
+func checkAlphabet(alphabet string) error {
+	if alphabet == "" {
+		return nil
+	}
+	for i, r := range alphabet {
+		if !strings.ContainsRune(nanoidAlphabet, r) {
+			return fmt.Errorf("%w: alphabet character %q is not a letter, digit, '_' or '-'", ErrShortIDOptions, r)
+		}
+		if strings.ContainsRune(alphabet[:i], r) {
+			return fmt.Errorf("%w: alphabet character %q is repeated", ErrShortIDOptions, r)
+		}
+	}
+	if len(alphabet) < 2 {
+		return fmt.Errorf("%w: alphabet must have at least 2 characters", ErrShortIDOptions)
+	}
+	return nil
+}
+
+// firstFree returns the first of at most MaxShortIDAttempts IDs made by next that is neither reserved nor taken.
+func firstFree(next func(attempt int) (string, error), taken func(shortID string) (bool, error)) (string, error) {
+	for attempt := range MaxShortIDAttempts {
+		id, err := next(attempt)
+		if err != nil {
+			return "", err
+		}
+		if routes.IsReserved(id) {
+			continue
+		}
+		isTaken, err := taken(id)
+		if err != nil {
+			return "", err
+		}
+		if !isTaken {
+			return id, nil
+		}
+	}
+	return "", ErrShortIDExhausted
+}
+
+// nanoidGenerator - generator of random IDs.
+type nanoidGenerator struct {
+	alphabet string
+	length   int
+}
+
+// Generate draws a new random ID for every attempt.
+func (g nanoidGenerator) Generate(taken func(shortID string) (bool, error)) (string, error) {
+	return firstFree(func(int) (string, error) {
+		return randomString(g.alphabet, g.length)
+	}, taken)
+}
+
+// randomString returns a string of length characters drawn uniformly from the alphabet by crypto/rand.
+func randomString(alphabet string, length int) (string, error) {
+	size := big.NewInt(int64(len(alphabet)))
+	var b strings.Builder
+	b.Grow(length)
+	for range length {
+		n, err := rand.Int(rand.Reader, size)
+		if err != nil {
+			return "", fmt.Errorf("error generating short ID: %w", err)
+		}
+		b.WriteByte(alphabet[n.Int64()])
+	}
+	return b.String(), nil
+}
+
+// base62Generator - generator of the storage sequence values in base62.
+type base62Generator struct {
+	seq Sequence
+}
+
+// Generate takes the next sequence value for every attempt.
+func (g base62Generator) Generate(taken func(shortID string) (bool, error)) (string, error) {
+	return firstFree(func(int) (string, error) {
+		n, err := g.seq()
+		if err != nil {
+			return "", err
+		}
+		return encode(new(big.Int).SetUint64(n), base62Alphabet, 1), nil
+	}, taken)
+}
+
+// hashidsGenerator - generator of obfuscated storage sequence values: the value is scattered by
+// a multiplication modulo the number of IDs of the length and written in the shuffled alphabet.
+// The IDs get longer when the values of the length run out, so they never repeat.
+type hashidsGenerator struct {
+	seq      Sequence
+	alphabet string
+	length   int
+}
+
+// Generate takes the next sequence value for every attempt.
+func (g hashidsGenerator) Generate(taken func(shortID string) (bool, error)) (string, error) {
+	return firstFree(func(int) (string, error) {
+		n, err := g.seq()
+		if err != nil {
+			return "", err
+		}
+		return g.obfuscate(n), nil
+	}, taken)
+}
+
+// obfuscate returns the ID of the sequence value.
+func (g hashidsGenerator) obfuscate(n uint64) string {
+	value := new(big.Int).SetUint64(n)
+	base := big.NewInt(int64(len(g.alphabet)))
+	length := g.length
+	space := new(big.Int).Exp(base, big.NewInt(int64(length)), nil)
+	for value.Cmp(space) >= 0 {
+		space.Mul(space, base)
+		length++
+	}
+	value.Mul(value, big.NewInt(hashidsMultiplier)).Mod(value, space)
+	return encode(value, g.alphabet, length)
+}
+
+// encode writes the value in the positional system of the alphabet, padded to at least length digits.
+func encode(value *big.Int, alphabet string, length int) string {
+	base := big.NewInt(int64(len(alphabet)))
+	value = new(big.Int).Set(value)
+	digit := new(big.Int)
+	var digits []byte
+	for value.Sign() > 0 || len(digits) < length {
+		value.DivMod(value, base, digit)
+		digits = append(digits, alphabet[digit.Int64()])
+	}
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+	return string(digits)
+}
+
+// shuffle returns the alphabet shuffled by a generator seeded with the salt; an empty salt keeps it.
+func shuffle(alphabet, salt string) string {
+	if salt == "" {
+		return alphabet
+	}
+	sum := sha256.Sum256([]byte(salt))
+	r := mathrand.New(mathrand.NewPCG(binary.BigEndian.Uint64(sum[:8]), binary.BigEndian.Uint64(sum[8:16]))) //nolint:gosec // deterministic shuffle, not a secret
+	chars := []byte(alphabet)
+	r.Shuffle(len(chars), func(i, j int) { chars[i], chars[j] = chars[j], chars[i] })
+	return string(chars)
+}
+
+// Words of the human-readable IDs.
+var (
+	adjectives = []string{
+		"amber", "bold", "brave", "bright", "calm", "clever", "cosy", "crisp", "daring", "eager", "fancy", "fast",
+		"gentle", "glad", "golden", "happy", "honest", "jolly", "kind", "lively", "lucky", "merry", "mighty", "neat",
+		"noble", "proud", "quick", "quiet", "rapid", "shiny", "silent", "sunny", "swift", "tidy", "vivid", "witty",
+	}
+	nouns = []string{
+		"badger", "bear", "beaver", "bison", "crane", "eagle", "falcon", "ferret", "finch", "fox", "gecko", "heron",
+		"horse", "koala", "lemur", "lion", "lynx", "moose", "otter", "owl", "panda", "parrot", "puffin", "rabbit",
+		"raven", "robin", "seal", "sparrow", "swan", "tiger", "toad", "turtle", "walrus", "whale", "wolf", "zebra",
+	}
+)
+
+// wordsGenerator - generator of random word pairs. The later half of the attempts gets a number
+// appended to the pair, because the pairs alone run out quickly.
+type wordsGenerator struct{}
+
+// Generate draws a new pair for every attempt.
+func (wordsGenerator) Generate(taken func(shortID string) (bool, error)) (string, error) {
+	return firstFree(func(attempt int) (string, error) {
+		var b strings.Builder
+		for i, words := range [][]string{adjectives, nouns} {
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(words))))
+			if err != nil {
+				return "", fmt.Errorf("error generating short ID: %w", err)
+			}
+			if i > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteString(words[n.Int64()])
+		}
+		if attempt >= MaxShortIDAttempts/2 {
+			suffix, err := randomString("0123456789", 3)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString("-" + suffix)
+		}
+		return b.String(), nil
+	}, taken)
+}
+
+// or returns s or, if it is empty, def.
+func or(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// orInt returns n or, if it is zero, def.
+func orInt(n, def int) int {
+	if n == 0 {
+		return def
+	}
+	return n
+}
+
+var (
+	generatorMu sync.RWMutex
+	generator   ShortIDGenerator = nanoidGenerator{alphabet: nanoidAlphabet, length: defaultNanoidLength}
+)
+
+// SetShortIDGenerator sets the generator of the short IDs of all storages (nanoid with the defaults until set).
+func SetShortIDGenerator(g ShortIDGenerator) {
+	generatorMu.Lock()
+	defer generatorMu.Unlock()
+	generator = g
+}
+
+// NewShortID returns a short ID for which taken reports false from the generator set by SetShortIDGenerator.
+func NewShortID(taken func(shortID string) (bool, error)) (string, error) {
+	generatorMu.RLock()
+	g := generator
+	generatorMu.RUnlock()
+	return g.Generate(taken)
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"regexp"
+	"testing"
+
+	"shortener/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// counter returns the sequence counting from start.
+func counter(start uint64) Sequence {
+	n := start - 1
+	return func() (uint64, error) {
+		n++
+		return n, nil
+	}
+}
+
+func notTaken(string) (bool, error) { return false, nil }
+
+func TestNewShortIDGeneratorOptions(t *testing.T) {
+	for _, opts := range []ShortIDOptions{
+		{Strategy: "uuid"},
+		{Alphabet: "ab/"},
+		{Alphabet: "abca"},
+		{Alphabet: "a"},
+		{Length: maxShortIDLength + 1},
+		{Length: -1},
+	} {
+		_, err := NewShortIDGenerator(opts, nil)
+		assert.ErrorIs(t, err, ErrShortIDOptions, "options %+v", opts)
+	}
+}
+
+func TestNanoidGenerator(t *testing.T) {
+	g, err := NewShortIDGenerator(ShortIDOptions{}, nil)
+	require.NoError(t, err)
+	id, err := g.Generate(notTaken)
+	require.NoError(t, err)
+	assert.Regexp(t, `^[A-Za-z0-9_-]{10}$`, id)
+
+	g, err = NewShortIDGenerator(ShortIDOptions{Strategy: StrategyNanoid, Alphabet: "xyz", Length: 16}, nil)
+	require.NoError(t, err)
+	id, err = g.Generate(notTaken)
+	require.NoError(t, err)
+	assert.Regexp(t, `^[xyz]{16}$`, id)
+}
+
+func TestBase62Generator(t *testing.T) {
+	g, err := NewShortIDGenerator(ShortIDOptions{Strategy: StrategyBase62}, counter(61))
+	require.NoError(t, err)
+
+	id, err := g.Generate(notTaken)
+	require.NoError(t, err)
+	assert.Equal(t, "Z", id)
+
+	// a taken ID is skipped for the next sequence value
+	id, err = g.Generate(func(id string) (bool, error) { return id == "10", nil })
+	require.NoError(t, err)
+	assert.Equal(t, "11", id)
+}
+
+func TestHashidsGenerator(t *testing.T) {
+	g, err := NewShortIDGenerator(ShortIDOptions{Strategy: StrategyHashids, Salt: "secret"}, counter(1))
+	require.NoError(t, err)
+	other, err := NewShortIDGenerator(ShortIDOptions{Strategy: StrategyHashids, Salt: "other"}, counter(1))
+	require.NoError(t, err)
+
+	seen := make(map[string]bool)
+	for range 10000 {
+		id, err := g.Generate(notTaken)
+		require.NoError(t, err)
+		require.Len(t, id, defaultHashidsLength)
+		require.False(t, seen[id], "Expected no repeated IDs, got %s twice", id)
+		seen[id] = true
+	}
+	id, err := other.Generate(notTaken)
+	require.NoError(t, err)
+	assert.NotEqual(t, g.(hashidsGenerator).obfuscate(1), id, "Expected the salt to change the IDs")
+
+	// the IDs get longer when the values of the minimum length run out
+	small := hashidsGenerator{alphabet: "ab", length: 2}
+	ids := make(map[string]bool)
+	for n := range uint64(8) {
+		ids[small.obfuscate(n)] = true
+	}
+	assert.Len(t, ids, 8)
+	assert.Len(t, small.obfuscate(3), 2)
+	assert.Len(t, small.obfuscate(4), 3)
+}
+
+func TestWordsGenerator(t *testing.T) {
+	g, err := NewShortIDGenerator(ShortIDOptions{Strategy: StrategyWords}, nil)
+	require.NoError(t, err)
+	id, err := g.Generate(notTaken)
+	require.NoError(t, err)
+	assert.Regexp(t, `^[a-z]+-[a-z]+$`, id)
+
+	var tried []string
+	_, err = g.Generate(func(id string) (bool, error) {
+		tried = append(tried, id)
+		return true, nil
+	})
+	require.ErrorIs(t, err, ErrShortIDExhausted)
+	require.Len(t, tried, MaxShortIDAttempts)
+	assert.Regexp(t, regexp.MustCompile(`^[a-z]+-[a-z]+-[0-9]{3}$`), tried[MaxShortIDAttempts-1])
+}
+
+func TestFirstFreeSkipsReserved(t *testing.T) {
+	ids := []string{"ping", "API", "ab"}
+	id, err := firstFree(func(attempt int) (string, error) { return ids[attempt], nil }, notTaken)
+	require.NoError(t, err)
+	assert.Equal(t, "ab", id)
+}
+
+func TestSetShortIDGenerator(t *testing.T) {
+	g, err := NewShortIDGenerator(ShortIDOptions{Strategy: StrategyBase62}, counter(10))
+	require.NoError(t, err)
+	SetShortIDGenerator(g)
+	defer SetShortIDGenerator(nanoidGenerator{alphabet: nanoidAlphabet, length: defaultNanoidLength})
+
+	id, err := NewShortID(notTaken)
+	require.NoError(t, err)
+	assert.Equal(t, "a", id)
+}
+
+func TestConfigShortIDStrategies(t *testing.T) {
+	for _, strategy := range config.ShortIDStrategies {
+		_, err := NewShortIDGenerator(ShortIDOptions{Strategy: strategy}, counter(1))
+		assert.NoError(t, err, "Expected the config strategy %q to be supported", strategy)
+	}
+}
@@ -0,0 +1,52 @@
+// Package routes keeps the registry of reserved path segments: the first path segments of the service
+// routes, which share the namespace of "/{id}" with the short links. Short IDs must never take them,
+// or the links would be shadowed by the routes (or the routes by the links).
+package routes
+
+import (
+	"slices"
+	"strings"
+	"sync"
+)
+
+var (
+	mu sync.RWMutex
+	// reserved - reserved segments in lower case; the routes of the service known before the router is built.
+	reserved = map[string]struct{}{"api": {}, "debug": {}, "ping": {}}
+)
+
+// Reserve registers the first path segments of service routes. Segments are compared in lower case;
+// empty segments and route patterns ("{id}", "*") are ignored.
+func Reserve(segments ...string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for _, s := range segments {
+		if s == "" || strings.ContainsAny(s, "{*") {
+			continue
+		}
+		reserved[strings.ToLower(s)] = struct{}{}
+	}
+}
+
+// IsReserved reports whether the short ID is a reserved path segment, regardless of case.
+func IsReserved(shortID string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	_, ok := reserved[strings.ToLower(shortID)]
+	return ok
+}
+
+// Reserved returns the reserved path segments, sorted.
+func Reserved() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	segments := make([]string, 0, len(reserved))
+	for s := range reserved {
+		segments = append(segments, s)
+	}
+	slices.Sort(segments)
+	return segments
+}
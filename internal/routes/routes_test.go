@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReserve(t *testing.T) {
+	assert.True(t, IsReserved("api"))
+	assert.True(t, IsReserved("PING"), "Expected segments to be reserved regardless of case")
+	assert.False(t, IsReserved("status"))
+
+	Reserve("Status", "", "{id}", "*")
+	assert.True(t, IsReserved("status"))
+	assert.False(t, IsReserved("{id}"))
+	assert.Equal(t, []string{"api", "debug", "ping", "status"}, Reserved())
+}
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS redirect_type INTEGER NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE urls DROP COLUMN IF EXISTS redirect_type;
+-- +goose StatementEnd
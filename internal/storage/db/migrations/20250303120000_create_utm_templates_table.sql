@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS utm_templates (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    params JSONB NOT NULL DEFAULT '{}',
+    UNIQUE (user_id, name)
+);
+
+ALTER TABLE urls ADD COLUMN IF NOT EXISTS utm_template_id TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE urls DROP COLUMN IF EXISTS utm_template_id;
+DROP TABLE IF EXISTS utm_templates;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS domains (
+    name TEXT PRIMARY KEY,
+    user_ids JSONB NOT NULL DEFAULT '[]'::jsonb,
+    workspace_ids JSONB NOT NULL DEFAULT '[]'::jsonb,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+-- +goose StatementEnd
+
+
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS domains;
+-- +goose StatementEnd
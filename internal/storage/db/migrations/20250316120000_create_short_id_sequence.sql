@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE SEQUENCE IF NOT EXISTS short_id_seq;
+-- +goose StatementEnd
+
+
+
+-- +goose Down
+-- +goose StatementBegin
+DROP SEQUENCE IF EXISTS short_id_seq;
+-- +goose StatementEnd
@@ -0,0 +1,57 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Fix-up: the primary key (user_id, short_url) let links of different users share a short ID.
+-- The oldest link keeps it; the others get new random short IDs in the namespace of their domain,
+-- and the renames are recorded in the audit log.
+-- Migrations run when the storage is opened, before the short ID generator is configured, so the new
+-- short IDs are 10 random hex characters whatever the strategy. Like every stored short ID they are
+-- checked against the reserved path segments at startup (see CheckReservedShortIDs).
+-- The IDs of the audit records are UUIDs made from md5 of random values: the built-in UUID generator
+-- needs PostgreSQL 13 or the pgcrypto extension.
+DO $$
+DECLARE
+    dup RECORD;
+    new_short_url TEXT;
+BEGIN
+    FOR dup IN
+        SELECT id, user_id, short_url FROM (
+            SELECT id, user_id, short_url,
+                row_number() OVER (PARTITION BY short_url ORDER BY created_at, id) AS n
+            FROM urls
+        ) ranked
+        WHERE n > 1
+    LOOP
+        LOOP
+            new_short_url := substr(md5(random()::text || dup.id::text), 1, 10);
+            IF position('@' IN dup.short_url) > 0 THEN
+                new_short_url := new_short_url || substr(dup.short_url, position('@' IN dup.short_url));
+            END IF;
+            EXIT WHEN NOT EXISTS (SELECT 1 FROM urls WHERE short_url = new_short_url);
+        END LOOP;
+
+        UPDATE urls SET short_url = new_short_url WHERE id = dup.id AND user_id = dup.user_id AND short_url = dup.short_url;
+        INSERT INTO audit_log (id, actor, action, short_id, user_id, before, after)
+        VALUES (md5(random()::text || clock_timestamp()::text || dup.id::text)::uuid::text, 'system', 'link.rename', new_short_url, dup.user_id,
+            jsonb_build_object('short_id', dup.short_url), jsonb_build_object('short_id', new_short_url));
+    END LOOP;
+END $$;
+
+-- The short ID alone identifies the link, so it replaces (user_id, short_url) as the primary key.
+ALTER TABLE urls DROP CONSTRAINT urls_pkey;
+ALTER TABLE urls ADD CONSTRAINT urls_pkey PRIMARY KEY (short_url);
+
+-- Listing of the user's links (see buildListLinks): sorted by creation time or clicks, then by short ID.
+CREATE INDEX IF NOT EXISTS urls_user_id_created_at_idx ON urls (user_id, created_at DESC, short_url DESC);
+CREATE INDEX IF NOT EXISTS urls_user_id_clicks_idx ON urls (user_id, clicks DESC, short_url DESC);
+-- +goose StatementEnd
+
+
+
+-- +goose Down
+-- +goose StatementBegin
+-- The renamed short IDs are not restored.
+DROP INDEX IF EXISTS urls_user_id_clicks_idx;
+DROP INDEX IF EXISTS urls_user_id_created_at_idx;
+ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_pkey;
+ALTER TABLE urls ADD CONSTRAINT urls_pkey PRIMARY KEY (user_id, short_url);
+-- +goose StatementEnd
@@ -2,6 +2,8 @@ package storage
 
 import (
 	"net/http"
+	"shortener/internal/domain/models"
+	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
@@ -9,14 +11,114 @@ import (
 // StorageService describes the interface for implementing different types of URL data storage.
 type StorageService interface {
 	// UpdateData updates the data in the storage and returns the shortened URL.
-	UpdateData(req *http.Request, originalURL, userID string) (shortURL string, retErr error)
+	// The short ID is generated, or taken from opts.Alias, in the namespace of opts.Domain
+	// and returned qualified by it (see models.QualifyShortID).
+	UpdateData(req *http.Request, originalURL, userID string, opts models.LinkOptions) (shortURL string, retErr error)
 	// GetData retrieves the original URL.
 	GetData(shortID string) (originalURL string, isDeleted bool, err error)
+	// GetLinkOptions retrieves the per-link settings stored with the short URL.
+	GetLinkOptions(shortID string) (models.LinkOptions, error)
+	// GetUserLink retrieves the link created by the user.
+	GetUserLink(userID, shortID string) (models.URLData, error)
+	// ListUserLinks returns a page of the links created by the user, filtered and sorted by the query.
+	ListUserLinks(userID string, q models.LinkQuery) (models.LinkPage, error)
+	// EditLink changes the settings of the link created by the user.
+	EditLink(userID, shortID string, edit models.LinkEdit) error
+	// RegisterClick counts a redirect via the link, its destination and the visitor country
+	// unless the click limit of the link is reached.
+	// The check and the increment are atomic, so concurrent redirects never exceed the limit.
+	// A counted click is recorded as a models.EventLinkClicked event in the webhook outbox.
+	RegisterClick(shortID string, click models.Click) (allowed bool, err error)
+	// ScanLinks calls fn for every stored link until fn returns an error, which is then returned.
+	ScanLinks(fn func(shortID string, data models.URLData) error) error
+	// SetLinkDisabled disables the link for the given reason or enables it if the reason is empty.
+	SetLinkDisabled(shortID, reason string) error
+	// SaveUTMTemplate creates the user's template or replaces the parameters of the
+	// template with the same name. Returns the stored template and whether it was created.
+	SaveUTMTemplate(tpl models.UTMTemplate) (saved models.UTMTemplate, created bool, err error)
+	// GetUTMTemplate retrieves the template by its identifier.
+	GetUTMTemplate(id string) (models.UTMTemplate, error)
+	// GetUTMTemplates retrieves all templates of the user.
+	GetUTMTemplates(userID string) ([]models.UTMTemplate, error)
+	// DeleteUTMTemplate deletes the user's template with the given name.
+	DeleteUTMTemplate(userID, name string) error
+	// SaveWebhook stores a new webhook of the user.
+	SaveWebhook(hook models.Webhook) error
+	// GetWebhook retrieves the webhook by its identifier.
+	GetWebhook(id string) (models.Webhook, error)
+	// GetWebhooks retrieves all webhooks of the user, oldest first.
+	GetWebhooks(userID string) ([]models.Webhook, error)
+	// DeleteWebhook deletes the user's webhook with its deliveries.
+	DeleteWebhook(userID, id string) error
+	// EnqueueWebhookEvent records in the outbox a pending delivery of the event
+	// for every webhook of the event's user subscribed to its type.
+	EnqueueWebhookEvent(event models.WebhookEvent) error
+	// ClaimWebhookDeliveries returns up to limit pending deliveries due at now and postpones them
+	// until leaseUntil, so that other workers skip them while they are being delivered.
+	ClaimWebhookDeliveries(now, leaseUntil time.Time, limit int) ([]models.WebhookDelivery, error)
+	// RecordWebhookAttempt appends the attempt to the delivery and sets its status and the time of the next attempt.
+	RecordWebhookAttempt(id string, attempt models.DeliveryAttempt, status string, next time.Time) error
+	// GetWebhookDeliveries retrieves up to limit latest deliveries of the user's webhook with their attempts, newest first.
+	GetWebhookDeliveries(userID, webhookID string, limit int) ([]models.WebhookDelivery, error)
+	// CreateWorkspace stores a new workspace with the user as its owner.
+	CreateWorkspace(ws models.Workspace, ownerID string) error
+	// GetUserWorkspaces retrieves the workspaces the user is a member of with the user's roles, oldest first.
+	GetUserWorkspaces(userID string) ([]models.WorkspaceMembership, error)
+	// GetWorkspaceRole retrieves the role of the user in the workspace.
+	// Returns repository.ErrNotFound if the user is not its member.
+	GetWorkspaceRole(workspaceID, userID string) (string, error)
+	// GetWorkspaceMembers retrieves the members of the workspace in the order they were added.
+	GetWorkspaceMembers(workspaceID string) ([]models.WorkspaceMember, error)
+	// SetWorkspaceMember adds the member to the workspace or changes the member's role.
+	SetWorkspaceMember(member models.WorkspaceMember) error
+	// RemoveWorkspaceMember removes the user from the workspace; the links stay in the workspace.
+	RemoveWorkspaceMember(workspaceID, userID string) error
+	// MoveLinksToWorkspace hands the links created by the user over to the workspace and returns their short IDs.
+	// Links already owned by a workspace are skipped. Returns repository.ErrForbidden
+	// unless the user is an owner or editor of the workspace.
+	MoveLinksToWorkspace(userID, workspaceID string, shortIDs []string) ([]string, error)
+	// ListWorkspaceLinks returns a page of the links of the workspace, filtered and sorted by the query.
+	ListWorkspaceLinks(workspaceID string, q models.LinkQuery) (models.LinkPage, error)
+	// GetWorkspaceStats counts the links, deletions, clicks and members of the workspace.
+	GetWorkspaceStats(workspaceID string) (models.WorkspaceStats, error)
+	// DeleteWorkspaceURLs marks the links of the workspace as deleted and returns the short IDs of the links
+	// that were not deleted before. Returns repository.ErrForbidden unless the user is an owner or editor of the workspace.
+	DeleteWorkspaceURLs(userID, workspaceID string, urlIDs []string) ([]string, error)
+	// GetLink retrieves the link of any user. Returns repository.ErrNotFound if there is no such link.
+	GetLink(shortID string) (models.URLData, error)
+	// FindLinksByURL retrieves the links of all users shortening the original URL.
+	FindLinksByURL(originalURL string) ([]models.UserLink, error)
+	// TransferLink makes the user the creator of the link.
+	TransferLink(shortID, toUserID string) error
+	// RenameLink changes the short ID of the link, keeping its settings and clicks. Returns repository.ErrNotFound
+	// if there is no link with shortID and repository.ErrShortIDTaken if another link has newShortID.
+	RenameLink(shortID, newShortID string) error
+	// PurgeUser removes the links the user created outside workspaces, the user's templates, webhooks
+	// and workspace memberships. Returns the number of removed links.
+	PurgeUser(userID string) (int, error)
+	// AppendAudit appends the record to the audit log.
+	AppendAudit(record models.AuditRecord) error
+	// ListAudit retrieves the latest audit records matching the query, newest first.
+	ListAudit(q models.AuditQuery) ([]models.AuditRecord, error)
+	// PruneAudit removes the audit records made before the time and returns their number.
+	PruneAudit(before time.Time) (int, error)
+	// SaveDomain registers the branded domain or replaces the assignments of the domain with the same name.
+	// Returns the stored domain and whether it was registered.
+	SaveDomain(d models.Domain) (saved models.Domain, created bool, err error)
+	// GetDomain retrieves the branded domain by its name. Returns repository.ErrNotFound if it is not registered.
+	GetDomain(name string) (models.Domain, error)
+	// ListDomains retrieves all branded domains sorted by name.
+	ListDomains() ([]models.Domain, error)
+	// DeleteDomain removes the branded domain from the registry; its links are kept.
+	DeleteDomain(name string) error
+	// NextSequence returns the next value of the counter of the sequence short ID strategies (see repository.Sequence).
+	NextSequence() (uint64, error)
 	// Ping checks the connection to the database, if one is used.
 	Ping() error
 	// Close closes db connection.
 	Close() error
-	// BatchDeleteURLs marks URLs as deleted in the database for a given user,
-	// if a database is used.
-	BatchDeleteURLs(userID string, urlIDs []string) error
+	// BatchDeleteURLs marks URLs as deleted for a given user: the links the user created
+	// and the links of the workspaces where the user is an owner or editor (see models.URLData.CanDelete).
+	// Returns the short IDs of the links that were deleted by the call.
+	BatchDeleteURLs(userID string, urlIDs []string) ([]string, error)
 }
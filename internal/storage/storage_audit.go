@@ -0,0 +1,106 @@
+package storage
+
+import (
+	"shortener/internal/domain/models"
+	"shortener/internal/repository"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+)
+
+// auditLog keeps the audit records in memory for the memory and file storages.
+type auditLog struct {
+	records []models.AuditRecord
+	mu      sync.Mutex
+}
+
+// newAuditLog creates an empty audit log.
+func newAuditLog() *auditLog {
+	return &auditLog{}
+}
+
+// append adds the record to the end of the log.
+func (a *auditLog) append(record models.AuditRecord) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.records = append(a.records, record)
+}
+
+// list returns the latest records matching the query, newest first.
+func (a *auditLog) list(q models.AuditQuery) []models.AuditRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	records := []models.AuditRecord{}
+	for i := len(a.records) - 1; i >= 0 && (q.Limit <= 0 || len(records) < q.Limit); i-- {
+		if q.Matches(a.records[i]) {
+			records = append(records, a.records[i])
+		}
+	}
+	return records
+}
+
+// prune removes the records made before the time and returns their number.
+func (a *auditLog) prune(before time.Time) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	kept := a.records[:0]
+	for _, r := range a.records {
+		if !r.At.Before(before) {
+			kept = append(kept, r)
+		}
+	}
+	pruned := len(a.records) - len(kept)
+	clear(a.records[len(kept):])
+	a.records = kept
+	return pruned
+}
+
+// snapshot returns all records, oldest first.
+func (a *auditLog) snapshot() []models.AuditRecord {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	return slices.Clone(a.records)
+}
+
+// findLinksByURL returns the links shortening the original URL, sorted by short ID.
+func findLinksByURL(urlStorage map[string]models.URLData, originalURL string) []models.UserLink {
+	links := []models.UserLink{}
+	for shortID, data := range urlStorage {
+		if data.OriginalURL == originalURL {
+			links = append(links, models.UserLink{ShortID: shortID, URLData: data})
+		}
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].ShortID < links[j].ShortID })
+	return links
+}
+
+// renameLink moves the link from shortID to newShortID and returns the moved link.
+func renameLink(urlStorage map[string]models.URLData, shortID, newShortID string) (models.URLData, error) {
+	data, exists := urlStorage[shortID]
+	if !exists {
+		return models.URLData{}, repository.ErrNotFound
+	}
+	if _, taken := urlStorage[newShortID]; taken {
+		return models.URLData{}, repository.ErrShortIDTaken
+	}
+	delete(urlStorage, shortID)
+	urlStorage[newShortID] = data
+	return data, nil
+}
+
+// purgeLinks removes the links the user created outside workspaces and returns their short IDs.
+func purgeLinks(urlStorage map[string]models.URLData, userID string) []string {
+	purged := []string{}
+	for shortID, data := range urlStorage {
+		if data.UserID == userID && data.WorkspaceID == "" {
+			delete(urlStorage, shortID)
+			purged = append(purged, shortID)
+		}
+	}
+	return purged
+}
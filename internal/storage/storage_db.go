@@ -3,9 +3,15 @@ package storage
 import (
 	"database/sql"
 	"embed"
+	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"shortener/internal/domain/models"
 	"shortener/internal/repository"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pressly/goose/v3"
 )
@@ -45,15 +51,44 @@ func NewStorageDB(connetion string) *StorageDB {
 }
 
 // UpdateData updates data in the storage and returns the shortened URL.
-func (s *StorageDB) UpdateData(req *http.Request, originalURL, userID string) (shortURL string, retErr error) {
+func (s *StorageDB) UpdateData(req *http.Request, originalURL, userID string, opts models.LinkOptions) (shortURL string, retErr error) {
 	var repo = &repository.Repo{}
-	shortURL, retErr = repo.GetShortURLDB(userID, originalURL, s.DBConn)
+	shortURL, retErr = repo.GetShortURLDB(userID, originalURL, opts, s.DBConn)
 	return shortURL, retErr
 }
 
-const updateSetIsDeleted = `UPDATE urls SET is_deleted = TRUE WHERE user_id = $1 AND short_url = ANY($2::text[])`
+// editorOf - condition on workspace_members: the user $1 may add and delete links of the workspace.
+const editorOf = "user_id = $1 AND role IN ('" + models.RoleOwner + "', '" + models.RoleEditor + "')"
+const updateSetIsDeleted = `
+UPDATE urls SET is_deleted = TRUE WHERE short_url = ANY($2::text[]) AND NOT is_deleted AND (
+	(workspace_id = '' AND user_id = $1) OR
+	workspace_id IN (SELECT workspace_id FROM workspace_members WHERE ` + editorOf + `))
+RETURNING short_url`
 const selectFullURLAndIsDeleted = "SELECT original_url, is_deleted FROM urls WHERE short_url=$1"
 
+// linkOptionsColumns - columns of the per-link settings, read by scanLinkOptions.
+const linkOptionsColumns = `redirect_type, passthrough, utm_template_id, password_hash, max_clicks, clicks,
+	destinations, rules, country_clicks, disabled_reason, title, interstitial, created_at, notes, tags`
+const selectLinkOptions = "SELECT " + linkOptionsColumns + " FROM urls WHERE short_url=$1"
+const selectUserLink = "SELECT original_url, is_deleted, " + linkOptionsColumns + " FROM urls WHERE user_id=$1 AND short_url=$2"
+const selectAllLinks = "SELECT short_url, user_id, original_url, is_deleted, " + linkOptionsColumns + " FROM urls ORDER BY short_url"
+const updateDisabledReason = "UPDATE urls SET disabled_reason = $2 WHERE short_url = $1"
+const selectEditableForUpdate = "SELECT destinations, rules, title, notes, tags FROM urls WHERE user_id=$1 AND short_url=$2 FOR UPDATE"
+const updateEditable = `
+UPDATE urls SET destinations = $3, rules = $4, title = $5, notes = $6, tags = $7
+WHERE user_id=$1 AND short_url=$2`
+const updateRegisterClick = `
+UPDATE urls SET clicks = clicks + 1,
+	destinations = CASE WHEN $2::int >= 0 AND $2::int < jsonb_array_length(destinations)
+		THEN jsonb_set(destinations, ARRAY[$2::int::text, 'clicks'],
+			to_jsonb(COALESCE((destinations->($2::int)->>'clicks')::int, 0) + 1))
+		ELSE destinations END,
+	country_clicks = CASE WHEN $3::text <> ''
+		THEN jsonb_set(country_clicks, ARRAY[$3::text], to_jsonb(COALESCE((country_clicks->>($3::text))::int, 0) + 1))
+		ELSE country_clicks END
+WHERE short_url = $1 AND (max_clicks = 0 OR clicks < max_clicks)
+RETURNING user_id, original_url`
+
 // GetData retrieves the original URL and deletion status from the storage.
 func (s *StorageDB) GetData(shortID string) (originalURL string, isDeleted bool, err error) {
 	err = s.DBConn.QueryRow(selectFullURLAndIsDeleted, shortID).Scan(&originalURL, &isDeleted)
@@ -66,16 +101,1019 @@ func (s *StorageDB) GetData(shortID string) (originalURL string, isDeleted bool,
 	return originalURL, isDeleted, nil
 }
 
+// GetLinkOptions retrieves the per-link settings stored with the short URL.
+func (s *StorageDB) GetLinkOptions(shortID string) (models.LinkOptions, error) {
+	var opts models.LinkOptions
+	if err := scanLinkOptions(s.DBConn.QueryRow(selectLinkOptions, shortID), &opts); err != nil {
+		return models.LinkOptions{}, err
+	}
+	return opts, nil
+}
+
+// GetUserLink retrieves the link created by the user.
+func (s *StorageDB) GetUserLink(userID, shortID string) (models.URLData, error) {
+	data := models.URLData{UserID: userID}
+	err := scanLinkOptions(s.DBConn.QueryRow(selectUserLink, userID, shortID), &data.LinkOptions, &data.OriginalURL, &data.IsDeleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.URLData{}, repository.ErrNotFound
+	}
+	if err != nil {
+		return models.URLData{}, err
+	}
+	return data, nil
+}
+
+// ListUserLinks returns a page of the links created by the user, filtered and sorted by the query.
+func (s *StorageDB) ListUserLinks(userID string, q models.LinkQuery) (models.LinkPage, error) {
+	return s.listLinks("user_id", userID, q)
+}
+
+// ListWorkspaceLinks returns a page of the links of the workspace, filtered and sorted by the query.
+func (s *StorageDB) ListWorkspaceLinks(workspaceID string, q models.LinkQuery) (models.LinkPage, error) {
+	return s.listLinks("workspace_id", workspaceID, q)
+}
+
+// listLinks returns a page of the links with the owner in the owner column.
+// One more link than the limit is read to find out whether there is a next page.
+func (s *StorageDB) listLinks(ownerColumn, owner string, q models.LinkQuery) (models.LinkPage, error) {
+	query, args := buildListLinks(ownerColumn, owner, q)
+	rows, err := s.DBConn.Query(query, args...)
+	if err != nil {
+		return models.LinkPage{}, err
+	}
+	defer rows.Close() //nolint:errcheck // rows.Err is checked
+
+	var page models.LinkPage
+	for rows.Next() {
+		var link models.UserLink
+		if err := scanLinkOptions(rows, &link.LinkOptions, &link.ShortID, &link.UserID, &link.WorkspaceID,
+			&link.OriginalURL, &link.IsDeleted); err != nil {
+			return models.LinkPage{}, err
+		}
+		page.Links = append(page.Links, link)
+	}
+	if err := rows.Err(); err != nil {
+		return models.LinkPage{}, err
+	}
+
+	if q.Limit > 0 && len(page.Links) > q.Limit {
+		page.Links = page.Links[:q.Limit]
+		next := q.CursorOf(page.Links[len(page.Links)-1])
+		page.Next = &next
+	}
+	return page, nil
+}
+
+// buildListLinks builds the query of listLinks and its arguments.
+func buildListLinks(ownerColumn, owner string, q models.LinkQuery) (string, []any) {
+	args := []any{owner}
+	arg := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	var b strings.Builder
+	b.WriteString("SELECT short_url, user_id, workspace_id, original_url, is_deleted, " + linkOptionsColumns +
+		" FROM urls WHERE " + ownerColumn + " = $1")
+	if q.Deleted != nil {
+		b.WriteString(" AND is_deleted = " + arg(*q.Deleted))
+	}
+	if q.Expired != nil {
+		b.WriteString(" AND (max_clicks > 0 AND clicks >= max_clicks) = " + arg(*q.Expired))
+	}
+	if q.Tag != "" {
+		b.WriteString(" AND tags ? " + arg(q.Tag))
+	}
+	if q.Search != "" {
+		p := arg(q.Search)
+		b.WriteString(" AND (strpos(lower(original_url), lower(" + p + ")) > 0 OR strpos(lower(title), lower(" + p + ")) > 0)")
+	}
+
+	key, direction, cmp := "created_at", "DESC", "<"
+	if q.Sort == models.SortClicks {
+		key = "clicks"
+	}
+	if q.Ascending {
+		direction, cmp = "ASC", ">"
+	}
+	if q.Cursor != nil {
+		var value any = q.Cursor.CreatedAt
+		if q.Sort == models.SortClicks {
+			value = q.Cursor.Clicks
+		}
+		b.WriteString(" AND (" + key + ", short_url) " + cmp + " (" + arg(value) + ", " + arg(q.Cursor.ShortID) + ")")
+	}
+	b.WriteString(" ORDER BY " + key + " " + direction + ", short_url " + direction)
+	if q.Limit > 0 {
+		b.WriteString(" LIMIT " + arg(q.Limit+1))
+	}
+	return b.String(), args
+}
+
+// ScanLinks calls fn for every stored link until fn returns an error.
+func (s *StorageDB) ScanLinks(fn func(shortID string, data models.URLData) error) error {
+	rows, err := s.DBConn.Query(selectAllLinks)
+	if err != nil {
+		return err
+	}
+	defer rows.Close() //nolint:errcheck // rows.Err is checked
+
+	for rows.Next() {
+		var shortID string
+		var data models.URLData
+		if err := scanLinkOptions(rows, &data.LinkOptions, &shortID, &data.UserID, &data.OriginalURL, &data.IsDeleted); err != nil {
+			return err
+		}
+		if err := fn(shortID, data); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// SetLinkDisabled disables the link for the given reason or enables it if the reason is empty.
+func (s *StorageDB) SetLinkDisabled(shortID, reason string) error {
+	result, err := s.DBConn.Exec(updateDisabledReason, shortID, reason)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// scanLinkOptions scans the row ending with linkOptionsColumns; dest receives the preceding columns.
+func scanLinkOptions(row rowScanner, opts *models.LinkOptions, dest ...any) error {
+	var destinations, rules, countryClicks, tags []byte
+	dest = append(dest, &opts.RedirectType, &opts.Passthrough, &opts.UTMTemplateID, &opts.PasswordHash,
+		&opts.MaxClicks, &opts.Clicks, &destinations, &rules, &countryClicks, &opts.DisabledReason,
+		&opts.Title, &opts.Interstitial, &opts.CreatedAt, &opts.Notes, &tags)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	if err := unmarshalJSONColumns(opts, destinations, rules, countryClicks); err != nil {
+		return err
+	}
+	var err error
+	opts.Tags, err = unmarshalList[string](tags)
+	return err
+}
+
+// EditLink changes the settings of the link created by the user.
+// The link row is locked while the edit is applied, so concurrent clicks are not lost.
+func (s *StorageDB) EditLink(userID, shortID string, edit models.LinkEdit) (retErr error) {
+	tx, err := s.DBConn.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if retErr != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var opts models.LinkOptions
+	var destinations, rules, tags []byte
+	err = tx.QueryRow(selectEditableForUpdate, userID, shortID).Scan(&destinations, &rules, &opts.Title, &opts.Notes, &tags)
+	if errors.Is(err, sql.ErrNoRows) {
+		return repository.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = unmarshalJSONColumns(&opts, destinations, rules, nil); err != nil {
+		return err
+	}
+	if opts.Tags, err = unmarshalList[string](tags); err != nil {
+		return err
+	}
+	opts.Apply(edit)
+
+	encodedDestinations, err := repository.MarshalDestinations(opts.Destinations)
+	if err != nil {
+		return err
+	}
+	encodedRules, err := repository.MarshalRules(opts.Rules)
+	if err != nil {
+		return err
+	}
+	encodedTags, err := repository.MarshalTags(opts.Tags)
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec(updateEditable, userID, shortID, encodedDestinations, encodedRules, opts.Title, opts.Notes, encodedTags); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// unmarshalJSONColumns decodes the JSONB destinations, rules and country_clicks columns into the link settings.
+func unmarshalJSONColumns(opts *models.LinkOptions, destinations, rules, countryClicks []byte) (err error) {
+	if opts.Destinations, err = unmarshalList[models.Destination](destinations); err != nil {
+		return err
+	}
+	if opts.Rules, err = unmarshalList[models.TargetingRule](rules); err != nil {
+		return err
+	}
+	if len(countryClicks) > 0 {
+		if err = json.Unmarshal(countryClicks, &opts.CountryClicks); err != nil {
+			return err
+		}
+		if len(opts.CountryClicks) == 0 {
+			opts.CountryClicks = nil
+		}
+	}
+	return nil
+}
+
+// unmarshalList decodes a JSONB array column (an empty array becomes a nil list).
+func unmarshalList[T any](data []byte) ([]T, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var list []T
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, nil
+	}
+	return list, nil
+}
+
+// RegisterClick counts a redirect via the link, its destination and the visitor country unless the click limit is reached.
+// The limit is checked by the conditional UPDATE, so concurrent redirects never exceed it.
+// The click and its webhook deliveries are saved in one transaction, so a failed enqueue does not use up a click.
+func (s *StorageDB) RegisterClick(shortID string, click models.Click) (allowed bool, retErr error) {
+	tx, err := s.DBConn.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if retErr != nil || !allowed {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var data models.URLData
+	err = tx.QueryRow(updateRegisterClick, shortID, click.Variant, click.Country).Scan(&data.UserID, &data.OriginalURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := enqueueWebhookEvent(tx, clickEvent(shortID, data, click)); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+const upsertUTMTemplate = `
+INSERT INTO utm_templates (id, user_id, name, params) VALUES ($1, $2, $3, $4)
+ON CONFLICT (user_id, name) DO UPDATE SET params = EXCLUDED.params
+RETURNING id`
+const selectUTMTemplate = "SELECT id, user_id, name, params FROM utm_templates WHERE id=$1"
+const selectUTMTemplates = "SELECT id, user_id, name, params FROM utm_templates WHERE user_id=$1 ORDER BY name"
+const deleteUTMTemplate = "DELETE FROM utm_templates WHERE user_id=$1 AND name=$2"
+
+// SaveUTMTemplate creates the user's template or replaces the parameters of the template with the same name.
+func (s *StorageDB) SaveUTMTemplate(tpl models.UTMTemplate) (saved models.UTMTemplate, created bool, err error) {
+	params, err := json.Marshal(tpl.Params)
+	if err != nil {
+		return models.UTMTemplate{}, false, err
+	}
+
+	var id string
+	err = s.DBConn.QueryRow(upsertUTMTemplate, tpl.ID, tpl.UserID, tpl.Name, string(params)).Scan(&id)
+	if err != nil {
+		return models.UTMTemplate{}, false, err
+	}
+
+	created = id == tpl.ID
+	tpl.ID = id
+	return tpl, created, nil
+}
+
+// GetUTMTemplate retrieves the template by its identifier.
+func (s *StorageDB) GetUTMTemplate(id string) (models.UTMTemplate, error) {
+	tpl, err := scanUTMTemplate(s.DBConn.QueryRow(selectUTMTemplate, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.UTMTemplate{}, repository.ErrNotFound
+	}
+	return tpl, err
+}
+
+// GetUTMTemplates retrieves all templates of the user.
+func (s *StorageDB) GetUTMTemplates(userID string) ([]models.UTMTemplate, error) {
+	rows, err := s.DBConn.Query(selectUTMTemplates, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.Printf("rows.Close() error %s\n", err.Error())
+		}
+	}()
+
+	templates := []models.UTMTemplate{}
+	for rows.Next() {
+		tpl, err := scanUTMTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, tpl)
+	}
+	return templates, rows.Err()
+}
+
+// DeleteUTMTemplate deletes the user's template with the given name.
+func (s *StorageDB) DeleteUTMTemplate(userID, name string) error {
+	result, err := s.DBConn.Exec(deleteUTMTemplate, userID, name)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+const insertWebhook = "INSERT INTO webhooks (id, user_id, url, secret, events, created_at) VALUES ($1, $2, $3, $4, $5, $6)"
+const webhookColumns = "id, user_id, url, secret, events, created_at"
+const selectWebhook = "SELECT " + webhookColumns + " FROM webhooks WHERE id=$1"
+const selectWebhooks = "SELECT " + webhookColumns + " FROM webhooks WHERE user_id=$1 ORDER BY created_at, id"
+const deleteWebhook = "DELETE FROM webhooks WHERE user_id=$1 AND id=$2"
+const insertWebhookDeliveries = `
+INSERT INTO webhook_deliveries (webhook_id, user_id, event, next_attempt_at, created_at)
+SELECT id, user_id, $2, $3, $3 FROM webhooks
+WHERE user_id = $1 AND (events = '[]'::jsonb OR events ? $4)`
+const deliveryColumns = "id, webhook_id, user_id, event, status, attempts, next_attempt_at, created_at"
+const claimWebhookDeliveries = `
+UPDATE webhook_deliveries SET next_attempt_at = $2
+WHERE id IN (
+	SELECT id FROM webhook_deliveries
+	WHERE status = 'pending' AND next_attempt_at <= $1
+	ORDER BY next_attempt_at LIMIT $3
+	FOR UPDATE SKIP LOCKED)
+RETURNING ` + deliveryColumns
+const updateWebhookAttempt = "UPDATE webhook_deliveries SET attempts = attempts || $2::jsonb, status = $3, next_attempt_at = $4 WHERE id = $1"
+const selectWebhookDeliveries = "SELECT " + deliveryColumns + `
+FROM webhook_deliveries WHERE user_id = $1 AND webhook_id = $2 ORDER BY created_at DESC, id DESC LIMIT $3`
+
+// SaveWebhook stores a new webhook of the user.
+func (s *StorageDB) SaveWebhook(hook models.Webhook) error {
+	if hook.Events == nil {
+		hook.Events = []string{}
+	}
+	events, err := json.Marshal(hook.Events)
+	if err != nil {
+		return err
+	}
+	_, err = s.DBConn.Exec(insertWebhook, hook.ID, hook.UserID, hook.URL, hook.Secret, string(events), hook.CreatedAt)
+	return err
+}
+
+// GetWebhook retrieves the webhook by its identifier.
+func (s *StorageDB) GetWebhook(id string) (models.Webhook, error) {
+	hook, err := scanWebhook(s.DBConn.QueryRow(selectWebhook, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Webhook{}, repository.ErrNotFound
+	}
+	return hook, err
+}
+
+// GetWebhooks retrieves all webhooks of the user, oldest first.
+func (s *StorageDB) GetWebhooks(userID string) ([]models.Webhook, error) {
+	rows, err := s.DBConn.Query(selectWebhooks, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck // rows.Err is checked
+
+	hooks := []models.Webhook{}
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		hooks = append(hooks, hook)
+	}
+	return hooks, rows.Err()
+}
+
+// DeleteWebhook deletes the user's webhook; its deliveries are deleted by the foreign key.
+func (s *StorageDB) DeleteWebhook(userID, id string) error {
+	result, err := s.DBConn.Exec(deleteWebhook, userID, id)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// EnqueueWebhookEvent records a pending delivery of the event for every subscribed webhook of its user
+// with a single statement.
+func (s *StorageDB) EnqueueWebhookEvent(event models.WebhookEvent) error {
+	return enqueueWebhookEvent(s.DBConn, event)
+}
+
+// execer runs statements on the database or in a transaction.
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// enqueueWebhookEvent inserts the pending deliveries of the event with db.
+func enqueueWebhookEvent(db execer, event models.WebhookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(insertWebhookDeliveries, event.UserID, string(payload), event.OccurredAt, event.Type)
+	return err
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries due at now and postpones them until leaseUntil.
+// Deliveries locked by another worker are skipped.
+func (s *StorageDB) ClaimWebhookDeliveries(now, leaseUntil time.Time, limit int) ([]models.WebhookDelivery, error) {
+	return s.queryDeliveries(claimWebhookDeliveries, now, leaseUntil, limit)
+}
+
+// RecordWebhookAttempt appends the attempt to the delivery and sets its status and the time of the next attempt.
+func (s *StorageDB) RecordWebhookAttempt(id string, attempt models.DeliveryAttempt, status string, next time.Time) error {
+	attempts, err := json.Marshal([]models.DeliveryAttempt{attempt})
+	if err != nil {
+		return err
+	}
+	result, err := s.DBConn.Exec(updateWebhookAttempt, id, string(attempts), status, next)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// GetWebhookDeliveries retrieves up to limit latest deliveries of the user's webhook, newest first.
+func (s *StorageDB) GetWebhookDeliveries(userID, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	hook, err := s.GetWebhook(webhookID)
+	if err != nil {
+		return nil, err
+	}
+	if hook.UserID != userID {
+		return nil, repository.ErrNotFound
+	}
+	return s.queryDeliveries(selectWebhookDeliveries, userID, webhookID, limit)
+}
+
+// queryDeliveries runs the query returning deliveryColumns and scans the deliveries.
+func (s *StorageDB) queryDeliveries(query string, args ...any) ([]models.WebhookDelivery, error) {
+	rows, err := s.DBConn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck // rows.Err is checked
+
+	deliveries := []models.WebhookDelivery{}
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var event, attempts []byte
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.UserID, &event, &d.Status, &attempts, &d.NextAttemptAt, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(event, &d.Event); err != nil {
+			return nil, err
+		}
+		d.Event.UserID = d.UserID
+		if d.Attempts, err = unmarshalList[models.DeliveryAttempt](attempts); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// scanWebhook reads a row of webhookColumns.
+func scanWebhook(row rowScanner) (models.Webhook, error) {
+	var hook models.Webhook
+	var events []byte
+	if err := row.Scan(&hook.ID, &hook.UserID, &hook.URL, &hook.Secret, &events, &hook.CreatedAt); err != nil {
+		return models.Webhook{}, err
+	}
+	var err error
+	hook.Events, err = unmarshalList[string](events)
+	return hook, err
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanUTMTemplate reads a template selected as id, user_id, name, params.
+func scanUTMTemplate(row rowScanner) (models.UTMTemplate, error) {
+	var tpl models.UTMTemplate
+	var params []byte
+	if err := row.Scan(&tpl.ID, &tpl.UserID, &tpl.Name, &params); err != nil {
+		return models.UTMTemplate{}, err
+	}
+	if err := json.Unmarshal(params, &tpl.Params); err != nil {
+		return models.UTMTemplate{}, err
+	}
+	return tpl, nil
+}
+
+const insertWorkspace = `
+WITH ws AS (INSERT INTO workspaces (id, name, created_at) VALUES ($1, $2, $3) RETURNING id)
+INSERT INTO workspace_members (workspace_id, user_id, role, added_at) SELECT id, $4, $5, $3 FROM ws`
+const selectUserWorkspaces = `
+SELECT w.id, w.name, w.created_at, m.role FROM workspaces w JOIN workspace_members m ON m.workspace_id = w.id
+WHERE m.user_id = $1 ORDER BY w.created_at, w.id`
+const selectWorkspaceRole = "SELECT role FROM workspace_members WHERE workspace_id=$1 AND user_id=$2"
+const selectWorkspaceMembers = `
+SELECT workspace_id, user_id, role, added_at FROM workspace_members WHERE workspace_id=$1 ORDER BY added_at, user_id`
+const upsertWorkspaceMember = `
+INSERT INTO workspace_members (workspace_id, user_id, role, added_at) VALUES ($1, $2, $3, $4)
+ON CONFLICT (workspace_id, user_id) DO UPDATE SET role = EXCLUDED.role`
+const deleteWorkspaceMember = "DELETE FROM workspace_members WHERE workspace_id=$1 AND user_id=$2"
+const updateMoveToWorkspace = `
+UPDATE urls SET workspace_id = $2 WHERE user_id = $1 AND workspace_id = '' AND short_url = ANY($3::text[])
+AND EXISTS (SELECT 1 FROM workspace_members WHERE workspace_id = $2 AND ` + editorOf + `)
+RETURNING short_url`
+const updateDeleteWorkspaceURLs = `
+UPDATE urls SET is_deleted = TRUE WHERE workspace_id = $2 AND short_url = ANY($3::text[]) AND NOT is_deleted
+AND EXISTS (SELECT 1 FROM workspace_members WHERE workspace_id = $2 AND ` + editorOf + `)
+RETURNING short_url`
+const selectWorkspaceStats = `
+SELECT count(*), count(*) FILTER (WHERE is_deleted), COALESCE(sum(clicks), 0),
+	(SELECT count(*) FROM workspace_members WHERE workspace_id = $1)
+FROM urls WHERE workspace_id = $1`
+
+// CreateWorkspace stores a new workspace with the user as its owner.
+func (s *StorageDB) CreateWorkspace(ws models.Workspace, ownerID string) error {
+	_, err := s.DBConn.Exec(insertWorkspace, ws.ID, ws.Name, ws.CreatedAt, ownerID, models.RoleOwner)
+	return err
+}
+
+// GetUserWorkspaces retrieves the workspaces the user is a member of with the user's roles, oldest first.
+func (s *StorageDB) GetUserWorkspaces(userID string) ([]models.WorkspaceMembership, error) {
+	rows, err := s.DBConn.Query(selectUserWorkspaces, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck // rows.Err is checked
+
+	memberships := []models.WorkspaceMembership{}
+	for rows.Next() {
+		var m models.WorkspaceMembership
+		if err := rows.Scan(&m.ID, &m.Name, &m.CreatedAt, &m.Role); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, m)
+	}
+	return memberships, rows.Err()
+}
+
+// GetWorkspaceRole retrieves the role of the user in the workspace.
+func (s *StorageDB) GetWorkspaceRole(workspaceID, userID string) (string, error) {
+	var role string
+	err := s.DBConn.QueryRow(selectWorkspaceRole, workspaceID, userID).Scan(&role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", repository.ErrNotFound
+	}
+	return role, err
+}
+
+// GetWorkspaceMembers retrieves the members of the workspace in the order they were added.
+// A workspace always has an owner, so no members means there is no such workspace.
+func (s *StorageDB) GetWorkspaceMembers(workspaceID string) ([]models.WorkspaceMember, error) {
+	rows, err := s.DBConn.Query(selectWorkspaceMembers, workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck // rows.Err is checked
+
+	members := []models.WorkspaceMember{}
+	for rows.Next() {
+		var m models.WorkspaceMember
+		if err := rows.Scan(&m.WorkspaceID, &m.UserID, &m.Role, &m.AddedAt); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		return nil, repository.ErrNotFound
+	}
+	return members, nil
+}
+
+// SetWorkspaceMember adds the member to the workspace or changes the member's role.
+func (s *StorageDB) SetWorkspaceMember(member models.WorkspaceMember) error {
+	_, err := s.DBConn.Exec(upsertWorkspaceMember, member.WorkspaceID, member.UserID, member.Role, member.AddedAt)
+	return err
+}
+
+// RemoveWorkspaceMember removes the user from the workspace.
+func (s *StorageDB) RemoveWorkspaceMember(workspaceID, userID string) error {
+	result, err := s.DBConn.Exec(deleteWorkspaceMember, workspaceID, userID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// MoveLinksToWorkspace hands the links created by the user over to the workspace and returns their short IDs.
+// The role is checked again by the UPDATE, so a member demoted meanwhile moves nothing.
+func (s *StorageDB) MoveLinksToWorkspace(userID, workspaceID string, shortIDs []string) ([]string, error) {
+	if err := s.checkEditor(userID, workspaceID); err != nil {
+		return nil, err
+	}
+	return s.queryShortIDs(updateMoveToWorkspace, userID, workspaceID, shortIDs)
+}
+
+// queryShortIDs runs the query returning short_url and collects the short IDs.
+func (s *StorageDB) queryShortIDs(query string, args ...any) ([]string, error) {
+	rows, err := s.DBConn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck // rows.Err is checked
+
+	shortIDs := []string{}
+	for rows.Next() {
+		var shortID string
+		if err := rows.Scan(&shortID); err != nil {
+			return nil, err
+		}
+		shortIDs = append(shortIDs, shortID)
+	}
+	return shortIDs, rows.Err()
+}
+
+// GetWorkspaceStats counts the links, deletions, clicks and members of the workspace.
+func (s *StorageDB) GetWorkspaceStats(workspaceID string) (models.WorkspaceStats, error) {
+	var stats models.WorkspaceStats
+	err := s.DBConn.QueryRow(selectWorkspaceStats, workspaceID).Scan(&stats.Links, &stats.Deleted, &stats.Clicks, &stats.Members)
+	if err != nil {
+		return models.WorkspaceStats{}, err
+	}
+	if stats.Members == 0 {
+		return models.WorkspaceStats{}, repository.ErrNotFound
+	}
+	return stats, nil
+}
+
+// DeleteWorkspaceURLs marks the links of the workspace as deleted and returns their short IDs.
+func (s *StorageDB) DeleteWorkspaceURLs(userID, workspaceID string, urlIDs []string) ([]string, error) {
+	if err := s.checkEditor(userID, workspaceID); err != nil {
+		return nil, err
+	}
+	return s.queryShortIDs(updateDeleteWorkspaceURLs, userID, workspaceID, urlIDs)
+}
+
+// checkEditor returns repository.ErrForbidden unless the user is an owner or editor of the workspace.
+func (s *StorageDB) checkEditor(userID, workspaceID string) error {
+	role, err := s.GetWorkspaceRole(workspaceID, userID)
+	if errors.Is(err, repository.ErrNotFound) || (err == nil && !models.CanEditLinks(role)) {
+		return repository.ErrForbidden
+	}
+	return err
+}
+
+const selectLink = "SELECT user_id, workspace_id, original_url, is_deleted, " + linkOptionsColumns + " FROM urls WHERE short_url=$1"
+const selectLinksByURL = "SELECT short_url, user_id, workspace_id, original_url, is_deleted, " + linkOptionsColumns +
+	" FROM urls WHERE original_url=$1 ORDER BY short_url"
+const updateTransferLink = "UPDATE urls SET user_id = $2 WHERE short_url = $1"
+const updateRenameLink = `
+UPDATE urls SET short_url = $2
+WHERE short_url = $1 AND NOT EXISTS (SELECT 1 FROM urls WHERE short_url = $2)`
+const selectShortIDExists = "SELECT EXISTS (SELECT 1 FROM urls WHERE short_url = $1)"
+const deleteUserURLs = "DELETE FROM urls WHERE user_id = $1 AND workspace_id = ''"
+const deleteUserTemplates = "DELETE FROM utm_templates WHERE user_id = $1"
+const deleteUserWebhooks = "DELETE FROM webhooks WHERE user_id = $1"
+const deleteUserMemberships = "DELETE FROM workspace_members WHERE user_id = $1"
+const insertAuditRecord = `
+INSERT INTO audit_log (id, at, actor, ip, user_agent, action, short_id, user_id, before, after)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+const selectAuditRecords = `
+SELECT id, at, actor, ip, user_agent, action, short_id, user_id, before, after FROM audit_log
+WHERE ($1 = '' OR short_id = $1) AND ($2 = '' OR user_id = $2) AND ($3 = '' OR actor = $3)
+AND ($4::timestamptz IS NULL OR at >= $4) AND ($5::timestamptz IS NULL OR at < $5)
+ORDER BY at DESC, id DESC`
+const deleteAuditRecords = "DELETE FROM audit_log WHERE at < $1"
+
+// GetLink retrieves the link of any user.
+func (s *StorageDB) GetLink(shortID string) (models.URLData, error) {
+	var data models.URLData
+	err := scanLinkOptions(s.DBConn.QueryRow(selectLink, shortID), &data.LinkOptions,
+		&data.UserID, &data.WorkspaceID, &data.OriginalURL, &data.IsDeleted)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.URLData{}, repository.ErrNotFound
+	}
+	if err != nil {
+		return models.URLData{}, err
+	}
+	return data, nil
+}
+
+// FindLinksByURL retrieves the links of all users shortening the original URL.
+func (s *StorageDB) FindLinksByURL(originalURL string) ([]models.UserLink, error) {
+	rows, err := s.DBConn.Query(selectLinksByURL, originalURL)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck // rows.Err is checked
+
+	links := []models.UserLink{}
+	for rows.Next() {
+		var link models.UserLink
+		if err := scanLinkOptions(rows, &link.LinkOptions, &link.ShortID, &link.UserID, &link.WorkspaceID,
+			&link.OriginalURL, &link.IsDeleted); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// TransferLink makes the user the creator of the link.
+func (s *StorageDB) TransferLink(shortID, toUserID string) error {
+	result, err := s.DBConn.Exec(updateTransferLink, shortID, toUserID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// RenameLink changes the short ID of the link. The audit records and webhook deliveries
+// of the link keep the old short ID.
+func (s *StorageDB) RenameLink(shortID, newShortID string) error {
+	result, err := s.DBConn.Exec(updateRenameLink, shortID, newShortID)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	var exists bool
+	if err := s.DBConn.QueryRow(selectShortIDExists, shortID).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return repository.ErrShortIDTaken
+	}
+	return repository.ErrNotFound
+}
+
+// PurgeUser removes the links the user created outside workspaces, the user's templates, webhooks
+// with their deliveries and workspace memberships in one transaction.
+func (s *StorageDB) PurgeUser(userID string) (purged int, retErr error) {
+	tx, err := s.DBConn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if retErr != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	result, err := tx.Exec(deleteUserURLs, userID)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	for _, query := range []string{deleteUserTemplates, deleteUserWebhooks, deleteUserMemberships} {
+		if _, err = tx.Exec(query, userID); err != nil {
+			return 0, err
+		}
+	}
+	return int(affected), tx.Commit()
+}
+
+// AppendAudit appends the record to the audit log.
+func (s *StorageDB) AppendAudit(record models.AuditRecord) error {
+	_, err := s.DBConn.Exec(insertAuditRecord, record.ID, record.At, record.Actor, record.IP, record.UserAgent,
+		record.Action, record.ShortID, record.UserID, nullJSON(record.Before), nullJSON(record.After))
+	return err
+}
+
+// ListAudit retrieves the latest audit records matching the query, newest first.
+func (s *StorageDB) ListAudit(q models.AuditQuery) ([]models.AuditRecord, error) {
+	query, args := selectAuditRecords, []any{q.ShortID, q.UserID, q.Actor, nullTime(q.Since), nullTime(q.Until)}
+	if q.Limit > 0 {
+		query += " LIMIT $6"
+		args = append(args, q.Limit)
+	}
+	rows, err := s.DBConn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck // rows.Err is checked
+
+	records := []models.AuditRecord{}
+	for rows.Next() {
+		var r models.AuditRecord
+		var before, after []byte
+		if err := rows.Scan(&r.ID, &r.At, &r.Actor, &r.IP, &r.UserAgent, &r.Action, &r.ShortID, &r.UserID, &before, &after); err != nil {
+			return nil, err
+		}
+		r.Before, r.After = before, after
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+// PruneAudit removes the audit records made before the time and returns their number.
+func (s *StorageDB) PruneAudit(before time.Time) (int, error) {
+	result, err := s.DBConn.Exec(deleteAuditRecords, before)
+	if err != nil {
+		return 0, err
+	}
+	affected, err := result.RowsAffected()
+	return int(affected), err
+}
+
+const upsertDomain = `
+INSERT INTO domains (name, user_ids, workspace_ids, created_at) VALUES ($1, $2, $3, $4)
+ON CONFLICT (name) DO UPDATE SET user_ids = EXCLUDED.user_ids, workspace_ids = EXCLUDED.workspace_ids
+RETURNING created_at, xmax = 0`
+const domainColumns = "name, user_ids, workspace_ids, created_at"
+const selectDomain = "SELECT " + domainColumns + " FROM domains WHERE name = $1"
+const selectDomains = "SELECT " + domainColumns + " FROM domains ORDER BY name"
+const deleteDomain = "DELETE FROM domains WHERE name = $1"
+
+// SaveDomain registers the branded domain or replaces the assignments of the domain with the same name.
+// A replaced domain keeps its creation time; xmax is 0 only for a row inserted by the query.
+func (s *StorageDB) SaveDomain(d models.Domain) (saved models.Domain, created bool, err error) {
+	userIDs, err := marshalStrings(d.UserIDs)
+	if err != nil {
+		return models.Domain{}, false, err
+	}
+	workspaceIDs, err := marshalStrings(d.WorkspaceIDs)
+	if err != nil {
+		return models.Domain{}, false, err
+	}
+	err = s.DBConn.QueryRow(upsertDomain, d.Name, userIDs, workspaceIDs, d.CreatedAt).Scan(&d.CreatedAt, &created)
+	if err != nil {
+		return models.Domain{}, false, err
+	}
+	return d, created, nil
+}
+
+// GetDomain retrieves the branded domain by its name.
+func (s *StorageDB) GetDomain(name string) (models.Domain, error) {
+	d, err := scanDomain(s.DBConn.QueryRow(selectDomain, name))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Domain{}, repository.ErrNotFound
+	}
+	return d, err
+}
+
+// ListDomains retrieves all branded domains sorted by name.
+func (s *StorageDB) ListDomains() ([]models.Domain, error) {
+	rows, err := s.DBConn.Query(selectDomains)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close() //nolint:errcheck // rows.Err is checked
+
+	domains := []models.Domain{}
+	for rows.Next() {
+		d, err := scanDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, d)
+	}
+	return domains, rows.Err()
+}
+
+// DeleteDomain removes the branded domain from the registry.
+func (s *StorageDB) DeleteDomain(name string) error {
+	result, err := s.DBConn.Exec(deleteDomain, name)
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return repository.ErrNotFound
+	}
+	return nil
+}
+
+// marshalStrings encodes the list for a JSONB column (a nil list becomes an empty array).
+func marshalStrings(list []string) (string, error) {
+	if list == nil {
+		list = []string{}
+	}
+	data, err := json.Marshal(list)
+	return string(data), err
+}
+
+// scanDomain reads a domain selected as domainColumns.
+func scanDomain(row rowScanner) (models.Domain, error) {
+	var d models.Domain
+	var userIDs, workspaceIDs []byte
+	if err := row.Scan(&d.Name, &userIDs, &workspaceIDs, &d.CreatedAt); err != nil {
+		return models.Domain{}, err
+	}
+	var err error
+	if d.UserIDs, err = unmarshalList[string](userIDs); err != nil {
+		return models.Domain{}, err
+	}
+	d.WorkspaceIDs, err = unmarshalList[string](workspaceIDs)
+	return d, err
+}
+
+// nullTime returns nil for the zero time, so it is passed as NULL.
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
+
+// nullJSON returns nil for an empty JSON value, so it is stored as NULL.
+func nullJSON(data json.RawMessage) any {
+	if len(data) == 0 {
+		return nil
+	}
+	return []byte(data)
+}
+
+const selectNextSequence = "SELECT nextval('short_id_seq')"
+
+// NextSequence returns the next value of the short_id_seq sequence shared by all instances of the service.
+func (s *StorageDB) NextSequence() (uint64, error) {
+	var n uint64
+	if err := s.DBConn.QueryRow(selectNextSequence).Scan(&n); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
+
 // Ping checks the connection to the database.
 func (s *StorageDB) Ping() error {
 	return s.DBConn.Ping()
 }
 
-// BatchDeleteURLs marks URLs as deleted in the database for a given user.
-func (s *StorageDB) BatchDeleteURLs(userID string, urlIDs []string) error {
-	_, err := s.DBConn.Exec(updateSetIsDeleted, userID, urlIDs)
-
-	return err
+// BatchDeleteURLs marks URLs as deleted in the database for a given user: the links the user created
+// and the links of the workspaces where the user is an owner or editor.
+func (s *StorageDB) BatchDeleteURLs(userID string, urlIDs []string) ([]string, error) {
+	return s.queryShortIDs(updateSetIsDeleted, userID, urlIDs)
 }
 
 // Close closes db connection.
@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"shortener/internal/domain/models"
+	"shortener/internal/repository"
+	"sort"
+	"sync"
+)
+
+// domainRegistry keeps branded domains in memory for the memory and file storages.
+type domainRegistry struct {
+	items map[string]models.Domain
+	mu    sync.Mutex
+}
+
+// newDomainRegistry creates an empty domain registry.
+func newDomainRegistry() *domainRegistry {
+	return &domainRegistry{
+		items: make(map[string]models.Domain),
+	}
+}
+
+// save registers the domain or replaces the assignments of the domain with the same name.
+func (r *domainRegistry) save(d models.Domain) (models.Domain, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	existing, exists := r.items[d.Name]
+	if exists {
+		d.CreatedAt = existing.CreatedAt
+	}
+	r.items[d.Name] = d
+	return d, !exists
+}
+
+// get returns the domain by its name.
+func (r *domainRegistry) get(name string) (models.Domain, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, exists := r.items[name]
+	if !exists {
+		return models.Domain{}, repository.ErrNotFound
+	}
+	return d, nil
+}
+
+// list returns all domains sorted by name.
+func (r *domainRegistry) list() []models.Domain {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	domains := make([]models.Domain, 0, len(r.items))
+	for _, d := range r.items {
+		domains = append(domains, d)
+	}
+	sort.Slice(domains, func(i, j int) bool { return domains[i].Name < domains[j].Name })
+	return domains
+}
+
+// delete removes the domain.
+func (r *domainRegistry) delete(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.items[name]; !exists {
+		return repository.ErrNotFound
+	}
+	delete(r.items, name)
+	return nil
+}
+
+// restore replaces all domains with the given ones.
+func (r *domainRegistry) restore(domains []models.Domain) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.items = make(map[string]models.Domain, len(domains))
+	for _, d := range domains {
+		r.items[d.Name] = d
+	}
+}
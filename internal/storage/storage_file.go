@@ -2,26 +2,71 @@ package storage
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
 	"os"
 	"shortener/internal/config"
 	"shortener/internal/domain/models"
 	"shortener/internal/repository"
+	"slices"
 	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
 )
 
 // StorageFile - structure for storing URL data in a file.
 type StorageFile struct {
-	urlStorage map[string]string
-	Events     chan map[string]string
+	urlStorage map[string]models.URLData
+	Events     chan map[string]models.URLData
 	file       io.Writer
-	mu         sync.Mutex
+	templates  *utmTemplates
+	webhooks   *webhookOutbox
+	workspaces *workspaceSet
+	audit      *auditLog
+	domains    *domainRegistry
+	sequence   atomic.Uint64
+	// clicked: short IDs of the links with click counters that are not saved to the file yet.
+	clicked map[string]struct{}
+	// inFlight: links flush is sending to Events without holding mu.
+	inFlight map[string]models.URLData
+	// webhooksDirty: clicks enqueued deliveries that are not saved to the webhooks file yet.
+	webhooksDirty atomic.Bool
+	sugar         *zap.SugaredLogger
+	// stop is closed by Close to stop AutoSave; saved is closed when AutoSave has written the last changes.
+	stop      chan struct{}
+	saved     chan struct{}
+	closeOnce sync.Once
+	path      string
+	mu        sync.Mutex
+	flushMu   sync.Mutex
+	fileMu    sync.Mutex
 }
 
+// templatesFileSuffix - suffix of the file next to the URL storage file that keeps UTM templates.
+const templatesFileSuffix = ".templates.json"
+
+// webhooksFileSuffix - suffix of the file next to the URL storage file that keeps webhooks and their deliveries.
+const webhooksFileSuffix = ".webhooks.json"
+
+// workspacesFileSuffix - suffix of the file next to the URL storage file that keeps workspaces and their members.
+const workspacesFileSuffix = ".workspaces.json"
+
+// domainsFileSuffix - suffix of the file next to the URL storage file that keeps branded domains.
+const domainsFileSuffix = ".domains.json"
+
+// auditFileSuffix - suffix of the file next to the URL storage file that keeps the audit log, one record per line.
+const auditFileSuffix = ".audit.jsonl"
+
+// saveInterval - period in which AutoSave saves the changes made by redirects.
+const saveInterval = time.Second
+
 // NewStorageFile creates and returns a new instance of StorageFile.
 func NewStorageFile(c *config.Config) *StorageFile {
 	bufSize := 100
@@ -33,31 +78,45 @@ func NewStorageFile(c *config.Config) *StorageFile {
 	}
 
 	return &StorageFile{
-		urlStorage: make(map[string]string),
-		Events:     make(chan map[string]string, bufSize),
+		urlStorage: make(map[string]models.URLData),
+		Events:     make(chan map[string]models.URLData, bufSize),
+		clicked:    make(map[string]struct{}),
 		file:       file,
+		templates:  newUTMTemplates(),
+		webhooks:   newWebhookOutbox(),
+		workspaces: newWorkspaceSet(),
+		audit:      newAuditLog(),
+		domains:    newDomainRegistry(),
+		sugar:      zap.NewNop().Sugar(),
+		stop:       make(chan struct{}),
+		path:       c.URLStorageFile,
 	}
 }
 
 // UpdateData updates the data in the storage and returns the shortened URL.
-func (s *StorageFile) UpdateData(req *http.Request, originalURL, userID string) (shortURL string, retErr error) {
+func (s *StorageFile) UpdateData(req *http.Request, originalURL, userID string, opts models.LinkOptions) (shortURL string, retErr error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	shortURL = repository.GenerateShortID()
-
 	for k, v := range s.urlStorage {
-		if v == originalURL {
+		if v.OriginalURL == originalURL {
 			return k, repository.ErrDuplicateURL
 		}
 	}
+	shortURL, retErr = newLinkKey(s.urlStorage, opts)
+	if retErr != nil {
+		return "", retErr
+	}
+	opts.Alias, opts.Domain = "", ""
 
-	newMap := make(map[string]string)
-	newMap[shortURL] = originalURL
+	opts.SetCreated(time.Now())
+	data := models.URLData{OriginalURL: originalURL, UserID: userID, LinkOptions: opts}
+	newMap := make(map[string]models.URLData)
+	newMap[shortURL] = data
 
-	s.urlStorage[shortURL] = originalURL
+	s.urlStorage[shortURL] = data
 
-	s.Events <- newMap
+	s.sendLinks(newMap)
 
 	return shortURL, nil
 }
@@ -67,11 +126,521 @@ func (s *StorageFile) GetData(shortID string) (originalURL string, isDeleted boo
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	originalURL, exists := s.urlStorage[shortID]
+	data, exists := s.urlStorage[shortID]
 	if !exists {
 		return "", false, fmt.Errorf("shortID not found: %s", shortID)
 	}
-	return originalURL, false, nil
+	return data.OriginalURL, data.IsDeleted, nil
+}
+
+// GetLinkOptions retrieves the per-link settings stored with the short URL.
+func (s *StorageFile) GetLinkOptions(shortID string) (models.LinkOptions, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.urlStorage[shortID]
+	if !exists {
+		return models.LinkOptions{}, fmt.Errorf("shortID not found: %s", shortID)
+	}
+	return data.LinkOptions, nil
+}
+
+// GetUserLink retrieves the link created by the user.
+func (s *StorageFile) GetUserLink(userID, shortID string) (models.URLData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.urlStorage[shortID]
+	if !exists || data.UserID != userID {
+		return models.URLData{}, repository.ErrNotFound
+	}
+	return data, nil
+}
+
+// ListUserLinks returns a page of the links created by the user, filtered and sorted by the query.
+func (s *StorageFile) ListUserLinks(userID string, q models.LinkQuery) (models.LinkPage, error) {
+	s.mu.Lock()
+	links := make([]models.UserLink, 0)
+	for shortID, data := range s.urlStorage {
+		if data.UserID == userID {
+			links = append(links, models.UserLink{ShortID: shortID, URLData: data})
+		}
+	}
+	s.mu.Unlock()
+
+	return q.Page(links), nil
+}
+
+// EditLink changes the settings of the link created by the user.
+// The changed link is saved to the file.
+func (s *StorageFile) EditLink(userID, shortID string, edit models.LinkEdit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.urlStorage[shortID]
+	if !exists || data.UserID != userID {
+		return repository.ErrNotFound
+	}
+
+	data.Apply(edit)
+	s.urlStorage[shortID] = data
+	s.sendLinks(map[string]models.URLData{shortID: data})
+	return nil
+}
+
+// RegisterClick counts a redirect via the link, its destination and the visitor country unless the click limit is reached.
+// The updated click counters and the webhook deliveries of the click are saved by AutoSave within saveInterval,
+// so the file gets one record per clicked link in the interval instead of one per click. The clicks of links
+// with a click limit are saved at once, so a restart cannot let the limit be exceeded.
+func (s *StorageFile) RegisterClick(shortID string, click models.Click) (allowed bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.urlStorage[shortID]
+	if !exists {
+		return false, fmt.Errorf("shortID not found: %s", shortID)
+	}
+	if data.ClicksExhausted() {
+		return false, nil
+	}
+
+	data.CountClick(click)
+	s.urlStorage[shortID] = data
+	if data.MaxClicks > 0 {
+		s.sendLinks(map[string]models.URLData{shortID: data})
+	} else {
+		s.clicked[shortID] = struct{}{}
+	}
+	if s.webhooks.enqueue(clickEvent(shortID, data, click)) > 0 {
+		s.webhooksDirty.Store(true)
+	}
+	return true, nil
+}
+
+// ScanLinks calls fn for every stored link until fn returns an error.
+// The links are copied first, so fn may change the storage.
+func (s *StorageFile) ScanLinks(fn func(shortID string, data models.URLData) error) error {
+	s.mu.Lock()
+	links := maps.Clone(s.urlStorage)
+	s.mu.Unlock()
+
+	for _, shortID := range slices.Sorted(maps.Keys(links)) {
+		if err := fn(shortID, links[shortID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetLinkDisabled disables the link for the given reason or enables it if the reason is empty.
+// The change is saved to the file.
+func (s *StorageFile) SetLinkDisabled(shortID, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.urlStorage[shortID]
+	if !exists {
+		return repository.ErrNotFound
+	}
+	data.DisabledReason = reason
+	s.urlStorage[shortID] = data
+	s.sendLinks(map[string]models.URLData{shortID: data})
+	return nil
+}
+
+// SaveUTMTemplate creates the user's template or replaces the parameters of the template with the same name.
+// All templates are saved to the templates file.
+func (s *StorageFile) SaveUTMTemplate(tpl models.UTMTemplate) (saved models.UTMTemplate, created bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved, created = s.templates.save(tpl)
+	return saved, created, writeSnapshot(s.path+templatesFileSuffix, s.templates.snapshot())
+}
+
+// GetUTMTemplate retrieves the template by its identifier.
+func (s *StorageFile) GetUTMTemplate(id string) (models.UTMTemplate, error) {
+	return s.templates.get(id)
+}
+
+// GetUTMTemplates retrieves all templates of the user.
+func (s *StorageFile) GetUTMTemplates(userID string) ([]models.UTMTemplate, error) {
+	return s.templates.list(userID), nil
+}
+
+// DeleteUTMTemplate deletes the user's template with the given name.
+// The remaining templates are saved to the templates file.
+func (s *StorageFile) DeleteUTMTemplate(userID, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.templates.delete(userID, name); err != nil {
+		return err
+	}
+	return writeSnapshot(s.path+templatesFileSuffix, s.templates.snapshot())
+}
+
+// SaveWebhook stores a new webhook of the user. All webhooks and deliveries are saved to the webhooks file.
+func (s *StorageFile) SaveWebhook(hook models.Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.webhooks.saveHook(hook)
+	return s.saveWebhooks()
+}
+
+// GetWebhook retrieves the webhook by its identifier.
+func (s *StorageFile) GetWebhook(id string) (models.Webhook, error) {
+	return s.webhooks.getHook(id)
+}
+
+// GetWebhooks retrieves all webhooks of the user, oldest first.
+func (s *StorageFile) GetWebhooks(userID string) ([]models.Webhook, error) {
+	return s.webhooks.listHooks(userID), nil
+}
+
+// DeleteWebhook deletes the user's webhook with its deliveries.
+func (s *StorageFile) DeleteWebhook(userID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.webhooks.deleteHook(userID, id); err != nil {
+		return err
+	}
+	return s.saveWebhooks()
+}
+
+// EnqueueWebhookEvent records a pending delivery of the event for every subscribed webhook of its user.
+func (s *StorageFile) EnqueueWebhookEvent(event models.WebhookEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.webhooks.enqueue(event) == 0 {
+		return nil
+	}
+	return s.saveWebhooks()
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries due at now and postpones them until leaseUntil.
+// The lease is not saved: after a restart the claimed deliveries are due again.
+func (s *StorageFile) ClaimWebhookDeliveries(now, leaseUntil time.Time, limit int) ([]models.WebhookDelivery, error) {
+	return s.webhooks.claim(now, leaseUntil, limit), nil
+}
+
+// RecordWebhookAttempt appends the attempt to the delivery and sets its status and the time of the next attempt.
+func (s *StorageFile) RecordWebhookAttempt(id string, attempt models.DeliveryAttempt, status string, next time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.webhooks.record(id, attempt, status, next); err != nil {
+		return err
+	}
+	return s.saveWebhooks()
+}
+
+// GetWebhookDeliveries retrieves up to limit latest deliveries of the user's webhook, newest first.
+func (s *StorageFile) GetWebhookDeliveries(userID, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	return s.webhooks.listDeliveries(userID, webhookID, limit)
+}
+
+// saveWebhooks saves all webhooks and deliveries to the webhooks file.
+func (s *StorageFile) saveWebhooks() error {
+	dirty := s.webhooksDirty.Swap(false)
+	if err := writeSnapshot(s.path+webhooksFileSuffix, s.webhooks.snapshot()); err != nil {
+		s.webhooksDirty.Store(dirty)
+		return err
+	}
+	return nil
+}
+
+// flush saves the changes made by redirects since the last call: the clicked links are saved
+// to the file and the webhook deliveries to the webhooks file. A failure to save the webhooks
+// is logged and they are saved by the next call.
+// The clicked links are copied under mu and sent to Events after it is released; a link changed
+// meanwhile is marked clicked again by sendLinks, so its latest record is saved by the next flush.
+func (s *StorageFile) flush() {
+	s.flushMu.Lock()
+	defer s.flushMu.Unlock()
+	select {
+	case <-s.stop:
+		// AutoSave is stopped, Close has saved the changes
+		return
+	default:
+	}
+
+	s.mu.Lock()
+	changed := make(map[string]models.URLData, len(s.clicked))
+	for shortID := range s.clicked {
+		// a link removed since the click is saved as a record without an original URL
+		changed[shortID] = s.urlStorage[shortID]
+	}
+	clear(s.clicked)
+	s.inFlight = changed
+	var err error
+	if s.webhooksDirty.Load() {
+		err = s.saveWebhooks()
+	}
+	s.mu.Unlock()
+
+	if len(changed) > 0 {
+		s.Events <- changed
+	}
+
+	s.mu.Lock()
+	s.inFlight = nil
+	s.mu.Unlock()
+
+	if err != nil {
+		s.sugar.Errorf("(flush) error save webhooks: %s", err.Error())
+	}
+}
+
+// sendLinks queues the changed links for AutoSave. It must be called with mu held.
+func (s *StorageFile) sendLinks(changed map[string]models.URLData) {
+	for shortID := range changed {
+		if _, sending := s.inFlight[shortID]; sending {
+			s.clicked[shortID] = struct{}{}
+		}
+	}
+	s.Events <- changed
+}
+
+// CreateWorkspace stores a new workspace with the user as its owner.
+// All workspaces and members are saved to the workspaces file.
+func (s *StorageFile) CreateWorkspace(ws models.Workspace, ownerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.workspaces.create(ws, models.WorkspaceMember{WorkspaceID: ws.ID, UserID: ownerID, Role: models.RoleOwner, AddedAt: ws.CreatedAt})
+	return s.saveWorkspaces()
+}
+
+// GetUserWorkspaces retrieves the workspaces the user is a member of with the user's roles, oldest first.
+func (s *StorageFile) GetUserWorkspaces(userID string) ([]models.WorkspaceMembership, error) {
+	return s.workspaces.listForUser(userID), nil
+}
+
+// GetWorkspaceRole retrieves the role of the user in the workspace.
+func (s *StorageFile) GetWorkspaceRole(workspaceID, userID string) (string, error) {
+	return s.workspaces.role(workspaceID, userID)
+}
+
+// GetWorkspaceMembers retrieves the members of the workspace in the order they were added.
+func (s *StorageFile) GetWorkspaceMembers(workspaceID string) ([]models.WorkspaceMember, error) {
+	return s.workspaces.listMembers(workspaceID)
+}
+
+// SetWorkspaceMember adds the member to the workspace or changes the member's role.
+func (s *StorageFile) SetWorkspaceMember(member models.WorkspaceMember) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.workspaces.setMember(member); err != nil {
+		return err
+	}
+	return s.saveWorkspaces()
+}
+
+// RemoveWorkspaceMember removes the user from the workspace.
+func (s *StorageFile) RemoveWorkspaceMember(workspaceID, userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.workspaces.removeMember(workspaceID, userID); err != nil {
+		return err
+	}
+	return s.saveWorkspaces()
+}
+
+// MoveLinksToWorkspace hands the links created by the user over to the workspace and returns their short IDs.
+// The moved links are saved to the file.
+func (s *StorageFile) MoveLinksToWorkspace(userID, workspaceID string, shortIDs []string) ([]string, error) {
+	role, err := s.workspaces.role(workspaceID, userID)
+	if err != nil || !models.CanEditLinks(role) {
+		return nil, repository.ErrForbidden
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	moved := moveLinks(s.urlStorage, userID, workspaceID, shortIDs)
+	s.saveLinks(moved)
+	return moved, nil
+}
+
+// ListWorkspaceLinks returns a page of the links of the workspace, filtered and sorted by the query.
+func (s *StorageFile) ListWorkspaceLinks(workspaceID string, q models.LinkQuery) (models.LinkPage, error) {
+	s.mu.Lock()
+	links := workspaceLinks(s.urlStorage, workspaceID)
+	s.mu.Unlock()
+
+	return q.Page(links), nil
+}
+
+// GetWorkspaceStats counts the links, deletions, clicks and members of the workspace.
+func (s *StorageFile) GetWorkspaceStats(workspaceID string) (models.WorkspaceStats, error) {
+	members, err := s.workspaces.listMembers(workspaceID)
+	if err != nil {
+		return models.WorkspaceStats{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return workspaceStats(s.urlStorage, workspaceID, len(members)), nil
+}
+
+// DeleteWorkspaceURLs marks the links of the workspace as deleted and returns their short IDs.
+// The deleted links are saved to the file.
+func (s *StorageFile) DeleteWorkspaceURLs(userID, workspaceID string, urlIDs []string) ([]string, error) {
+	role, err := s.workspaces.role(workspaceID, userID)
+	if err != nil || !models.CanEditLinks(role) {
+		return nil, repository.ErrForbidden
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := deleteLinks(s.urlStorage, urlIDs, func(data models.URLData) bool { return data.WorkspaceID == workspaceID })
+	s.saveLinks(deleted)
+	return deleted, nil
+}
+
+// GetLink retrieves the link of any user.
+func (s *StorageFile) GetLink(shortID string) (models.URLData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.urlStorage[shortID]
+	if !exists {
+		return models.URLData{}, repository.ErrNotFound
+	}
+	return data, nil
+}
+
+// FindLinksByURL retrieves the links of all users shortening the original URL.
+func (s *StorageFile) FindLinksByURL(originalURL string) ([]models.UserLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return findLinksByURL(s.urlStorage, originalURL), nil
+}
+
+// TransferLink makes the user the creator of the link. The changed link is saved to the file.
+func (s *StorageFile) TransferLink(shortID, toUserID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.urlStorage[shortID]
+	if !exists {
+		return repository.ErrNotFound
+	}
+	data.UserID = toUserID
+	s.urlStorage[shortID] = data
+	s.sendLinks(map[string]models.URLData{shortID: data})
+	return nil
+}
+
+// RenameLink changes the short ID of the link. The link is saved to the file under the new short ID,
+// and a record without an original URL removes the old one.
+func (s *StorageFile) RenameLink(shortID, newShortID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := renameLink(s.urlStorage, shortID, newShortID)
+	if err != nil {
+		return err
+	}
+	s.sendLinks(map[string]models.URLData{shortID: {}})
+	s.sendLinks(map[string]models.URLData{newShortID: data})
+	return nil
+}
+
+// PurgeUser removes the links the user created outside workspaces, the user's templates, webhooks
+// and workspace memberships. The removed links are saved to the file as records without
+// an original URL, which RestoreURLstorage skips.
+func (s *StorageFile) PurgeUser(userID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	purged := purgeLinks(s.urlStorage, userID)
+	for _, shortID := range purged {
+		s.sendLinks(map[string]models.URLData{shortID: {}})
+	}
+
+	s.templates.purge(userID)
+	s.webhooks.purge(userID)
+	s.workspaces.purge(userID)
+	if err := writeSnapshot(s.path+templatesFileSuffix, s.templates.snapshot()); err != nil {
+		return len(purged), err
+	}
+	if err := s.saveWebhooks(); err != nil {
+		return len(purged), err
+	}
+	return len(purged), s.saveWorkspaces()
+}
+
+// AppendAudit appends the record to the audit log and to the end of the audit file.
+func (s *StorageFile) AppendAudit(record models.AuditRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.path+auditFileSuffix, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666) //nolint:mnd,gosec // same permissions as the URL storage file
+	if err != nil {
+		return fmt.Errorf("error open file %s %s", s.path+auditFileSuffix, err.Error())
+	}
+	defer file.Close() //nolint:errcheck // the write error is returned
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	s.audit.append(record)
+	return nil
+}
+
+// ListAudit retrieves the latest audit records matching the query, newest first.
+func (s *StorageFile) ListAudit(q models.AuditQuery) ([]models.AuditRecord, error) {
+	return s.audit.list(q), nil
+}
+
+// PruneAudit removes the audit records made before the time and returns their number.
+// The remaining records are written to the audit file, replacing its previous content.
+func (s *StorageFile) PruneAudit(before time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pruned := s.audit.prune(before)
+	if pruned == 0 {
+		return 0, nil
+	}
+
+	var buf bytes.Buffer
+	for _, record := range s.audit.snapshot() {
+		data, err := json.Marshal(record)
+		if err != nil {
+			return pruned, err
+		}
+		buf.Write(append(data, '\n'))
+	}
+	tmp := s.path + auditFileSuffix + ".tmp"
+	if err := os.WriteFile(tmp, buf.Bytes(), 0666); err != nil { //nolint:mnd,gosec // same permissions as the URL storage file
+		return pruned, fmt.Errorf("error write file %s %s", tmp, err.Error())
+	}
+	return pruned, os.Rename(tmp, s.path+auditFileSuffix)
+}
+
+// saveLinks saves the changed links to the file.
+func (s *StorageFile) saveLinks(shortIDs []string) {
+	for _, shortID := range shortIDs {
+		s.sendLinks(map[string]models.URLData{shortID: s.urlStorage[shortID]})
+	}
+}
+
+// saveWorkspaces saves all workspaces and members to the workspaces file.
+func (s *StorageFile) saveWorkspaces() error {
+	return writeSnapshot(s.path+workspacesFileSuffix, s.workspaces.snapshot())
 }
 
 // RestoreURLstorage restores URL data from a backup file.
@@ -92,74 +661,204 @@ func RestoreURLstorage(c *config.Config, s *StorageFile) error {
 			return err
 		}
 
-		s.urlStorage[urlFileStorage.ShortURL] = urlFileStorage.OriginalURL
-
-		newMap := make(map[string]string)
-		newMap[urlFileStorage.ShortURL] = urlFileStorage.OriginalURL
-		s.Events <- newMap
+		if urlFileStorage.OriginalURL == "" {
+			// The link was removed by PurgeUser or renamed by RenameLink.
+			delete(s.urlStorage, urlFileStorage.ShortURL)
+			continue
+		}
+		s.urlStorage[urlFileStorage.ShortURL] = urlFileStorage.URLData
 	}
 	_ = os.Truncate(c.URLStorageFile, 0)
+	s.sequence.Store(uint64(len(s.urlStorage)))
 
-	return nil
+	// A later record of the same short URL replaces the earlier ones, so only
+	// the last record of each short URL is written back.
+	for shortID, data := range s.urlStorage {
+		s.sendLinks(map[string]models.URLData{shortID: data})
+	}
+
+	var templates []models.UTMTemplate
+	if err := readSnapshot(c.URLStorageFile+templatesFileSuffix, &templates); err != nil {
+		return err
+	}
+	s.templates.restore(templates)
+
+	var webhooks webhookSnapshot
+	if err := readSnapshot(c.URLStorageFile+webhooksFileSuffix, &webhooks); err != nil {
+		return err
+	}
+	s.webhooks.restore(webhooks)
+
+	var workspaces workspaceSnapshot
+	if err := readSnapshot(c.URLStorageFile+workspacesFileSuffix, &workspaces); err != nil {
+		return err
+	}
+	s.workspaces.restore(workspaces)
+
+	var domains []models.Domain
+	if err := readSnapshot(c.URLStorageFile+domainsFileSuffix, &domains); err != nil {
+		return err
+	}
+	s.domains.restore(domains)
+
+	return restoreAudit(c.URLStorageFile+auditFileSuffix, s.audit)
+}
+
+// restoreAudit loads the audit records from the audit file. A missing file is not an error.
+func restoreAudit(path string, audit *auditLog) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("error open file %s %s", path, err.Error())
+	}
+	defer file.Close() //nolint:errcheck // read-only file
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record models.AuditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return err
+		}
+		audit.append(record)
+	}
+	return scanner.Err()
 }
 
-// AutoSave initiates automatic saving of URL data changes.
-func AutoSave(s *StorageFile) {
+// AutoSave initiates automatic saving of URL data changes and, every saveInterval, of the changes made by redirects.
+// Errors of the background saves are reported to sugar. AutoSave runs until Close.
+func AutoSave(s *StorageFile, sugar *zap.SugaredLogger) {
+	s.sugar = sugar
+	s.saved = make(chan struct{})
 	go func() {
+		defer close(s.saved)
 		i := 0
 		for {
-			newMap := <-s.Events
-			BackupURLs(s, newMap, i+1)
-			i++
+			select {
+			case newMap := <-s.Events:
+				i++
+				BackupURLs(s, newMap, i)
+			case <-s.stop:
+				for {
+					select {
+					case newMap := <-s.Events:
+						i++
+						BackupURLs(s, newMap, i)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+	go func() {
+		ticker := time.NewTicker(saveInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.flush()
+			case <-s.stop:
+				return
+			}
 		}
 	}()
 }
 
 // BackupURLs performs backup of URL data to a file.
-func BackupURLs(s *StorageFile, newMap map[string]string, counter int) {
-	shortID := ""
-	originalURL := ""
-	for key, value := range newMap {
-		shortID = key
-		originalURL = value
-
+func BackupURLs(s *StorageFile, newMap map[string]models.URLData, counter int) {
+	for shortID, data := range newMap {
 		urlFileStorage := models.StorageJSON{
-			UUID:        strconv.Itoa(counter),
-			ShortURL:    shortID,
-			OriginalURL: originalURL,
+			UUID:     strconv.Itoa(counter),
+			ShortURL: shortID,
+			URLData:  data,
 		}
 
 		data, err := json.Marshal(&urlFileStorage)
 		if err != nil {
-			fmt.Printf("error Marshal %s\n", err.Error())
+			s.sugar.Errorf("(BackupURLs) error Marshal: %s", err.Error())
 			return
 		}
 		data = append(data, '\n')
 
-		s.mu.Lock()
+		s.fileMu.Lock()
 		_, err = s.file.Write(data)
-		s.mu.Unlock()
+		s.fileMu.Unlock()
 
 		if err != nil {
-			fmt.Printf("error backup\n")
+			s.sugar.Errorf("(BackupURLs) error backup: %s", err.Error())
 		}
 	}
 }
 
+// SaveDomain registers the branded domain or replaces the assignments of the domain with the same name.
+// All domains are saved to the domains file.
+func (s *StorageFile) SaveDomain(d models.Domain) (saved models.Domain, created bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved, created = s.domains.save(d)
+	return saved, created, writeSnapshot(s.path+domainsFileSuffix, s.domains.list())
+}
+
+// GetDomain retrieves the branded domain by its name.
+func (s *StorageFile) GetDomain(name string) (models.Domain, error) {
+	return s.domains.get(name)
+}
+
+// ListDomains retrieves all branded domains sorted by name.
+func (s *StorageFile) ListDomains() ([]models.Domain, error) {
+	return s.domains.list(), nil
+}
+
+// DeleteDomain removes the branded domain from the registry and saves the remaining domains to the domains file.
+func (s *StorageFile) DeleteDomain(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.domains.delete(name); err != nil {
+		return err
+	}
+	return writeSnapshot(s.path+domainsFileSuffix, s.domains.list())
+}
+
+// NextSequence returns the next value of the short ID counter. The counter is not saved: after a restart
+// it continues from the number of restored links, and the generators skip the short IDs already taken.
+func (s *StorageFile) NextSequence() (uint64, error) {
+	return s.sequence.Add(1), nil
+}
+
 // Ping checks the connection to the database. Not used in this case.
 func (s *StorageFile) Ping() error {
 	return nil
 }
 
-// Close closes db connection. Not used in this case.
+// Close saves the changes made by redirects, stops AutoSave and waits until the queued links are written
+// to the file. Without AutoSave it does nothing.
 func (s *StorageFile) Close() error {
+	if s.saved == nil {
+		return nil
+	}
+	s.closeOnce.Do(func() {
+		s.flush()
+		s.flushMu.Lock()
+		close(s.stop)
+		s.flushMu.Unlock()
+		<-s.saved
+	})
 	return nil
 }
 
-// BatchDeleteURLs marks URLs as deleted in the database for a given user.
-// Not used in this instance.
-func (s *StorageFile) BatchDeleteURLs(userID string, urlIDs []string) error {
-	return nil
+// BatchDeleteURLs marks URLs as deleted for a given user: the links the user created
+// and the links of the workspaces where the user is an owner or editor. The deleted links are saved to the file.
+func (s *StorageFile) BatchDeleteURLs(userID string, urlIDs []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := deleteLinks(s.urlStorage, urlIDs, s.workspaces.canDelete(userID))
+	s.saveLinks(deleted)
+	return deleted, nil
 }
 
 // OpenFileAsReader opens a file for reading and creates the file if it does not exist.
@@ -180,6 +879,32 @@ func OpenFileAsWriter(c *config.Config) (io.ReadWriteCloser, error) {
 	return file, nil
 }
 
+// writeSnapshot saves v as JSON to the file at path, replacing its previous content.
+func writeSnapshot(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0666); err != nil { //nolint:mnd,gosec // same permissions as the URL storage file
+		return fmt.Errorf("error write file %s %s", tmp, err.Error())
+	}
+	return os.Rename(tmp, path)
+}
+
+// readSnapshot loads JSON saved by writeSnapshot into v. A missing file is not an error.
+func readSnapshot(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("error read file %s %s", path, err.Error())
+	}
+	return json.Unmarshal(data, v)
+}
+
 // ReadWriteCloserClose closes the ReadWriteCloser.
 func ReadWriteCloserClose(rwc io.ReadWriteCloser) {
 	_ = rwc.Close()
@@ -2,55 +2,435 @@ package storage
 
 import (
 	"fmt"
+	"maps"
 	"net/http"
+	"shortener/internal/domain/models"
 	"shortener/internal/repository"
+	"slices"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // StorageMemory - structure for storing URL data in memory.
 type StorageMemory struct {
-	urlStorage map[string]string
+	urlStorage map[string]models.URLData
+	templates  *utmTemplates
+	webhooks   *webhookOutbox
+	workspaces *workspaceSet
+	audit      *auditLog
+	domains    *domainRegistry
+	sequence   atomic.Uint64
 	mu         sync.Mutex
 }
 
 // NewStorageMemory creates and returns a new instance of StorageMemory.
 func NewStorageMemory() *StorageMemory {
 	return &StorageMemory{
-		urlStorage: make(map[string]string),
+		urlStorage: make(map[string]models.URLData),
+		templates:  newUTMTemplates(),
+		webhooks:   newWebhookOutbox(),
+		workspaces: newWorkspaceSet(),
+		audit:      newAuditLog(),
+		domains:    newDomainRegistry(),
 	}
 }
 
 // UpdateData updates the data in the storage and returns the shortened URL.
-func (s *StorageMemory) UpdateData(req *http.Request, originalURL, userID string) (shortURL string, retErr error) {
+func (s *StorageMemory) UpdateData(req *http.Request, originalURL, userID string, opts models.LinkOptions) (shortURL string, retErr error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 	retErr = nil
 
-	shortURL = repository.GenerateShortID()
-
 	for k, v := range s.urlStorage {
-		if v == originalURL {
+		if v.OriginalURL == originalURL {
 			return k, repository.ErrDuplicateURL
 		}
 	}
+	shortURL, retErr = newLinkKey(s.urlStorage, opts)
+	if retErr != nil {
+		return "", retErr
+	}
+	opts.Alias, opts.Domain = "", ""
 
-	s.urlStorage[shortURL] = originalURL
-	newMap := make(map[string]string)
-	newMap[shortURL] = originalURL
+	opts.SetCreated(time.Now())
+	s.urlStorage[shortURL] = models.URLData{OriginalURL: originalURL, UserID: userID, LinkOptions: opts}
 
 	return shortURL, nil
 }
 
+// newLinkKey returns the storage key of a new link with the options (see repository.AliasOrNewShortID).
+// A generated key that is taken anyway is detected and replaced, at most repository.MaxShortIDAttempts
+// times, so a stored link is never overwritten.
+func newLinkKey(urlStorage map[string]models.URLData, opts models.LinkOptions) (string, error) {
+	for range repository.MaxShortIDAttempts {
+		key, err := repository.AliasOrNewShortID(opts, takenIn(urlStorage, opts.Domain))
+		if err != nil {
+			return "", err
+		}
+		if _, taken := urlStorage[key]; !taken {
+			return key, nil
+		}
+		opts.Alias = ""
+	}
+	return "", repository.ErrShortIDExhausted
+}
+
+// takenIn returns the check of the short IDs in the namespace of the domain taken by the links.
+func takenIn(urlStorage map[string]models.URLData, domain string) func(shortID string) (bool, error) {
+	return func(shortID string) (bool, error) {
+		_, taken := urlStorage[models.QualifyShortID(shortID, domain)]
+		return taken, nil
+	}
+}
+
 // GetData retrieves the original URL.
 func (s *StorageMemory) GetData(shortID string) (originalURL string, isDeleted bool, err error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	originalURL, exists := s.urlStorage[shortID]
+	data, exists := s.urlStorage[shortID]
 	if !exists {
 		return "", false, fmt.Errorf("shortID not found: %s", shortID)
 	}
-	return originalURL, false, nil
+	return data.OriginalURL, data.IsDeleted, nil
+}
+
+// GetLinkOptions retrieves the per-link settings stored with the short URL.
+func (s *StorageMemory) GetLinkOptions(shortID string) (models.LinkOptions, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.urlStorage[shortID]
+	if !exists {
+		return models.LinkOptions{}, fmt.Errorf("shortID not found: %s", shortID)
+	}
+	return data.LinkOptions, nil
+}
+
+// GetUserLink retrieves the link created by the user.
+func (s *StorageMemory) GetUserLink(userID, shortID string) (models.URLData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.urlStorage[shortID]
+	if !exists || data.UserID != userID {
+		return models.URLData{}, repository.ErrNotFound
+	}
+	return data, nil
+}
+
+// ListUserLinks returns a page of the links created by the user, filtered and sorted by the query.
+func (s *StorageMemory) ListUserLinks(userID string, q models.LinkQuery) (models.LinkPage, error) {
+	s.mu.Lock()
+	links := make([]models.UserLink, 0)
+	for shortID, data := range s.urlStorage {
+		if data.UserID == userID {
+			links = append(links, models.UserLink{ShortID: shortID, URLData: data})
+		}
+	}
+	s.mu.Unlock()
+
+	return q.Page(links), nil
+}
+
+// EditLink changes the settings of the link created by the user.
+func (s *StorageMemory) EditLink(userID, shortID string, edit models.LinkEdit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.urlStorage[shortID]
+	if !exists || data.UserID != userID {
+		return repository.ErrNotFound
+	}
+
+	data.Apply(edit)
+	s.urlStorage[shortID] = data
+	return nil
+}
+
+// RegisterClick counts a redirect via the link, its destination and the visitor country unless the click limit is reached.
+func (s *StorageMemory) RegisterClick(shortID string, click models.Click) (allowed bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.urlStorage[shortID]
+	if !exists {
+		return false, fmt.Errorf("shortID not found: %s", shortID)
+	}
+	if data.ClicksExhausted() {
+		return false, nil
+	}
+
+	data.CountClick(click)
+	s.urlStorage[shortID] = data
+	s.webhooks.enqueue(clickEvent(shortID, data, click))
+	return true, nil
+}
+
+// ScanLinks calls fn for every stored link until fn returns an error.
+// The links are copied first, so fn may change the storage.
+func (s *StorageMemory) ScanLinks(fn func(shortID string, data models.URLData) error) error {
+	s.mu.Lock()
+	links := maps.Clone(s.urlStorage)
+	s.mu.Unlock()
+
+	for _, shortID := range slices.Sorted(maps.Keys(links)) {
+		if err := fn(shortID, links[shortID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetLinkDisabled disables the link for the given reason or enables it if the reason is empty.
+func (s *StorageMemory) SetLinkDisabled(shortID, reason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.urlStorage[shortID]
+	if !exists {
+		return repository.ErrNotFound
+	}
+	data.DisabledReason = reason
+	s.urlStorage[shortID] = data
+	return nil
+}
+
+// SaveUTMTemplate creates the user's template or replaces the parameters of the template with the same name.
+func (s *StorageMemory) SaveUTMTemplate(tpl models.UTMTemplate) (saved models.UTMTemplate, created bool, err error) {
+	saved, created = s.templates.save(tpl)
+	return saved, created, nil
+}
+
+// GetUTMTemplate retrieves the template by its identifier.
+func (s *StorageMemory) GetUTMTemplate(id string) (models.UTMTemplate, error) {
+	return s.templates.get(id)
+}
+
+// GetUTMTemplates retrieves all templates of the user.
+func (s *StorageMemory) GetUTMTemplates(userID string) ([]models.UTMTemplate, error) {
+	return s.templates.list(userID), nil
+}
+
+// DeleteUTMTemplate deletes the user's template with the given name.
+func (s *StorageMemory) DeleteUTMTemplate(userID, name string) error {
+	return s.templates.delete(userID, name)
+}
+
+// SaveWebhook stores a new webhook of the user.
+func (s *StorageMemory) SaveWebhook(hook models.Webhook) error {
+	s.webhooks.saveHook(hook)
+	return nil
+}
+
+// GetWebhook retrieves the webhook by its identifier.
+func (s *StorageMemory) GetWebhook(id string) (models.Webhook, error) {
+	return s.webhooks.getHook(id)
+}
+
+// GetWebhooks retrieves all webhooks of the user, oldest first.
+func (s *StorageMemory) GetWebhooks(userID string) ([]models.Webhook, error) {
+	return s.webhooks.listHooks(userID), nil
+}
+
+// DeleteWebhook deletes the user's webhook with its deliveries.
+func (s *StorageMemory) DeleteWebhook(userID, id string) error {
+	return s.webhooks.deleteHook(userID, id)
+}
+
+// EnqueueWebhookEvent records a pending delivery of the event for every subscribed webhook of its user.
+func (s *StorageMemory) EnqueueWebhookEvent(event models.WebhookEvent) error {
+	s.webhooks.enqueue(event)
+	return nil
+}
+
+// ClaimWebhookDeliveries returns up to limit pending deliveries due at now and postpones them until leaseUntil.
+func (s *StorageMemory) ClaimWebhookDeliveries(now, leaseUntil time.Time, limit int) ([]models.WebhookDelivery, error) {
+	return s.webhooks.claim(now, leaseUntil, limit), nil
+}
+
+// RecordWebhookAttempt appends the attempt to the delivery and sets its status and the time of the next attempt.
+func (s *StorageMemory) RecordWebhookAttempt(id string, attempt models.DeliveryAttempt, status string, next time.Time) error {
+	return s.webhooks.record(id, attempt, status, next)
+}
+
+// GetWebhookDeliveries retrieves up to limit latest deliveries of the user's webhook, newest first.
+func (s *StorageMemory) GetWebhookDeliveries(userID, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	return s.webhooks.listDeliveries(userID, webhookID, limit)
+}
+
+// CreateWorkspace stores a new workspace with the user as its owner.
+func (s *StorageMemory) CreateWorkspace(ws models.Workspace, ownerID string) error {
+	s.workspaces.create(ws, models.WorkspaceMember{WorkspaceID: ws.ID, UserID: ownerID, Role: models.RoleOwner, AddedAt: ws.CreatedAt})
+	return nil
+}
+
+// GetUserWorkspaces retrieves the workspaces the user is a member of with the user's roles, oldest first.
+func (s *StorageMemory) GetUserWorkspaces(userID string) ([]models.WorkspaceMembership, error) {
+	return s.workspaces.listForUser(userID), nil
+}
+
+// GetWorkspaceRole retrieves the role of the user in the workspace.
+func (s *StorageMemory) GetWorkspaceRole(workspaceID, userID string) (string, error) {
+	return s.workspaces.role(workspaceID, userID)
+}
+
+// GetWorkspaceMembers retrieves the members of the workspace in the order they were added.
+func (s *StorageMemory) GetWorkspaceMembers(workspaceID string) ([]models.WorkspaceMember, error) {
+	return s.workspaces.listMembers(workspaceID)
+}
+
+// SetWorkspaceMember adds the member to the workspace or changes the member's role.
+func (s *StorageMemory) SetWorkspaceMember(member models.WorkspaceMember) error {
+	return s.workspaces.setMember(member)
+}
+
+// RemoveWorkspaceMember removes the user from the workspace.
+func (s *StorageMemory) RemoveWorkspaceMember(workspaceID, userID string) error {
+	return s.workspaces.removeMember(workspaceID, userID)
+}
+
+// MoveLinksToWorkspace hands the links created by the user over to the workspace and returns their short IDs.
+func (s *StorageMemory) MoveLinksToWorkspace(userID, workspaceID string, shortIDs []string) ([]string, error) {
+	role, err := s.workspaces.role(workspaceID, userID)
+	if err != nil || !models.CanEditLinks(role) {
+		return nil, repository.ErrForbidden
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return moveLinks(s.urlStorage, userID, workspaceID, shortIDs), nil
+}
+
+// ListWorkspaceLinks returns a page of the links of the workspace, filtered and sorted by the query.
+func (s *StorageMemory) ListWorkspaceLinks(workspaceID string, q models.LinkQuery) (models.LinkPage, error) {
+	s.mu.Lock()
+	links := workspaceLinks(s.urlStorage, workspaceID)
+	s.mu.Unlock()
+
+	return q.Page(links), nil
+}
+
+// GetWorkspaceStats counts the links, deletions, clicks and members of the workspace.
+func (s *StorageMemory) GetWorkspaceStats(workspaceID string) (models.WorkspaceStats, error) {
+	members, err := s.workspaces.listMembers(workspaceID)
+	if err != nil {
+		return models.WorkspaceStats{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return workspaceStats(s.urlStorage, workspaceID, len(members)), nil
+}
+
+// DeleteWorkspaceURLs marks the links of the workspace as deleted and returns their short IDs.
+func (s *StorageMemory) DeleteWorkspaceURLs(userID, workspaceID string, urlIDs []string) ([]string, error) {
+	role, err := s.workspaces.role(workspaceID, userID)
+	if err != nil || !models.CanEditLinks(role) {
+		return nil, repository.ErrForbidden
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return deleteLinks(s.urlStorage, urlIDs, func(data models.URLData) bool { return data.WorkspaceID == workspaceID }), nil
+}
+
+// GetLink retrieves the link of any user.
+func (s *StorageMemory) GetLink(shortID string) (models.URLData, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.urlStorage[shortID]
+	if !exists {
+		return models.URLData{}, repository.ErrNotFound
+	}
+	return data, nil
+}
+
+// FindLinksByURL retrieves the links of all users shortening the original URL.
+func (s *StorageMemory) FindLinksByURL(originalURL string) ([]models.UserLink, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return findLinksByURL(s.urlStorage, originalURL), nil
+}
+
+// TransferLink makes the user the creator of the link.
+func (s *StorageMemory) TransferLink(shortID, toUserID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, exists := s.urlStorage[shortID]
+	if !exists {
+		return repository.ErrNotFound
+	}
+	data.UserID = toUserID
+	s.urlStorage[shortID] = data
+	return nil
+}
+
+// RenameLink changes the short ID of the link.
+func (s *StorageMemory) RenameLink(shortID, newShortID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, err := renameLink(s.urlStorage, shortID, newShortID)
+	return err
+}
+
+// PurgeUser removes the links the user created outside workspaces, the user's templates, webhooks
+// and workspace memberships.
+func (s *StorageMemory) PurgeUser(userID string) (int, error) {
+	s.templates.purge(userID)
+	s.webhooks.purge(userID)
+	s.workspaces.purge(userID)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(purgeLinks(s.urlStorage, userID)), nil
+}
+
+// AppendAudit appends the record to the audit log.
+func (s *StorageMemory) AppendAudit(record models.AuditRecord) error {
+	s.audit.append(record)
+	return nil
+}
+
+// ListAudit retrieves the latest audit records matching the query, newest first.
+func (s *StorageMemory) ListAudit(q models.AuditQuery) ([]models.AuditRecord, error) {
+	return s.audit.list(q), nil
+}
+
+// PruneAudit removes the audit records made before the time and returns their number.
+func (s *StorageMemory) PruneAudit(before time.Time) (int, error) {
+	return s.audit.prune(before), nil
+}
+
+// SaveDomain registers the branded domain or replaces the assignments of the domain with the same name.
+func (s *StorageMemory) SaveDomain(d models.Domain) (saved models.Domain, created bool, err error) {
+	saved, created = s.domains.save(d)
+	return saved, created, nil
+}
+
+// GetDomain retrieves the branded domain by its name.
+func (s *StorageMemory) GetDomain(name string) (models.Domain, error) {
+	return s.domains.get(name)
+}
+
+// ListDomains retrieves all branded domains sorted by name.
+func (s *StorageMemory) ListDomains() ([]models.Domain, error) {
+	return s.domains.list(), nil
+}
+
+// DeleteDomain removes the branded domain from the registry.
+func (s *StorageMemory) DeleteDomain(name string) error {
+	return s.domains.delete(name)
+}
+
+// NextSequence returns the next value of the short ID counter, which starts at 1.
+func (s *StorageMemory) NextSequence() (uint64, error) {
+	return s.sequence.Add(1), nil
 }
 
 // Ping checks the connection to the database. Not used in this context.
@@ -63,8 +443,11 @@ func (s *StorageMemory) Close() error {
 	return nil
 }
 
-// BatchDeleteURLs marks URLs as deleted in the database for a specified user.
-// Not used in this context.
-func (s *StorageMemory) BatchDeleteURLs(userID string, urlIDs []string) error {
-	return nil
+// BatchDeleteURLs marks URLs as deleted for a specified user: the links the user created
+// and the links of the workspaces where the user is an owner or editor.
+func (s *StorageMemory) BatchDeleteURLs(userID string, urlIDs []string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return deleteLinks(s.urlStorage, urlIDs, s.workspaces.canDelete(userID)), nil
 }
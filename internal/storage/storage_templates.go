@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"shortener/internal/domain/models"
+	"shortener/internal/repository"
+	"sort"
+	"sync"
+)
+
+// utmTemplates keeps UTM templates in memory for the memory and file storages.
+type utmTemplates struct {
+	items map[string]models.UTMTemplate
+	mu    sync.Mutex
+}
+
+// newUTMTemplates creates an empty set of UTM templates.
+func newUTMTemplates() *utmTemplates {
+	return &utmTemplates{
+		items: make(map[string]models.UTMTemplate),
+	}
+}
+
+// save creates the template or replaces the parameters of the user's template with the same name.
+func (t *utmTemplates) save(tpl models.UTMTemplate) (models.UTMTemplate, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for id, existing := range t.items {
+		if existing.UserID == tpl.UserID && existing.Name == tpl.Name {
+			existing.Params = tpl.Params
+			t.items[id] = existing
+			return existing, false
+		}
+	}
+
+	t.items[tpl.ID] = tpl
+	return tpl, true
+}
+
+// get returns the template by its identifier.
+func (t *utmTemplates) get(id string) (models.UTMTemplate, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tpl, exists := t.items[id]
+	if !exists {
+		return models.UTMTemplate{}, repository.ErrNotFound
+	}
+	return tpl, nil
+}
+
+// list returns the user's templates sorted by name.
+func (t *utmTemplates) list(userID string) []models.UTMTemplate {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	templates := []models.UTMTemplate{}
+	for _, tpl := range t.items {
+		if tpl.UserID == userID {
+			templates = append(templates, tpl)
+		}
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates
+}
+
+// delete removes the user's template with the given name.
+func (t *utmTemplates) delete(userID, name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for id, tpl := range t.items {
+		if tpl.UserID == userID && tpl.Name == name {
+			delete(t.items, id)
+			return nil
+		}
+	}
+	return repository.ErrNotFound
+}
+
+// snapshot returns all templates.
+func (t *utmTemplates) snapshot() []models.UTMTemplate {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	templates := make([]models.UTMTemplate, 0, len(t.items))
+	for _, tpl := range t.items {
+		templates = append(templates, tpl)
+	}
+	return templates
+}
+
+// restore replaces all templates with the given ones.
+func (t *utmTemplates) restore(templates []models.UTMTemplate) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.items = make(map[string]models.UTMTemplate, len(templates))
+	for _, tpl := range templates {
+		t.items[tpl.ID] = tpl
+	}
+}
+
+// purge removes all templates of the user.
+func (t *utmTemplates) purge(userID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for id, tpl := range t.items {
+		if tpl.UserID == userID {
+			delete(t.items, id)
+		}
+	}
+}
@@ -1,18 +1,36 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"io/fs"
 	"net/http"
 	"os"
+	"path/filepath"
 	"shortener/internal/config"
+	"shortener/internal/domain/models"
 	"shortener/internal/repository"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/pressly/goose/v3"
 	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
 )
 
+// linkOptionsRowColumns - columns of the per-link settings in the rows returned by the mocked database.
+var linkOptionsRowColumns = []string{"redirect_type", "passthrough", "utm_template_id", "password_hash", "max_clicks", "clicks",
+	"destinations", "rules", "country_clicks", "disabled_reason", "title", "interstitial", "created_at", "notes", "tags"}
+
 func TestNewStorageDB(t *testing.T) {
 	t.Run("Successful connection and migration", func(t *testing.T) {
 		db, mock, err := sqlmock.New()
@@ -94,8 +112,8 @@ func TestStorageDB_Ping(t *testing.T) {
 
 func TestStorageMemory_GetData(t *testing.T) {
 	storage := &StorageMemory{
-		urlStorage: map[string]string{
-			"abc123": "http://example.com",
+		urlStorage: map[string]models.URLData{
+			"abc123": {OriginalURL: "http://example.com"},
 		},
 	}
 
@@ -117,8 +135,8 @@ func TestStorageMemory_GetData(t *testing.T) {
 
 func TestStorageFile_GetData(t *testing.T) {
 	storage := &StorageFile{
-		urlStorage: map[string]string{
-			"abc123": "http://example.com",
+		urlStorage: map[string]models.URLData{
+			"abc123": {OriginalURL: "http://example.com"},
 		},
 	}
 
@@ -179,7 +197,7 @@ func TestStorageDB_GetData(t *testing.T) {
 
 func TestStorageMemory_UpdateData(t *testing.T) {
 	storage := &StorageMemory{
-		urlStorage: make(map[string]string),
+		urlStorage: make(map[string]models.URLData),
 	}
 
 	// Mock
@@ -187,14 +205,14 @@ func TestStorageMemory_UpdateData(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Run("Add new original URL", func(t *testing.T) {
-		shortURL, err := storage.UpdateData(req, "http://example.com", "user123")
+		shortURL, err := storage.UpdateData(req, "http://example.com", "user123", models.LinkOptions{})
 		require.NoError(t, err, "Expected no error when adding new original URL")
 		require.NotEmpty(t, shortURL, "Expected a non-empty short URL")
-		require.Equal(t, "http://example.com", storage.urlStorage[shortURL], "Expected stored URL to match original")
+		require.Equal(t, "http://example.com", storage.urlStorage[shortURL].OriginalURL, "Expected stored URL to match original")
 	})
 
 	t.Run("Add duplicate original URL", func(t *testing.T) {
-		_, err := storage.UpdateData(req, "http://example.com", "user123")
+		_, err := storage.UpdateData(req, "http://example.com", "user123", models.LinkOptions{})
 		require.Error(t, err, "Expected error for duplicate original URL")
 		require.Equal(t, repository.ErrDuplicateURL, err, "Expected duplicate URL error")
 	})
@@ -202,8 +220,8 @@ func TestStorageMemory_UpdateData(t *testing.T) {
 
 func TestStorageFile_UpdateData(t *testing.T) {
 	storage := &StorageFile{
-		urlStorage: make(map[string]string),
-		Events:     make(chan map[string]string, 1),
+		urlStorage: make(map[string]models.URLData),
+		Events:     make(chan map[string]models.URLData, 1),
 	}
 
 	// Mock
@@ -211,18 +229,1260 @@ func TestStorageFile_UpdateData(t *testing.T) {
 	require.NoError(t, err)
 
 	t.Run("Add new original URL", func(t *testing.T) {
-		shortURL, err := storage.UpdateData(req, "http://example.com", "user123")
+		shortURL, err := storage.UpdateData(req, "http://example.com", "user123", models.LinkOptions{})
 		require.NoError(t, err, "Expected no error when adding new original URL")
 		require.NotEmpty(t, shortURL, "Expected a non-empty short URL")
-		require.Equal(t, "http://example.com", storage.urlStorage[shortURL], "Expected stored URL to match original")
+		require.Equal(t, "http://example.com", storage.urlStorage[shortURL].OriginalURL, "Expected stored URL to match original")
 
 		event := <-storage.Events
-		require.Equal(t, "http://example.com", event[shortURL], "Expected event to contain the correct URL")
+		require.Equal(t, "http://example.com", event[shortURL].OriginalURL, "Expected event to contain the correct URL")
 	})
 
 	t.Run("Add duplicate original URL", func(t *testing.T) {
-		_, err := storage.UpdateData(req, "http://example.com", "user123")
+		_, err := storage.UpdateData(req, "http://example.com", "user123", models.LinkOptions{})
 		require.Error(t, err, "Expected error for duplicate original URL")
 		require.Equal(t, repository.ErrDuplicateURL, err, "Expected duplicate URL error")
 	})
 }
+
+func TestStorageMemory_GetLinkOptions(t *testing.T) {
+	storage := NewStorageMemory()
+	shortID, err := storage.UpdateData(nil, "http://example.com", "user123", models.LinkOptions{RedirectType: http.StatusMovedPermanently})
+	require.NoError(t, err)
+
+	opts, err := storage.GetLinkOptions(shortID)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusMovedPermanently, opts.RedirectType)
+	require.WithinDuration(t, time.Now(), opts.CreatedAt, time.Minute, "Expected creation time to be recorded")
+
+	_, err = storage.GetLinkOptions("nonexistent")
+	require.EqualError(t, err, "shortID not found: nonexistent")
+}
+
+func TestStorageDB_GetLinkOptions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if e := db.Close(); e != nil {
+			fmt.Println("db.Close() error")
+		}
+	}()
+
+	storageDB := &StorageDB{DBConn: db}
+
+	createdAt := time.Date(2025, 3, 10, 12, 0, 0, 0, time.UTC)
+	rows := sqlmock.NewRows(linkOptionsRowColumns).
+		AddRow(http.StatusPermanentRedirect, true, "", "", 0, 0, []byte(`[{"url":"http://a.example","weight":70,"clicks":3}]`),
+			[]byte(`[{"platform":"ios","url":"http://ios.example"}]`), []byte(`{"DE":3}`), "phishing", "Spring sale", true, createdAt,
+			"print run", []byte(`["spring","print"]`))
+	mock.ExpectQuery("SELECT redirect_type, passthrough, utm_template_id, password_hash, max_clicks, clicks, destinations, rules, country_clicks, disabled_reason").WithArgs("shortURL123").WillReturnRows(rows)
+
+	opts, err := storageDB.GetLinkOptions("shortURL123")
+	require.NoError(t, err)
+	require.Equal(t, http.StatusPermanentRedirect, opts.RedirectType)
+	require.True(t, opts.Passthrough)
+	require.Equal(t, []models.Destination{{URL: "http://a.example", Weight: 70, Clicks: 3}}, opts.Destinations)
+	require.Equal(t, []models.TargetingRule{{Platform: models.PlatformIOS, URL: "http://ios.example"}}, opts.Rules)
+	require.Equal(t, map[string]int{"DE": 3}, opts.CountryClicks)
+	require.Equal(t, "phishing", opts.DisabledReason)
+	require.Equal(t, "Spring sale", opts.Title)
+	require.True(t, opts.Interstitial)
+	require.Equal(t, createdAt, opts.CreatedAt)
+	require.Equal(t, "print run", opts.Notes)
+	require.Equal(t, []string{"spring", "print"}, opts.Tags)
+	require.NoError(t, mock.ExpectationsWereMet(), "Unfulfilled expectations")
+}
+
+func TestStorageMemory_UTMTemplates(t *testing.T) {
+	storage := NewStorageMemory()
+
+	saved, created, err := storage.SaveUTMTemplate(models.UTMTemplate{
+		ID: "tpl1", UserID: "user123", Name: "spring", Params: map[string]string{"utm_source": "newsletter"},
+	})
+	require.NoError(t, err)
+	require.True(t, created)
+	require.Equal(t, "tpl1", saved.ID)
+
+	saved, created, err = storage.SaveUTMTemplate(models.UTMTemplate{
+		ID: "tpl2", UserID: "user123", Name: "spring", Params: map[string]string{"utm_source": "blog"},
+	})
+	require.NoError(t, err)
+	require.False(t, created, "Expected template with the same name to be updated")
+	require.Equal(t, "tpl1", saved.ID)
+
+	tpl, err := storage.GetUTMTemplate("tpl1")
+	require.NoError(t, err)
+	require.Equal(t, "blog", tpl.Params["utm_source"])
+
+	templates, err := storage.GetUTMTemplates("another")
+	require.NoError(t, err)
+	require.Empty(t, templates)
+
+	require.NoError(t, storage.DeleteUTMTemplate("user123", "spring"))
+	require.ErrorIs(t, storage.DeleteUTMTemplate("user123", "spring"), repository.ErrNotFound)
+	_, err = storage.GetUTMTemplate("tpl1")
+	require.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestStorageFile_UTMTemplatesRestore(t *testing.T) {
+	c := &config.Config{URLStorageFile: filepath.Join(t.TempDir(), "urls.json")}
+
+	storageFile := NewStorageFile(c)
+	require.NotNil(t, storageFile)
+	_, _, err := storageFile.SaveUTMTemplate(models.UTMTemplate{
+		ID: "tpl1", UserID: "user123", Name: "spring", Params: map[string]string{"utm_source": "newsletter"},
+	})
+	require.NoError(t, err)
+
+	restored := NewStorageFile(c)
+	require.NotNil(t, restored)
+	require.NoError(t, RestoreURLstorage(c, restored))
+
+	templates, err := restored.GetUTMTemplates("user123")
+	require.NoError(t, err)
+	require.Len(t, templates, 1)
+	require.Equal(t, "newsletter", templates[0].Params["utm_source"])
+}
+
+func TestStorageDB_SaveUTMTemplate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if e := db.Close(); e != nil {
+			fmt.Println("db.Close() error")
+		}
+	}()
+
+	storageDB := &StorageDB{DBConn: db}
+	tpl := models.UTMTemplate{ID: "new", UserID: "user123", Name: "spring", Params: map[string]string{"utm_source": "x"}}
+
+	mock.ExpectQuery("INSERT INTO utm_templates").
+		WithArgs("new", "user123", "spring", `{"utm_source":"x"}`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("existing"))
+
+	saved, created, err := storageDB.SaveUTMTemplate(tpl)
+	require.NoError(t, err)
+	require.False(t, created)
+	require.Equal(t, "existing", saved.ID)
+
+	mock.ExpectExec("DELETE FROM utm_templates").WithArgs("user123", "spring").WillReturnResult(sqlmock.NewResult(0, 0))
+	require.ErrorIs(t, storageDB.DeleteUTMTemplate("user123", "spring"), repository.ErrNotFound)
+	require.NoError(t, mock.ExpectationsWereMet(), "Unfulfilled expectations")
+}
+
+func TestStorageFile_WebhooksRestore(t *testing.T) {
+	c := &config.Config{URLStorageFile: filepath.Join(t.TempDir(), "urls.json")}
+
+	storageFile := NewStorageFile(c)
+	require.NotNil(t, storageFile)
+	require.NoError(t, storageFile.SaveWebhook(models.Webhook{ID: "hook1", UserID: "user123", URL: "http://hooks.example"}))
+	shortID, err := storageFile.UpdateData(nil, "http://example.com/clicked", "user123", models.LinkOptions{})
+	require.NoError(t, err)
+	allowed, err := storageFile.RegisterClick(shortID, models.Click{Variant: -1, Country: "DE"})
+	require.NoError(t, err)
+	require.True(t, allowed)
+	storageFile.flush()
+
+	restored := NewStorageFile(c)
+	require.NotNil(t, restored)
+	require.NoError(t, RestoreURLstorage(c, restored))
+
+	now := time.Now().Add(time.Minute)
+	claimed, err := restored.ClaimWebhookDeliveries(now, now.Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1, "Expected the click to be restored in the outbox")
+	require.Equal(t, models.EventLinkClicked, claimed[0].Event.Type)
+	require.Equal(t, "user123", claimed[0].Event.UserID)
+	require.Equal(t, "DE", claimed[0].Event.Click.Country)
+
+	claimed, err = restored.ClaimWebhookDeliveries(now, now.Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Empty(t, claimed, "Expected a claimed delivery to be leased")
+
+	require.ErrorIs(t, restored.DeleteWebhook("another", "hook1"), repository.ErrNotFound)
+	require.NoError(t, restored.DeleteWebhook("user123", "hook1"))
+	_, err = restored.GetWebhookDeliveries("user123", "hook1", 10)
+	require.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestStorageFile_RegisterClickWebhooksSaveError(t *testing.T) {
+	c := &config.Config{URLStorageFile: filepath.Join(t.TempDir(), "urls.json")}
+
+	storageFile := NewStorageFile(c)
+	require.NotNil(t, storageFile)
+	require.NoError(t, storageFile.SaveWebhook(models.Webhook{ID: "hook1", UserID: "user123", URL: "http://hooks.example"}))
+	shortID, err := storageFile.UpdateData(nil, "http://example.com/clicked", "user123", models.LinkOptions{MaxClicks: 1})
+	require.NoError(t, err)
+
+	// the snapshot cannot be written while a directory takes the place of its temporary file
+	require.NoError(t, os.Mkdir(c.URLStorageFile+webhooksFileSuffix+".tmp", 0o755))
+	allowed, err := storageFile.RegisterClick(shortID, models.Click{Variant: -1})
+	require.NoError(t, err, "Expected a failed save of the webhooks not to fail the click")
+	require.True(t, allowed)
+	storageFile.flush()
+	require.True(t, storageFile.webhooksDirty.Load(), "Expected the failed save to be retried")
+
+	require.NoError(t, os.Remove(c.URLStorageFile+webhooksFileSuffix+".tmp"))
+	storageFile.flush()
+	require.False(t, storageFile.webhooksDirty.Load())
+}
+
+func TestStorageDB_ClaimWebhookDeliveries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if e := db.Close(); e != nil {
+			fmt.Println("db.Close() error")
+		}
+	}()
+
+	storageDB := &StorageDB{DBConn: db}
+	now := time.Date(2025, 3, 12, 10, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery("UPDATE webhook_deliveries SET next_attempt_at = \\$2 WHERE id IN").
+		WithArgs(now, now.Add(time.Minute), 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "webhook_id", "user_id", "event", "status", "attempts", "next_attempt_at", "created_at"}).
+			AddRow("d1", "hook1", "user123", `{"id":"evt1","type":"link.created","link":{"short_id":"abc"}}`,
+				models.DeliveryPending, `[{"at":"2025-03-12T09:59:00Z","status_code":500}]`, now, now))
+
+	claimed, err := storageDB.ClaimWebhookDeliveries(now, now.Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 1)
+	require.Equal(t, "user123", claimed[0].Event.UserID)
+	require.Equal(t, "abc", claimed[0].Event.Link.ShortID)
+	require.Len(t, claimed[0].Attempts, 1)
+
+	mock.ExpectExec("UPDATE webhook_deliveries SET").
+		WithArgs("d1", `[{"at":"2025-03-12T10:00:00Z","status_code":204}]`, models.DeliveryDelivered, now).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, storageDB.RecordWebhookAttempt("d1", models.DeliveryAttempt{At: now, StatusCode: 204}, models.DeliveryDelivered, now))
+	require.NoError(t, mock.ExpectationsWereMet(), "Unfulfilled expectations")
+}
+
+func TestStorageMemory_RegisterClick(t *testing.T) {
+	storage := NewStorageMemory()
+	shortID, err := storage.UpdateData(nil, "http://example.com/once", "user123", models.LinkOptions{MaxClicks: 2})
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	var allowedCount atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			allowed, err := storage.RegisterClick(shortID, models.Click{Variant: -1})
+			require.NoError(t, err)
+			if allowed {
+				allowedCount.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+
+	require.Equal(t, int32(2), allowedCount.Load(), "Expected concurrent clicks not to exceed the limit")
+	opts, err := storage.GetLinkOptions(shortID)
+	require.NoError(t, err)
+	require.True(t, opts.ClicksExhausted())
+}
+
+func TestStorageFile_RegisterClickRestore(t *testing.T) {
+	c := &config.Config{URLStorageFile: filepath.Join(t.TempDir(), "urls.json")}
+
+	storageFile := NewStorageFile(c)
+	require.NotNil(t, storageFile)
+	shortID, err := storageFile.UpdateData(nil, "http://example.com/once", "user123", models.LinkOptions{MaxClicks: 1})
+	require.NoError(t, err)
+	allowed, err := storageFile.RegisterClick(shortID, models.Click{Variant: -1})
+	require.NoError(t, err)
+	require.True(t, allowed)
+	storageFile.flush()
+	for len(storageFile.Events) > 0 {
+		BackupURLs(storageFile, <-storageFile.Events, 1)
+	}
+
+	restored := NewStorageFile(c)
+	require.NotNil(t, restored)
+	require.NoError(t, RestoreURLstorage(c, restored))
+
+	allowed, err = restored.RegisterClick(shortID, models.Click{Variant: -1})
+	require.NoError(t, err)
+	require.False(t, allowed, "Expected restored link to keep its click counter")
+	require.Len(t, restored.Events, 1, "Expected restored file to keep one record per short URL")
+}
+
+func TestStorageFile_RegisterClickCoalesced(t *testing.T) {
+	c := &config.Config{URLStorageFile: filepath.Join(t.TempDir(), "urls.json")}
+
+	storageFile := NewStorageFile(c)
+	require.NotNil(t, storageFile)
+	shortID, err := storageFile.UpdateData(nil, "http://example.com/popular", "user123", models.LinkOptions{})
+	require.NoError(t, err)
+	<-storageFile.Events
+
+	for i := 0; i < 2*cap(storageFile.Events); i++ {
+		allowed, err := storageFile.RegisterClick(shortID, models.Click{Variant: -1})
+		require.NoError(t, err)
+		require.True(t, allowed)
+	}
+	require.Empty(t, storageFile.Events, "Expected clicks not to be saved one by one")
+
+	storageFile.flush()
+	require.Len(t, storageFile.Events, 1)
+	changed := <-storageFile.Events
+	require.Equal(t, 2*cap(storageFile.Events), changed[shortID].Clicks, "Expected one record with all clicks")
+
+	storageFile.flush()
+	require.Empty(t, storageFile.Events, "Expected saved clicks not to be saved again")
+
+	limitedID, err := storageFile.UpdateData(nil, "http://example.com/limited", "user123", models.LinkOptions{MaxClicks: 5})
+	require.NoError(t, err)
+	<-storageFile.Events
+	allowed, err := storageFile.RegisterClick(limitedID, models.Click{Variant: -1})
+	require.NoError(t, err)
+	require.True(t, allowed)
+	require.Len(t, storageFile.Events, 1, "Expected clicks of a link with a click limit to be saved at once")
+}
+
+func TestStorageFile_CloseSavesClicks(t *testing.T) {
+	c := &config.Config{URLStorageFile: filepath.Join(t.TempDir(), "urls.json")}
+
+	storageFile := NewStorageFile(c)
+	require.NotNil(t, storageFile)
+	AutoSave(storageFile, zap.NewNop().Sugar())
+	require.NoError(t, storageFile.SaveWebhook(models.Webhook{ID: "hook1", UserID: "user123", URL: "http://hooks.example"}))
+	shortID, err := storageFile.UpdateData(nil, "http://example.com/popular", "user123", models.LinkOptions{})
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = storageFile.RegisterClick(shortID, models.Click{Variant: -1})
+		require.NoError(t, err)
+	}
+	require.NoError(t, storageFile.Close())
+	require.NoError(t, storageFile.Close(), "Expected Close to be idempotent")
+
+	restored := NewStorageFile(c)
+	require.NotNil(t, restored)
+	require.NoError(t, RestoreURLstorage(c, restored))
+	opts, err := restored.GetLinkOptions(shortID)
+	require.NoError(t, err)
+	require.Equal(t, 3, opts.Clicks, "Expected Close to save the clicks")
+	now := time.Now().Add(time.Minute)
+	claimed, err := restored.ClaimWebhookDeliveries(now, now.Add(time.Minute), 10)
+	require.NoError(t, err)
+	require.Len(t, claimed, 3, "Expected Close to save the webhook deliveries of the clicks")
+}
+
+func TestStorageFile_FlushConcurrentEdit(t *testing.T) {
+	c := &config.Config{URLStorageFile: filepath.Join(t.TempDir(), "urls.json")}
+
+	storageFile := NewStorageFile(c)
+	require.NotNil(t, storageFile)
+	shortID, err := storageFile.UpdateData(nil, "http://example.com/edited", "user123", models.LinkOptions{})
+	require.NoError(t, err)
+	<-storageFile.Events
+	_, err = storageFile.RegisterClick(shortID, models.Click{Variant: -1})
+	require.NoError(t, err)
+
+	// an edit while flush sends the clicked link is saved after the copy of flush by the next flush
+	storageFile.mu.Lock()
+	clear(storageFile.clicked)
+	storageFile.inFlight = map[string]models.URLData{shortID: {}}
+	storageFile.mu.Unlock()
+	title := "Edited"
+	require.NoError(t, storageFile.EditLink("user123", shortID, models.LinkEdit{Title: &title}))
+	<-storageFile.Events
+	storageFile.mu.Lock()
+	storageFile.inFlight = nil
+	storageFile.mu.Unlock()
+
+	storageFile.flush()
+	changed := <-storageFile.Events
+	require.Equal(t, "Edited", changed[shortID].Title)
+	require.Equal(t, 1, changed[shortID].Clicks)
+}
+
+func TestStorageDB_RegisterClick(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if e := db.Close(); e != nil {
+			fmt.Println("db.Close() error")
+		}
+	}()
+
+	storageDB := &StorageDB{DBConn: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE urls SET clicks = clicks \\+ 1").WithArgs("once", -1, "").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "original_url"}).AddRow("user123", "http://example.com/once"))
+	mock.ExpectExec("INSERT INTO webhook_deliveries").
+		WithArgs("user123", sqlmock.AnyArg(), sqlmock.AnyArg(), models.EventLinkClicked).WillReturnError(errors.New("outbox is down"))
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE urls SET clicks = clicks \\+ 1").WithArgs("once", -1, "").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "original_url"}).AddRow("user123", "http://example.com/once"))
+	mock.ExpectExec("INSERT INTO webhook_deliveries").
+		WithArgs("user123", sqlmock.AnyArg(), sqlmock.AnyArg(), models.EventLinkClicked).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectQuery("UPDATE urls SET clicks = clicks \\+ 1").WithArgs("once", -1, "").
+		WillReturnRows(sqlmock.NewRows([]string{"user_id", "original_url"}))
+	mock.ExpectRollback()
+
+	allowed, err := storageDB.RegisterClick("once", models.Click{Variant: -1})
+	require.Error(t, err)
+	require.False(t, allowed, "Expected a failed enqueue to roll the click back")
+
+	allowed, err = storageDB.RegisterClick("once", models.Click{Variant: -1})
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	allowed, err = storageDB.RegisterClick("once", models.Click{Variant: -1})
+	require.NoError(t, err)
+	require.False(t, allowed)
+	require.NoError(t, mock.ExpectationsWereMet(), "Unfulfilled expectations")
+}
+
+func TestStorageMemory_Destinations(t *testing.T) {
+	storage := NewStorageMemory()
+	opts := models.LinkOptions{Destinations: []models.Destination{
+		{URL: "http://a.example", Weight: 70},
+		{URL: "http://b.example", Weight: 30},
+	}}
+	shortID, err := storage.UpdateData(nil, "http://example.com/ab", "user123", opts)
+	require.NoError(t, err)
+
+	allowed, err := storage.RegisterClick(shortID, models.Click{Variant: 1, Country: "DE"})
+	require.NoError(t, err)
+	require.True(t, allowed)
+
+	_, err = storage.GetUserLink("other", shortID)
+	require.ErrorIs(t, err, repository.ErrNotFound)
+	require.ErrorIs(t, storage.EditLink("other", shortID, models.LinkEdit{}), repository.ErrNotFound)
+
+	data, err := storage.GetUserLink("user123", shortID)
+	require.NoError(t, err)
+	require.Equal(t, 1, data.Clicks)
+	require.Equal(t, []int{0, 1}, []int{data.Destinations[0].Clicks, data.Destinations[1].Clicks})
+	require.Equal(t, map[string]int{"DE": 1}, data.CountryClicks)
+
+	destinations := []models.Destination{{URL: "http://b.example", Weight: 50}, {URL: "http://c.example", Weight: 50}}
+	require.NoError(t, storage.EditLink("user123", shortID, models.LinkEdit{Destinations: &destinations}))
+
+	data, err = storage.GetUserLink("user123", shortID)
+	require.NoError(t, err)
+	require.Equal(t, []models.Destination{
+		{URL: "http://b.example", Weight: 50, Clicks: 1},
+		{URL: "http://c.example", Weight: 50},
+	}, data.Destinations, "Expected kept destination to carry its clicks over")
+}
+
+func TestStorageDB_EditLink(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if e := db.Close(); e != nil {
+			fmt.Println("db.Close() error")
+		}
+	}()
+
+	storageDB := &StorageDB{DBConn: db}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT destinations, rules, title, notes, tags FROM urls").WithArgs("user123", "ab").
+		WillReturnRows(sqlmock.NewRows([]string{"destinations", "rules", "title", "notes", "tags"}).
+			AddRow([]byte(`[{"url":"http://a.example","weight":1,"clicks":4}]`), []byte(`[{"language":"de","url":"http://de.example"}]`),
+				"Sale", "", []byte(`["old"]`)))
+	mock.ExpectExec("UPDATE urls SET destinations").
+		WithArgs("user123", "ab", `[{"url":"http://a.example","weight":2,"clicks":4}]`, `[{"language":"de","url":"http://de.example"}]`,
+			"Sale", "", `["spring"]`).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	destinations := []models.Destination{{URL: "http://a.example", Weight: 2}}
+	tags := []string{"spring"}
+	require.NoError(t, storageDB.EditLink("user123", "ab", models.LinkEdit{Destinations: &destinations, Tags: &tags}))
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT destinations, rules, title, notes, tags FROM urls").WithArgs("other", "ab").WillReturnError(sql.ErrNoRows)
+	mock.ExpectRollback()
+
+	require.ErrorIs(t, storageDB.EditLink("other", "ab", models.LinkEdit{}), repository.ErrNotFound)
+	require.NoError(t, mock.ExpectationsWereMet(), "Unfulfilled expectations")
+}
+
+func TestStorageMemory_ScanAndDisableLinks(t *testing.T) {
+	storage := NewStorageMemory()
+	first, err := storage.UpdateData(nil, "http://bad.example/a", "user123", models.LinkOptions{})
+	require.NoError(t, err)
+	_, err = storage.UpdateData(nil, "http://good.example/b", "user123", models.LinkOptions{})
+	require.NoError(t, err)
+
+	var scanned []string
+	err = storage.ScanLinks(func(shortID string, data models.URLData) error {
+		scanned = append(scanned, data.OriginalURL)
+		// the storage must not be locked while fn runs
+		return storage.SetLinkDisabled(first, "phishing")
+	})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"http://bad.example/a", "http://good.example/b"}, scanned)
+
+	opts, err := storage.GetLinkOptions(first)
+	require.NoError(t, err)
+	require.Equal(t, "phishing", opts.DisabledReason)
+
+	require.NoError(t, storage.SetLinkDisabled(first, ""))
+	opts, err = storage.GetLinkOptions(first)
+	require.NoError(t, err)
+	require.Empty(t, opts.DisabledReason)
+
+	require.ErrorIs(t, storage.SetLinkDisabled("missing", "phishing"), repository.ErrNotFound)
+}
+
+func TestStorageDB_ScanAndDisableLinks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if e := db.Close(); e != nil {
+			fmt.Println("db.Close() error")
+		}
+	}()
+
+	storageDB := &StorageDB{DBConn: db}
+
+	mock.ExpectQuery("SELECT short_url, user_id, original_url, is_deleted, redirect_type").
+		WillReturnRows(sqlmock.NewRows(append([]string{"short_url", "user_id", "original_url", "is_deleted"}, linkOptionsRowColumns...)).
+			AddRow("ab", "user123", "http://bad.example/a", false, 0, false, "", "", 0, 2,
+				[]byte(`[{"url":"http://a.example","weight":1,"clicks":2}]`), []byte(`[]`), []byte(`{}`), "", "", false, time.Time{}, "", []byte(`[]`)))
+	mock.ExpectExec("UPDATE urls SET disabled_reason").WithArgs("ab", "phishing").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE urls SET disabled_reason").WithArgs("missing", "phishing").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	links := map[string]models.URLData{}
+	require.NoError(t, storageDB.ScanLinks(func(shortID string, data models.URLData) error {
+		links[shortID] = data
+		return nil
+	}))
+	require.Equal(t, "user123", links["ab"].UserID)
+	require.Equal(t, "http://bad.example/a", links["ab"].OriginalURL)
+	require.Equal(t, []models.Destination{{URL: "http://a.example", Weight: 1, Clicks: 2}}, links["ab"].Destinations)
+
+	require.NoError(t, storageDB.SetLinkDisabled("ab", "phishing"))
+	require.ErrorIs(t, storageDB.SetLinkDisabled("missing", "phishing"), repository.ErrNotFound)
+	require.NoError(t, mock.ExpectationsWereMet(), "Unfulfilled expectations")
+}
+
+func TestStorageMemory_ListUserLinks(t *testing.T) {
+	storage := NewStorageMemory()
+	base := time.Date(2025, 3, 12, 10, 0, 0, 0, time.UTC)
+	add := func(originalURL string, opts models.LinkOptions) string {
+		shortID, err := storage.UpdateData(nil, originalURL, "user123", opts)
+		require.NoError(t, err)
+		return shortID
+	}
+	first := add("http://shop.example/a", models.LinkOptions{CreatedAt: base, Clicks: 5})
+	second := add("http://blog.example/b", models.LinkOptions{CreatedAt: base.Add(time.Hour), LinkMetadata: models.LinkMetadata{Title: "Shop news", Tags: []string{"news"}}})
+	third := add("http://docs.example/c", models.LinkOptions{CreatedAt: base.Add(2 * time.Hour), MaxClicks: 1, Clicks: 1})
+	_, err := storage.UpdateData(nil, "http://shop.example/other", "user456", models.LinkOptions{})
+	require.NoError(t, err)
+
+	shortIDs := func(page models.LinkPage) []string {
+		ids := make([]string, 0, len(page.Links))
+		for _, link := range page.Links {
+			ids = append(ids, link.ShortID)
+		}
+		return ids
+	}
+
+	q := models.LinkQuery{Limit: 2, Sort: models.SortCreated}
+	page, err := storage.ListUserLinks("user123", q)
+	require.NoError(t, err)
+	require.Equal(t, []string{third, second}, shortIDs(page))
+	require.NotNil(t, page.Next)
+
+	q.Cursor = page.Next
+	page, err = storage.ListUserLinks("user123", q)
+	require.NoError(t, err)
+	require.Equal(t, []string{first}, shortIDs(page))
+	require.Nil(t, page.Next)
+
+	page, err = storage.ListUserLinks("user123", models.LinkQuery{Limit: 10, Sort: models.SortClicks, Ascending: true})
+	require.NoError(t, err)
+	require.Equal(t, []string{second, third, first}, shortIDs(page))
+
+	page, err = storage.ListUserLinks("user123", models.LinkQuery{Limit: 10, Sort: models.SortCreated, Search: "SHOP"})
+	require.NoError(t, err)
+	require.Equal(t, []string{second, first}, shortIDs(page))
+
+	expired := true
+	page, err = storage.ListUserLinks("user123", models.LinkQuery{Limit: 10, Sort: models.SortCreated, Expired: &expired})
+	require.NoError(t, err)
+	require.Equal(t, []string{third}, shortIDs(page))
+
+	page, err = storage.ListUserLinks("user123", models.LinkQuery{Limit: 10, Sort: models.SortCreated, Tag: "news"})
+	require.NoError(t, err)
+	require.Equal(t, []string{second}, shortIDs(page))
+}
+
+func TestStorageDB_ListUserLinks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if e := db.Close(); e != nil {
+			fmt.Println("db.Close() error")
+		}
+	}()
+
+	storageDB := &StorageDB{DBConn: db}
+	created := time.Date(2025, 3, 12, 10, 0, 0, 0, time.UTC)
+	columns := append([]string{"short_url", "user_id", "workspace_id", "original_url", "is_deleted"}, linkOptionsRowColumns...)
+	row := func(rows *sqlmock.Rows, shortID string, clicks int) *sqlmock.Rows {
+		return rows.AddRow(shortID, "user123", "", "http://shop.example/"+shortID, false, 0, false, "", "", 0, clicks,
+			[]byte(`[]`), []byte(`[]`), []byte(`{}`), "", "Shop", false, created, "", []byte(`["news"]`))
+	}
+
+	deleted := false
+	cursor := models.LinkCursor{Sort: models.SortClicks, Clicks: 7, ShortID: "zz"}
+	mock.ExpectQuery(`SELECT short_url, user_id, workspace_id, original_url, is_deleted, redirect_type, .* FROM urls WHERE user_id = \$1 `+
+		`AND is_deleted = \$2 AND tags \? \$3 AND \(strpos\(lower\(original_url\), lower\(\$4\)\) > 0 OR strpos\(lower\(title\), lower\(\$4\)\) > 0\) `+
+		`AND \(clicks, short_url\) < \(\$5, \$6\) ORDER BY clicks DESC, short_url DESC LIMIT \$7`).
+		WithArgs("user123", false, "news", "shop", 7, "zz", 3).
+		WillReturnRows(row(row(row(sqlmock.NewRows(columns), "ab", 5), "cd", 3), "ef", 1))
+
+	q := models.LinkQuery{Limit: 2, Sort: models.SortClicks, Cursor: &cursor, Search: "shop", Tag: "news", Deleted: &deleted}
+	page, err := storageDB.ListUserLinks("user123", q)
+	require.NoError(t, err)
+	require.Len(t, page.Links, 2)
+	require.Equal(t, "ab", page.Links[0].ShortID)
+	require.Equal(t, "user123", page.Links[0].UserID)
+	require.Equal(t, "Shop", page.Links[0].Title)
+	require.Equal(t, []string{"news"}, page.Links[0].Tags)
+	require.Equal(t, &models.LinkCursor{Sort: models.SortClicks, Clicks: 3, ShortID: "cd"}, page.Next)
+
+	mock.ExpectQuery(`FROM urls WHERE user_id = \$1 AND \(created_at, short_url\) > \(\$2, \$3\) ORDER BY created_at ASC, short_url ASC LIMIT \$4`).
+		WithArgs("user123", created, "cd", 101).
+		WillReturnRows(row(sqlmock.NewRows(columns), "ef", 1))
+
+	cursor = models.LinkCursor{Sort: models.SortCreated, Ascending: true, CreatedAt: created, ShortID: "cd"}
+	page, err = storageDB.ListUserLinks("user123", models.LinkQuery{Limit: models.DefaultPageSize, Sort: models.SortCreated, Ascending: true, Cursor: &cursor})
+	require.NoError(t, err)
+	require.Len(t, page.Links, 1)
+	require.Nil(t, page.Next)
+	require.NoError(t, mock.ExpectationsWereMet(), "Unfulfilled expectations")
+}
+
+func TestStorageMemory_UpdateDataAlias(t *testing.T) {
+	storage := NewStorageMemory()
+	shortID, err := storage.UpdateData(nil, "http://example.com/1", "user123", models.LinkOptions{Alias: "promo"})
+	require.NoError(t, err)
+	require.Equal(t, "promo", shortID)
+
+	shortID, err = storage.UpdateData(nil, "http://example.com/2", "user123", models.LinkOptions{Alias: "promo"})
+	require.NoError(t, err)
+	require.NotEqual(t, "promo", shortID)
+
+	data, err := storage.GetUserLink("user123", "promo")
+	require.NoError(t, err)
+	require.Equal(t, "http://example.com/1", data.OriginalURL)
+	require.Empty(t, data.Alias)
+}
+
+func TestStorageMemory_Workspaces(t *testing.T) {
+	storage := NewStorageMemory()
+	created := time.Date(2025, 3, 13, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, storage.CreateWorkspace(models.Workspace{ID: "ws1", Name: "Marketing", CreatedAt: created}, "alice"))
+	require.NoError(t, storage.SetWorkspaceMember(models.WorkspaceMember{WorkspaceID: "ws1", UserID: "bob", Role: models.RoleEditor}))
+	require.NoError(t, storage.SetWorkspaceMember(models.WorkspaceMember{WorkspaceID: "ws1", UserID: "carol", Role: models.RoleViewer}))
+	require.ErrorIs(t, storage.SetWorkspaceMember(models.WorkspaceMember{WorkspaceID: "none", UserID: "bob"}), repository.ErrNotFound)
+
+	workspaces, err := storage.GetUserWorkspaces("bob")
+	require.NoError(t, err)
+	require.Equal(t, []models.WorkspaceMembership{{Workspace: models.Workspace{ID: "ws1", Name: "Marketing", CreatedAt: created}, Role: models.RoleEditor}}, workspaces)
+
+	shared, err := storage.UpdateData(nil, "http://example.com/shared", "alice", models.LinkOptions{})
+	require.NoError(t, err)
+	private, err := storage.UpdateData(nil, "http://example.com/private", "alice", models.LinkOptions{})
+	require.NoError(t, err)
+
+	_, err = storage.MoveLinksToWorkspace("carol", "ws1", []string{shared})
+	require.ErrorIs(t, err, repository.ErrForbidden, "Expected a viewer not to add links")
+	moved, err := storage.MoveLinksToWorkspace("alice", "ws1", []string{shared, "unknown"})
+	require.NoError(t, err)
+	require.Equal(t, []string{shared}, moved)
+
+	page, err := storage.ListWorkspaceLinks("ws1", models.LinkQuery{Limit: 10, Sort: models.SortCreated})
+	require.NoError(t, err)
+	require.Len(t, page.Links, 1)
+	require.Equal(t, shared, page.Links[0].ShortID)
+
+	// the viewer and the non-member cannot delete, the editor deletes the workspace link but not alice's own link
+	deletedIDs, err := storage.BatchDeleteURLs("carol", []string{shared})
+	require.NoError(t, err)
+	require.Empty(t, deletedIDs)
+	deletedIDs, err = storage.BatchDeleteURLs("bob", []string{private})
+	require.NoError(t, err)
+	require.Empty(t, deletedIDs)
+	_, deleted, err := storage.GetData(shared)
+	require.NoError(t, err)
+	require.False(t, deleted)
+	deletedIDs, err = storage.BatchDeleteURLs("bob", []string{shared, private})
+	require.NoError(t, err)
+	require.Equal(t, []string{shared}, deletedIDs)
+	_, deleted, err = storage.GetData(shared)
+	require.NoError(t, err)
+	require.True(t, deleted)
+	_, deleted, err = storage.GetData(private)
+	require.NoError(t, err)
+	require.False(t, deleted)
+
+	// links stay in the workspace when their creator leaves
+	require.NoError(t, storage.RemoveWorkspaceMember("ws1", "alice"))
+	stats, err := storage.GetWorkspaceStats("ws1")
+	require.NoError(t, err)
+	require.Equal(t, models.WorkspaceStats{Links: 1, Deleted: 1, Members: 2}, stats)
+
+	_, err = storage.DeleteWorkspaceURLs("carol", "ws1", []string{shared})
+	require.ErrorIs(t, err, repository.ErrForbidden)
+	_, err = storage.GetWorkspaceRole("ws1", "alice")
+	require.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestStorageFile_WorkspacesRestore(t *testing.T) {
+	c := &config.Config{URLStorageFile: filepath.Join(t.TempDir(), "urls.json")}
+
+	storageFile := NewStorageFile(c)
+	require.NotNil(t, storageFile)
+	require.NoError(t, storageFile.CreateWorkspace(models.Workspace{ID: "ws1", Name: "Marketing"}, "alice"))
+	require.NoError(t, storageFile.SetWorkspaceMember(models.WorkspaceMember{WorkspaceID: "ws1", UserID: "bob", Role: models.RoleViewer}))
+
+	restored := NewStorageFile(c)
+	require.NotNil(t, restored)
+	require.NoError(t, RestoreURLstorage(c, restored))
+
+	members, err := restored.GetWorkspaceMembers("ws1")
+	require.NoError(t, err)
+	require.Len(t, members, 2)
+	role, err := restored.GetWorkspaceRole("ws1", "bob")
+	require.NoError(t, err)
+	require.Equal(t, models.RoleViewer, role)
+}
+
+func TestStorageMemory_AdminActions(t *testing.T) {
+	storage := NewStorageMemory()
+	own, err := storage.UpdateData(nil, "http://example.com/a", "alice", models.LinkOptions{})
+	require.NoError(t, err)
+	shared, err := storage.UpdateData(nil, "http://example.com/b", "alice", models.LinkOptions{})
+	require.NoError(t, err)
+	require.NoError(t, storage.CreateWorkspace(models.Workspace{ID: "ws1"}, "alice"))
+	_, err = storage.MoveLinksToWorkspace("alice", "ws1", []string{shared})
+	require.NoError(t, err)
+
+	links, err := storage.FindLinksByURL("http://example.com/a")
+	require.NoError(t, err)
+	require.Len(t, links, 1)
+	require.Equal(t, own, links[0].ShortID)
+
+	require.NoError(t, storage.TransferLink(shared, "bob"))
+	data, err := storage.GetLink(shared)
+	require.NoError(t, err)
+	require.Equal(t, "bob", data.UserID)
+	require.Equal(t, "ws1", data.WorkspaceID)
+	require.ErrorIs(t, storage.TransferLink("none", "bob"), repository.ErrNotFound)
+
+	_, _, err = storage.SaveUTMTemplate(models.UTMTemplate{ID: "t1", UserID: "alice", Name: "news"})
+	require.NoError(t, err)
+	purged, err := storage.PurgeUser("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+	_, err = storage.GetLink(own)
+	require.ErrorIs(t, err, repository.ErrNotFound)
+	templates, err := storage.GetUTMTemplates("alice")
+	require.NoError(t, err)
+	require.Empty(t, templates)
+	_, err = storage.GetWorkspaceRole("ws1", "alice")
+	require.ErrorIs(t, err, repository.ErrNotFound)
+
+	require.NoError(t, storage.AppendAudit(models.AuditRecord{ID: "r1", ShortID: own, UserID: "alice"}))
+	require.NoError(t, storage.AppendAudit(models.AuditRecord{ID: "r2", UserID: "alice"}))
+	require.NoError(t, storage.AppendAudit(models.AuditRecord{ID: "r3", ShortID: shared, UserID: "bob"}))
+	records, err := storage.ListAudit(models.AuditQuery{UserID: "alice"})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, "r2", records[0].ID, "Expected the newest record first")
+	records, err = storage.ListAudit(models.AuditQuery{Limit: 1})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, "r3", records[0].ID)
+}
+
+func TestStorageMemory_AuditQueryAndPrune(t *testing.T) {
+	storage := NewStorageMemory()
+	start := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+	for i, actor := range []string{"alice", "bob", "alice", models.ActorAdmin} {
+		require.NoError(t, storage.AppendAudit(models.AuditRecord{ID: strconv.Itoa(i), At: start.Add(time.Duration(i) * time.Hour), Actor: actor}))
+	}
+
+	records, err := storage.ListAudit(models.AuditQuery{Actor: "alice", Since: start.Add(time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, "2", records[0].ID)
+	records, err = storage.ListAudit(models.AuditQuery{Until: start.Add(2 * time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, records, 2, "Expected until to be exclusive")
+
+	pruned, err := storage.PruneAudit(start.Add(2 * time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 2, pruned)
+	records, err = storage.ListAudit(models.AuditQuery{})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, "3", records[0].ID)
+}
+
+func TestStorageFile_PurgeAndAuditRestore(t *testing.T) {
+	c := &config.Config{URLStorageFile: filepath.Join(t.TempDir(), "urls.json")}
+
+	storageFile := NewStorageFile(c)
+	require.NotNil(t, storageFile)
+	purgedID, err := storageFile.UpdateData(nil, "http://example.com/a", "alice", models.LinkOptions{})
+	require.NoError(t, err)
+	keptID, err := storageFile.UpdateData(nil, "http://example.com/b", "bob", models.LinkOptions{})
+	require.NoError(t, err)
+	purged, err := storageFile.PurgeUser("alice")
+	require.NoError(t, err)
+	require.Equal(t, 1, purged)
+
+	old := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, storageFile.AppendAudit(models.AuditRecord{ID: "r0", At: old, Action: models.AuditLinkCreate, UserID: "alice"}))
+	require.NoError(t, storageFile.AppendAudit(models.AuditRecord{ID: "r1", At: old.AddDate(0, 0, 2), Action: models.AuditAdminPurge, UserID: "alice"}))
+	pruned, err := storageFile.PruneAudit(old.AddDate(0, 0, 1))
+	require.NoError(t, err)
+	require.Equal(t, 1, pruned)
+	for len(storageFile.Events) > 0 {
+		BackupURLs(storageFile, <-storageFile.Events, 1)
+	}
+
+	restored := NewStorageFile(c)
+	require.NotNil(t, restored)
+	require.NoError(t, RestoreURLstorage(c, restored))
+
+	_, err = restored.GetLink(purgedID)
+	require.ErrorIs(t, err, repository.ErrNotFound, "Expected the purged link to stay removed")
+	_, err = restored.GetLink(keptID)
+	require.NoError(t, err)
+	records, err := restored.ListAudit(models.AuditQuery{UserID: "alice"})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, models.AuditAdminPurge, records[0].Action)
+}
+
+// arrayConverter passes string slices to the mocked database like the pgx driver does.
+type arrayConverter struct{}
+
+func (arrayConverter) ConvertValue(v any) (driver.Value, error) {
+	if list, ok := v.([]string); ok {
+		return list, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+func TestStorageDB_Workspaces(t *testing.T) {
+	db, mock, err := sqlmock.New(sqlmock.ValueConverterOption(arrayConverter{}))
+	require.NoError(t, err)
+	defer func() {
+		if e := db.Close(); e != nil {
+			fmt.Println("db.Close() error")
+		}
+	}()
+
+	storageDB := &StorageDB{DBConn: db}
+
+	mock.ExpectQuery(`UPDATE urls SET is_deleted = TRUE WHERE short_url = ANY\(\$2::text\[\]\) AND NOT is_deleted AND \( `+
+		`\(workspace_id = '' AND user_id = \$1\) OR workspace_id IN \(SELECT workspace_id FROM workspace_members `+
+		`WHERE user_id = \$1 AND role IN \('owner', 'editor'\)\)\) RETURNING short_url`).
+		WithArgs("bob", []string{"ab"}).WillReturnRows(sqlmock.NewRows([]string{"short_url"}).AddRow("ab"))
+	deleted, err := storageDB.BatchDeleteURLs("bob", []string{"ab"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ab"}, deleted)
+
+	mock.ExpectQuery("SELECT role FROM workspace_members").WithArgs("ws1", "carol").
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(models.RoleViewer))
+	_, err = storageDB.MoveLinksToWorkspace("carol", "ws1", []string{"ab"})
+	require.ErrorIs(t, err, repository.ErrForbidden)
+
+	mock.ExpectQuery("SELECT role FROM workspace_members").WithArgs("ws1", "alice").
+		WillReturnRows(sqlmock.NewRows([]string{"role"}).AddRow(models.RoleOwner))
+	mock.ExpectQuery("UPDATE urls SET workspace_id = \\$2 .* RETURNING short_url").WithArgs("alice", "ws1", []string{"ab", "cd"}).
+		WillReturnRows(sqlmock.NewRows([]string{"short_url"}).AddRow("ab").AddRow("cd"))
+	moved, err := storageDB.MoveLinksToWorkspace("alice", "ws1", []string{"ab", "cd"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"ab", "cd"}, moved)
+
+	mock.ExpectQuery("SELECT count").WithArgs("none").
+		WillReturnRows(sqlmock.NewRows([]string{"links", "deleted", "clicks", "members"}).AddRow(0, 0, 0, 0))
+	_, err = storageDB.GetWorkspaceStats("none")
+	require.ErrorIs(t, err, repository.ErrNotFound)
+	require.NoError(t, mock.ExpectationsWereMet(), "Unfulfilled expectations")
+}
+
+func TestStorageDB_AdminActions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if e := db.Close(); e != nil {
+			fmt.Println("db.Close() error")
+		}
+	}()
+
+	storageDB := &StorageDB{DBConn: db}
+
+	mock.ExpectQuery("SELECT user_id, workspace_id, original_url, is_deleted, .* FROM urls WHERE short_url=\\$1").WithArgs("ab").
+		WillReturnRows(sqlmock.NewRows(append([]string{"user_id", "workspace_id", "original_url", "is_deleted"}, linkOptionsRowColumns...)).
+			AddRow("alice", "ws1", "http://example.com", false, 0, false, "", "", 0, 0, nil, nil, nil, "phishing", "", false, time.Time{}, "", nil))
+	data, err := storageDB.GetLink("ab")
+	require.NoError(t, err)
+	require.Equal(t, "alice", data.UserID)
+	require.Equal(t, "ws1", data.WorkspaceID)
+	require.Equal(t, "phishing", data.DisabledReason)
+
+	mock.ExpectExec("UPDATE urls SET user_id = \\$2 WHERE short_url = \\$1").WithArgs("none", "bob").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	require.ErrorIs(t, storageDB.TransferLink("none", "bob"), repository.ErrNotFound)
+
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM urls WHERE user_id = \\$1 AND workspace_id = ''").WithArgs("alice").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("DELETE FROM utm_templates").WithArgs("alice").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM webhooks").WithArgs("alice").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM workspace_members").WithArgs("alice").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	purged, err := storageDB.PurgeUser("alice")
+	require.NoError(t, err)
+	require.Equal(t, 2, purged)
+
+	at := time.Date(2025, 3, 14, 12, 0, 0, 0, time.UTC)
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs("r1", at, models.ActorAdmin, "", "", models.AuditAdminPurge, "", "alice", nil, []byte(`{"purged":2}`)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, storageDB.AppendAudit(models.AuditRecord{
+		ID: "r1", At: at, Actor: models.ActorAdmin, Action: models.AuditAdminPurge, UserID: "alice", After: []byte(`{"purged":2}`),
+	}))
+
+	since := at.Add(-time.Hour)
+	mock.ExpectQuery("SELECT id, at, actor, .* FROM audit_log .* ORDER BY at DESC, id DESC LIMIT \\$6").
+		WithArgs("", "alice", "", since, nil, 10).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "at", "actor", "ip", "user_agent", "action", "short_id", "user_id", "before", "after"}).
+			AddRow("r1", at, models.ActorAdmin, "", "", models.AuditAdminPurge, "", "alice", nil, []byte(`{"purged":2}`)))
+	records, err := storageDB.ListAudit(models.AuditQuery{UserID: "alice", Since: since, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.JSONEq(t, `{"purged":2}`, string(records[0].After))
+	require.Nil(t, records[0].Before)
+
+	mock.ExpectExec("DELETE FROM audit_log WHERE at < \\$1").WithArgs(at).WillReturnResult(sqlmock.NewResult(0, 3))
+	pruned, err := storageDB.PruneAudit(at)
+	require.NoError(t, err)
+	require.Equal(t, 3, pruned)
+
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestStorageMemory_DomainNamespaces(t *testing.T) {
+	storage := NewStorageMemory()
+	created := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+	saved, isNew, err := storage.SaveDomain(models.Domain{Name: "go.brand-a.com", UserIDs: []string{"alice"}, CreatedAt: created})
+	require.NoError(t, err)
+	require.True(t, isNew)
+	saved, isNew, err = storage.SaveDomain(models.Domain{Name: "go.brand-a.com", WorkspaceIDs: []string{"ws1"}, CreatedAt: time.Now()})
+	require.NoError(t, err)
+	require.False(t, isNew)
+	require.Equal(t, created, saved.CreatedAt, "Expected the creation time of a replaced domain to be kept")
+	d, err := storage.GetDomain("go.brand-a.com")
+	require.NoError(t, err)
+	require.Empty(t, d.UserIDs)
+	require.Equal(t, []string{"ws1"}, d.WorkspaceIDs)
+
+	// the same alias is free in every namespace
+	shortID, err := storage.UpdateData(nil, "http://example.com/1", "alice", models.LinkOptions{Alias: "promo"})
+	require.NoError(t, err)
+	require.Equal(t, "promo", shortID)
+	shortID, err = storage.UpdateData(nil, "http://example.com/2", "alice", models.LinkOptions{Alias: "promo", Domain: "go.brand-a.com"})
+	require.NoError(t, err)
+	require.Equal(t, "promo@go.brand-a.com", shortID)
+	originalURL, _, err := storage.GetData("promo@go.brand-a.com")
+	require.NoError(t, err)
+	require.Equal(t, "http://example.com/2", originalURL)
+
+	shortID, err = storage.UpdateData(nil, "http://example.com/3", "alice", models.LinkOptions{Domain: "go.brand-a.com"})
+	require.NoError(t, err)
+	id, domain := models.SplitShortID(shortID)
+	require.NotEmpty(t, id)
+	require.Equal(t, "go.brand-a.com", domain)
+
+	require.NoError(t, storage.DeleteDomain("go.brand-a.com"))
+	require.ErrorIs(t, storage.DeleteDomain("go.brand-a.com"), repository.ErrNotFound)
+	domains, err := storage.ListDomains()
+	require.NoError(t, err)
+	require.Empty(t, domains)
+}
+
+func TestStorageFile_DomainsRestore(t *testing.T) {
+	c := &config.Config{URLStorageFile: filepath.Join(t.TempDir(), "urls.json")}
+
+	storageFile := NewStorageFile(c)
+	require.NotNil(t, storageFile)
+	_, _, err := storageFile.SaveDomain(models.Domain{Name: "l.brand-b.io", UserIDs: []string{"bob"}})
+	require.NoError(t, err)
+	_, _, err = storageFile.SaveDomain(models.Domain{Name: "go.brand-a.com"})
+	require.NoError(t, err)
+	require.NoError(t, storageFile.DeleteDomain("go.brand-a.com"))
+
+	restored := NewStorageFile(c)
+	require.NotNil(t, restored)
+	require.NoError(t, RestoreURLstorage(c, restored))
+
+	domains, err := restored.ListDomains()
+	require.NoError(t, err)
+	require.Len(t, domains, 1)
+	require.Equal(t, "l.brand-b.io", domains[0].Name)
+	require.Equal(t, []string{"bob"}, domains[0].UserIDs)
+}
+
+func TestStorageDB_Domains(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if e := db.Close(); e != nil {
+			fmt.Println("db.Close() error")
+		}
+	}()
+
+	storageDB := &StorageDB{DBConn: db}
+	created := time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	mock.ExpectQuery(`INSERT INTO domains \(name, user_ids, workspace_ids, created_at\) VALUES \(\$1, \$2, \$3, \$4\) `+
+		`ON CONFLICT \(name\) DO UPDATE SET user_ids = EXCLUDED.user_ids, workspace_ids = EXCLUDED.workspace_ids `+
+		`RETURNING created_at, xmax = 0`).
+		WithArgs("go.brand-a.com", `["alice"]`, `[]`, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"created_at", "created"}).AddRow(created, false))
+	saved, isNew, err := storageDB.SaveDomain(models.Domain{Name: "go.brand-a.com", UserIDs: []string{"alice"}, CreatedAt: time.Now()})
+	require.NoError(t, err)
+	require.False(t, isNew)
+	require.Equal(t, created, saved.CreatedAt)
+
+	mock.ExpectQuery("SELECT name, user_ids, workspace_ids, created_at FROM domains WHERE name = \\$1").
+		WithArgs("go.brand-a.com").
+		WillReturnRows(sqlmock.NewRows([]string{"name", "user_ids", "workspace_ids", "created_at"}).
+			AddRow("go.brand-a.com", []byte(`["alice"]`), []byte(`["ws1"]`), created))
+	d, err := storageDB.GetDomain("go.brand-a.com")
+	require.NoError(t, err)
+	require.Equal(t, []string{"alice"}, d.UserIDs)
+	require.Equal(t, []string{"ws1"}, d.WorkspaceIDs)
+
+	mock.ExpectQuery("SELECT name, user_ids, workspace_ids, created_at FROM domains WHERE name = \\$1").
+		WithArgs("l.brand-b.io").WillReturnError(sql.ErrNoRows)
+	_, err = storageDB.GetDomain("l.brand-b.io")
+	require.ErrorIs(t, err, repository.ErrNotFound)
+
+	mock.ExpectExec("DELETE FROM domains WHERE name = \\$1").WithArgs("l.brand-b.io").WillReturnResult(sqlmock.NewResult(0, 0))
+	require.ErrorIs(t, storageDB.DeleteDomain("l.brand-b.io"), repository.ErrNotFound)
+	require.NoError(t, mock.ExpectationsWereMet(), "Unfulfilled expectations")
+}
+
+func TestStorageMemory_RenameLink(t *testing.T) {
+	storage := NewStorageMemory()
+	_, err := storage.UpdateData(nil, "http://example.com/1", "alice", models.LinkOptions{Alias: "api"})
+	require.NoError(t, err)
+	_, err = storage.UpdateData(nil, "http://example.com/2", "alice", models.LinkOptions{Alias: "cd"})
+	require.NoError(t, err)
+
+	require.ErrorIs(t, storage.RenameLink("api", "cd"), repository.ErrShortIDTaken)
+	require.ErrorIs(t, storage.RenameLink("missing", "ef"), repository.ErrNotFound)
+	require.NoError(t, storage.RenameLink("api", "ab"))
+
+	originalURL, _, err := storage.GetData("ab")
+	require.NoError(t, err)
+	require.Equal(t, "http://example.com/1", originalURL)
+	_, err = storage.GetLink("api")
+	require.ErrorIs(t, err, repository.ErrNotFound)
+}
+
+func TestStorageDB_RenameLink(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if e := db.Close(); e != nil {
+			fmt.Println("db.Close() error")
+		}
+	}()
+
+	storageDB := &StorageDB{DBConn: db}
+	rename := `UPDATE urls SET short_url = \$2 WHERE short_url = \$1 AND NOT EXISTS \(SELECT 1 FROM urls WHERE short_url = \$2\)`
+	exists := `SELECT EXISTS \(SELECT 1 FROM urls WHERE short_url = \$1\)`
+
+	mock.ExpectExec(rename).WithArgs("api", "ab").WillReturnResult(sqlmock.NewResult(0, 1))
+	require.NoError(t, storageDB.RenameLink("api", "ab"))
+
+	mock.ExpectExec(rename).WithArgs("api", "cd").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(exists).WithArgs("api").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	require.ErrorIs(t, storageDB.RenameLink("api", "cd"), repository.ErrShortIDTaken)
+
+	mock.ExpectExec(rename).WithArgs("missing", "ef").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(exists).WithArgs("missing").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	require.ErrorIs(t, storageDB.RenameLink("missing", "ef"), repository.ErrNotFound)
+
+	require.NoError(t, mock.ExpectationsWereMet(), "Unfulfilled expectations")
+}
+
+func TestStorageDB_NextSequence(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if e := db.Close(); e != nil {
+			fmt.Println("db.Close() error")
+		}
+	}()
+
+	storageDB := &StorageDB{DBConn: db}
+	mock.ExpectQuery(`SELECT nextval\('short_id_seq'\)`).WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(42))
+	n, err := storageDB.NextSequence()
+	require.NoError(t, err)
+	require.Equal(t, uint64(42), n)
+	require.NoError(t, mock.ExpectationsWereMet(), "Unfulfilled expectations")
+}
+
+// fixedGenerator returns its IDs in order, repeating the last one, and ignores the taken check,
+// so the storages have to detect the collisions themselves.
+type fixedGenerator struct {
+	ids  []string
+	next int
+}
+
+func (g *fixedGenerator) Generate(func(shortID string) (bool, error)) (string, error) {
+	id := g.ids[min(g.next, len(g.ids)-1)]
+	g.next++
+	return id, nil
+}
+
+// useGenerator makes the storages generate the short IDs with g until the end of the test.
+func useGenerator(t *testing.T, g repository.ShortIDGenerator) {
+	repository.SetShortIDGenerator(g)
+	t.Cleanup(func() {
+		def, err := repository.NewShortIDGenerator(repository.ShortIDOptions{}, nil)
+		require.NoError(t, err)
+		repository.SetShortIDGenerator(def)
+	})
+}
+
+func TestStorageMemory_UpdateDataCollision(t *testing.T) {
+	storage := NewStorageMemory()
+	_, err := storage.UpdateData(nil, "http://example.com/1", "alice", models.LinkOptions{Alias: "aa"})
+	require.NoError(t, err)
+
+	useGenerator(t, &fixedGenerator{ids: []string{"aa", "aa", "bb"}})
+	shortID, err := storage.UpdateData(nil, "http://example.com/2", "bob", models.LinkOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "bb", shortID)
+	originalURL, _, err := storage.GetData("aa")
+	require.NoError(t, err)
+	require.Equal(t, "http://example.com/1", originalURL, "Expected the colliding link not to be overwritten")
+
+	useGenerator(t, &fixedGenerator{ids: []string{"aa"}})
+	_, err = storage.UpdateData(nil, "http://example.com/3", "bob", models.LinkOptions{})
+	require.ErrorIs(t, err, repository.ErrShortIDExhausted)
+	require.NotErrorIs(t, err, repository.ErrDuplicateURL)
+}
+
+func TestStorageDB_UpdateDataCollision(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if e := db.Close(); e != nil {
+			fmt.Println("db.Close() error")
+		}
+	}()
+	storageDB := &StorageDB{DBConn: db}
+
+	insertArgs := func(shortID string) []driver.Value {
+		args := make([]driver.Value, 15)
+		for i := range args {
+			args[i] = sqlmock.AnyArg()
+		}
+		args[0], args[1], args[2] = "alice", shortID, "http://example.com/1"
+		return args
+	}
+	collision := &pgconn.PgError{Code: "23505", ConstraintName: "urls_pkey"}
+
+	// the generated ID taken by a concurrent insert is replaced
+	useGenerator(t, &fixedGenerator{ids: []string{"aa", "bb"}})
+	mock.ExpectQuery("INSERT INTO urls").WithArgs(insertArgs("aa")...).WillReturnError(collision)
+	mock.ExpectQuery("INSERT INTO urls").WithArgs(insertArgs("bb")...).
+		WillReturnRows(sqlmock.NewRows([]string{"short_url"}).AddRow("bb"))
+	shortID, err := storageDB.UpdateData(nil, "http://example.com/1", "alice", models.LinkOptions{})
+	require.NoError(t, err)
+	require.Equal(t, "bb", shortID)
+
+	// a conflict on the original URL is a duplicate, not a collision
+	useGenerator(t, &fixedGenerator{ids: []string{"cc"}})
+	mock.ExpectQuery("INSERT INTO urls").WithArgs(insertArgs("cc")...).WillReturnRows(sqlmock.NewRows([]string{"short_url"}))
+	mock.ExpectQuery("SELECT short_url FROM urls WHERE original_url").WithArgs("http://example.com/1").
+		WillReturnRows(sqlmock.NewRows([]string{"short_url"}).AddRow("bb"))
+	shortID, err = storageDB.UpdateData(nil, "http://example.com/1", "alice", models.LinkOptions{})
+	require.ErrorIs(t, err, repository.ErrDuplicateURL)
+	require.Equal(t, "bb", shortID)
+
+	// the retries are bounded
+	useGenerator(t, &fixedGenerator{ids: []string{"aa"}})
+	for range repository.MaxShortIDAttempts {
+		mock.ExpectQuery("INSERT INTO urls").WithArgs(insertArgs("aa")...).WillReturnError(collision)
+	}
+	_, err = storageDB.UpdateData(nil, "http://example.com/1", "alice", models.LinkOptions{})
+	require.ErrorIs(t, err, repository.ErrShortIDExhausted)
+
+	// other errors are not retried
+	useGenerator(t, &fixedGenerator{ids: []string{"dd"}})
+	mock.ExpectQuery("INSERT INTO urls").WithArgs(insertArgs("dd")...).WillReturnError(sql.ErrConnDone)
+	_, err = storageDB.UpdateData(nil, "http://example.com/1", "alice", models.LinkOptions{})
+	require.ErrorIs(t, err, sql.ErrConnDone)
+
+	require.NoError(t, mock.ExpectationsWereMet(), "Unfulfilled expectations")
+}
+
+func TestMakeShortURLUniqueMigration(t *testing.T) {
+	const name = "20250317120000_make_short_url_unique.sql"
+	migration, err := fs.ReadFile(embedMigrations, "db/migrations/"+name)
+	require.NoError(t, err)
+	// the built-in UUID generator needs PostgreSQL 13 or pgcrypto
+	require.NotContains(t, string(migration), "gen_random_uuid")
+
+	db, mock, err := sqlmock.New()
+	require.NoError(t, err)
+	defer func() {
+		if e := db.Close(); e != nil {
+			fmt.Println("db.Close() error")
+		}
+	}()
+
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, fstest.MapFS{name: {Data: migration}},
+		goose.WithDisableVersioning(true))
+	require.NoError(t, err)
+
+	// the fix-up renames the links sharing a short ID before the short ID becomes the primary key
+	mock.ExpectBegin()
+	mock.ExpectExec(`(?s)^DO \$\$.*PARTITION BY short_url ORDER BY created_at, id.*WHERE n > 1` +
+		`.*EXIT WHEN NOT EXISTS \(SELECT 1 FROM urls WHERE short_url = new_short_url\)` +
+		`.*INSERT INTO audit_log .*VALUES \(md5\(random\(\)::text \|\| clock_timestamp\(\)::text \|\| dup\.id::text\)::uuid::text, 'system', 'link\.rename'.*END \$\$;` +
+		`.*ALTER TABLE urls DROP CONSTRAINT urls_pkey;\s*ALTER TABLE urls ADD CONSTRAINT urls_pkey PRIMARY KEY \(short_url\);` +
+		`.*CREATE INDEX IF NOT EXISTS urls_user_id_created_at_idx`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	_, err = provider.Up(context.Background())
+	require.NoError(t, err)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`(?s)DROP INDEX IF EXISTS urls_user_id_clicks_idx;` +
+		`.*ALTER TABLE urls DROP CONSTRAINT IF EXISTS urls_pkey;\s*ALTER TABLE urls ADD CONSTRAINT urls_pkey PRIMARY KEY \(user_id, short_url\);$`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	_, err = provider.Down(context.Background())
+	require.NoError(t, err)
+	require.NoError(t, mock.ExpectationsWereMet(), "Unfulfilled expectations")
+}
@@ -0,0 +1,284 @@
+package storage
+
+import (
+	"shortener/internal/domain/models"
+	"shortener/internal/repository"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// maxFinishedDeliveries - number of delivered and dead deliveries kept per webhook by the memory and file storages;
+// older ones are dropped.
+const maxFinishedDeliveries = 1000
+
+// webhookOutbox keeps webhooks and the outbox of their deliveries in memory for the memory and file storages.
+type webhookOutbox struct {
+	hooks      map[string]models.Webhook
+	deliveries map[string]models.WebhookDelivery
+	mu         sync.Mutex
+}
+
+// webhookSnapshot - webhooks and deliveries saved by the file storage.
+type webhookSnapshot struct {
+	Webhooks   []models.Webhook         `json:"webhooks"`
+	Deliveries []models.WebhookDelivery `json:"deliveries"`
+}
+
+// newWebhookOutbox creates an empty outbox without webhooks.
+func newWebhookOutbox() *webhookOutbox {
+	return &webhookOutbox{
+		hooks:      make(map[string]models.Webhook),
+		deliveries: make(map[string]models.WebhookDelivery),
+	}
+}
+
+// saveHook stores the webhook.
+func (o *webhookOutbox) saveHook(hook models.Webhook) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.hooks[hook.ID] = hook
+}
+
+// getHook returns the webhook by its identifier.
+func (o *webhookOutbox) getHook(id string) (models.Webhook, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	hook, exists := o.hooks[id]
+	if !exists {
+		return models.Webhook{}, repository.ErrNotFound
+	}
+	return hook, nil
+}
+
+// listHooks returns the user's webhooks, oldest first.
+func (o *webhookOutbox) listHooks(userID string) []models.Webhook {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	hooks := []models.Webhook{}
+	for _, hook := range o.hooks {
+		if hook.UserID == userID {
+			hooks = append(hooks, hook)
+		}
+	}
+	sort.Slice(hooks, func(i, j int) bool {
+		if !hooks[i].CreatedAt.Equal(hooks[j].CreatedAt) {
+			return hooks[i].CreatedAt.Before(hooks[j].CreatedAt)
+		}
+		return hooks[i].ID < hooks[j].ID
+	})
+	return hooks
+}
+
+// deleteHook removes the user's webhook and its deliveries.
+func (o *webhookOutbox) deleteHook(userID, id string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	hook, exists := o.hooks[id]
+	if !exists || hook.UserID != userID {
+		return repository.ErrNotFound
+	}
+	delete(o.hooks, id)
+	for deliveryID, d := range o.deliveries {
+		if d.WebhookID == id {
+			delete(o.deliveries, deliveryID)
+		}
+	}
+	return nil
+}
+
+// purge removes all webhooks of the user and their deliveries.
+func (o *webhookOutbox) purge(userID string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for id, hook := range o.hooks {
+		if hook.UserID == userID {
+			delete(o.hooks, id)
+		}
+	}
+	for id, d := range o.deliveries {
+		if d.UserID == userID {
+			delete(o.deliveries, id)
+		}
+	}
+}
+
+// enqueue adds a pending delivery of the event for every webhook of its user subscribed to its type
+// and returns the number of added deliveries.
+func (o *webhookOutbox) enqueue(event models.WebhookEvent) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	n := 0
+	for _, hook := range o.hooks {
+		if hook.UserID != event.UserID || !hook.Subscribed(event.Type) {
+			continue
+		}
+		d := models.WebhookDelivery{
+			ID:            uuid.New().String(),
+			WebhookID:     hook.ID,
+			UserID:        hook.UserID,
+			Event:         event,
+			Status:        models.DeliveryPending,
+			NextAttemptAt: event.OccurredAt,
+			CreatedAt:     event.OccurredAt,
+		}
+		o.deliveries[d.ID] = d
+		n++
+	}
+	return n
+}
+
+// claim returns up to limit pending deliveries due at now, earliest first, and postpones them until leaseUntil.
+func (o *webhookOutbox) claim(now, leaseUntil time.Time, limit int) []models.WebhookDelivery {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	due := []models.WebhookDelivery{}
+	for _, d := range o.deliveries {
+		if d.Status == models.DeliveryPending && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	for i := range due {
+		d := o.deliveries[due[i].ID]
+		d.NextAttemptAt = leaseUntil
+		o.deliveries[d.ID] = d
+		due[i].Attempts = append([]models.DeliveryAttempt(nil), due[i].Attempts...)
+	}
+	return due
+}
+
+// record appends the attempt to the delivery and sets its status and the time of the next attempt.
+func (o *webhookOutbox) record(id string, attempt models.DeliveryAttempt, status string, next time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	d, exists := o.deliveries[id]
+	if !exists {
+		return repository.ErrNotFound
+	}
+	d.Attempts = append(d.Attempts, attempt)
+	d.Status = status
+	d.NextAttemptAt = next
+	o.deliveries[id] = d
+
+	if status != models.DeliveryPending {
+		o.pruneFinished(d.WebhookID)
+	}
+	return nil
+}
+
+// pruneFinished drops the oldest finished deliveries of the webhook above maxFinishedDeliveries.
+func (o *webhookOutbox) pruneFinished(webhookID string) {
+	finished := []models.WebhookDelivery{}
+	for _, d := range o.deliveries {
+		if d.WebhookID == webhookID && d.Status != models.DeliveryPending {
+			finished = append(finished, d)
+		}
+	}
+	if len(finished) <= maxFinishedDeliveries {
+		return
+	}
+	sortNewestFirst(finished)
+	for _, d := range finished[maxFinishedDeliveries:] {
+		delete(o.deliveries, d.ID)
+	}
+}
+
+// listDeliveries returns up to limit latest deliveries of the user's webhook, newest first.
+func (o *webhookOutbox) listDeliveries(userID, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	hook, exists := o.hooks[webhookID]
+	if !exists || hook.UserID != userID {
+		return nil, repository.ErrNotFound
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	for _, d := range o.deliveries {
+		if d.WebhookID == webhookID {
+			deliveries = append(deliveries, d)
+		}
+	}
+	sortNewestFirst(deliveries)
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+// sortNewestFirst sorts the deliveries by creation time, newest first.
+func sortNewestFirst(deliveries []models.WebhookDelivery) {
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID > deliveries[j].ID
+	})
+}
+
+// snapshot returns all webhooks and deliveries.
+func (o *webhookOutbox) snapshot() webhookSnapshot {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	s := webhookSnapshot{
+		Webhooks:   make([]models.Webhook, 0, len(o.hooks)),
+		Deliveries: make([]models.WebhookDelivery, 0, len(o.deliveries)),
+	}
+	for _, hook := range o.hooks {
+		s.Webhooks = append(s.Webhooks, hook)
+	}
+	for _, d := range o.deliveries {
+		s.Deliveries = append(s.Deliveries, d)
+	}
+	return s
+}
+
+// restore replaces all webhooks and deliveries with the saved ones.
+// The user of an event is not saved with it and is taken from its delivery.
+func (o *webhookOutbox) restore(s webhookSnapshot) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.hooks = make(map[string]models.Webhook, len(s.Webhooks))
+	for _, hook := range s.Webhooks {
+		o.hooks[hook.ID] = hook
+	}
+	o.deliveries = make(map[string]models.WebhookDelivery, len(s.Deliveries))
+	for _, d := range s.Deliveries {
+		d.Event.UserID = d.UserID
+		o.deliveries[d.ID] = d
+	}
+}
+
+// clickEvent returns the event of a counted click via the link.
+func clickEvent(shortID string, data models.URLData, click models.Click) models.WebhookEvent {
+	return models.WebhookEvent{
+		ID:         uuid.New().String(),
+		Type:       models.EventLinkClicked,
+		UserID:     data.UserID,
+		OccurredAt: time.Now().UTC(),
+		Link:       models.EventLink{ShortID: shortID, OriginalURL: data.OriginalURL},
+		Click:      &models.EventClick{Country: click.Country, Destination: click.Variant},
+	}
+}
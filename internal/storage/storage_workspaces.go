@@ -0,0 +1,237 @@
+package storage
+
+import (
+	"shortener/internal/domain/models"
+	"shortener/internal/repository"
+	"sort"
+	"sync"
+)
+
+// workspaceSet keeps workspaces and their members in memory for the memory and file storages.
+type workspaceSet struct {
+	workspaces map[string]models.Workspace
+	// members: workspace ID -> user ID -> member.
+	members map[string]map[string]models.WorkspaceMember
+	mu      sync.Mutex
+}
+
+// workspaceSnapshot - workspaces and members saved by the file storage.
+type workspaceSnapshot struct {
+	Workspaces []models.Workspace       `json:"workspaces"`
+	Members    []models.WorkspaceMember `json:"members"`
+}
+
+// newWorkspaceSet creates an empty set of workspaces.
+func newWorkspaceSet() *workspaceSet {
+	return &workspaceSet{
+		workspaces: make(map[string]models.Workspace),
+		members:    make(map[string]map[string]models.WorkspaceMember),
+	}
+}
+
+// create stores the workspace with the owner as its only member.
+func (w *workspaceSet) create(ws models.Workspace, owner models.WorkspaceMember) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.workspaces[ws.ID] = ws
+	w.members[ws.ID] = map[string]models.WorkspaceMember{owner.UserID: owner}
+}
+
+// role returns the role of the user in the workspace.
+func (w *workspaceSet) role(workspaceID, userID string) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	member, exists := w.members[workspaceID][userID]
+	if !exists {
+		return "", repository.ErrNotFound
+	}
+	return member.Role, nil
+}
+
+// listForUser returns the workspaces of the user with the user's roles, oldest first.
+func (w *workspaceSet) listForUser(userID string) []models.WorkspaceMembership {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	memberships := []models.WorkspaceMembership{}
+	for id, members := range w.members {
+		if member, exists := members[userID]; exists {
+			memberships = append(memberships, models.WorkspaceMembership{Workspace: w.workspaces[id], Role: member.Role})
+		}
+	}
+	sort.Slice(memberships, func(i, j int) bool {
+		if !memberships[i].CreatedAt.Equal(memberships[j].CreatedAt) {
+			return memberships[i].CreatedAt.Before(memberships[j].CreatedAt)
+		}
+		return memberships[i].ID < memberships[j].ID
+	})
+	return memberships
+}
+
+// listMembers returns the members of the workspace in the order they were added.
+func (w *workspaceSet) listMembers(workspaceID string) ([]models.WorkspaceMember, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, exists := w.workspaces[workspaceID]; !exists {
+		return nil, repository.ErrNotFound
+	}
+	members := make([]models.WorkspaceMember, 0, len(w.members[workspaceID]))
+	for _, member := range w.members[workspaceID] {
+		members = append(members, member)
+	}
+	sortMembers(members)
+	return members, nil
+}
+
+// setMember adds the member to its workspace or changes the member's role.
+func (w *workspaceSet) setMember(member models.WorkspaceMember) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	members, exists := w.members[member.WorkspaceID]
+	if !exists {
+		return repository.ErrNotFound
+	}
+	if existing, exists := members[member.UserID]; exists {
+		member.AddedAt = existing.AddedAt
+	}
+	members[member.UserID] = member
+	return nil
+}
+
+// removeMember removes the user from the workspace.
+func (w *workspaceSet) removeMember(workspaceID, userID string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, exists := w.members[workspaceID][userID]; !exists {
+		return repository.ErrNotFound
+	}
+	delete(w.members[workspaceID], userID)
+	return nil
+}
+
+// purge removes the user from all workspaces.
+func (w *workspaceSet) purge(userID string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, members := range w.members {
+		delete(members, userID)
+	}
+}
+
+// sortMembers sorts the members in the order they were added.
+func sortMembers(members []models.WorkspaceMember) {
+	sort.Slice(members, func(i, j int) bool {
+		if !members[i].AddedAt.Equal(members[j].AddedAt) {
+			return members[i].AddedAt.Before(members[j].AddedAt)
+		}
+		return members[i].UserID < members[j].UserID
+	})
+}
+
+// snapshot returns all workspaces and members.
+func (w *workspaceSet) snapshot() workspaceSnapshot {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	s := workspaceSnapshot{
+		Workspaces: make([]models.Workspace, 0, len(w.workspaces)),
+		Members:    []models.WorkspaceMember{},
+	}
+	for id, ws := range w.workspaces {
+		s.Workspaces = append(s.Workspaces, ws)
+		for _, member := range w.members[id] {
+			s.Members = append(s.Members, member)
+		}
+	}
+	return s
+}
+
+// restore replaces all workspaces and members with the saved ones.
+func (w *workspaceSet) restore(s workspaceSnapshot) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.workspaces = make(map[string]models.Workspace, len(s.Workspaces))
+	w.members = make(map[string]map[string]models.WorkspaceMember, len(s.Workspaces))
+	for _, ws := range s.Workspaces {
+		w.workspaces[ws.ID] = ws
+		w.members[ws.ID] = make(map[string]models.WorkspaceMember)
+	}
+	for _, member := range s.Members {
+		if members, exists := w.members[member.WorkspaceID]; exists {
+			members[member.UserID] = member
+		}
+	}
+}
+
+// workspaceStats counts the links of the workspace; members is the number of its members.
+func workspaceStats(urlStorage map[string]models.URLData, workspaceID string, members int) models.WorkspaceStats {
+	stats := models.WorkspaceStats{Members: members}
+	for _, data := range urlStorage {
+		if data.WorkspaceID != workspaceID {
+			continue
+		}
+		stats.Links++
+		stats.Clicks += data.Clicks
+		if data.IsDeleted {
+			stats.Deleted++
+		}
+	}
+	return stats
+}
+
+// canDelete returns the check of models.URLData.CanDelete for the user with the roles of the set.
+func (w *workspaceSet) canDelete(userID string) func(data models.URLData) bool {
+	return func(data models.URLData) bool {
+		role, _ := w.role(data.WorkspaceID, userID)
+		return data.CanDelete(userID, role)
+	}
+}
+
+// moveLinks hands the links created by the user and not owned by a workspace over to the workspace.
+// Returns the short IDs of the moved links.
+func moveLinks(urlStorage map[string]models.URLData, userID, workspaceID string, shortIDs []string) []string {
+	moved := []string{}
+	for _, shortID := range shortIDs {
+		data, exists := urlStorage[shortID]
+		if !exists || data.UserID != userID || data.WorkspaceID != "" {
+			continue
+		}
+		data.WorkspaceID = workspaceID
+		urlStorage[shortID] = data
+		moved = append(moved, shortID)
+	}
+	return moved
+}
+
+// deleteLinks marks the links allowed by the check as deleted and returns their short IDs.
+func deleteLinks(urlStorage map[string]models.URLData, shortIDs []string, allowed func(data models.URLData) bool) []string {
+	deleted := []string{}
+	for _, shortID := range shortIDs {
+		data, exists := urlStorage[shortID]
+		if !exists || data.IsDeleted || !allowed(data) {
+			continue
+		}
+		data.IsDeleted = true
+		urlStorage[shortID] = data
+		deleted = append(deleted, shortID)
+	}
+	return deleted
+}
+
+// workspaceLinks returns the links of the workspace.
+func workspaceLinks(urlStorage map[string]models.URLData, workspaceID string) []models.UserLink {
+	links := make([]models.UserLink, 0)
+	for shortID, data := range urlStorage {
+		if data.WorkspaceID == workspaceID {
+			links = append(links, models.UserLink{ShortID: shortID, URLData: data})
+		}
+	}
+	return links
+}
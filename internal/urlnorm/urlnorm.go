@@ -0,0 +1,165 @@
+// Package urlnorm validates destination URLs of short links and converts them to a normalized form,
+// so that equal destinations written differently are stored once.
+package urlnorm
+
+import (
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// MaxLength - maximum length of a destination URL before and after normalization.
+const MaxLength = 2048
+
+// Reasons why a destination URL is rejected.
+const (
+	CodeEmpty             = "empty"
+	CodeTooLong           = "too_long"
+	CodeInvalidCharacters = "invalid_characters"
+	CodeMalformed         = "malformed"
+	CodeSchemeNotAllowed  = "scheme_not_allowed"
+	CodeHostRequired      = "host_required"
+	CodeInvalidHost       = "invalid_host"
+	CodeInvalidPort       = "invalid_port"
+)
+
+// allowedSchemes - schemes of destination URLs with their default ports.
+var allowedSchemes = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Error - error describing why a destination URL is rejected.
+type Error struct {
+	// Code: machine-readable reason (one of the Code* constants).
+	Code string `json:"code"`
+	// Message: human-readable description.
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Normalize checks the destination URL and returns its normalized form:
+// surrounding whitespace is trimmed, the scheme and host are lower-cased, internationalized
+// host names are converted to punycode and the default port of the scheme is removed.
+// If the URL is rejected, the returned error is an *Error.
+func Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", newError(CodeEmpty, "url is empty")
+	}
+	if len(raw) > MaxLength {
+		return "", newError(CodeTooLong, "url is longer than "+strconv.Itoa(MaxLength)+" bytes")
+	}
+	if !utf8.ValidString(raw) {
+		return "", newError(CodeInvalidCharacters, "url is not valid UTF-8")
+	}
+	for _, r := range raw {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return "", newError(CodeInvalidCharacters, "url contains whitespace or control characters")
+		}
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", newError(CodeMalformed, "url is malformed")
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	defaultPort, ok := allowedSchemes[u.Scheme]
+	if !ok {
+		if u.Scheme == "" {
+			return "", newError(CodeSchemeNotAllowed, "url must be absolute (http or https)")
+		}
+		return "", newError(CodeSchemeNotAllowed, "scheme "+u.Scheme+" is not allowed")
+	}
+	if u.Opaque != "" || u.Host == "" {
+		return "", newError(CodeHostRequired, "url has no host")
+	}
+
+	host, err := normalizeHost(u.Hostname())
+	if err != nil {
+		return "", err
+	}
+
+	port := u.Port()
+	if port != "" {
+		n, err := strconv.Atoi(port)
+		if err != nil || n < 1 || n > 65535 {
+			return "", newError(CodeInvalidPort, "port "+port+" is invalid")
+		}
+		port = strconv.Itoa(n)
+	}
+	if port == defaultPort {
+		port = ""
+	}
+
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	u.Host = host
+
+	normalized := u.String()
+	if len(normalized) > MaxLength {
+		return "", newError(CodeTooLong, "url is longer than "+strconv.Itoa(MaxLength)+" bytes")
+	}
+	return normalized, nil
+}
+
+// normalizeHost lower-cases the host and converts its internationalized labels to punycode.
+func normalizeHost(host string) (string, error) {
+	if host == "" {
+		return "", newError(CodeHostRequired, "url has no host")
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return strings.ToLower(host), nil
+	}
+
+	host = strings.ToLower(norm.NFC.String(host))
+	labels := strings.Split(strings.TrimSuffix(host, "."), ".")
+	for i, label := range labels {
+		if label == "" {
+			return "", newError(CodeInvalidHost, "host "+host+" has an empty label")
+		}
+		if !isASCII(label) {
+			encoded, err := punycodeEncode(label)
+			if err != nil {
+				return "", newError(CodeInvalidHost, "host "+host+" cannot be converted to punycode")
+			}
+			label = "xn--" + encoded
+		}
+		if len(label) > 63 {
+			return "", newError(CodeInvalidHost, "host "+host+" has a label longer than 63 characters")
+		}
+		for _, c := range label {
+			if c != '-' && c != '_' && (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+				return "", newError(CodeInvalidHost, "host "+host+" contains invalid characters")
+			}
+		}
+		labels[i] = label
+	}
+	return strings.Join(labels, "."), nil
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,82 @@
+package urlnorm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected string
+	}{
+		{name: "unchanged", raw: "https://example.com/path?q=1#frag", expected: "https://example.com/path?q=1#frag"},
+		{name: "surrounding whitespace", raw: "  https://example.com/a\n", expected: "https://example.com/a"},
+		{name: "upper-case scheme and host", raw: "HTTPS://WWW.Example.COM/Path", expected: "https://www.example.com/Path"},
+		{name: "default http port", raw: "http://example.com:80/a", expected: "http://example.com/a"},
+		{name: "default https port", raw: "https://example.com:443", expected: "https://example.com"},
+		{name: "other port", raw: "https://example.com:8443/", expected: "https://example.com:8443/"},
+		{name: "idn host", raw: "https://bücher.example/katalog", expected: "https://xn--bcher-kva.example/katalog"},
+		{name: "idn upper case", raw: "http://MÜNCHEN.de", expected: "http://xn--mnchen-3ya.de"},
+		{name: "cyrillic host", raw: "http://пример.рф", expected: "http://xn--e1afmkfd.xn--p1ai"},
+		{name: "ipv6 host", raw: "http://[2001:DB8::1]:80/", expected: "http://[2001:db8::1]/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			normalized, err := Normalize(tt.raw)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, normalized)
+		})
+	}
+}
+
+func TestNormalizeRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		raw  string
+		code string
+	}{
+		{name: "empty", raw: " \n", code: CodeEmpty},
+		{name: "javascript", raw: "javascript:alert(1)", code: CodeSchemeNotAllowed},
+		{name: "data", raw: "data:text/html,<script>", code: CodeSchemeNotAllowed},
+		{name: "relative", raw: "example.com/path", code: CodeSchemeNotAllowed},
+		{name: "inner newline", raw: "https://example.com/a\nb", code: CodeInvalidCharacters},
+		{name: "inner space", raw: "https://example.com/a b", code: CodeInvalidCharacters},
+		{name: "no host", raw: "https:///path", code: CodeHostRequired},
+		{name: "opaque", raw: "http:example.com", code: CodeHostRequired},
+		{name: "bad port", raw: "https://example.com:99999/", code: CodeInvalidPort},
+		{name: "empty label", raw: "https://example..com/", code: CodeInvalidHost},
+		{name: "invalid host characters", raw: "https://exa$mple.com/", code: CodeInvalidHost},
+		{name: "too long", raw: "https://example.com/" + strings.Repeat("a", MaxLength), code: CodeTooLong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Normalize(tt.raw)
+			var urlErr *Error
+			require.True(t, errors.As(err, &urlErr), "Expected *Error, got %v", err)
+			assert.Equal(t, tt.code, urlErr.Code)
+		})
+	}
+}
+
+func TestPunycodeEncode(t *testing.T) {
+	// Samples from RFC 3492, section 7.1.
+	tests := map[string]string{
+		"他们为什么不说中文":         "ihqwcrb4cv8a8dqg056pqjye",
+		"ليهمابتكلموشعربي؟": "egbpdaj6bu4bxfgehfvwxn",
+		"3年B組金八先生":          "3B-ww4c5e180e575a65lsy2b",
+		"bücher":            "bcher-kva",
+	}
+	for label, expected := range tests {
+		encoded, err := punycodeEncode(label)
+		require.NoError(t, err)
+		assert.Equal(t, expected, encoded, label)
+	}
+}
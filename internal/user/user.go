@@ -4,6 +4,7 @@ package user
 import (
 	"fmt"
 	"net/http"
+	"shortener/internal/domain/models"
 	"time"
 
 	"github.com/gorilla/securecookie"
@@ -15,6 +16,7 @@ type UserURL struct {
 	ShortURL    string `json:"short_url" db:"short_url"`
 	OriginalURL string `json:"original_url" db:"original_url"`
 	DeletedFlag bool   `db:"is_deleted"`
+	models.LinkMetadata
 }
 
 // user implements the service for handling user URLs, including cookie management and URL storage.
@@ -33,7 +35,9 @@ type UserService interface {
 	// GetUserURLs returns all URLs associated with the user.
 	GetUserURLs(userID string) ([]UserURL, bool)
 	// AddURLs adds URLs for the user.
-	AddURLs(baseURL, userID, shortURL, originalURL string)
+	AddURLs(baseURL, userID, shortURL, originalURL string, meta models.LinkMetadata)
+	// SetURLMetadata replaces the title, notes and tags of the user's URL.
+	SetURLMetadata(baseURL, userID, shortURL string, meta models.LinkMetadata)
 	// InitUserURLs initializes the URL structure for the user.
 	InitUserURLs(userID string)
 }
@@ -98,13 +102,23 @@ func (u *user) GetUserURLs(userID string) ([]UserURL, bool) {
 const estimatedSize = 100
 
 // AddURLs adds a new URL to the user's URL storage.
-func (u *user) AddURLs(baseURL, userID, shortURL, originalURL string) {
+func (u *user) AddURLs(baseURL, userID, shortURL, originalURL string, meta models.LinkMetadata) {
 	if _, exists := u.urls[userID]; !exists { // memory optimisation
 		u.urls[userID] = make([]UserURL, 0, estimatedSize)
 	}
 
 	short := baseURL + "/" + shortURL
-	u.urls[userID] = append(u.urls[userID], UserURL{ShortURL: short, OriginalURL: originalURL})
+	u.urls[userID] = append(u.urls[userID], UserURL{ShortURL: short, OriginalURL: originalURL, LinkMetadata: meta})
+}
+
+// SetURLMetadata replaces the title, notes and tags of the user's URL.
+func (u *user) SetURLMetadata(baseURL, userID, shortURL string, meta models.LinkMetadata) {
+	short := baseURL + "/" + shortURL
+	for i := range u.urls[userID] {
+		if u.urls[userID][i].ShortURL == short {
+			u.urls[userID][i].LinkMetadata = meta
+		}
+	}
 }
 
 // InitUserURLs initializes the URL storage for a user.
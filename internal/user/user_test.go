@@ -6,6 +6,8 @@ import (
 	"strconv"
 	"testing"
 
+	"shortener/internal/domain/models"
+
 	"github.com/stretchr/testify/assert"
 )
 
@@ -50,7 +52,7 @@ func TestGetUserURLs(t *testing.T) {
 	assert.False(t, exist)
 	assert.Nil(t, urls)
 
-	service.AddURLs("http://base.com", userID, "short", "http://original.com")
+	service.AddURLs("http://base.com", userID, "short", "http://original.com", models.LinkMetadata{})
 	urls, exist = service.GetUserURLs(userID)
 	assert.True(t, exist)
 	assert.Len(t, urls, 1)
@@ -64,7 +66,7 @@ func TestAddURLs(t *testing.T) {
 	urlCount := 5
 
 	for i := 0; i < urlCount; i++ {
-		service.AddURLs("http://base.com", userID, "short"+strconv.Itoa(i), "http://original"+strconv.Itoa(i)+".com")
+		service.AddURLs("http://base.com", userID, "short"+strconv.Itoa(i), "http://original"+strconv.Itoa(i)+".com", models.LinkMetadata{})
 	}
 
 	urls, exist := service.GetUserURLs(userID)
@@ -72,6 +74,20 @@ func TestAddURLs(t *testing.T) {
 	assert.Len(t, urls, urlCount)
 }
 
+func TestSetURLMetadata(t *testing.T) {
+	service := NewUserService()
+	userID := "user123"
+	service.AddURLs("http://base.com", userID, "short", "http://original.com", models.LinkMetadata{Title: "Old"})
+	service.AddURLs("http://base.com", userID, "other", "http://other.com", models.LinkMetadata{})
+
+	meta := models.LinkMetadata{Title: "New", Notes: "print run", Tags: []string{"spring"}}
+	service.SetURLMetadata("http://base.com", userID, "short", meta)
+
+	urls, _ := service.GetUserURLs(userID)
+	assert.Equal(t, meta, urls[0].LinkMetadata)
+	assert.Equal(t, models.LinkMetadata{}, urls[1].LinkMetadata)
+}
+
 func TestInitUserURLs(t *testing.T) {
 	service := NewUserService()
 	userID := "user123"
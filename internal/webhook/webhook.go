@@ -0,0 +1,228 @@
+// Package webhook delivers link lifecycle events from the outbox of the storage to the webhooks of the users.
+//
+// Every delivery is a POST request with the JSON-encoded models.WebhookEvent as the body and the headers:
+//   - X-Webhook-Event: type of the event;
+//   - X-Webhook-Delivery: identifier of the delivery, the same for all its attempts;
+//   - X-Webhook-Signature: "t=<unix time>,v1=<hex HMAC-SHA256 of "<unix time>.<body>" keyed with the webhook secret>".
+//
+// Webhooks are only delivered to public addresses: the URL is checked with CheckURL when the webhook
+// is registered and the address is checked again when the worker connects.
+//
+// A 2xx response completes the delivery. Otherwise the delivery is retried with exponential backoff
+// and dead-lettered after MaxAttempts attempts.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/netip"
+	"shortener/internal/domain/models"
+	"shortener/internal/repository"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Headers of the delivery requests.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Defaults of the worker.
+const (
+	// MaxAttempts - number of failed attempts after which a delivery is dead-lettered.
+	MaxAttempts = 8
+	// BaseDelay - delay before the second attempt; every next delay is twice as long.
+	BaseDelay = 30 * time.Second
+	// MaxDelay - longest delay between attempts.
+	MaxDelay = time.Hour
+	// PollInterval - how often the worker looks for due deliveries.
+	PollInterval = time.Second
+	// BatchSize - maximum number of deliveries claimed at once.
+	BatchSize = 50
+	// Timeout - time limit of a delivery request.
+	Timeout = 10 * time.Second
+	// Lease - time for which claimed deliveries are hidden from other workers; it covers a whole batch,
+	// so only the deliveries of a worker that stopped midway are attempted again.
+	Lease = BatchSize * Timeout
+)
+
+// maxResponseBody - number of bytes of the response read to reuse the connection.
+const maxResponseBody = 4 << 10
+
+// Store - storage of the webhooks and the outbox of their deliveries.
+type Store interface {
+	GetWebhook(id string) (models.Webhook, error)
+	ClaimWebhookDeliveries(now, leaseUntil time.Time, limit int) ([]models.WebhookDelivery, error)
+	RecordWebhookAttempt(id string, attempt models.DeliveryAttempt, status string, next time.Time) error
+}
+
+// Worker delivers the due deliveries of the outbox.
+type Worker struct {
+	store   Store
+	client  *http.Client
+	logger  *zap.SugaredLogger
+	baseURL string
+	// now returns the current time; it is replaced in tests.
+	now func() time.Time
+	// allowAddr reports whether deliveries may connect to the address; it is replaced in tests
+	// delivering to local servers.
+	allowAddr   func(netip.Addr) bool
+	maxAttempts int
+	baseDelay   time.Duration
+}
+
+// NewWorker creates a worker delivering the deliveries of the store. The short URLs of the events
+// are built from baseURL (see models.ShortURL). Deliveries only connect to public addresses (see IsPublicAddr).
+func NewWorker(store Store, baseURL string, logger *zap.SugaredLogger) *Worker {
+	w := &Worker{
+		store:       store,
+		logger:      logger,
+		baseURL:     baseURL,
+		now:         time.Now,
+		allowAddr:   IsPublicAddr,
+		maxAttempts: MaxAttempts,
+		baseDelay:   BaseDelay,
+	}
+	w.client = newClient(func(addr netip.Addr) bool { return w.allowAddr(addr) })
+	return w
+}
+
+// Run delivers the due deliveries every PollInterval until stop is closed.
+func (w *Worker) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			// after a full batch more deliveries may be due
+			for w.DeliverDue() == BatchSize {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+			}
+		}
+	}
+}
+
+// DeliverDue claims the due deliveries, attempts them and records the attempts.
+// Returns the number of attempted deliveries.
+func (w *Worker) DeliverDue() int {
+	now := w.now()
+	deliveries, err := w.store.ClaimWebhookDeliveries(now, now.Add(Lease), BatchSize)
+	if err != nil {
+		w.logger.Errorf("(webhook) claim deliveries: %s", err)
+		return 0
+	}
+
+	for _, d := range deliveries {
+		attempt := w.attempt(d)
+		status, next := w.schedule(d, attempt)
+		if err := w.store.RecordWebhookAttempt(d.ID, attempt, status, next); err != nil {
+			w.logger.Errorf("(webhook) record attempt of delivery %s: %s", d.ID, err)
+		}
+	}
+	return len(deliveries)
+}
+
+// attempt sends the delivery to its webhook.
+func (w *Worker) attempt(d models.WebhookDelivery) models.DeliveryAttempt {
+	attempt := models.DeliveryAttempt{At: w.now().UTC()}
+
+	hook, err := w.store.GetWebhook(d.WebhookID)
+	if err != nil {
+		if errors.Is(err, repository.ErrNotFound) {
+			err = errors.New("webhook is deleted")
+		}
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	event := d.Event
+	if event.Link.ShortURL == "" && event.Link.ShortID != "" {
+		event.Link.ShortURL = models.ShortURL(w.baseURL, event.Link.ShortID)
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, event.Type)
+	req.Header.Set(HeaderDelivery, d.ID)
+	req.Header.Set(HeaderSignature, Signature(hook.Secret, attempt.At, body))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			w.logger.Errorf("(webhook) resp.Body.Close() error: %s", err)
+		}
+	}()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return attempt
+}
+
+// schedule returns the status of the delivery after the attempt and the time of its next attempt.
+func (w *Worker) schedule(d models.WebhookDelivery, attempt models.DeliveryAttempt) (string, time.Time) {
+	if attempt.Error == "" {
+		return models.DeliveryDelivered, attempt.At
+	}
+	failed := len(d.Attempts) + 1
+	if failed >= w.maxAttempts {
+		return models.DeliveryDead, attempt.At
+	}
+	return models.DeliveryPending, attempt.At.Add(Backoff(w.baseDelay, failed))
+}
+
+// Backoff returns the delay after the given number of failed attempts: base, 2*base, 4*base
+// and so on, at most MaxDelay.
+func Backoff(base time.Duration, failed int) time.Duration {
+	delay := base
+	for i := 1; i < failed && delay < MaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, MaxDelay)
+}
+
+// Signature returns the value of the X-Webhook-Signature header of the body sent at the time.
+// Receivers recompute the HMAC with their secret to verify the delivery and may reject old timestamps.
+func Signature(secret string, at time.Time, body []byte) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
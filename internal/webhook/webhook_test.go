@@ -0,0 +1,192 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+
+	"shortener/internal/domain/models"
+	"shortener/internal/storage"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestDeliverDue(t *testing.T) {
+	var received []*http.Request
+	var bodies [][]byte
+	status := http.StatusNoContent
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, r)
+		bodies = append(bodies, body)
+		w.WriteHeader(status)
+	}))
+	defer receiver.Close()
+
+	store := storage.NewStorageMemory()
+	occurred := time.Date(2025, 3, 12, 10, 0, 0, 0, time.UTC)
+	require.NoError(t, store.SaveWebhook(models.Webhook{ID: "hook1", UserID: "user123", URL: receiver.URL, Secret: "s3cret"}))
+	require.NoError(t, store.SaveWebhook(models.Webhook{
+		ID: "hook2", UserID: "user123", URL: receiver.URL, Secret: "other", Events: []string{models.EventLinkDeleted},
+	}))
+	require.NoError(t, store.EnqueueWebhookEvent(models.WebhookEvent{
+		ID: "evt1", Type: models.EventLinkCreated, UserID: "user123", OccurredAt: occurred,
+		Link: models.EventLink{ShortID: "abc", OriginalURL: "http://example.com"},
+	}))
+
+	now := occurred
+	w := NewWorker(store, "http://localhost:8080", zap.NewNop().Sugar())
+	w.now = func() time.Time { return now }
+	// the receiver listens on the loopback address
+	w.allowAddr = func(netip.Addr) bool { return true }
+
+	// a failed attempt is retried after the backoff delay
+	status = http.StatusInternalServerError
+	require.Equal(t, 1, w.DeliverDue(), "Expected only the subscribed webhook to get the event")
+	require.Equal(t, 0, w.DeliverDue(), "Expected the retry to wait for the backoff delay")
+
+	deliveries, err := store.GetWebhookDeliveries("user123", "hook1", 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	d := deliveries[0]
+	assert.Equal(t, models.DeliveryPending, d.Status)
+	require.Len(t, d.Attempts, 1)
+	assert.Equal(t, http.StatusInternalServerError, d.Attempts[0].StatusCode)
+	assert.Equal(t, occurred.Add(BaseDelay), d.NextAttemptAt)
+
+	status = http.StatusNoContent
+	now = occurred.Add(BaseDelay)
+	require.Equal(t, 1, w.DeliverDue())
+
+	deliveries, err = store.GetWebhookDeliveries("user123", "hook1", 10)
+	require.NoError(t, err)
+	assert.Equal(t, models.DeliveryDelivered, deliveries[0].Status)
+	assert.Len(t, deliveries[0].Attempts, 2)
+
+	require.Len(t, received, 2)
+	last := received[1]
+	assert.Equal(t, models.EventLinkCreated, last.Header.Get(HeaderEvent))
+	assert.Equal(t, d.ID, last.Header.Get(HeaderDelivery))
+	assert.Equal(t, Signature("s3cret", now, bodies[1]), last.Header.Get(HeaderSignature))
+
+	var event models.WebhookEvent
+	require.NoError(t, json.Unmarshal(bodies[1], &event))
+	assert.Equal(t, "evt1", event.ID)
+	assert.Equal(t, "http://localhost:8080/abc", event.Link.ShortURL)
+}
+
+func TestDeliverDueDeadLetter(t *testing.T) {
+	store := storage.NewStorageMemory()
+	occurred := time.Date(2025, 3, 12, 10, 0, 0, 0, time.UTC)
+	// nothing listens on the port of a closed server
+	receiver := httptest.NewServer(http.NotFoundHandler())
+	receiver.Close()
+	require.NoError(t, store.SaveWebhook(models.Webhook{ID: "hook1", UserID: "user123", URL: receiver.URL}))
+	require.NoError(t, store.EnqueueWebhookEvent(models.WebhookEvent{
+		ID: "evt1", Type: models.EventLinkDeleted, UserID: "user123", OccurredAt: occurred,
+	}))
+
+	now := occurred
+	w := NewWorker(store, "http://localhost:8080", zap.NewNop().Sugar())
+	w.now = func() time.Time { return now }
+	w.allowAddr = func(netip.Addr) bool { return true }
+	w.maxAttempts = 3
+
+	for i := 0; i < 3; i++ {
+		require.Equal(t, 1, w.DeliverDue())
+		now = now.Add(MaxDelay)
+	}
+	require.Equal(t, 0, w.DeliverDue(), "Expected a dead delivery not to be retried")
+
+	deliveries, err := store.GetWebhookDeliveries("user123", "hook1", 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	assert.Equal(t, models.DeliveryDead, deliveries[0].Status)
+	require.Len(t, deliveries[0].Attempts, 3)
+	assert.NotEmpty(t, deliveries[0].Attempts[2].Error)
+}
+
+func TestDeliverDueForbiddenAddress(t *testing.T) {
+	received := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received++
+	}))
+	defer receiver.Close()
+
+	store := storage.NewStorageMemory()
+	require.NoError(t, store.SaveWebhook(models.Webhook{ID: "hook1", UserID: "user123", URL: receiver.URL}))
+	require.NoError(t, store.EnqueueWebhookEvent(models.WebhookEvent{
+		ID: "evt1", Type: models.EventLinkDeleted, UserID: "user123", OccurredAt: time.Now(),
+	}))
+
+	w := NewWorker(store, "http://localhost:8080", zap.NewNop().Sugar())
+	require.Equal(t, 1, w.DeliverDue())
+	assert.Zero(t, received, "Expected no request to the loopback address")
+
+	deliveries, err := store.GetWebhookDeliveries("user123", "hook1", 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Len(t, deliveries[0].Attempts, 1)
+	assert.Contains(t, deliveries[0].Attempts[0].Error, ErrForbiddenAddress.Error())
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	for _, addr := range []string{"93.184.216.34", "2606:2800:220:1:248:1893:25c8:1946", "203.0.113.10"} {
+		assert.True(t, IsPublicAddr(netip.MustParseAddr(addr)), addr)
+	}
+	for _, addr := range []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1", "0.0.0.0",
+		"255.255.255.255", "224.0.0.1", "::1", "::", "fe80::1", "fd00::1", "::ffff:127.0.0.1",
+		"::ffff:169.254.169.254", "64:ff9b::a9fe:a9fe", "2002:7f00:1::",
+	} {
+		assert.False(t, IsPublicAddr(netip.MustParseAddr(addr)), addr)
+	}
+}
+
+// staticResolver resolves every host to the same addresses.
+type staticResolver []netip.Addr
+
+func (r staticResolver) LookupNetIP(context.Context, string, string) ([]netip.Addr, error) {
+	if len(r) == 0 {
+		return nil, errors.New("no such host")
+	}
+	return r, nil
+}
+
+func TestCheckURL(t *testing.T) {
+	public := staticResolver{netip.MustParseAddr("93.184.216.34")}
+
+	assert.NoError(t, CheckURL(context.Background(), public, "https://hooks.example/in"))
+	assert.NoError(t, CheckURL(context.Background(), staticResolver{}, "https://93.184.216.34/in"))
+
+	assert.ErrorIs(t, CheckURL(context.Background(), public, "http://169.254.169.254/latest/meta-data"), ErrForbiddenAddress)
+	assert.ErrorIs(t, CheckURL(context.Background(), public, "http://[::1]:8080/"), ErrForbiddenAddress)
+	mixed := staticResolver{netip.MustParseAddr("93.184.216.34"), netip.MustParseAddr("10.0.0.5")}
+	assert.ErrorIs(t, CheckURL(context.Background(), mixed, "https://internal.example/"), ErrForbiddenAddress)
+
+	err := CheckURL(context.Background(), staticResolver{}, "https://unknown.example/")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, ErrForbiddenAddress)
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, 30*time.Second, Backoff(BaseDelay, 1))
+	assert.Equal(t, 60*time.Second, Backoff(BaseDelay, 2))
+	assert.Equal(t, 4*time.Minute, Backoff(BaseDelay, 4))
+	assert.Equal(t, MaxDelay, Backoff(BaseDelay, 20))
+}
+
+func TestSignature(t *testing.T) {
+	at := time.Unix(1741773600, 0)
+	// echo -n '1741773600.{}' | openssl dgst -sha256 -hmac key
+	assert.Equal(t, "t=1741773600,v1=da406efa16d1c2fd7d4398efa7f7791dd88ab97c74d7d41fb4b4c72eefba1612",
+		Signature("key", at, []byte("{}")))
+}